@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	deleteUserName string
+	deleteConfirm  bool
+)
+
+func init() {
+	accountDeleteCmd.Flags().StringVarP(&deleteUserName, "username", "u", "", "username required")
+	accountDeleteCmd.Flags().BoolVar(&deleteConfirm, "yes", false, "do not ask for confirmation")
+	accountDeleteCmd.MarkFlagRequired("username")
+	accountCmd.AddCommand(accountDeleteCmd)
+	rootCmd.AddCommand(accountCmd)
+}
+
+var accountCmd = &cobra.Command{
+	Use:   "account",
+	Short: "manage account",
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+var accountDeleteCmd = &cobra.Command{
+	Use:   "delete",
+	Short: "delete account with every stored item",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(deleteUserName) == 0 {
+			return fmt.Errorf("empty username is not allowed")
+		}
+		if !deleteConfirm {
+			fmt.Printf("Every item of '%s' will be destroyed, this cannot be undone. Type the username to confirm:\n", deleteUserName)
+			answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if strings.TrimSpace(answer) != deleteUserName {
+				return fmt.Errorf("account deletion is cancelled")
+			}
+		}
+		fmt.Println("Enter password:")
+		password, err := term.ReadPassword(0)
+		if err != nil {
+			return err
+		}
+
+		deleteReq := deleteAccountRequest{Password: string(password)}
+		if isEncrypted() {
+			deleteReq.Password, err = authPassword(deriveMasterKey(password, deleteUserName))
+			if err != nil {
+				return err
+			}
+		}
+		err = sendJSON(http.MethodDelete, "/api/account", deleteReq, nil)
+		if err != nil {
+			return err
+		}
+
+		storeTokens(loginResponse{})
+		storeVaultKey(nil, "")
+		err = writeConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Account deleted")
+		return nil
+	},
+}
@@ -7,6 +7,7 @@ import (
 	"mime"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
@@ -31,6 +32,14 @@ var getFileCmd = &cobra.Command{
 	Use:   "file",
 	Short: "get binary data",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if isEncrypted() {
+			item, err := getVaultItem(dataID, binaryItem)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(filepath.Base(item.Title), item.Data, 0600)
+		}
+
 		req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/keeper/file/"+dataID, nil)
 		if err != nil {
 			return err
@@ -80,24 +89,8 @@ var getCredCmd = &cobra.Command{
 	Use:   "cred",
 	Short: "get credentials",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		client := http.Client{}
-		req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/keeper/credentials/"+dataID, nil)
-		if err != nil {
-			return err
-		}
-		setAuthToken(req)
-		resp, err := client.Do(req)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("failed to get credentials with http code: %d", resp.StatusCode)
-		}
-
 		var bodyResp credentialsResponse
-		decoder := json.NewDecoder(resp.Body)
-		err = decoder.Decode(&bodyResp)
+		err := getJSONItem("/api/keeper/credentials/", credentialsItem, &bodyResp)
 		if err != nil {
 			return err
 		}
@@ -118,23 +111,8 @@ var getBankCmd = &cobra.Command{
 	Use:   "bank",
 	Short: "get bank data",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/keeper/bank/"+dataID, nil)
-		if err != nil {
-			return err
-		}
-		setAuthToken(req)
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("failed to get credentials with http code: %d", resp.StatusCode)
-		}
-
 		var bodyResp bankResponse
-		decoder := json.NewDecoder(resp.Body)
-		err = decoder.Decode(&bodyResp)
+		err := getJSONItem("/api/keeper/bank/", bankItem, &bodyResp)
 		if err != nil {
 			return err
 		}
@@ -142,3 +120,32 @@ var getBankCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// getJSONItem decodes item from the plain endpoint or, for client side
+// encrypted accounts, from the vault.
+func getJSONItem(path, itemType string, v any) error {
+	if isEncrypted() {
+		item, err := getVaultItem(dataID, itemType)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(item.Data, v)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, upstreamURL+path+dataID, nil)
+	if err != nil {
+		return err
+	}
+	setAuthToken(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s with http code: %d", itemType, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	return decoder.Decode(v)
+}
@@ -7,7 +7,6 @@ import (
 	"net/http"
 
 	"github.com/spf13/cobra"
-	"github.com/theherk/viper"
 )
 
 func init() {
@@ -15,9 +14,10 @@ func init() {
 }
 
 type itemResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Encrypted bool   `json:"encrypted"`
 }
 
 type listItemsResponse struct {
@@ -28,12 +28,11 @@ var listCmd = &cobra.Command{
 	Use:   "list",
 	Short: "list user items",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		token := viper.GetString("token")
 		req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/keeper", nil)
 		if err != nil {
 			return err
 		}
-		req.Header.Set("authorization", fmt.Sprintf("bearer %s", token))
+		setAuthToken(req)
 
 		resp, err := httpClient.Do(req)
 		if err != nil {
@@ -51,9 +50,23 @@ var listCmd = &cobra.Command{
 			return err
 		}
 
+		var vaultKey []byte
+		if isEncrypted() {
+			vaultKey, err = loadVaultKey()
+			if err != nil {
+				return err
+			}
+		}
+
 		fmt.Println("ID Name Type")
 
 		for _, resp := range listResp.Items {
+			if resp.Encrypted {
+				resp.Name, err = openTitle(vaultKey, resp.Type, resp.Name)
+				if err != nil {
+					return fmt.Errorf("failed to decrypt title of '%s': %w", resp.ID, err)
+				}
+			}
 			fmt.Printf("%s %s %s\n", resp.ID, resp.Name, resp.Type)
 		}
 		return nil
@@ -1,21 +1,27 @@
 package cmd
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
-	"github.com/theherk/viper"
 	"golang.org/x/term"
 )
 
-var loginUserName string
+var (
+	loginUserName  string
+	loginEncrypted bool
+)
 
 func init() {
 	loginCmd.Flags().StringVarP(&loginUserName, "username", "u", "", "username required")
+	loginCmd.Flags().BoolVar(&loginEncrypted, "e2e", false, "account encrypts items on the client side")
 	loginCmd.MarkFlagRequired("username")
 	rootCmd.AddCommand(loginCmd)
 }
@@ -26,7 +32,10 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	AccessToken string `json:"token"`
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    int64  `json:"expires_at"`
+	Challenge    string `json:"challenge"`
 }
 
 var loginCmd = &cobra.Command{
@@ -42,9 +51,19 @@ var loginCmd = &cobra.Command{
 			return err
 		}
 
+		var masterKey []byte
+		loginPassword := string(password)
+		if loginEncrypted {
+			masterKey = deriveMasterKey(password, loginUserName)
+			loginPassword, err = authPassword(masterKey)
+			if err != nil {
+				return err
+			}
+		}
+
 		body, err := json.Marshal(loginRequest{
 			Name:     loginUserName,
-			Password: string(password),
+			Password: loginPassword,
 		})
 		if err != nil {
 			return err
@@ -69,8 +88,28 @@ var loginCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		viper.Set("token", loginResp.AccessToken)
-		err = viper.WriteConfig()
+		if len(loginResp.Challenge) > 0 {
+			loginResp, err = completeChallenge(loginResp.Challenge)
+			if err != nil {
+				return err
+			}
+		}
+		storeTokens(loginResp)
+
+		var wrappedKey []byte
+		if loginEncrypted {
+			wrappedKey, err = fetchVaultKey()
+			if err != nil {
+				return err
+			}
+			// unwrapping checks the password before the key is stored
+			_, err = unwrapVaultKey(masterKey, wrappedKey)
+			if err != nil {
+				return err
+			}
+		}
+		storeVaultKey(wrappedKey, loginUserName)
+		err = writeConfig()
 		if err != nil {
 			return err
 		}
@@ -78,3 +117,73 @@ var loginCmd = &cobra.Command{
 		return nil
 	},
 }
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+// completeChallenge asks for authenticator or recovery code when the account
+// has two factor authentication enabled.
+func completeChallenge(challenge string) (loginResponse, error) {
+	code, err := readCode()
+	if err != nil {
+		return loginResponse{}, err
+	}
+	body, err := json.Marshal(twoFactorLoginRequest{Challenge: challenge, Code: code})
+	if err != nil {
+		return loginResponse{}, err
+	}
+	resp, err := httpClient.Post(upstreamURL+"/api/login/2fa", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return loginResponse{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return loginResponse{}, fmt.Errorf("failed to verify code, http status code:'%d' and body:'%s'", resp.StatusCode, body)
+	}
+	var loginResp loginResponse
+	err = json.NewDecoder(resp.Body).Decode(&loginResp)
+	if err != nil {
+		return loginResponse{}, err
+	}
+	return loginResp, nil
+}
+
+func readCode() (string, error) {
+	fmt.Println("Enter authentication code (or recovery code):")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimSpace(code), nil
+}
+
+type vaultKeyResponse struct {
+	VaultKey []byte `json:"vault_key"`
+}
+
+// fetchVaultKey returns the vault key wrapped by the master key.
+func fetchVaultKey() ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/account/vault-key", nil)
+	if err != nil {
+		return nil, err
+	}
+	setAuthToken(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get vault key with http code: %d", resp.StatusCode)
+	}
+
+	var keyResp vaultKeyResponse
+	err = json.NewDecoder(resp.Body).Decode(&keyResp)
+	if err != nil {
+		return nil, err
+	}
+	return keyResp.VaultKey, nil
+}
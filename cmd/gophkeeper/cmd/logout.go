@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/theherk/viper"
+)
+
+func init() {
+	rootCmd.AddCommand(logoutCmd)
+}
+
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "logout user",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		body, err := json.Marshal(logoutRequest{RefreshToken: viper.GetString("refresh_token")})
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequest(http.MethodPost, upstreamURL+"/api/logout", bytes.NewBuffer(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		setAuthToken(req)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+			return fmt.Errorf("failed to logout with http code: %d", resp.StatusCode)
+		}
+
+		storeTokens(loginResponse{})
+		storeVaultKey(nil, "")
+		err = writeConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Println("User logged out")
+		return nil
+	},
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var passwdUserName string
+
+func init() {
+	passwdCmd.Flags().StringVarP(&passwdUserName, "username", "u", "", "username required")
+	passwdCmd.MarkFlagRequired("username")
+	rootCmd.AddCommand(passwdCmd)
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+	VaultKey    []byte `json:"vault_key,omitempty"`
+}
+
+var passwdCmd = &cobra.Command{
+	Use:   "passwd",
+	Short: "change password of the logged in user",
+	Long: `Change password of the logged in user. Other sessions of the user are logged out.
+Accounts encrypted on the client side keep their vault key, it is wrapped again for the new password.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(passwdUserName) == 0 {
+			return fmt.Errorf("empty username is not allowed")
+		}
+		fmt.Println("Enter current password:")
+		oldPassword, err := term.ReadPassword(0)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Enter new password:")
+		newPassword, err := term.ReadPassword(0)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Repeat new password:")
+		repeated, err := term.ReadPassword(0)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(newPassword, repeated) {
+			return fmt.Errorf("passwords do not match")
+		}
+
+		changeReq := changePasswordRequest{
+			OldPassword: string(oldPassword),
+			NewPassword: string(newPassword),
+		}
+		if isEncrypted() {
+			oldMasterKey := deriveMasterKey(oldPassword, passwdUserName)
+			changeReq.OldPassword, err = authPassword(oldMasterKey)
+			if err != nil {
+				return err
+			}
+			// unwrapping the vault key checks the current password before
+			// anything changes
+			wrappedKey, err := fetchVaultKey()
+			if err != nil {
+				return err
+			}
+			vaultKey, err := unwrapVaultKey(oldMasterKey, wrappedKey)
+			if err != nil {
+				return err
+			}
+			newMasterKey := deriveMasterKey(newPassword, passwdUserName)
+			changeReq.NewPassword, err = authPassword(newMasterKey)
+			if err != nil {
+				return err
+			}
+			changeReq.VaultKey, err = wrapVaultKey(newMasterKey, vaultKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		var tokens loginResponse
+		err = postJSON("/api/account/password", changeReq, &tokens)
+		if err != nil {
+			return err
+		}
+		storeTokens(tokens)
+		if isEncrypted() {
+			storeVaultKey(changeReq.VaultKey, passwdUserName)
+		}
+		err = writeConfig()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Password changed")
+		return nil
+	},
+}
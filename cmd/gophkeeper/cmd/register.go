@@ -11,10 +11,14 @@ import (
 	"golang.org/x/term"
 )
 
-var userName string
+var (
+	userName          string
+	registerEncrypted bool
+)
 
 func init() {
 	registerCmd.Flags().StringVarP(&userName, "username", "u", "", "username required")
+	registerCmd.Flags().BoolVar(&registerEncrypted, "e2e", false, "encrypt items on the client side")
 	registerCmd.MarkFlagRequired("username")
 	rootCmd.AddCommand(registerCmd)
 }
@@ -22,6 +26,7 @@ func init() {
 type registerRequest struct {
 	Name     string `json:"name"`
 	Password string `json:"password"`
+	VaultKey []byte `json:"vault_key,omitempty"`
 }
 
 var registerCmd = &cobra.Command{
@@ -37,10 +42,27 @@ var registerCmd = &cobra.Command{
 			return err
 		}
 
-		body, err := json.Marshal(registerRequest{
+		regReq := registerRequest{
 			Name:     userName,
 			Password: string(password),
-		})
+		}
+		if registerEncrypted {
+			masterKey := deriveMasterKey(password, userName)
+			regReq.Password, err = authPassword(masterKey)
+			if err != nil {
+				return err
+			}
+			vaultKey, err := newVaultKey()
+			if err != nil {
+				return err
+			}
+			regReq.VaultKey, err = wrapVaultKey(masterKey, vaultKey)
+			if err != nil {
+				return err
+			}
+		}
+
+		body, err := json.Marshal(regReq)
 		if err != nil {
 			return err
 		}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -36,11 +39,78 @@ func makeRequest(url string) error {
 	return nil
 }
 
+// refreshMargin renews access token a bit before it expires, so it does not
+// expire in flight.
+const refreshMargin = 30 * time.Second
+
+// personalTokenEnv holds a personal access token for non interactive use,
+// it takes place of the stored session.
+const personalTokenEnv = "GOPHKEEPER_TOKEN"
+
 func setAuthToken(req *http.Request) {
+	if token := os.Getenv(personalTokenEnv); len(token) > 0 {
+		req.Header.Set("authorization", fmt.Sprintf("bearer %s", token))
+		return
+	}
+	if expiresAt := viper.GetInt64("token_expires_at"); expiresAt > 0 &&
+		time.Now().Add(refreshMargin).After(time.Unix(expiresAt, 0)) {
+		err := refreshTokens()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to refresh session: %v\n", err)
+		}
+	}
 	token := viper.GetString("token")
 	req.Header.Set("authorization", fmt.Sprintf("bearer %s", token))
 }
 
+func storeTokens(tokens loginResponse) {
+	viper.Set("token", tokens.AccessToken)
+	viper.Set("refresh_token", tokens.RefreshToken)
+	viper.Set("token_expires_at", tokens.ExpiresAt)
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// refreshTokens exchanges stored refresh token for a new token pair.
+func refreshTokens() error {
+	refreshToken := viper.GetString("refresh_token")
+	if len(refreshToken) == 0 {
+		return fmt.Errorf("no refresh token, login again")
+	}
+	body, err := json.Marshal(refreshRequest{RefreshToken: refreshToken})
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.Post(upstreamURL+"/api/refresh", "application/json", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to refresh token with http code: %d, login again", resp.StatusCode)
+	}
+
+	var tokens loginResponse
+	err = json.NewDecoder(resp.Body).Decode(&tokens)
+	if err != nil {
+		return err
+	}
+	storeTokens(tokens)
+	return writeConfig()
+}
+
+// writeConfig saves the config and restores its 0600 permissions, it holds
+// the session tokens.
+func writeConfig() error {
+	err := viper.WriteConfig()
+	if err != nil {
+		return err
+	}
+	return os.Chmod(viper.ConfigFileUsed(), 0600)
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
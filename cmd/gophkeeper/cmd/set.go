@@ -60,6 +60,14 @@ var setFileCmd = &cobra.Command{
 	Use:   "file",
 	Short: "store binary data",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if isEncrypted() {
+			data, err := os.ReadFile(filePath)
+			if err != nil {
+				return err
+			}
+			return setVaultItem(binaryItem, filepath.Base(filePath), data)
+		}
+
 		pr, pw := io.Pipe()
 		writer := multipart.NewWriter(pw)
 		ct := writer.FormDataContentType()
@@ -123,6 +131,9 @@ var setCredCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if isEncrypted() {
+			return setVaultItem(credentialsItem, credTitle, body)
+		}
 
 		req, err := http.NewRequest(http.MethodPost, upstreamURL+"/api/keeper/credentials", bytes.NewBuffer(body))
 		if err != nil {
@@ -165,6 +176,9 @@ var setBankCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if isEncrypted() {
+			return setVaultItem(bankItem, credTitle, body)
+		}
 
 		req, err := http.NewRequest(http.MethodPost, upstreamURL+"/api/keeper/bank", bytes.NewBuffer(body))
 		if err != nil {
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	tokenName    string
+	tokenScopes  []string
+	tokenItemIDs []string
+	tokenExpires int
+)
+
+func init() {
+	tokenCreateCmd.Flags().StringVarP(&tokenName, "name", "n", "", "token name required")
+	tokenCreateCmd.Flags().StringSliceVarP(&tokenScopes, "scope", "s", nil, "granted scope like read:credentials or write:file, repeat for more")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenItemIDs, "item", nil, "limit the token to item id, repeat for more")
+	tokenCreateCmd.Flags().IntVar(&tokenExpires, "expires", 30, "token lifetime in days")
+	tokenCreateCmd.MarkFlagRequired("name")
+	tokenCreateCmd.MarkFlagRequired("scope")
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+	rootCmd.AddCommand(tokenCmd)
+}
+
+var tokenCmd = &cobra.Command{
+	Use:   "token",
+	Short: "manage personal access tokens",
+	Long: `Manage personal access tokens for automation. Put a token into the ` + personalTokenEnv + `
+environment variable to use it instead of the logged in session.`,
+}
+
+type createTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ItemIDs   []string `json:"item_ids,omitempty"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+type tokenResponse struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ItemIDs   []string `json:"item_ids"`
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at"`
+	Token     string   `json:"token"`
+}
+
+type listTokensResponse struct {
+	Tokens []tokenResponse `json:"tokens"`
+}
+
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "create personal access token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var created tokenResponse
+		err := postJSON("/api/account/tokens", createTokenRequest{
+			Name:      tokenName,
+			Scopes:    tokenScopes,
+			ItemIDs:   tokenItemIDs,
+			ExpiresIn: tokenExpires,
+		}, &created)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Token '%s' (id %s) expires at %s, it is shown only once:\n",
+			created.Name, created.ID, time.Unix(created.ExpiresAt, 0).Format(time.DateTime))
+		fmt.Println(created.Token)
+		return nil
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "list personal access tokens",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var list listTokensResponse
+		err := sendJSON(http.MethodGet, "/api/account/tokens", nil, &list)
+		if err != nil {
+			return err
+		}
+		for _, token := range list.Tokens {
+			items := "all items"
+			if len(token.ItemIDs) > 0 {
+				items = strings.Join(token.ItemIDs, ",")
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\texpires %s\n", token.ID, token.Name, strings.Join(token.Scopes, ","), items,
+				time.Unix(token.ExpiresAt, 0).Format(time.DateTime))
+		}
+		return nil
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "revoke personal access token",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := sendJSON(http.MethodDelete, "/api/account/tokens/"+args[0], nil, nil)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Token revoked")
+		return nil
+	},
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/theherk/viper"
+)
+
+// Connection settings come from flags or, when a flag is not given, from the
+// same keys in the config file.
+var (
+	serverURL      string
+	caFile         string
+	pinnedKeys     []string
+	clientCertFile string
+	clientKeyFile  string
+)
+
+func init() {
+	flags := rootCmd.PersistentFlags()
+	flags.StringVar(&serverURL, "server", upstreamURL, "server URL, use https:// for TLS (config key server)")
+	flags.StringVar(&caFile, "ca-file", "", "PEM bundle of CAs trusted for the server certificate (config key ca_file)")
+	flags.StringSliceVar(&pinnedKeys, "pin-sha256", nil, "base64 SHA-256 of a pinned server or CA public key (config key pin_sha256)")
+	flags.StringVar(&clientCertFile, "cert", "", "client certificate for servers requiring one (config key client_cert)")
+	flags.StringVar(&clientKeyFile, "key", "", "client certificate key (config key client_key)")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		return configureTransport(cmd)
+	}
+}
+
+func setting(cmd *cobra.Command, flag string, value string, key string) string {
+	if cmd.Flags().Changed(flag) {
+		return value
+	}
+	if configured := viper.GetString(key); len(configured) > 0 {
+		return configured
+	}
+	return value
+}
+
+// configureTransport points httpClient at the server and sets up TLS.
+func configureTransport(cmd *cobra.Command) error {
+	upstreamURL = strings.TrimRight(setting(cmd, "server", serverURL, "server"), "/")
+	pins := pinnedKeys
+	if !cmd.Flags().Changed("pin-sha256") && viper.IsSet("pin_sha256") {
+		pins = viper.GetStringSlice("pin_sha256")
+	}
+	if len(pins) > 0 && !strings.HasPrefix(upstreamURL, "https://") {
+		return fmt.Errorf("public key pinning needs https server URL")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if path := setting(cmd, "ca-file", caFile, "ca_file"); len(path) > 0 {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in '%s'", path)
+		}
+		config.RootCAs = pool
+	}
+	if len(pins) > 0 {
+		verify, err := verifyPinnedKeys(pins)
+		if err != nil {
+			return err
+		}
+		config.VerifyConnection = verify
+	}
+	certFile := setting(cmd, "cert", clientCertFile, "client_cert")
+	keyFile := setting(cmd, "key", clientKeyFile, "client_key")
+	if len(certFile) > 0 || len(keyFile) > 0 {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	httpClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: config,
+	}
+	return nil
+}
+
+// verifyPinnedKeys accepts connection when a certificate of the verified
+// chain has one of the pinned public keys. Pins are base64 SHA-256 of the
+// DER encoded SubjectPublicKeyInfo, optionally prefixed with "sha256//".
+func verifyPinnedKeys(pins []string) (func(tls.ConnectionState) error, error) {
+	var hashes [][]byte
+	for _, pin := range pins {
+		hash, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(pin), "sha256//"))
+		if err != nil || len(hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid public key pin '%s'", pin)
+		}
+		hashes = append(hashes, hash)
+	}
+	return func(state tls.ConnectionState) error {
+		for _, chain := range state.VerifiedChains {
+			for _, cert := range chain {
+				sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+				for _, hash := range hashes {
+					if subtle.ConstantTimeCompare(sum[:], hash) == 1 {
+						return nil
+					}
+				}
+			}
+		}
+		return fmt.Errorf("server public key does not match pinned keys")
+	}, nil
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	twoFactorCmd.AddCommand(twoFactorEnableCmd)
+	rootCmd.AddCommand(twoFactorCmd)
+}
+
+var twoFactorCmd = &cobra.Command{
+	Use:   "2fa",
+	Short: "manage two factor authentication",
+}
+
+type enrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type confirmRequest struct {
+	Code string `json:"code"`
+}
+
+type confirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+var twoFactorEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "enable TOTP two factor authentication",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var enrollment enrollResponse
+		err := postJSON("/api/account/2fa/enroll", nil, &enrollment)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Add the account to your authenticator app")
+		fmt.Println("Secret:", enrollment.Secret)
+		fmt.Println("URI:", enrollment.URI)
+
+		code, err := readCode()
+		if err != nil {
+			return err
+		}
+		var confirm confirmResponse
+		err = postJSON("/api/account/2fa/confirm", confirmRequest{Code: code}, &confirm)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Two factor authentication enabled. Keep recovery codes in a safe place, each works once:")
+		for _, code := range confirm.RecoveryCodes {
+			fmt.Println(code)
+		}
+		return nil
+	},
+}
+
+// postJSON sends authorized request and decodes response into out.
+func postJSON(path string, in, out any) error {
+	return sendJSON(http.MethodPost, path, in, out)
+}
+
+func sendJSON(method, path string, in, out any) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, upstreamURL+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuthToken(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request %s failed, http status code:'%d' and body:'%s'", path, resp.StatusCode, body)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/theherk/viper"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/term"
+)
+
+// Client side encryption. The master password is stretched with Argon2id into
+// the master key, the server only ever sees a password derived from it. Items
+// are encrypted with a random vault key which is stored on the server wrapped
+// by the master key.
+const (
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	vaultKeySize = 32
+)
+
+const (
+	binaryItem      = "binary"
+	credentialsItem = "credentials"
+	bankItem        = "bank"
+)
+
+var errNotEncrypted = errors.New("client side encryption is not enabled, login with --e2e")
+
+// deriveMasterKey stretches master password, the user name salts it so every
+// client derives the same key.
+func deriveMasterKey(password []byte, username string) []byte {
+	salt := sha256.Sum256([]byte("gophkeeper vault:" + username))
+	return argon2.IDKey(password, salt[:16], argonTime, argonMemory, argonThreads, vaultKeySize)
+}
+
+func deriveSubkey(masterKey []byte, purpose string) ([]byte, error) {
+	key := make([]byte, vaultKeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, masterKey, nil, []byte(purpose)), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// authPassword is sent to the server instead of the master password.
+func authPassword(masterKey []byte) (string, error) {
+	key, err := deriveSubkey(masterKey, "gophkeeper auth")
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(key), nil
+}
+
+func wrapVaultKey(masterKey, vaultKey []byte) ([]byte, error) {
+	kek, err := deriveSubkey(masterKey, "gophkeeper wrap")
+	if err != nil {
+		return nil, err
+	}
+	return seal(kek, vaultKey, []byte("vault key"))
+}
+
+func unwrapVaultKey(masterKey, wrapped []byte) ([]byte, error) {
+	kek, err := deriveSubkey(masterKey, "gophkeeper wrap")
+	if err != nil {
+		return nil, err
+	}
+	vaultKey, err := open(kek, wrapped, []byte("vault key"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock vault, wrong password?")
+	}
+	return vaultKey, nil
+}
+
+func newVaultKey() ([]byte, error) {
+	vaultKey := make([]byte, vaultKeySize)
+	if _, err := io.ReadFull(rand.Reader, vaultKey); err != nil {
+		return nil, err
+	}
+	return vaultKey, nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aesgcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aesgcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, ciphertext, aad []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aesgcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	nonce := ciphertext[:aesgcm.NonceSize()]
+	return aesgcm.Open(nil, nonce, ciphertext[aesgcm.NonceSize():], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isEncrypted() bool {
+	return viper.GetBool("encrypted")
+}
+
+// storeVaultKey keeps the vault key only wrapped by the master key, the same
+// way the server has it, so the config file alone does not open the vault.
+// A key stored unwrapped by older clients is dropped.
+func storeVaultKey(wrapped []byte, username string) {
+	viper.Set("encrypted", wrapped != nil)
+	viper.Set("vault_key", "")
+	viper.Set("wrapped_vault_key", base64.StdEncoding.EncodeToString(wrapped))
+	viper.Set("vault_user", username)
+}
+
+// loadVaultKey asks for the master password and unwraps the stored vault key
+// with it.
+func loadVaultKey() ([]byte, error) {
+	if !isEncrypted() {
+		return nil, errNotEncrypted
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(viper.GetString("wrapped_vault_key"))
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) == 0 {
+		return nil, fmt.Errorf("vault key is not stored, login with --e2e again")
+	}
+	fmt.Println("Enter password:")
+	password, err := term.ReadPassword(0)
+	if err != nil {
+		return nil, err
+	}
+	return unwrapVaultKey(deriveMasterKey(password, viper.GetString("vault_user")), wrapped)
+}
+
+type vaultItem struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Title string `json:"title"`
+	Data  []byte `json:"data"`
+}
+
+func sealTitle(vaultKey []byte, itemType, title string) (string, error) {
+	encrypted, err := seal(vaultKey, []byte(title), []byte("title:"+itemType))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+func openTitle(vaultKey []byte, itemType, title string) (string, error) {
+	encrypted, err := base64.StdEncoding.DecodeString(title)
+	if err != nil {
+		return "", err
+	}
+	decrypted, err := open(vaultKey, encrypted, []byte("title:"+itemType))
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
+
+// setVaultItem encrypts item locally and stores it on the server.
+func setVaultItem(itemType, title string, data []byte) error {
+	vaultKey, err := loadVaultKey()
+	if err != nil {
+		return err
+	}
+	encryptedTitle, err := sealTitle(vaultKey, itemType, title)
+	if err != nil {
+		return err
+	}
+	encryptedData, err := seal(vaultKey, data, []byte("data:"+itemType))
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(vaultItem{Type: itemType, Title: encryptedTitle, Data: encryptedData})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, upstreamURL+"/api/keeper/vault", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	setAuthToken(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to store item, http status code:'%d' and body:'%s'", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// getVaultItem loads item of the expected type and decrypts it locally.
+func getVaultItem(id, itemType string) (vaultItem, error) {
+	vaultKey, err := loadVaultKey()
+	if err != nil {
+		return vaultItem{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, upstreamURL+"/api/keeper/vault/"+id, nil)
+	if err != nil {
+		return vaultItem{}, err
+	}
+	setAuthToken(req)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return vaultItem{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return vaultItem{}, fmt.Errorf("failed to get item with http code: %d", resp.StatusCode)
+	}
+
+	var item vaultItem
+	err = json.NewDecoder(resp.Body).Decode(&item)
+	if err != nil {
+		return vaultItem{}, err
+	}
+	if item.Type != itemType {
+		return vaultItem{}, fmt.Errorf("item '%s' has type '%s'", id, item.Type)
+	}
+
+	item.Title, err = openTitle(vaultKey, item.Type, item.Title)
+	if err != nil {
+		return vaultItem{}, err
+	}
+	item.Data, err = open(vaultKey, item.Data, []byte("data:"+item.Type))
+	if err != nil {
+		return vaultItem{}, err
+	}
+	return item, nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/config"
+	repositry "github.com/rutkin/gophkeeper/internal/server/adapter/repository/file"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/postgress"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/service"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+func runCommand(cfg config.Config, name string, args []string) {
+	var err error
+	switch name {
+	case "rotate-keys", "reseal":
+		err = rotateKeys(cfg, args)
+	case "verify":
+		err = verifyAudit(cfg, args)
+	case "migrate":
+		err = migrate(cfg, args)
+	default:
+		err = fmt.Errorf("unknown command '%s'", name)
+	}
+	if err != nil {
+		log.Err(err).Msgf("command '%s' failed", name)
+		os.Exit(1)
+	}
+}
+
+// rotateKeys moves all items under the key of their user and the current
+// envelope version, so it also re-seals items written before they were bound
+// to their owner, and wraps user keys with the current master key. Previous
+// master keys must be configured, so the running server keeps reading old
+// items.
+func rotateKeys(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	checkpointPath := flags.String("checkpoint", "", "checkpoint file, defaults to ./rotation-<key id>-v<envelope version>-user-keys.checkpoint")
+	flags.Parse(args)
+
+	keyProvider, err := initKeyProvider(cfg)
+	if err != nil {
+		return err
+	}
+	userRepository, err := initUserRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer userRepository.Close()
+	userKeyRepository, err := initUserKeyRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer userKeyRepository.Close()
+	keeperRepository, err := initKeeperRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer keeperRepository.Close()
+
+	rotationService, err := service.NewRotationService(userRepository, keeperRepository, keyProvider)
+	if err != nil {
+		return err
+	}
+	rotationService, err = rotationService.WithUserKeys(userKeyRepository, keyProvider)
+	if err != nil {
+		return err
+	}
+	if chunks, ok := keeperRepository.(port.ChunkRepository); ok {
+		rotationService.WithChunks(chunks)
+	}
+	if len(*checkpointPath) == 0 {
+		*checkpointPath = fmt.Sprintf("./rotation-%08x-v%d-user-keys.checkpoint", rotationService.KeyID(), util.EnvelopeVersion)
+	}
+	checkpoint, err := repositry.NewRotationCheckpoint(*checkpointPath)
+	if err != nil {
+		return err
+	}
+	defer checkpoint.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Info().Msgf("rotating items to key %08x, checkpoint '%s'", rotationService.KeyID(), *checkpointPath)
+	stats, err := rotationService.Rotate(ctx, checkpoint)
+	log.Info().Msgf("rotation finished, users: %d items: %d rotated: %d skipped: %d failed: %d",
+		stats.Users, stats.Items, stats.Rotated, stats.Skipped, stats.Failed)
+	if err != nil {
+		return err
+	}
+	if stats.Failed > 0 {
+		return fmt.Errorf("failed to rotate %d items, run the command again to retry", stats.Failed)
+	}
+	return nil
+}
+
+// verifyAudit checks the hash chain of the audit log. It only reads the log,
+// so it can run while the server keeps writing. The master keys must be
+// available to check entry HMACs.
+func verifyAudit(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := flags.String("file", cfg.AuditLogFile, "audit log file")
+	flags.Parse(args)
+
+	auditLog, err := repositry.OpenAuditLog(*path)
+	if err != nil {
+		return err
+	}
+	defer auditLog.Close()
+	keyProvider, err := initKeyProvider(cfg)
+	if err != nil {
+		return err
+	}
+	auditService, err := service.NewAuditService(auditLog, keyProvider)
+	if err != nil {
+		return err
+	}
+
+	last, err := auditService.Verify(context.Background())
+	if err != nil {
+		return err
+	}
+	if last.Seq > 0 && last.KeyID == 0 {
+		log.Warn().Msgf("audit log '%s' has no entries authenticated with the audit key, the chain only shows it is consistent", *path)
+	}
+	log.Info().Msgf("audit log '%s' is intact, entries: %d last hash: %x", *path, last.Seq, last.Hash)
+	return nil
+}
+
+// migrate applies, rolls back or lists Postgres schema migrations:
+// server migrate [-steps n] up|down|status
+func migrate(cfg config.Config, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	flags.Parse(args)
+	action := "status"
+	if flags.NArg() > 0 {
+		action = flags.Arg(0)
+	}
+
+	migrator, err := postgress.NewMigrator(cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	ctx := context.Background()
+	switch action {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("applied %d migrations", applied)
+	case "down":
+		if *steps < 1 {
+			return fmt.Errorf("steps must be positive")
+		}
+		rolled, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			return err
+		}
+		log.Info().Msgf("rolled back %d migrations", rolled)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Applied {
+				state = "applied " + status.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Printf("%04d_%s\t%s\n", status.Version, status.Name, state)
+		}
+	default:
+		return fmt.Errorf("unknown migrate action '%s', use up, down or status", action)
+	}
+	return nil
+}
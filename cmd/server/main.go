@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,10 +13,17 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/adapter/config"
 	httpserver "github.com/rutkin/gophkeeper/internal/server/adapter/http_server"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/keyprovider"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/blob"
 	repositry "github.com/rutkin/gophkeeper/internal/server/adapter/repository/file"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/memory"
 	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/postgress"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/sqlite"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/tlsconfig"
 	"github.com/rutkin/gophkeeper/internal/server/adapter/token"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
 	"github.com/rutkin/gophkeeper/internal/server/core/service"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
 )
 
 func initLogger(cfg config.Config) {
@@ -27,27 +35,350 @@ func initLogger(cfg config.Config) {
 	}
 }
 
+func initKeyProvider(cfg config.Config) (port.KeyProvider, error) {
+	switch cfg.KeyProvider {
+	case config.KeyProviderFile:
+		return keyprovider.NewFile(cfg.MasterKeyFile, cfg.PreviousMasterKeyFiles...), nil
+	case config.KeyProviderEnv:
+		return keyprovider.NewEnv(cfg.MasterKeyEnv, cfg.PreviousMasterKeyEnvs...), nil
+	case config.KeyProviderPKCS11:
+		return keyprovider.NewPKCS11(keyprovider.PKCS11Config{
+			Module:     cfg.PKCS11Module,
+			TokenLabel: cfg.PKCS11Token,
+			Pin:        cfg.PKCS11Pin,
+			KeyLabel:   cfg.PKCS11KeyLabel,
+
+			PreviousKeyLabels: cfg.PKCS11PreviousKeyLabels,
+		}), nil
+	}
+	return nil, fmt.Errorf("unknown key provider '%s'", cfg.KeyProvider)
+}
+
+func initUserRepository(cfg config.Config) (port.UserRepository, error) {
+	switch cfg.UserStorage {
+	case config.UserStoragePostgres:
+		return postgress.NewUserRepo(cfg.DatabaseDSN)
+	case config.UserStorageSQLite:
+		return sqlite.NewUserRepo(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("unknown user storage '%s'", cfg.UserStorage)
+}
+
+// initUserKeyRepository keeps user keys next to the users.
+func initUserKeyRepository(cfg config.Config) (port.UserKeyRepository, error) {
+	switch cfg.UserStorage {
+	case config.UserStoragePostgres:
+		return postgress.NewUserKeyRepo(cfg.DatabaseDSN)
+	case config.UserStorageSQLite:
+		return sqlite.NewUserKeyRepo(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("unknown user storage '%s'", cfg.UserStorage)
+}
+
+func initSessionRepository(cfg config.Config) (port.SessionRepository, error) {
+	switch cfg.SessionStorage {
+	case config.SessionStoragePostgres:
+		return postgress.NewSessionRepo(cfg.DatabaseDSN)
+	case config.SessionStorageMemory:
+		return memory.NewSessionRepo(), nil
+	case config.SessionStorageSQLite:
+		return sqlite.NewSessionRepo(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("unknown session storage '%s'", cfg.SessionStorage)
+}
+
+func initLoginAttemptRepository(cfg config.Config) (port.LoginAttemptRepository, error) {
+	switch cfg.SessionStorage {
+	case config.SessionStoragePostgres:
+		return postgress.NewLoginAttemptRepo(cfg.DatabaseDSN)
+	case config.SessionStorageMemory:
+		return memory.NewLoginAttemptRepo(), nil
+	case config.SessionStorageSQLite:
+		return sqlite.NewLoginAttemptRepo(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("unknown session storage '%s'", cfg.SessionStorage)
+}
+
+func initPersonalTokenRepository(cfg config.Config) (port.PersonalTokenRepository, error) {
+	switch cfg.SessionStorage {
+	case config.SessionStoragePostgres:
+		return postgress.NewPersonalTokenRepo(cfg.DatabaseDSN)
+	case config.SessionStorageMemory:
+		return memory.NewPersonalTokenRepo(), nil
+	case config.SessionStorageSQLite:
+		return sqlite.NewPersonalTokenRepo(cfg.SQLitePath)
+	}
+	return nil, fmt.Errorf("unknown session storage '%s'", cfg.SessionStorage)
+}
+
+func initKeeperRepository(cfg config.Config) (port.KeeperRepository, error) {
+	var primary port.KeeperRepository
+	var err error
+	switch cfg.KeeperStorage {
+	case config.KeeperStorageFile:
+		primary, err = repositry.NewKeeper()
+	case config.KeeperStoragePostgres:
+		primary, err = postgress.NewKeeperRepo(cfg.DatabaseDSN)
+	case config.KeeperStorageSQLite:
+		primary, err = sqlite.NewKeeperRepo(cfg.SQLitePath)
+	default:
+		return nil, fmt.Errorf("unknown keeper storage '%s'", cfg.KeeperStorage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	dropStaleChunks(cfg, primary)
+
+	switch cfg.BlobStorage {
+	case config.BlobStorageNone:
+		return primary, nil
+	case config.BlobStorageS3:
+		store, err := blob.NewS3(blob.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			Region:    cfg.S3Region,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Insecure:  cfg.S3Insecure,
+		})
+		if err != nil {
+			primary.Close()
+			return nil, err
+		}
+		if err := store.CheckBucket(context.Background()); err != nil {
+			primary.Close()
+			return nil, fmt.Errorf("bucket '%s' is not available: %w", cfg.S3Bucket, err)
+		}
+		return blob.NewKeeper(primary, store), nil
+	}
+	primary.Close()
+	return nil, fmt.Errorf("unknown blob storage '%s'", cfg.BlobStorage)
+}
+
+// dropStaleChunks removes chunk rows left by interrupted uploads of
+// repositories that keep files in chunks, failure does not stop the start.
+func dropStaleChunks(cfg config.Config, repo port.KeeperRepository) {
+	chunked, ok := repo.(interface {
+		DropStaleChunks(ctx context.Context, before time.Time) (int64, error)
+	})
+	if !ok {
+		return
+	}
+	before := time.Now().Add(-time.Hour * time.Duration(cfg.StaleChunksAge))
+	dropped, err := chunked.DropStaleChunks(context.Background(), before)
+	if err != nil {
+		log.Err(err).Msg("failed to drop stale item chunks")
+		return
+	}
+	if dropped > 0 {
+		log.Info().Msgf("dropped %d stale item chunks", dropped)
+	}
+}
+
+// initTokenService signs tokens with the configured algorithm. HMAC keys
+// derived from master keys always verify, so switching to an asymmetric
+// algorithm keeps issued tokens valid until they expire.
+func initTokenService(cfg config.Config, keyProvider port.KeyProvider) (*token.TokenService, error) {
+	exp := time.Minute * time.Duration(cfg.AccessTokenExpiration)
+	hmacKeys, err := token.NewHMACKeys(keyProvider)
+	if err != nil {
+		return nil, err
+	}
+	verifyKeys := hmacKeys
+	for _, path := range cfg.TokenVerifyKeyFiles {
+		key, err := token.LoadPublicKeyFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load token verification key '%s': %w", path, err)
+		}
+		verifyKeys = append(verifyKeys, key)
+	}
+
+	if cfg.TokenAlgorithm == config.TokenAlgorithmHS256 {
+		return token.New(exp, hmacKeys[0], verifyKeys...)
+	}
+	if cfg.TokenAlgorithm != config.TokenAlgorithmEdDSA && cfg.TokenAlgorithm != config.TokenAlgorithmRS256 {
+		return nil, fmt.Errorf("unknown token algorithm '%s'", cfg.TokenAlgorithm)
+	}
+	signingKey, err := token.LoadPrivateKeyFile(cfg.TokenSigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load token signing key '%s': %w", cfg.TokenSigningKeyFile, err)
+	}
+	if signingKey.Method.Alg() != string(cfg.TokenAlgorithm) {
+		return nil, fmt.Errorf("token signing key is for '%s', not '%s'", signingKey.Method.Alg(), cfg.TokenAlgorithm)
+	}
+	return token.New(exp, signingKey, verifyKeys...)
+}
+
+// usesPostgres reports whether any storage is in Postgres.
+func usesPostgres(cfg config.Config) bool {
+	return cfg.UserStorage == config.UserStoragePostgres ||
+		cfg.KeeperStorage == config.KeeperStoragePostgres ||
+		cfg.SessionStorage == config.SessionStoragePostgres
+}
+
+// migrateDatabase brings the Postgres schema up to date, replicas starting
+// at once wait for each other on the migration lock. SQLite databases are
+// migrated when they are opened.
+func migrateDatabase(cfg config.Config) error {
+	if !usesPostgres(cfg) {
+		return nil
+	}
+	migrator, err := postgress.NewMigrator(cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+	ctx := context.Background()
+	if !cfg.MigrateOnStart {
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			if !status.Applied {
+				return fmt.Errorf("migration %04d_%s is not applied, run server migrate up", status.Version, status.Name)
+			}
+		}
+		return nil
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		log.Info().Msgf("applied %d migrations, schema version %d", applied, migrator.Latest())
+	}
+	return nil
+}
+
 func initService(cfg config.Config) {
-	userRepository, err := postgress.NewUserRepo(cfg.DatabaseDSN)
+	if err := migrateDatabase(cfg); err != nil {
+		log.Err(err).Msg("failed to migrate database")
+		os.Exit(1)
+	}
+	keyProvider, err := initKeyProvider(cfg)
+	if err != nil {
+		log.Err(err).Msg("failed to create key provider")
+		os.Exit(1)
+	}
+	userRepository, err := initUserRepository(cfg)
 	if err != nil {
 		log.Err(err).Msg("filed to create user repository")
 		os.Exit(1)
 	}
 	defer userRepository.Close()
-	keeperRepository, err := repositry.NewKeeper()
+	userKeyRepository, err := initUserKeyRepository(cfg)
+	if err != nil {
+		log.Err(err).Msg("failed to create user key repository")
+		os.Exit(1)
+	}
+	defer userKeyRepository.Close()
+	keeperRepository, err := initKeeperRepository(cfg)
 	if err != nil {
 		log.Err(err).Msg("filed to create keeper repository")
 		os.Exit(1)
 	}
-	tokenService := token.New(time.Hour * time.Duration(cfg.TokenExpiration))
-	authService := service.NewAuthService(userRepository, tokenService)
-	keeperService := service.NewKeeperService(keeperRepository)
-	handler := httpserver.NewHandler(authService, keeperService, tokenService)
+	defer keeperRepository.Close()
+	auditRepository, err := repositry.NewAuditLog(cfg.AuditLogFile)
+	if err != nil {
+		log.Err(err).Msg("failed to open audit log")
+		os.Exit(1)
+	}
+	defer auditRepository.Close()
+	auditService, err := service.NewAuditService(auditRepository, keyProvider)
+	if err != nil {
+		log.Err(err).Msg("failed to create audit service")
+		os.Exit(1)
+	}
+	tokenService, err := initTokenService(cfg, keyProvider)
+	if err != nil {
+		log.Err(err).Msg("failed to create token service")
+		os.Exit(1)
+	}
+	sessionRepository, err := initSessionRepository(cfg)
+	if err != nil {
+		log.Err(err).Msg("failed to create session repository")
+		os.Exit(1)
+	}
+	defer sessionRepository.Close()
+	loginAttemptRepository, err := initLoginAttemptRepository(cfg)
+	if err != nil {
+		log.Err(err).Msg("failed to create login attempt repository")
+		os.Exit(1)
+	}
+	defer loginAttemptRepository.Close()
+	personalTokenRepository, err := initPersonalTokenRepository(cfg)
+	if err != nil {
+		log.Err(err).Msg("failed to create personal token repository")
+		os.Exit(1)
+	}
+	defer personalTokenRepository.Close()
+	authService, err := service.NewAuthService(userRepository, tokenService, sessionRepository, time.Hour*time.Duration(cfg.TokenExpiration)).
+		WithMaxSession(time.Hour*time.Duration(cfg.SessionMaxLifetime)).
+		WithLockout(loginAttemptRepository, service.LockoutPolicy{
+			MaxUserFailures: cfg.LoginMaxFailures,
+			MaxIPFailures:   cfg.LoginMaxIPFailures,
+			BaseDelay:       cfg.LoginBackoff,
+			MaxDelay:        cfg.LoginMaxBackoff,
+			Lockout:         cfg.LoginLockout,
+		}).
+		WithPasswordHasher(util.NewPasswordHasher(util.Argon2Params{
+			Memory:     cfg.PasswordMemory,
+			Time:       cfg.PasswordTime,
+			Threads:    cfg.PasswordThreads,
+			SaltLength: util.DefaultArgon2Params.SaltLength,
+			KeyLength:  util.DefaultArgon2Params.KeyLength,
+		})).
+		WithKeeperRepository(keeperRepository).
+		WithUserKeys(userKeyRepository).
+		WithPersonalTokens(personalTokenRepository).
+		WithAudit(auditService).
+		WithTwoFactorKeys(keyProvider)
+	if err != nil {
+		log.Err(err).Msg("failed to create auth service")
+		os.Exit(1)
+	}
+	keeperService, err := service.NewKeeperService(keeperRepository, keyProvider)
+	if err == nil {
+		keeperService, err = keeperService.WithUserKeys(userKeyRepository, keyProvider)
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to create keeper service")
+		os.Exit(1)
+	}
+	if chunks, ok := keeperRepository.(port.ChunkRepository); ok {
+		keeperService.WithChunks(chunks)
+	}
+	if cfg.RejectUnboundItems {
+		keeperService.WithBoundOnly()
+	}
+	handler := httpserver.NewHandler(authService, service.NewAuditedKeeper(keeperService, auditService), tokenService, auditService)
+	if len(cfg.TrustedProxies) > 0 {
+		if err := handler.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+			log.Err(err).Msg("failed to set trusted proxies")
+			os.Exit(1)
+		}
+	}
 
 	srv := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.ServerAddress,
 		Handler: handler,
 	}
+	if len(cfg.TLSCertFile) > 0 || len(cfg.TLSKeyFile) > 0 {
+		reloader, err := tlsconfig.New(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile)
+		if err != nil {
+			log.Err(err).Msg("failed to load TLS certificate")
+			os.Exit(1)
+		}
+		srv.TLSConfig = reloader.Config()
+		if reloader.RequiresClientCert() {
+			handler.MapClientCertificates()
+		}
+		go reloadOnHangup(reloader)
+	} else if len(cfg.TLSClientCAFile) > 0 {
+		log.Error().Msg("client certificates need TLS_CERT_FILE and TLS_KEY_FILE")
+		os.Exit(1)
+	}
 	idleConnsClosed := make(chan struct{})
 	sigint := make(chan os.Signal, 1)
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
@@ -58,7 +389,11 @@ func initService(cfg config.Config) {
 		}
 		close(idleConnsClosed)
 	}()
-	err = srv.ListenAndServe()
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
 
 	if err != http.ErrServerClosed {
 		log.Err(err).Msg("failed to start keeper service")
@@ -66,6 +401,20 @@ func initService(cfg config.Config) {
 	}
 }
 
+// reloadOnHangup reads TLS certificates again on SIGHUP, so renewed
+// certificates are served without restart.
+func reloadOnHangup(reloader *tlsconfig.Reloader) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		if err := reloader.Reload(); err != nil {
+			log.Err(err).Msg("failed to reload TLS certificates, serving the previous ones")
+			continue
+		}
+		log.Info().Msg("TLS certificates reloaded")
+	}
+}
+
 func main() {
 	cfg, err := config.New()
 	if err != nil {
@@ -74,6 +423,10 @@ func main() {
 	}
 
 	initLogger(cfg)
+	if len(os.Args) > 1 {
+		runCommand(cfg, os.Args[1], os.Args[2:])
+		return
+	}
 	log.Info().Msg("Starting keeper service")
 	initService(cfg)
 	log.Info().Msg("keeper service stopped")
@@ -1,6 +1,10 @@
 package config
 
-import "github.com/caarlos0/env/v11"
+import (
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
 
 type LogLevel string
 
@@ -9,10 +13,121 @@ const (
 	LogLevelInfo  = LogLevel("INFO")
 )
 
+type KeyProviderType string
+
+const (
+	KeyProviderFile   = KeyProviderType("file")
+	KeyProviderEnv    = KeyProviderType("env")
+	KeyProviderPKCS11 = KeyProviderType("pkcs11")
+)
+
+type TokenAlgorithm string
+
+const (
+	TokenAlgorithmHS256 = TokenAlgorithm("HS256")
+	TokenAlgorithmEdDSA = TokenAlgorithm("EdDSA")
+	TokenAlgorithmRS256 = TokenAlgorithm("RS256")
+)
+
+type SessionStorage string
+
+const (
+	SessionStoragePostgres = SessionStorage("postgres")
+	SessionStorageMemory   = SessionStorage("memory")
+	SessionStorageSQLite   = SessionStorage("sqlite")
+)
+
+type KeeperStorage string
+
+const (
+	KeeperStorageFile     = KeeperStorage("file")
+	KeeperStoragePostgres = KeeperStorage("postgres")
+	KeeperStorageSQLite   = KeeperStorage("sqlite")
+)
+
+type BlobStorage string
+
+const (
+	BlobStorageNone = BlobStorage("")
+	BlobStorageS3   = BlobStorage("s3")
+)
+
+type UserStorage string
+
+const (
+	UserStoragePostgres = UserStorage("postgres")
+	UserStorageSQLite   = UserStorage("sqlite")
+)
+
 type Config struct {
-	LogLevel        LogLevel `env:"LOG_LEVEL" envDefault:"DEBUG"`
-	TokenExpiration int      `env:"TOKEN_EXPIRATION" envDefault:"24"`
-	DatabaseDSN     string   `env:"DATABASE_DSN" envDefault:"host=localhost port=5432 user=myuser password=123 dbname=gophkeeper sslmode=disable"`
+	LogLevel LogLevel `env:"LOG_LEVEL" envDefault:"DEBUG"`
+	// TokenExpiration is refresh token lifetime in hours, access tokens
+	// live AccessTokenExpiration minutes.
+	TokenExpiration       int            `env:"TOKEN_EXPIRATION" envDefault:"24"`
+	AccessTokenExpiration int            `env:"ACCESS_TOKEN_EXPIRATION" envDefault:"15"`
+	DatabaseDSN           string         `env:"DATABASE_DSN" envDefault:"host=localhost port=5432 user=myuser password=123 dbname=gophkeeper sslmode=disable"`
+	SessionStorage        SessionStorage `env:"SESSION_STORAGE" envDefault:"postgres"`
+	UserStorage           UserStorage    `env:"USER_STORAGE" envDefault:"postgres"`
+	KeeperStorage         KeeperStorage  `env:"KEEPER_STORAGE" envDefault:"file"`
+	// SQLitePath is the database of users, items and sessions stored in
+	// SQLite.
+	SQLitePath string `env:"SQLITE_PATH" envDefault:"./gophkeeper.db"`
+	// StaleChunksAge in hours after which chunk rows no item refers to are
+	// dropped on start.
+	StaleChunksAge int `env:"STALE_CHUNKS_AGE" envDefault:"24"`
+	// BlobStorage keeps ciphertext of files in an S3 compatible bucket,
+	// metadata stays in KeeperStorage.
+	BlobStorage BlobStorage `env:"BLOB_STORAGE"`
+	S3Endpoint  string      `env:"S3_ENDPOINT"`
+	S3Bucket    string      `env:"S3_BUCKET" envDefault:"gophkeeper"`
+	S3Region    string      `env:"S3_REGION" envDefault:"us-east-1"`
+	S3AccessKey string      `env:"S3_ACCESS_KEY"`
+	S3SecretKey string      `env:"S3_SECRET_KEY"`
+	S3Insecure  bool        `env:"S3_INSECURE"`
+	// MigrateOnStart applies pending Postgres migrations on start, without
+	// it the server refuses to start on an outdated schema.
+	MigrateOnStart bool            `env:"MIGRATE_ON_START" envDefault:"true"`
+	KeyProvider    KeyProviderType `env:"KEY_PROVIDER" envDefault:"file"`
+	MasterKeyFile  string          `env:"MASTER_KEY_FILE" envDefault:"./master.key"`
+	MasterKeyEnv   string          `env:"MASTER_KEY_ENV" envDefault:"MASTER_KEY"`
+	PKCS11Module   string          `env:"PKCS11_MODULE"`
+	PKCS11Token    string          `env:"PKCS11_TOKEN"`
+	PKCS11Pin      string          `env:"PKCS11_PIN"`
+	PKCS11KeyLabel string          `env:"PKCS11_KEY_LABEL" envDefault:"gophkeeper-master-key"`
+	// Retired master keys stay readable while items are rotated.
+	PreviousMasterKeyFiles  []string `env:"PREVIOUS_MASTER_KEY_FILES" envSeparator:","`
+	PreviousMasterKeyEnvs   []string `env:"PREVIOUS_MASTER_KEY_ENVS" envSeparator:","`
+	PKCS11PreviousKeyLabels []string `env:"PKCS11_PREVIOUS_KEY_LABELS" envSeparator:","`
+	// RejectUnboundItems refuses items sealed before they were bound to
+	// owner, id and type, set it once rotate-keys has resealed them.
+	RejectUnboundItems bool `env:"REJECT_UNBOUND_ITEMS"`
+	// HS256 tokens are signed with a key derived from the master key, EdDSA
+	// and RS256 tokens with the PEM private key from TOKEN_SIGNING_KEY_FILE.
+	TokenAlgorithm      TokenAlgorithm `env:"TOKEN_ALG" envDefault:"HS256"`
+	TokenSigningKeyFile string         `env:"TOKEN_SIGNING_KEY_FILE"`
+	// PEM public keys of retired or upcoming signing keys.
+	TokenVerifyKeyFiles []string `env:"TOKEN_VERIFY_KEY_FILES" envSeparator:","`
+	// SessionMaxLifetime in hours ends a session however often it is
+	// refreshed, a new login is needed then.
+	SessionMaxLifetime int `env:"SESSION_MAX_LIFETIME" envDefault:"720"`
+	// Failed logins are counted per username and per client address.
+	LoginMaxFailures   int           `env:"LOGIN_MAX_FAILURES" envDefault:"5"`
+	LoginMaxIPFailures int           `env:"LOGIN_MAX_IP_FAILURES" envDefault:"20"`
+	LoginBackoff       time.Duration `env:"LOGIN_BACKOFF" envDefault:"1s"`
+	LoginMaxBackoff    time.Duration `env:"LOGIN_MAX_BACKOFF" envDefault:"1m"`
+	LoginLockout       time.Duration `env:"LOGIN_LOCKOUT" envDefault:"15m"`
+	TrustedProxies     []string      `env:"TRUSTED_PROXIES" envSeparator:","`
+	// Argon2id parameters of password hashes, memory is in KiB.
+	PasswordMemory  uint32 `env:"PASSWORD_ARGON2_MEMORY" envDefault:"65536"`
+	PasswordTime    uint32 `env:"PASSWORD_ARGON2_TIME" envDefault:"3"`
+	PasswordThreads uint8  `env:"PASSWORD_ARGON2_THREADS" envDefault:"4"`
+	AuditLogFile    string `env:"AUDIT_LOG_FILE" envDefault:"./audit.log"`
+	ServerAddress   string `env:"SERVER_ADDRESS" envDefault:":8080"`
+	// TLS is served when certificate and key are set, clients present
+	// certificates issued to their user name when client CA is set too.
+	TLSCertFile     string `env:"TLS_CERT_FILE"`
+	TLSKeyFile      string `env:"TLS_KEY_FILE"`
+	TLSClientCAFile string `env:"TLS_CLIENT_CA_FILE"`
 }
 
 func New() (Config, error) {
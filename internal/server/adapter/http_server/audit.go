@@ -0,0 +1,44 @@
+package httpserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+const defaultAuditPage = 100
+
+type auditEventsRequest struct {
+	After uint64 `form:"after"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=1000"`
+}
+
+type auditEventsResponse struct {
+	Events []domain.AuditEvent `json:"events"`
+	// Next is the after value of the next page, empty on the last page.
+	Next uint64 `json:"next,omitempty"`
+}
+
+// ListAuditEvents returns a page of audit events of the authenticated user,
+// ?after=<seq> continues after the given entry, ?limit=<n> sets page size.
+func (h *Handler) ListAuditEvents(ctx *gin.Context) {
+	var req auditEventsRequest
+	if err := ctx.ShouldBindQuery(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultAuditPage
+	}
+
+	payload := getAuthPayload(ctx)
+	events, err := h.audit.ListEvents(ctx, payload.ID, req.After, req.Limit)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	resp := auditEventsResponse{Events: events}
+	if len(events) == req.Limit {
+		resp.Next = events[len(events)-1].Seq
+	}
+	handleSuccess(ctx, resp)
+}
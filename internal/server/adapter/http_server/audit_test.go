@@ -0,0 +1,62 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_ListAuditEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokenService := mock_port.NewMockTokenService(ctrl)
+	tokenService.EXPECT().VerifyToken("token").Return(domain.TokenPayload{ID: "id", Name: "name"}, nil).AnyTimes()
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	audit := mock_port.NewMockAudit(ctrl)
+	events := []domain.AuditEvent{{Seq: 3, Action: domain.AuditGet, Success: true, UserID: "id", ItemID: "item", ItemType: domain.BankType}}
+	audit.EXPECT().ListEvents(gomock.Any(), domain.UserID("id"), uint64(0), defaultAuditPage).Return(events, nil)
+	audit.EXPECT().ListEvents(gomock.Any(), domain.UserID("id"), uint64(2), 1).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, after uint64, limit int) ([]domain.AuditEvent, error) {
+			require.Equal(t, "127.0.0.1", domain.ClientIP(ctx))
+			return events, nil
+		},
+	)
+	handler := NewHandler(authService, mock_port.NewMockKeeper(ctrl), tokenService, audit)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	body, status := listAuditEvents(t, server.URL+"/api/audit")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, events[0].ItemID, body.Events[0].ItemID)
+	require.Zero(t, body.Next)
+
+	body, status = listAuditEvents(t, server.URL+"/api/audit?after=2&limit=1")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, uint64(3), body.Next)
+
+	_, status = listAuditEvents(t, server.URL+"/api/audit?limit=100000")
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func listAuditEvents(t *testing.T, url string) (auditEventsResponse, int) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("authorization", "bearer token")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var body auditEventsResponse
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	}
+	return body, resp.StatusCode
+}
@@ -1,6 +1,8 @@
 package httpserver
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
@@ -8,6 +10,8 @@ import (
 type registerRequest struct {
 	Name     string `json:"name" binding:"required" example:"John Doe"`
 	Password string `json:"password" binding:"required,min=8" example:"12345678"`
+	// VaultKey is set for accounts encrypting items on the client side.
+	VaultKey []byte `json:"vault_key"`
 }
 
 func (h *Handler) Register(ctx *gin.Context) {
@@ -17,9 +21,14 @@ func (h *Handler) Register(ctx *gin.Context) {
 		return
 	}
 
+	if err := h.checkClientCert(ctx, req.Name); err != nil {
+		handleError(ctx, err)
+		return
+	}
 	user := domain.User{
 		Name:     domain.UserName(req.Name),
 		Password: req.Password,
+		VaultKey: req.VaultKey,
 	}
 
 	err := h.authService.Register(ctx, user)
@@ -37,7 +46,11 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	AccessToken string `json:"token" example:"v2.local.Gdh5kiOTyyaQ3_bNykYDeYHO21Jg2..."`
+	AccessToken  string `json:"token" example:"v2.local.Gdh5kiOTyyaQ3_bNykYDeYHO21Jg2..."`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at,omitempty"`
+	// Challenge is returned instead of tokens when second factor is required.
+	Challenge string `json:"challenge,omitempty"`
 }
 
 func (h *Handler) Login(ctx *gin.Context) {
@@ -47,17 +60,203 @@ func (h *Handler) Login(ctx *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(ctx, domain.User{Name: domain.UserName(req.Name), Password: req.Password})
+	if err := h.checkClientCert(ctx, req.Name); err != nil {
+		handleError(ctx, err)
+		return
+	}
+	tokens, err := h.authService.Login(ctx, domain.User{Name: domain.UserName(req.Name), Password: req.Password}, ctx.ClientIP())
 	if err != nil {
 		handleError(ctx, err)
 		return
 	}
 
-	rsp := newAuthResponse(token)
+	rsp := newAuthResponse(tokens)
 
 	handleSuccess(ctx, rsp)
 }
 
-func newAuthResponse(token domain.Token) loginResponse {
-	return loginResponse{string(token)}
+func newAuthResponse(tokens domain.Tokens) loginResponse {
+	if len(tokens.Challenge) > 0 {
+		return loginResponse{Challenge: string(tokens.Challenge)}
+	}
+	return loginResponse{
+		AccessToken:  string(tokens.AccessToken),
+		RefreshToken: string(tokens.RefreshToken),
+		ExpiresAt:    tokens.ExpiresAt.Unix(),
+	}
+}
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+func (h *Handler) LoginTwoFactor(ctx *gin.Context) {
+	var req twoFactorLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	tokens, err := h.authService.LoginTwoFactor(ctx, domain.Token(req.Challenge), req.Code)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, newAuthResponse(tokens))
+}
+
+type enrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (h *Handler) EnrollTwoFactor(ctx *gin.Context) {
+	payload := getAuthPayload(ctx)
+	enrollment, err := h.authService.EnrollTwoFactor(ctx, domain.UserName(payload.Name))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, enrollResponse{Secret: enrollment.Secret, URI: enrollment.URI})
+}
+
+type confirmRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type confirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (h *Handler) ConfirmTwoFactor(ctx *gin.Context) {
+	var req confirmRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	payload := getAuthPayload(ctx)
+	codes, err := h.authService.ConfirmTwoFactor(ctx, domain.UserName(payload.Name), req.Code)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, confirmResponse{RecoveryCodes: codes})
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func (h *Handler) Refresh(ctx *gin.Context) {
+	var req refreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	tokens, err := h.authService.Refresh(ctx, domain.Token(req.RefreshToken))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, newAuthResponse(tokens))
+}
+
+type logoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *Handler) Logout(ctx *gin.Context) {
+	var req logoutRequest
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			validationError(ctx, err)
+			return
+		}
+	}
+
+	err := h.authService.Logout(ctx, getAuthPayload(ctx), domain.Token(req.RefreshToken))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, nil)
+}
+
+type vaultKeyResponse struct {
+	VaultKey []byte `json:"vault_key"`
+}
+
+func (h *Handler) GetVaultKey(ctx *gin.Context) {
+	payload := getAuthPayload(ctx)
+	vaultKey, err := h.authService.GetVaultKey(ctx, domain.UserName(payload.Name))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, vaultKeyResponse{VaultKey: vaultKey})
+}
+
+type changePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=8" example:"12345678" minLength:"8"`
+	// VaultKey is the vault key wrapped for the new password, required for
+	// accounts encrypting items on the client side.
+	VaultKey []byte `json:"vault_key"`
+}
+
+// ChangePassword sets new password and returns a new session, other sessions
+// of the user are revoked.
+func (h *Handler) ChangePassword(ctx *gin.Context) {
+	var req changePasswordRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	payload := getAuthPayload(ctx)
+	tokens, err := h.authService.ChangePassword(ctx, domain.UserName(payload.Name), domain.PasswordChange{
+		OldPassword: req.OldPassword,
+		NewPassword: req.NewPassword,
+		VaultKey:    req.VaultKey,
+	})
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, newAuthResponse(tokens))
+}
+
+type deleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// DeleteAccount removes the user with every stored item.
+func (h *Handler) DeleteAccount(ctx *gin.Context) {
+	var req deleteAccountRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	payload := getAuthPayload(ctx)
+	err := h.authService.DeleteAccount(ctx, domain.UserName(payload.Name), req.Password)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, nil)
+}
+
+type jwksResponse struct {
+	Keys []domain.PublicKey `json:"keys"`
+}
+
+// JWKS publishes token verification keys in the JSON Web Key Set format, so
+// other services can verify tokens on their own.
+func (h *Handler) JWKS(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, jwksResponse{Keys: h.tokenService.PublicKeys()})
 }
@@ -0,0 +1,96 @@
+package httpserver
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_LoginRetryAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().Login(gomock.Any(), domain.User{Name: "name", Password: "password"}, "127.0.0.1").
+		Return(domain.Tokens{}, &domain.RetryError{RetryAfter: 1500 * time.Millisecond})
+	handler := NewHandler(authService, mock_port.NewMockKeeper(ctrl), mock_port.NewMockTokenService(ctrl), mock_port.NewMockAudit(ctrl))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	body, err := json.Marshal(loginRequest{Name: "name", Password: "password"})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/login", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "2", resp.Header.Get("Retry-After"))
+}
+
+func TestHandler_DeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokenService := mock_port.NewMockTokenService(ctrl)
+	tokenService.EXPECT().VerifyToken("token").Return(domain.TokenPayload{ID: "id", Name: "name"}, nil).Times(2)
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
+	authService.EXPECT().DeleteAccount(gomock.Any(), domain.UserName("name"), "wrong").Return(domain.ErrInvalidCredentials)
+	authService.EXPECT().DeleteAccount(gomock.Any(), domain.UserName("name"), "password").Return(nil)
+	handler := NewHandler(authService, mock_port.NewMockKeeper(ctrl), tokenService, mock_port.NewMockAudit(ctrl))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	for password, status := range map[string]int{"wrong": http.StatusUnauthorized, "password": http.StatusOK} {
+		body, err := json.Marshal(deleteAccountRequest{Password: password})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodDelete, server.URL+"/api/account", bytes.NewBuffer(body))
+		require.NoError(t, err)
+		req.Header.Set("authorization", "bearer token")
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, status, resp.StatusCode, password)
+	}
+}
+
+func TestHandler_ClientCertificate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokenService := mock_port.NewMockTokenService(ctrl)
+	tokenService.EXPECT().VerifyToken("token").Return(domain.TokenPayload{ID: "id", Name: "name"}, nil).Times(3)
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(3)
+	authService.EXPECT().GetVaultKey(gomock.Any(), domain.UserName("name")).Return([]byte("key"), nil)
+	handler := NewHandler(authService, mock_port.NewMockKeeper(ctrl), tokenService, mock_port.NewMockAudit(ctrl))
+	handler.MapClientCertificates()
+
+	for _, tt := range []struct {
+		name   string
+		state  *tls.ConnectionState
+		status int
+	}{
+		{name: "without certificate", status: http.StatusForbidden},
+		{name: "other user", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "other"}}}}}, status: http.StatusForbidden},
+		{name: "owner", state: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: "name"}}}}}, status: http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/account/vault-key", nil)
+		req.Header.Set("authorization", "bearer token")
+		req.TLS = tt.state
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		require.Equal(t, tt.status, recorder.Code, tt.name)
+	}
+}
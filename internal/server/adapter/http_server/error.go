@@ -1,7 +1,10 @@
 package httpserver
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
@@ -16,6 +19,16 @@ var errorStatusMap = map[error]int{
 	domain.ErrInvalidAuthorizationType:   http.StatusUnauthorized,
 	domain.ErrBadRequest:                 http.StatusBadRequest,
 	domain.ErrInvalidToken:               http.StatusUnauthorized,
+	domain.ErrEncryptionMode:             http.StatusConflict,
+	domain.ErrDecryptionFailed:           http.StatusUnprocessableEntity,
+	domain.ErrTwoFactorEnabled:           http.StatusConflict,
+	domain.ErrTwoFactorNotEnrolled:       http.StatusConflict,
+	domain.ErrInvalidCode:                http.StatusUnauthorized,
+	domain.ErrTooManyAttempts:            http.StatusTooManyRequests,
+	domain.ErrClientCertificate:          http.StatusForbidden,
+	domain.ErrInsufficientScope:          http.StatusForbidden,
+	domain.ErrInvalidDataID:              http.StatusBadRequest,
+	domain.ErrNotFound:                   http.StatusNotFound,
 }
 
 func validationError(ctx *gin.Context, err error) {
@@ -23,10 +36,25 @@ func validationError(ctx *gin.Context, err error) {
 	ctx.JSON(http.StatusBadRequest, "validation error")
 }
 
+// errorStatus maps err, or the error it wraps, to http status.
+func errorStatus(err error) int {
+	if statusCode, ok := errorStatusMap[err]; ok {
+		return statusCode
+	}
+	for target, statusCode := range errorStatusMap {
+		if errors.Is(err, target) {
+			return statusCode
+		}
+	}
+	return http.StatusInternalServerError
+}
+
 func handleError(ctx *gin.Context, err error) {
-	statusCode, ok := errorStatusMap[err]
-	if !ok {
-		statusCode = http.StatusInternalServerError
+	statusCode := errorStatus(err)
+	var retryErr *domain.RetryError
+	if errors.As(err, &retryErr) {
+		seconds := int64(math.Ceil(retryErr.RetryAfter.Seconds()))
+		ctx.Header("Retry-After", strconv.FormatInt(seconds, 10))
 	}
 
 	log.Err(err).Msg("response error")
@@ -38,10 +66,7 @@ func handleSuccess(ctx *gin.Context, data any) {
 }
 
 func handleAbort(ctx *gin.Context, err error) {
-	statusCode, ok := errorStatusMap[err]
-	if !ok {
-		statusCode = http.StatusInternalServerError
-	}
+	statusCode := errorStatus(err)
 
 	log.Err(err).Msg("abort response")
 	ctx.AbortWithStatusJSON(statusCode, err)
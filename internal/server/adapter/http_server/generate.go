@@ -2,3 +2,4 @@ package httpserver
 
 //go:generate mockgen -source=../../core/port/keeper.go -destination=mock/keeper.go
 //go:generate mockgen -source=../../core/port/auth.go -destination=mock/auth.go
+//go:generate mockgen -source=../../core/port/audit.go -destination=mock/audit.go
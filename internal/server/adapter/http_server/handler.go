@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 	"github.com/rutkin/gophkeeper/internal/server/core/port"
 )
 
@@ -11,36 +12,102 @@ type Handler struct {
 	authService   port.AuthService
 	keeperService port.Keeper
 	tokenService  port.TokenService
+	audit         port.Audit
 	engine        *gin.Engine
+	// certUsers maps client certificates to users by common name.
+	certUsers bool
 }
 
-func NewHandler(authService port.AuthService, keeperService port.Keeper, tokenService port.TokenService) *Handler {
+func NewHandler(authService port.AuthService, keeperService port.Keeper, tokenService port.TokenService, audit port.Audit) *Handler {
 	engine := gin.New()
+	// client address limits login attempts, forwarded headers are only
+	// trusted from proxies set with SetTrustedProxies
+	engine.SetTrustedProxies(nil)
+	// services read client address from the request context
+	engine.ContextWithFallback = true
 
-	handler := &Handler{authService: authService, keeperService: keeperService, tokenService: tokenService, engine: engine}
+	handler := &Handler{authService: authService, keeperService: keeperService, tokenService: tokenService, audit: audit, engine: engine}
 	handler.init()
 
 	return handler
 }
 
+// recoverPanic answers with internal error, panics aborting a response that
+// is already being sent are passed on to the server, which drops the
+// connection.
+func recoverPanic(ctx *gin.Context, err any) {
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	ctx.AbortWithStatus(http.StatusInternalServerError)
+}
+
 func (h *Handler) init() {
-	h.engine.Use(gin.Recovery())
+	h.engine.Use(gin.CustomRecovery(recoverPanic))
 	h.engine.Use(gin.Logger())
+	h.engine.Use(clientIPMiddleware())
 
 	h.engine.POST("api/register", h.Register)
 	h.engine.POST("api/login", h.Login)
+	h.engine.POST("api/login/2fa", h.LoginTwoFactor)
+	h.engine.POST("api/refresh", h.Refresh)
+	h.engine.POST("api/logout", authMiddleware(h.tokenService, h.authService), h.clientCertMiddleware, requireSession, h.Logout)
+	h.engine.GET(".well-known/jwks.json", h.JWKS)
+
+	account := h.engine.Group("api/account", authMiddleware(h.tokenService, h.authService), h.clientCertMiddleware)
+	{
+		// automation on client side encrypted accounts needs the vault key
+		// to decrypt items
+		account.GET("/vault-key", requireAnyItemScope(domain.ScopeReadVault), h.GetVaultKey)
+	}
+
+	session := account.Group("", requireSession)
+	{
+		session.DELETE("", h.DeleteAccount)
+		session.POST("/password", h.ChangePassword)
+		session.POST("/2fa/enroll", h.EnrollTwoFactor)
+		session.POST("/2fa/confirm", h.ConfirmTwoFactor)
+		session.POST("/tokens", h.CreatePersonalToken)
+		session.GET("/tokens", h.ListPersonalTokens)
+		session.DELETE("/tokens/:id", h.RevokePersonalToken)
+	}
+
+	h.engine.GET("api/audit", authMiddleware(h.tokenService, h.authService), h.clientCertMiddleware, requireSession, h.ListAuditEvents)
 
-	keeper := h.engine.Group("api/keeper").Use(authMiddleware(h.tokenService))
+	keeper := h.engine.Group("api/keeper", authMiddleware(h.tokenService, h.authService), h.clientCertMiddleware)
 	{
-		keeper.GET("/", h.ListItems)
-		keeper.POST("/file", h.UploadFile)
-		keeper.GET("/file/:id", h.DownloadFile)
-		keeper.POST("/credentials", h.SetCredentials)
-		keeper.GET("/credentials/:id", h.GetCredentials)
-		keeper.POST("/bank", h.SetBank)
-		keeper.GET("/bank/:id", h.GetBank)
-		keeper.POST("/delete/:id", h.Delete)
+		keeper.GET("/", requireScope(domain.ScopeReadItems), h.ListItems)
+		keeper.POST("/delete/:id", requireScope(domain.ScopeDeleteItems), h.Delete)
 	}
+
+	plain := keeper.Group("", encryptionMiddleware(h.authService, false))
+	{
+		plain.POST("/file", requireScope(domain.ScopeWriteFile), h.UploadFile)
+		plain.GET("/file/:id", requireScope(domain.ScopeReadFile), h.DownloadFile)
+		plain.POST("/credentials", requireScope(domain.ScopeWriteCredentials), h.SetCredentials)
+		plain.GET("/credentials/:id", requireScope(domain.ScopeReadCredentials), h.GetCredentials)
+		plain.POST("/bank", requireScope(domain.ScopeWriteBank), h.SetBank)
+		plain.GET("/bank/:id", requireScope(domain.ScopeReadBank), h.GetBank)
+	}
+
+	vault := keeper.Group("/vault", encryptionMiddleware(h.authService, true))
+	{
+		vault.POST("", requireScope(domain.ScopeWriteVault), h.SetVaultItem)
+		vault.GET("/:id", requireScope(domain.ScopeReadVault), h.GetVaultItem)
+	}
+}
+
+// SetTrustedProxies allows reverse proxies to pass client address in
+// X-Forwarded-For.
+func (h *Handler) SetTrustedProxies(proxies []string) error {
+	return h.engine.SetTrustedProxies(proxies)
+}
+
+// MapClientCertificates requires the common name of the verified client
+// certificate to match the user of the request. The TLS listener has to
+// require client certificates.
+func (h *Handler) MapClientCertificates() {
+	h.certUsers = true
 }
 
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
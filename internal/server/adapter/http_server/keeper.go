@@ -1,11 +1,9 @@
 package httpserver
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -14,9 +12,10 @@ import (
 )
 
 type itemResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
-	Type string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Encrypted bool   `json:"encrypted,omitempty"`
 }
 
 type listItemsResponse struct {
@@ -37,11 +36,13 @@ func (h *Handler) ListItems(ctx *gin.Context) {
 
 	var resp listItemsResponse
 	for _, m := range meta {
-		resp.Items = append(resp.Items, itemResponse{ID: string(m.ID), Name: m.Title, Type: string(m.Type)})
+		resp.Items = append(resp.Items, itemResponse{ID: string(m.ID), Name: m.Title, Type: string(m.Type), Encrypted: m.Encrypted})
 	}
 	ctx.JSON(http.StatusOK, resp)
 }
 
+// UploadFile streams the file part of the request into the keeper, the file
+// is never held in memory whole.
 func (h *Handler) UploadFile(ctx *gin.Context) {
 	reader, err := ctx.Request.MultipartReader()
 	if err != nil {
@@ -54,15 +55,12 @@ func (h *Handler) UploadFile(ctx *gin.Context) {
 		if err == io.EOF {
 			break
 		}
+		if err != nil {
+			log.Err(err).Msg("failed to read multipart part")
+			handleError(ctx, err)
+			return
+		}
 		if part.FormName() == "file" {
-			var buf bytes.Buffer
-			_, err := io.Copy(&buf, part)
-			if err != nil {
-				log.Err(err).Msg("failed to file buffer")
-				handleError(ctx, err)
-				return
-			}
-
 			payload := getAuthPayload(ctx)
 			dataCtx := domain.DataContext{
 				ID:     domain.DataID(uuid.NewString()),
@@ -70,7 +68,7 @@ func (h *Handler) UploadFile(ctx *gin.Context) {
 				Type:   domain.BinaryType,
 				Title:  part.FileName(),
 			}
-			err = h.keeperService.SetBinaryData(ctx, domain.BinaryData{Ctx: dataCtx, Data: buf.Bytes()})
+			err = h.keeperService.SetBinaryStream(ctx, dataCtx, part)
 			if err != nil {
 				log.Err(err).Msg("failed to set binary data")
 				handleError(ctx, err)
@@ -83,21 +81,34 @@ func (h *Handler) UploadFile(ctx *gin.Context) {
 	handleError(ctx, domain.ErrInvalidToken)
 }
 
+// DownloadFile streams the decrypted file. The size is not known up front,
+// so the response is chunked and the connection is dropped when the file
+// fails to decrypt midway, clients then see a broken transfer instead of a
+// shorter file.
 func (h *Handler) DownloadFile(ctx *gin.Context) {
-	dataID := ctx.Param("id")
+	dataID, err := domain.ParseDataID(ctx.Param("id"))
+	if err != nil {
+		validationError(ctx, err)
+		return
+	}
 	payload := getAuthPayload(ctx)
-	data, err := h.keeperService.GetBinaryData(ctx, domain.DataContext{ID: domain.DataID(dataID), UserID: payload.ID})
+	dataCtx, data, err := h.keeperService.GetBinaryStream(ctx, domain.DataContext{ID: dataID, UserID: payload.ID})
 	if err != nil {
 		log.Err(err).Msg("failed to get binary data")
 		handleError(ctx, err)
 		return
 	}
+	defer data.Close()
 	ctx.Header("Content-Description", "File Transfer")
 	ctx.Header("Content-Transfer-Encoding", "binary")
-	ctx.Header("Content-Length", strconv.Itoa(len(data.Data)))
-	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", data.Ctx.Title))
+	ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", dataCtx.Title))
 	ctx.Header("Access-Control-Expose-Headers", "Content-Disposition")
-	ctx.Data(http.StatusOK, "application/octet-stream", data.Data)
+	ctx.Header("Content-Type", "application/octet-stream")
+	ctx.Status(http.StatusOK)
+	if _, err := io.Copy(ctx.Writer, data); err != nil {
+		log.Err(err).Msgf("failed to send file '%s'", dataID)
+		panic(http.ErrAbortHandler)
+	}
 }
 
 type credentialsItem struct {
@@ -142,9 +153,13 @@ func (h *Handler) SetCredentials(ctx *gin.Context) {
 }
 
 func (h *Handler) GetCredentials(ctx *gin.Context) {
-	id := ctx.Param("id")
+	id, err := domain.ParseDataID(ctx.Param("id"))
+	if err != nil {
+		validationError(ctx, err)
+		return
+	}
 	payload := getAuthPayload(ctx)
-	data, err := h.keeperService.GetCredentialsData(ctx, domain.DataContext{ID: domain.DataID(id), UserID: payload.ID})
+	data, err := h.keeperService.GetCredentialsData(ctx, domain.DataContext{ID: id, UserID: payload.ID})
 	if err != nil {
 		log.Err(err).Msg("failed to get credentials")
 		handleError(ctx, err)
@@ -200,9 +215,13 @@ func (h *Handler) SetBank(ctx *gin.Context) {
 }
 
 func (h *Handler) GetBank(ctx *gin.Context) {
-	id := ctx.Param("id")
+	id, err := domain.ParseDataID(ctx.Param("id"))
+	if err != nil {
+		validationError(ctx, err)
+		return
+	}
 	payload := getAuthPayload(ctx)
-	data, err := h.keeperService.GetBankData(ctx, domain.DataContext{ID: domain.DataID(id), UserID: payload.ID})
+	data, err := h.keeperService.GetBankData(ctx, domain.DataContext{ID: id, UserID: payload.ID})
 	if err != nil {
 		log.Err(err).Msg("failed to get bank data")
 		handleError(ctx, err)
@@ -219,9 +238,13 @@ func (h *Handler) GetBank(ctx *gin.Context) {
 }
 
 func (h *Handler) Delete(ctx *gin.Context) {
-	id := ctx.Param("id")
+	id, err := domain.ParseDataID(ctx.Param("id"))
+	if err != nil {
+		validationError(ctx, err)
+		return
+	}
 	payload := getAuthPayload(ctx)
-	err := h.keeperService.Delete(ctx, domain.DataContext{ID: domain.DataID(id), UserID: payload.ID})
+	err = h.keeperService.Delete(ctx, domain.DataContext{ID: id, UserID: payload.ID})
 	if err != nil {
 		log.Err(err).Msg("failed to delete item")
 		handleError(ctx, err)
@@ -229,3 +252,61 @@ func (h *Handler) Delete(ctx *gin.Context) {
 	}
 	handleSuccess(ctx, nil)
 }
+
+// vaultItem is an item encrypted on the client side, both title and data are
+// opaque to the server.
+type vaultItem struct {
+	ID    string `json:"id"`
+	Type  string `json:"type" binding:"required"`
+	Title string `json:"title"`
+	Data  []byte `json:"data" binding:"required"`
+}
+
+func (h *Handler) SetVaultItem(ctx *gin.Context) {
+	var req vaultItem
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+	if !domain.DataType(req.Type).IsValid() {
+		validationError(ctx, domain.ErrBadRequest)
+		return
+	}
+
+	payload := getAuthPayload(ctx)
+	dataCtx := domain.DataContext{
+		ID:        domain.DataID(uuid.NewString()),
+		UserID:    payload.ID,
+		Title:     req.Title,
+		Type:      domain.DataType(req.Type),
+		Encrypted: true,
+	}
+	err := h.keeperService.SetEncryptedData(ctx, domain.EncryptedData{Ctx: dataCtx, Data: req.Data})
+	if err != nil {
+		log.Err(err).Msg("failed to set encrypted data")
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, itemResponse{ID: string(dataCtx.ID), Name: dataCtx.Title, Type: req.Type, Encrypted: true})
+}
+
+func (h *Handler) GetVaultItem(ctx *gin.Context) {
+	id, err := domain.ParseDataID(ctx.Param("id"))
+	if err != nil {
+		validationError(ctx, err)
+		return
+	}
+	payload := getAuthPayload(ctx)
+	data, err := h.keeperService.GetEncryptedData(ctx, domain.DataContext{ID: id, UserID: payload.ID})
+	if err != nil {
+		log.Err(err).Msg("failed to get encrypted data")
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, vaultItem{
+		ID:    string(data.Ctx.ID),
+		Type:  string(data.Ctx.Type),
+		Title: data.Ctx.Title,
+		Data:  data.Data,
+	})
+}
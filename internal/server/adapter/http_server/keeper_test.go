@@ -2,11 +2,15 @@ package httpserver
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"testing/iotest"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/mock/gomock"
@@ -88,9 +92,22 @@ func TestKeeper_SetBank(t *testing.T) {
 						return domain.TokenPayload{}, nil
 					},
 				)
+				f.authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil)
+				f.authService.EXPECT().IsEncrypted(gomock.Any(), gomock.Any()).Return(false, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name: "revoked token set bank request",
+			args: args{
+				bank: bankItem{},
+			},
+			prepare: func(f fields, a args) {
+				f.tokenService.EXPECT().VerifyToken(gomock.Any()).Return(domain.TokenPayload{TokenID: "jti"}, nil)
+				f.authService.EXPECT().IsTokenRevoked(gomock.Any(), domain.TokenPayload{TokenID: "jti"}).Return(true, nil)
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
 		{
 			name: "unauthorized set bank request",
 			args: args{
@@ -112,7 +129,7 @@ func TestKeeper_SetBank(t *testing.T) {
 			tt.fields.authService = mock_port.NewMockAuthService(ctrl)
 			tt.fields.keeperService = mock_port.NewMockKeeper(ctrl)
 			tt.fields.tokenService = mock_port.NewMockTokenService(ctrl)
-			handler := NewHandler(tt.fields.authService, tt.fields.keeperService, tt.fields.tokenService)
+			handler := NewHandler(tt.fields.authService, tt.fields.keeperService, tt.fields.tokenService, mock_port.NewMockAudit(ctrl))
 			tt.prepare(tt.fields, tt.args)
 
 			server := httptest.NewServer(handler)
@@ -161,3 +178,174 @@ func TestHandler_GetBank(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_EncryptionMode(t *testing.T) {
+	tests := []struct {
+		name           string
+		encrypted      bool
+		path           string
+		body           any
+		prepare        func(keeperService *mock_port.MockKeeper)
+		expectedStatus int
+	}{
+		{
+			name:           "plain item for encrypted account",
+			encrypted:      true,
+			path:           "/api/keeper/bank",
+			body:           bankItem{Number: "124"},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:           "encrypted item for plain account",
+			encrypted:      false,
+			path:           "/api/keeper/vault",
+			body:           vaultItem{Type: string(domain.BankType), Data: []byte("ciphertext")},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:      "encrypted item for encrypted account",
+			encrypted: true,
+			path:      "/api/keeper/vault",
+			body:      vaultItem{Type: string(domain.BankType), Title: "title", Data: []byte("ciphertext")},
+			prepare: func(keeperService *mock_port.MockKeeper) {
+				keeperService.EXPECT().SetEncryptedData(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, data domain.EncryptedData) error {
+						require.True(t, data.Ctx.Encrypted)
+						require.Equal(t, []byte("ciphertext"), data.Data)
+						return nil
+					},
+				)
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			keeperService := mock_port.NewMockKeeper(ctrl)
+			tokenService := mock_port.NewMockTokenService(ctrl)
+			// the claim is stale, the mode of the account decides
+			tokenService.EXPECT().VerifyToken(gomock.Any()).Return(domain.TokenPayload{Encrypted: !tt.encrypted}, nil)
+			if tt.prepare != nil {
+				tt.prepare(keeperService)
+			}
+			authService := mock_port.NewMockAuthService(ctrl)
+			authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil)
+			authService.EXPECT().IsEncrypted(gomock.Any(), gomock.Any()).Return(tt.encrypted, nil)
+			handler := NewHandler(authService, keeperService, tokenService, mock_port.NewMockAudit(ctrl))
+
+			server := httptest.NewServer(handler)
+			defer server.Close()
+			body, err := json.Marshal(tt.body)
+			require.NoError(t, err)
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+tt.path, bytes.NewBuffer(body))
+			require.NoError(t, err)
+			req.Header.Set("authorization", "bearer token")
+			req.Header.Set("Content-Type", "application/json")
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestHandler_File(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	keeperService := mock_port.NewMockKeeper(ctrl)
+	tokenService := mock_port.NewMockTokenService(ctrl)
+	tokenService.EXPECT().VerifyToken(gomock.Any()).Return(domain.TokenPayload{ID: "user"}, nil).AnyTimes()
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	authService.EXPECT().IsEncrypted(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	handler := NewHandler(authService, keeperService, tokenService, mock_port.NewMockAudit(ctrl))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	content := bytes.Repeat([]byte("file content"), 10000)
+	keeperService.EXPECT().SetBinaryStream(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+			require.Equal(t, domain.UserID("user"), dataCtx.UserID)
+			require.Equal(t, "file.bin", dataCtx.Title)
+			data, err := io.ReadAll(src)
+			require.NoError(t, err)
+			require.Equal(t, content, data)
+			return nil
+		},
+	)
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "file.bin")
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/keeper/file", &body)
+	require.NoError(t, err)
+	req.Header.Set("authorization", "bearer token")
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	id := domain.DataID("0b8f5ab4-7f5d-4c7e-9d3c-1f2a3b4c5d6e")
+	download := func(file io.Reader) (*http.Response, []byte, error) {
+		keeperService.EXPECT().GetBinaryStream(gomock.Any(), domain.DataContext{ID: id, UserID: "user"}).
+			Return(domain.DataContext{ID: id, UserID: "user", Title: "file.bin"}, io.NopCloser(file), nil)
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/keeper/file/"+string(id), nil)
+		require.NoError(t, err)
+		req.Header.Set("authorization", "bearer token")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		return resp, data, err
+	}
+
+	resp, data, err := download(bytes.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "attachment; filename=file.bin", resp.Header.Get("Content-Disposition"))
+	require.Equal(t, content, data)
+
+	// a file failing to decrypt midway is not taken for a complete one
+	damaged := io.MultiReader(bytes.NewReader(content), iotest.ErrReader(domain.ErrDecryptionFailed))
+	_, _, err = download(damaged)
+	require.Error(t, err)
+}
+
+func TestHandler_InvalidID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	tokenService := mock_port.NewMockTokenService(ctrl)
+	tokenService.EXPECT().VerifyToken(gomock.Any()).Return(domain.TokenPayload{ID: "user"}, nil).AnyTimes()
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().IsTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	authService.EXPECT().IsEncrypted(gomock.Any(), gomock.Any()).Return(false, nil).AnyTimes()
+	// the keeper is never reached
+	handler := NewHandler(authService, mock_port.NewMockKeeper(ctrl), tokenService, mock_port.NewMockAudit(ctrl))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	for _, id := range []string{"..", "%2e%2e", "%2E%2E%5Cother", "id", "0B8F5AB4-7F5D-4C7E-9D3C-1F2A3B4C5D6E", "{0b8f5ab4-7f5d-4c7e-9d3c-1f2a3b4c5d6e}"} {
+		for _, endpoint := range []struct {
+			method string
+			path   string
+		}{
+			{method: http.MethodGet, path: "/api/keeper/file/"},
+			{method: http.MethodGet, path: "/api/keeper/credentials/"},
+			{method: http.MethodGet, path: "/api/keeper/bank/"},
+			{method: http.MethodPost, path: "/api/keeper/delete/"},
+		} {
+			req, err := http.NewRequest(endpoint.method, server.URL+endpoint.path+id, nil)
+			require.NoError(t, err)
+			req.Header.Set("authorization", "bearer token")
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Equal(t, http.StatusBadRequest, resp.StatusCode, endpoint.path+id)
+		}
+	}
+}
@@ -14,7 +14,7 @@ const (
 	authorizationType      = "bearer"
 )
 
-func authMiddleware(ts port.TokenService) gin.HandlerFunc {
+func authMiddleware(ts port.TokenService, as port.AuthService) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
 
@@ -41,6 +41,18 @@ func authMiddleware(ts port.TokenService) gin.HandlerFunc {
 		}
 
 		accessToken := fields[1]
+		if strings.HasPrefix(accessToken, domain.PersonalTokenPrefix) {
+			payload, err := as.VerifyPersonalToken(ctx, domain.Token(accessToken))
+			if err != nil {
+				log.Err(err).Msg("failed to verify personal token")
+				handleAbort(ctx, err)
+				return
+			}
+			setAuthPayload(ctx, payload)
+			ctx.Next()
+			return
+		}
+
 		payload, err := ts.VerifyToken(accessToken)
 		if err != nil {
 			log.Err(err).Msg("failed to verify token")
@@ -48,7 +60,108 @@ func authMiddleware(ts port.TokenService) gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := as.IsTokenRevoked(ctx, payload)
+		if err != nil {
+			log.Err(err).Msg("failed to check token revocation")
+			handleAbort(ctx, err)
+			return
+		}
+		if revoked {
+			handleAbort(ctx, domain.ErrInvalidToken)
+			return
+		}
+
 		setAuthPayload(ctx, payload)
 		ctx.Next()
 	}
 }
+
+// requireScope lets personal tokens through only with scope, on routes
+// with :id the item has to be allowed to the token as well.
+func requireScope(scope domain.Scope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !getAuthPayload(ctx).Allows(scope, domain.DataID(ctx.Param("id"))) {
+			handleAbort(ctx, domain.ErrInsufficientScope)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// requireAnyItemScope checks scope only, for routes serving every item of
+// the token like the vault key.
+func requireAnyItemScope(scope domain.Scope) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !getAuthPayload(ctx).HasScope(scope) {
+			handleAbort(ctx, domain.ErrInsufficientScope)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// requireSession keeps personal tokens away from account management.
+func requireSession(ctx *gin.Context) {
+	if len(getAuthPayload(ctx).PersonalTokenID) > 0 {
+		handleAbort(ctx, domain.ErrInsufficientScope)
+		return
+	}
+	ctx.Next()
+}
+
+// encryptionMiddleware keeps client side encrypted accounts away from plain
+// item routes and the other way around. The mode of session tokens is read
+// from the account, the claim may predate it. Personal tokens get the mode
+// from the account when they are verified.
+func encryptionMiddleware(as port.AuthService, encrypted bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		payload := getAuthPayload(ctx)
+		mode := payload.Encrypted
+		if len(payload.PersonalTokenID) == 0 {
+			var err error
+			mode, err = as.IsEncrypted(ctx, payload)
+			if err != nil {
+				handleAbort(ctx, err)
+				return
+			}
+		}
+		if mode != encrypted {
+			handleAbort(ctx, domain.ErrEncryptionMode)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// clientIPMiddleware passes client address to services through the request
+// context.
+func clientIPMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Request = ctx.Request.WithContext(domain.WithClientIP(ctx.Request.Context(), ctx.ClientIP()))
+		ctx.Next()
+	}
+}
+
+// clientCertMiddleware lets only the owner of the client certificate act as
+// the authenticated user.
+func (h *Handler) clientCertMiddleware(ctx *gin.Context) {
+	if err := h.checkClientCert(ctx, getAuthPayload(ctx).Name); err != nil {
+		handleAbort(ctx, err)
+		return
+	}
+	ctx.Next()
+}
+
+func (h *Handler) checkClientCert(ctx *gin.Context, name string) error {
+	if !h.certUsers {
+		return nil
+	}
+	state := ctx.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return domain.ErrClientCertificate
+	}
+	if state.VerifiedChains[0][0].Subject.CommonName != name {
+		return domain.ErrClientCertificate
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ package mock_port
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -79,6 +80,22 @@ func (mr *MockKeeperMockRecorder) GetBinaryData(ctx, dataCtx interface{}) *gomoc
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBinaryData", reflect.TypeOf((*MockKeeper)(nil).GetBinaryData), ctx, dataCtx)
 }
 
+// GetBinaryStream mocks base method.
+func (m *MockKeeper) GetBinaryStream(ctx context.Context, dataCtx domain.DataContext) (domain.DataContext, io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBinaryStream", ctx, dataCtx)
+	ret0, _ := ret[0].(domain.DataContext)
+	ret1, _ := ret[1].(io.ReadCloser)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetBinaryStream indicates an expected call of GetBinaryStream.
+func (mr *MockKeeperMockRecorder) GetBinaryStream(ctx, dataCtx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBinaryStream", reflect.TypeOf((*MockKeeper)(nil).GetBinaryStream), ctx, dataCtx)
+}
+
 // GetCredentialsData mocks base method.
 func (m *MockKeeper) GetCredentialsData(ctx context.Context, dataCtx domain.DataContext) (domain.CredentialsData, error) {
 	m.ctrl.T.Helper()
@@ -94,6 +111,21 @@ func (mr *MockKeeperMockRecorder) GetCredentialsData(ctx, dataCtx interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCredentialsData", reflect.TypeOf((*MockKeeper)(nil).GetCredentialsData), ctx, dataCtx)
 }
 
+// GetEncryptedData mocks base method.
+func (m *MockKeeper) GetEncryptedData(ctx context.Context, dataCtx domain.DataContext) (domain.EncryptedData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEncryptedData", ctx, dataCtx)
+	ret0, _ := ret[0].(domain.EncryptedData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEncryptedData indicates an expected call of GetEncryptedData.
+func (mr *MockKeeperMockRecorder) GetEncryptedData(ctx, dataCtx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEncryptedData", reflect.TypeOf((*MockKeeper)(nil).GetEncryptedData), ctx, dataCtx)
+}
+
 // GetTextData mocks base method.
 func (m *MockKeeper) GetTextData(ctx context.Context, dataCtx domain.DataContext) (string, error) {
 	m.ctrl.T.Helper()
@@ -152,6 +184,20 @@ func (mr *MockKeeperMockRecorder) SetBinaryData(ctx, data interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBinaryData", reflect.TypeOf((*MockKeeper)(nil).SetBinaryData), ctx, data)
 }
 
+// SetBinaryStream mocks base method.
+func (m *MockKeeper) SetBinaryStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetBinaryStream", ctx, dataCtx, src)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetBinaryStream indicates an expected call of SetBinaryStream.
+func (mr *MockKeeperMockRecorder) SetBinaryStream(ctx, dataCtx, src interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetBinaryStream", reflect.TypeOf((*MockKeeper)(nil).SetBinaryStream), ctx, dataCtx, src)
+}
+
 // SetCredentialsData mocks base method.
 func (m *MockKeeper) SetCredentialsData(ctx context.Context, data domain.CredentialsData) error {
 	m.ctrl.T.Helper()
@@ -166,6 +212,20 @@ func (mr *MockKeeperMockRecorder) SetCredentialsData(ctx, data interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetCredentialsData", reflect.TypeOf((*MockKeeper)(nil).SetCredentialsData), ctx, data)
 }
 
+// SetEncryptedData mocks base method.
+func (m *MockKeeper) SetEncryptedData(ctx context.Context, data domain.EncryptedData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetEncryptedData", ctx, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetEncryptedData indicates an expected call of SetEncryptedData.
+func (mr *MockKeeperMockRecorder) SetEncryptedData(ctx, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetEncryptedData", reflect.TypeOf((*MockKeeper)(nil).SetEncryptedData), ctx, data)
+}
+
 // SetTextData mocks base method.
 func (m *MockKeeper) SetTextData(ctx context.Context, data domain.TextData) error {
 	m.ctrl.T.Helper()
@@ -203,6 +263,18 @@ func (m *MockKeeperRepository) EXPECT() *MockKeeperRepositoryMockRecorder {
 	return m.recorder
 }
 
+// Close mocks base method.
+func (m *MockKeeperRepository) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockKeeperRepositoryMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockKeeperRepository)(nil).Close))
+}
+
 // Delete mocks base method.
 func (m *MockKeeperRepository) Delete(ctx context.Context, dataCtx domain.DataContext) error {
 	m.ctrl.T.Helper()
@@ -217,6 +289,20 @@ func (mr *MockKeeperRepositoryMockRecorder) Delete(ctx, dataCtx interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockKeeperRepository)(nil).Delete), ctx, dataCtx)
 }
 
+// DeleteAll mocks base method.
+func (m *MockKeeperRepository) DeleteAll(ctx context.Context, userID domain.UserID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAll", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAll indicates an expected call of DeleteAll.
+func (mr *MockKeeperRepositoryMockRecorder) DeleteAll(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAll", reflect.TypeOf((*MockKeeperRepository)(nil).DeleteAll), ctx, userID)
+}
+
 // GetAllData mocks base method.
 func (m *MockKeeperRepository) GetAllData(ctx context.Context, userID domain.UserID) ([]domain.DataContext, error) {
 	m.ctrl.T.Helper()
@@ -262,6 +348,49 @@ func (mr *MockKeeperRepositoryMockRecorder) GetMeta(ctx, userID, id interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMeta", reflect.TypeOf((*MockKeeperRepository)(nil).GetMeta), ctx, userID, id)
 }
 
+// GetStream mocks base method.
+func (m *MockKeeperRepository) GetStream(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetStream", ctx, dataCtx)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStream indicates an expected call of GetStream.
+func (mr *MockKeeperRepositoryMockRecorder) GetStream(ctx, dataCtx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStream", reflect.TypeOf((*MockKeeperRepository)(nil).GetStream), ctx, dataCtx)
+}
+
+// ReplaceData mocks base method.
+func (m *MockKeeperRepository) ReplaceData(ctx context.Context, dataCtx domain.DataContext, old, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceData", ctx, dataCtx, old, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceData indicates an expected call of ReplaceData.
+func (mr *MockKeeperRepositoryMockRecorder) ReplaceData(ctx, dataCtx, old, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceData", reflect.TypeOf((*MockKeeperRepository)(nil).ReplaceData), ctx, dataCtx, old, data)
+}
+
+// ReplaceHead mocks base method.
+func (m *MockKeeperRepository) ReplaceHead(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceHead", ctx, dataCtx, old, head)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceHead indicates an expected call of ReplaceHead.
+func (mr *MockKeeperRepositoryMockRecorder) ReplaceHead(ctx, dataCtx, old, head interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceHead", reflect.TypeOf((*MockKeeperRepository)(nil).ReplaceHead), ctx, dataCtx, old, head)
+}
+
 // Set mocks base method.
 func (m *MockKeeperRepository) Set(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
 	m.ctrl.T.Helper()
@@ -275,3 +404,17 @@ func (mr *MockKeeperRepositoryMockRecorder) Set(ctx, dataCtx, data interface{})
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockKeeperRepository)(nil).Set), ctx, dataCtx, data)
 }
+
+// SetStream mocks base method.
+func (m *MockKeeperRepository) SetStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetStream", ctx, dataCtx, src)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetStream indicates an expected call of SetStream.
+func (mr *MockKeeperRepositoryMockRecorder) SetStream(ctx, dataCtx, src interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetStream", reflect.TypeOf((*MockKeeperRepository)(nil).SetStream), ctx, dataCtx, src)
+}
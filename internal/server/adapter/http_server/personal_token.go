@@ -0,0 +1,104 @@
+package httpserver
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type createPersonalTokenRequest struct {
+	Name   string   `json:"name" binding:"required" example:"ci"`
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"read:credentials"`
+	// ItemIDs limits the token to these items.
+	ItemIDs []string `json:"item_ids"`
+	// ExpiresIn is lifetime of the token in days.
+	ExpiresIn int `json:"expires_in" binding:"required,min=1" example:"30"`
+}
+
+type personalTokenResponse struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ItemIDs   []string `json:"item_ids,omitempty"`
+	CreatedAt int64    `json:"created_at"`
+	ExpiresAt int64    `json:"expires_at"`
+	// Token is returned only when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+type listPersonalTokensResponse struct {
+	Tokens []personalTokenResponse `json:"tokens"`
+}
+
+func newPersonalTokenResponse(token domain.PersonalToken) personalTokenResponse {
+	rsp := personalTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		CreatedAt: token.CreatedAt.Unix(),
+		ExpiresAt: token.ExpiresAt.Unix(),
+	}
+	for _, scope := range token.Scopes {
+		rsp.Scopes = append(rsp.Scopes, string(scope))
+	}
+	for _, id := range token.ItemIDs {
+		rsp.ItemIDs = append(rsp.ItemIDs, string(id))
+	}
+	return rsp
+}
+
+// CreatePersonalToken mints a personal access token for automation.
+func (h *Handler) CreatePersonalToken(ctx *gin.Context) {
+	var req createPersonalTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		validationError(ctx, err)
+		return
+	}
+
+	tokenReq := domain.PersonalTokenRequest{
+		Name:      req.Name,
+		ExpiresIn: time.Duration(req.ExpiresIn) * 24 * time.Hour,
+	}
+	for _, scope := range req.Scopes {
+		tokenReq.Scopes = append(tokenReq.Scopes, domain.Scope(scope))
+	}
+	for _, id := range req.ItemIDs {
+		itemID, err := domain.ParseDataID(id)
+		if err != nil {
+			validationError(ctx, err)
+			return
+		}
+		tokenReq.ItemIDs = append(tokenReq.ItemIDs, itemID)
+	}
+
+	token, stored, err := h.authService.CreatePersonalToken(ctx, getAuthPayload(ctx), tokenReq)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	rsp := newPersonalTokenResponse(stored)
+	rsp.Token = string(token)
+	handleSuccess(ctx, rsp)
+}
+
+func (h *Handler) ListPersonalTokens(ctx *gin.Context) {
+	tokens, err := h.authService.ListPersonalTokens(ctx, getAuthPayload(ctx).ID)
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	rsp := listPersonalTokensResponse{Tokens: []personalTokenResponse{}}
+	for _, token := range tokens {
+		rsp.Tokens = append(rsp.Tokens, newPersonalTokenResponse(token))
+	}
+	handleSuccess(ctx, rsp)
+}
+
+func (h *Handler) RevokePersonalToken(ctx *gin.Context) {
+	err := h.authService.RevokePersonalToken(ctx, getAuthPayload(ctx), ctx.Param("id"))
+	if err != nil {
+		handleError(ctx, err)
+		return
+	}
+	handleSuccess(ctx, nil)
+}
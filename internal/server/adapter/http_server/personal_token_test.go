@@ -0,0 +1,97 @@
+package httpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/service"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_PersonalTokenScopes(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	token := "gkp_token"
+	allowed := "8f14e45f-ceea-467f-a0e6-4e5f1c1d5c0b"
+	other := "c9f0f895-fb98-4b91-b0c5-9a0e7a5f4c1d"
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().VerifyPersonalToken(gomock.Any(), domain.Token(token)).Return(domain.TokenPayload{
+		ID:              "id",
+		Name:            "name",
+		PersonalTokenID: "pt",
+		Scopes:          []domain.Scope{domain.ScopeReadCredentials},
+		ItemIDs:         []domain.DataID{domain.DataID(allowed)},
+	}, nil).AnyTimes()
+	keeper := mock_port.NewMockKeeper(ctrl)
+	keeper.EXPECT().GetCredentialsData(gomock.Any(), gomock.Any()).Return(domain.CredentialsData{}, nil)
+	handler := NewHandler(authService, keeper, mock_port.NewMockTokenService(ctrl), mock_port.NewMockAudit(ctrl))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{method: http.MethodGet, path: "/api/keeper/credentials/" + allowed, status: http.StatusOK},
+		{method: http.MethodGet, path: "/api/keeper/credentials/" + other, status: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/keeper/bank/" + allowed, status: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/keeper/credentials", body: "{}", status: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/keeper/", status: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/keeper/delete/" + allowed, status: http.StatusForbidden},
+		{method: http.MethodPost, path: "/api/account/tokens", body: "{}", status: http.StatusForbidden},
+		{method: http.MethodGet, path: "/api/audit", status: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+		require.NoError(t, err)
+		req.Header.Set("authorization", "bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, tt.status, resp.StatusCode, tt.path)
+	}
+}
+
+// A token allowed to read files of an item can not read the item through the
+// file route when the item is not a file.
+func TestHandler_PersonalTokenItemType(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	token := "gkp_token"
+	id := "8f14e45f-ceea-467f-a0e6-4e5f1c1d5c0b"
+	authService := mock_port.NewMockAuthService(ctrl)
+	authService.EXPECT().VerifyPersonalToken(gomock.Any(), domain.Token(token)).Return(domain.TokenPayload{
+		ID:              "id",
+		Name:            "name",
+		PersonalTokenID: "pt",
+		Scopes:          []domain.Scope{domain.ScopeReadFile},
+		ItemIDs:         []domain.DataID{domain.DataID(id)},
+	}, nil).AnyTimes()
+	repo := mock_port.NewMockKeeperRepository(ctrl)
+	repo.EXPECT().GetMeta(gomock.Any(), domain.UserID("id"), domain.DataID(id)).Return(domain.DataContext{
+		ID:     domain.DataID(id),
+		UserID: "id",
+		Type:   domain.CredentialsType,
+	}, nil)
+	keys := mock_port.NewMockKeyProvider(ctrl)
+	keys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	keys.EXPECT().PreviousKeys().Return(nil, nil)
+	keeper, err := service.NewKeeperService(repo, keys)
+	require.NoError(t, err)
+	handler := NewHandler(authService, keeper, mock_port.NewMockTokenService(ctrl), mock_port.NewMockAudit(ctrl))
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/api/keeper/file/"+id, nil)
+	require.NoError(t, err)
+	req.Header.Set("authorization", "bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,34 @@
+package keyprovider
+
+import (
+	"errors"
+	"os"
+)
+
+var ErrEmptyKeyEnv = errors.New("master key environment variable is not set")
+
+// EnvProvider reads base64 encoded master key from environment variable.
+type EnvProvider struct {
+	name     string
+	previous []string
+}
+
+func NewEnv(name string, previous ...string) *EnvProvider {
+	return &EnvProvider{name: name, previous: previous}
+}
+
+func (ep *EnvProvider) MasterKey() ([]byte, error) {
+	return readKeyEnv(ep.name)
+}
+
+func (ep *EnvProvider) PreviousKeys() ([][]byte, error) {
+	return collectKeys(ep.previous, readKeyEnv)
+}
+
+func readKeyEnv(name string) ([]byte, error) {
+	encoded, ok := os.LookupEnv(name)
+	if !ok || len(encoded) == 0 {
+		return nil, ErrEmptyKeyEnv
+	}
+	return decodeKey(encoded)
+}
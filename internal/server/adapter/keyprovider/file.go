@@ -0,0 +1,43 @@
+package keyprovider
+
+import (
+	"os"
+
+	"github.com/rs/zerolog/log"
+)
+
+// FileProvider reads base64 encoded master key from file.
+type FileProvider struct {
+	path     string
+	previous []string
+}
+
+func NewFile(path string, previous ...string) *FileProvider {
+	return &FileProvider{path: path, previous: previous}
+}
+
+func (fp *FileProvider) MasterKey() ([]byte, error) {
+	return readKeyFile(fp.path)
+}
+
+func (fp *FileProvider) PreviousKeys() ([][]byte, error) {
+	return collectKeys(fp.previous, readKeyFile)
+}
+
+func readKeyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Err(err).Msgf("failed to stat master key file '%s'", path)
+		return nil, err
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		log.Warn().Msgf("master key file '%s' is accessible by other users", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Err(err).Msgf("failed to read master key file '%s'", path)
+		return nil, err
+	}
+	return decodeKey(string(data))
+}
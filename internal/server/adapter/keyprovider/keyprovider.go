@@ -0,0 +1,35 @@
+package keyprovider
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+const minKeySize = 32
+
+var ErrShortKey = errors.New("master key must be at least 32 bytes")
+
+// decodeKey decodes base64 encoded master key.
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) < minKeySize {
+		return nil, ErrShortKey
+	}
+	return key, nil
+}
+
+func collectKeys(names []string, read func(string) ([]byte, error)) ([][]byte, error) {
+	keys := make([][]byte, 0, len(names))
+	for _, name := range names {
+		key, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,46 @@
+package keyprovider
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef!")
+
+func TestFileProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "master.key")
+	_, err := NewFile(path).MasterKey()
+	require.Error(t, err)
+
+	err = os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(testKey)+"\n"), 0600)
+	require.NoError(t, err)
+	key, err := NewFile(path).MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+
+	previousPath := filepath.Join(t.TempDir(), "master.key.1")
+	err = os.WriteFile(previousPath, []byte(base64.StdEncoding.EncodeToString(testKey[1:])), 0600)
+	require.NoError(t, err)
+	previous, err := NewFile(path, previousPath).PreviousKeys()
+	require.NoError(t, err)
+	require.Equal(t, [][]byte{testKey[1:]}, previous)
+
+	err = os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(testKey[:16])), 0600)
+	require.NoError(t, err)
+	_, err = NewFile(path).MasterKey()
+	require.Equal(t, ErrShortKey, err)
+}
+
+func TestEnvProvider(t *testing.T) {
+	_, err := NewEnv("GOPHKEEPER_TEST_MASTER_KEY").MasterKey()
+	require.Equal(t, ErrEmptyKeyEnv, err)
+
+	t.Setenv("GOPHKEEPER_TEST_MASTER_KEY", base64.StdEncoding.EncodeToString(testKey))
+	key, err := NewEnv("GOPHKEEPER_TEST_MASTER_KEY").MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, testKey, key)
+}
@@ -0,0 +1,155 @@
+//go:build cgo
+
+package keyprovider
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+	"github.com/rs/zerolog/log"
+)
+
+// pkcs11KeyMessage is signed with the token key to get the master key, so the
+// token key itself never leaves the device.
+const pkcs11KeyMessage = "gophkeeper master key"
+
+var (
+	ErrPKCS11Module   = errors.New("failed to load pkcs11 module")
+	ErrPKCS11Token    = errors.New("pkcs11 token not found")
+	ErrPKCS11KeyCount = errors.New("pkcs11 key label must match exactly one key")
+)
+
+type PKCS11Config struct {
+	Module     string
+	TokenLabel string
+	Pin        string
+	KeyLabel   string
+	// PreviousKeyLabels are labels of retired keys kept for reading.
+	PreviousKeyLabels []string
+}
+
+// PKCS11Provider derives master key with HMAC-SHA256 secret key stored in
+// PKCS#11 token.
+type PKCS11Provider struct {
+	cfg PKCS11Config
+}
+
+func NewPKCS11(cfg PKCS11Config) *PKCS11Provider {
+	return &PKCS11Provider{cfg: cfg}
+}
+
+func (pp *PKCS11Provider) MasterKey() ([]byte, error) {
+	keys, err := pp.deriveKeys(pp.cfg.KeyLabel)
+	if err != nil {
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+func (pp *PKCS11Provider) PreviousKeys() ([][]byte, error) {
+	if len(pp.cfg.PreviousKeyLabels) == 0 {
+		return nil, nil
+	}
+	return pp.deriveKeys(pp.cfg.PreviousKeyLabels...)
+}
+
+func (pp *PKCS11Provider) deriveKeys(labels ...string) ([][]byte, error) {
+	ctx := pkcs11.New(pp.cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("%w '%s'", ErrPKCS11Module, pp.cfg.Module)
+	}
+	defer ctx.Destroy()
+
+	err := ctx.Initialize()
+	if err != nil {
+		log.Err(err).Msg("failed to initialize pkcs11 module")
+		return nil, err
+	}
+	defer ctx.Finalize()
+
+	slot, err := findSlot(ctx, pp.cfg.TokenLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		log.Err(err).Msg("failed to open pkcs11 session")
+		return nil, err
+	}
+	defer ctx.CloseSession(session)
+
+	err = ctx.Login(session, pkcs11.CKU_USER, pp.cfg.Pin)
+	if err != nil {
+		log.Err(err).Msg("failed to login to pkcs11 token")
+		return nil, err
+	}
+	defer ctx.Logout(session)
+
+	keys := make([][]byte, 0, len(labels))
+	for _, label := range labels {
+		key, err := findKey(ctx, session, label)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ctx.SignInit(session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_SHA256_HMAC, nil)}, key)
+		if err != nil {
+			log.Err(err).Msg("failed to init pkcs11 hmac")
+			return nil, err
+		}
+		masterKey, err := ctx.Sign(session, []byte(pkcs11KeyMessage))
+		if err != nil {
+			log.Err(err).Msg("failed to derive key with pkcs11 hmac")
+			return nil, err
+		}
+		keys = append(keys, masterKey)
+	}
+	return keys, nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		log.Err(err).Msg("failed to list pkcs11 slots")
+		return 0, err
+	}
+	for _, slot := range slots {
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			log.Err(err).Msgf("failed to get pkcs11 token info for slot %d", slot)
+			continue
+		}
+		if strings.TrimSpace(info.Label) == label {
+			return slot, nil
+		}
+	}
+	return 0, ErrPKCS11Token
+}
+
+func findKey(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	err := ctx.FindObjectsInit(session, template)
+	if err != nil {
+		log.Err(err).Msg("failed to search pkcs11 key")
+		return 0, err
+	}
+	objects, _, err := ctx.FindObjects(session, 2)
+	finalErr := ctx.FindObjectsFinal(session)
+	if err != nil {
+		log.Err(err).Msg("failed to search pkcs11 key")
+		return 0, err
+	}
+	if finalErr != nil {
+		return 0, finalErr
+	}
+	if len(objects) != 1 {
+		return 0, ErrPKCS11KeyCount
+	}
+	return objects[0], nil
+}
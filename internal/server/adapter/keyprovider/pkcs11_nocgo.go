@@ -0,0 +1,31 @@
+//go:build !cgo
+
+package keyprovider
+
+import "errors"
+
+var ErrPKCS11Unsupported = errors.New("pkcs11 key provider requires cgo")
+
+type PKCS11Config struct {
+	Module     string
+	TokenLabel string
+	Pin        string
+	KeyLabel   string
+	// PreviousKeyLabels are labels of retired keys kept for reading.
+	PreviousKeyLabels []string
+}
+
+// PKCS11Provider is unavailable in binaries built without cgo.
+type PKCS11Provider struct{}
+
+func NewPKCS11(cfg PKCS11Config) *PKCS11Provider {
+	return &PKCS11Provider{}
+}
+
+func (pp *PKCS11Provider) MasterKey() ([]byte, error) {
+	return nil, ErrPKCS11Unsupported
+}
+
+func (pp *PKCS11Provider) PreviousKeys() ([][]byte, error) {
+	return nil, ErrPKCS11Unsupported
+}
@@ -0,0 +1,86 @@
+//go:build cgo
+
+package keyprovider
+
+import (
+	"os"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPKCS11Provider runs against SoftHSM token initialized with
+//
+//	softhsm2-util --init-token --free --label gophkeeper --pin 1234 --so-pin 1234
+//
+// and SOFTHSM2_MODULE pointing to libsofthsm2.so.
+func TestPKCS11Provider(t *testing.T) {
+	module := os.Getenv("SOFTHSM2_MODULE")
+	if len(module) == 0 {
+		t.Skip("SOFTHSM2_MODULE is not set")
+	}
+	cfg := PKCS11Config{
+		Module:     module,
+		TokenLabel: "gophkeeper",
+		Pin:        "1234",
+		KeyLabel:   "gophkeeper-test-key",
+	}
+	destroy := generateTestKey(t, cfg)
+	defer destroy()
+
+	first, err := NewPKCS11(cfg).MasterKey()
+	require.NoError(t, err)
+	require.Len(t, first, 32)
+	second, err := NewPKCS11(cfg).MasterKey()
+	require.NoError(t, err)
+	require.Equal(t, first, second)
+
+	cfg.KeyLabel = "missing"
+	_, err = NewPKCS11(cfg).MasterKey()
+	require.Equal(t, ErrPKCS11KeyCount, err)
+}
+
+// withTestSession runs fn inside logged in read-write session. The module
+// is finalized afterwards, so the provider can initialize it again.
+func withTestSession(t *testing.T, cfg PKCS11Config, fn func(ctx *pkcs11.Ctx, session pkcs11.SessionHandle)) {
+	ctx := pkcs11.New(cfg.Module)
+	require.NotNil(t, ctx)
+	defer ctx.Destroy()
+	require.NoError(t, ctx.Initialize())
+	defer ctx.Finalize()
+	slot, err := findSlot(ctx, cfg.TokenLabel)
+	require.NoError(t, err)
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	require.NoError(t, err)
+	defer ctx.CloseSession(session)
+	require.NoError(t, ctx.Login(session, pkcs11.CKU_USER, cfg.Pin))
+	defer ctx.Logout(session)
+	fn(ctx, session)
+}
+
+func generateTestKey(t *testing.T, cfg PKCS11Config) func() {
+	withTestSession(t, cfg, func(ctx *pkcs11.Ctx, session pkcs11.SessionHandle) {
+		_, err := ctx.GenerateKey(session,
+			[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_GENERIC_SECRET_KEY_GEN, nil)},
+			[]*pkcs11.Attribute{
+				pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+				pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_GENERIC_SECRET),
+				pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+				pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+				pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+				pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+				pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32),
+				pkcs11.NewAttribute(pkcs11.CKA_LABEL, cfg.KeyLabel),
+			})
+		require.NoError(t, err)
+	})
+
+	return func() {
+		withTestSession(t, cfg, func(ctx *pkcs11.Ctx, session pkcs11.SessionHandle) {
+			key, err := findKey(ctx, session, cfg.KeyLabel)
+			require.NoError(t, err)
+			require.NoError(t, ctx.DestroyObject(session, key))
+		})
+	}
+}
@@ -0,0 +1,380 @@
+// Package blob moves ciphertext of binary items from the keeper repository
+// into a blob store, so replicas share files without a shared disk.
+package blob
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+)
+
+// KeeperRepository keeps metadata of every item and data of small items in
+// the primary repository, ciphertext of binary items goes to the blob store.
+// Every write of a binary item uploads a new version under
+// <user id>/<item id>/<version> and the primary repository keeps a reference
+// to it in place of the data, so switching to the new version is a single
+// write of the primary repository. Readers never see a version that is
+// half written or already removed.
+type KeeperRepository struct {
+	port.KeeperRepository
+	blobs port.BlobStore
+}
+
+func NewKeeper(primary port.KeeperRepository, blobs port.BlobStore) *KeeperRepository {
+	return &KeeperRepository{KeeperRepository: primary, blobs: blobs}
+}
+
+// blobRef starts data of items kept in the blob store, the rest of the data
+// is the blob key.
+var blobRef = []byte("gophkeeper blob\x00")
+
+// legacyBlobKey is the key of blobs written before they were versioned, their
+// items have no data in the primary repository.
+func legacyBlobKey(userID domain.UserID, id domain.DataID) string {
+	return string(userID) + "/" + string(id)
+}
+
+func newBlobKey(userID domain.UserID, id domain.DataID) string {
+	return legacyBlobKey(userID, id) + "/" + uuid.NewString()
+}
+
+func userPrefix(userID domain.UserID) string {
+	return string(userID) + "/"
+}
+
+// storedBlob returns key of the blob item data is kept in. Items of other
+// types, items stored inline and missing items have none.
+func (kr *KeeperRepository) storedBlob(ctx context.Context, userID domain.UserID, id domain.DataID) (string, bool, error) {
+	meta, err := kr.KeeperRepository.GetMeta(ctx, userID, id)
+	if err == domain.ErrNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if meta.Type != domain.BinaryType {
+		return "", false, nil
+	}
+	data, err := kr.KeeperRepository.GetData(ctx, meta)
+	if err == domain.ErrNotFound {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return blobOf(meta, data)
+}
+
+// blobOf returns key of the blob referenced by data of item.
+func blobOf(dataCtx domain.DataContext, data []byte) (string, bool, error) {
+	switch {
+	case len(data) == 0:
+		return legacyBlobKey(dataCtx.UserID, dataCtx.ID), true, nil
+	case bytes.HasPrefix(data, blobRef):
+		return string(data[len(blobRef):]), true, nil
+	default:
+		return "", false, nil
+	}
+}
+
+// removeBlob deletes blob no item refers to anymore. A blob left by a failure
+// is only wasted space and is removed with the account.
+func (kr *KeeperRepository) removeBlob(ctx context.Context, dataCtx domain.DataContext, key string) {
+	err := kr.blobs.Delete(ctx, key)
+	if err != nil && err != domain.ErrNotFound {
+		log.Err(err).Msgf("failed to delete blob of item '%s'", dataCtx.ID)
+	}
+}
+
+// Set writes the blob before metadata, so stored metadata never points to a
+// missing blob. The blob is removed again when metadata is refused, the
+// replaced blob once the new one is referenced. Items changing their type
+// away from binary drop their blob too.
+func (kr *KeeperRepository) Set(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
+	if dataCtx.Type != domain.BinaryType {
+		return kr.setInline(ctx, dataCtx, func() error {
+			return kr.KeeperRepository.Set(ctx, dataCtx, data)
+		})
+	}
+	if len(dataCtx.UserID) == 0 {
+		return domain.ErrBadRequest
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	key := newBlobKey(dataCtx.UserID, dataCtx.ID)
+	return kr.setBlob(ctx, dataCtx, key, func() error {
+		return kr.blobs.Put(ctx, key, data)
+	})
+}
+
+// SetStream uploads binary items in parts, like Set it writes the blob before
+// metadata.
+func (kr *KeeperRepository) SetStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	if dataCtx.Type != domain.BinaryType {
+		return kr.setInline(ctx, dataCtx, func() error {
+			return kr.KeeperRepository.SetStream(ctx, dataCtx, src)
+		})
+	}
+	if len(dataCtx.UserID) == 0 {
+		return domain.ErrBadRequest
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	key := newBlobKey(dataCtx.UserID, dataCtx.ID)
+	return kr.setBlob(ctx, dataCtx, key, func() error {
+		return kr.blobs.PutStream(ctx, key, src)
+	})
+}
+
+// setInline stores item of another type than binary with set and removes
+// the blob of the binary item it replaces.
+func (kr *KeeperRepository) setInline(ctx context.Context, dataCtx domain.DataContext, set func() error) error {
+	if !dataCtx.ID.IsValid() {
+		return set()
+	}
+	replaced, ok, err := kr.storedBlob(ctx, dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+	if err := set(); err != nil {
+		return err
+	}
+	if ok {
+		kr.removeBlob(ctx, dataCtx, replaced)
+	}
+	return nil
+}
+
+// setBlob uploads new version of item with put and references it. Writers
+// racing for one item each remove the version they saw before their own
+// write, so the referenced version is never removed.
+func (kr *KeeperRepository) setBlob(ctx context.Context, dataCtx domain.DataContext, key string, put func() error) error {
+	replaced, ok, err := kr.storedBlob(ctx, dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+	err = put()
+	if err != nil {
+		log.Err(err).Msgf("failed to put blob of item '%s'", dataCtx.ID)
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	err = kr.KeeperRepository.Set(ctx, dataCtx, append(append([]byte{}, blobRef...), key...))
+	if err != nil {
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	if ok {
+		kr.removeBlob(ctx, dataCtx, replaced)
+	}
+	return nil
+}
+
+// GetData reads binary items from the blob store. Items written before the
+// blob store was enabled still have their data in the primary repository.
+func (kr *KeeperRepository) GetData(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	data, err := kr.KeeperRepository.GetData(ctx, dataCtx)
+	if err != nil || dataCtx.Type != domain.BinaryType {
+		return data, err
+	}
+	key, ok, _ := blobOf(dataCtx, data)
+	if !ok {
+		return data, nil
+	}
+	blob, err := kr.blobs.Get(ctx, key)
+	if err == domain.ErrNotFound && len(data) == 0 {
+		return data, nil
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return nil, err
+	}
+	return blob, nil
+}
+
+// ReplaceData of binary items kept in the blob store compares old with the
+// referenced blob, uploads data as a new version and switches the reference
+// only while the item still refers to the compared blob.
+func (kr *KeeperRepository) ReplaceData(ctx context.Context, dataCtx domain.DataContext, old, data []byte) error {
+	if dataCtx.Type != domain.BinaryType {
+		return kr.KeeperRepository.ReplaceData(ctx, dataCtx, old, data)
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	stored, err := kr.KeeperRepository.GetData(ctx, dataCtx)
+	if err != nil {
+		return err
+	}
+	replaced, ok, _ := blobOf(dataCtx, stored)
+	if !ok {
+		return kr.KeeperRepository.ReplaceData(ctx, dataCtx, old, data)
+	}
+	current, err := kr.blobs.Get(ctx, replaced)
+	if err == domain.ErrNotFound && len(stored) == 0 {
+		return kr.KeeperRepository.ReplaceData(ctx, dataCtx, old, data)
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return domain.ErrNotFound
+	}
+
+	key := newBlobKey(dataCtx.UserID, dataCtx.ID)
+	err = kr.blobs.Put(ctx, key, data)
+	if err != nil {
+		log.Err(err).Msgf("failed to put blob of item '%s'", dataCtx.ID)
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	err = kr.KeeperRepository.ReplaceData(ctx, dataCtx, stored, append(append([]byte{}, blobRef...), key...))
+	if err != nil {
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	kr.removeBlob(ctx, dataCtx, replaced)
+	return nil
+}
+
+// ReplaceHead of binary items kept in the blob store compares old with the
+// head of the referenced blob and uploads the blob again as a new version,
+// streaming the rest of it behind head. The reference is switched only while
+// the item still refers to the compared blob.
+func (kr *KeeperRepository) ReplaceHead(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+	if dataCtx.Type != domain.BinaryType {
+		return kr.KeeperRepository.ReplaceHead(ctx, dataCtx, old, head)
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	stored, err := kr.KeeperRepository.GetData(ctx, dataCtx)
+	if err != nil {
+		return err
+	}
+	replaced, ok, _ := blobOf(dataCtx, stored)
+	if !ok {
+		return kr.KeeperRepository.ReplaceHead(ctx, dataCtx, old, head)
+	}
+	blob, err := kr.blobs.GetStream(ctx, replaced)
+	if err == domain.ErrNotFound && len(stored) == 0 {
+		return kr.KeeperRepository.ReplaceHead(ctx, dataCtx, old, head)
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+	defer blob.Close()
+	current := make([]byte, len(old))
+	_, err = io.ReadFull(blob, current)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && !bytes.Equal(current, old)) {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+
+	key := newBlobKey(dataCtx.UserID, dataCtx.ID)
+	err = kr.blobs.PutStream(ctx, key, io.MultiReader(bytes.NewReader(head), blob))
+	if err != nil {
+		log.Err(err).Msgf("failed to put blob of item '%s'", dataCtx.ID)
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	err = kr.KeeperRepository.ReplaceData(ctx, dataCtx, stored, append(append([]byte{}, blobRef...), key...))
+	if err != nil {
+		kr.removeBlob(ctx, dataCtx, key)
+		return err
+	}
+	kr.removeBlob(ctx, dataCtx, replaced)
+	return nil
+}
+
+// GetStream reads only the head of data kept in the primary repository to
+// tell blob references from data stored inline.
+func (kr *KeeperRepository) GetStream(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	stream, err := kr.KeeperRepository.GetStream(ctx, dataCtx)
+	if err != nil || dataCtx.Type != domain.BinaryType {
+		return stream, err
+	}
+	head := bufio.NewReader(stream)
+	peeked, err := head.Peek(len(blobRef))
+	if err != nil && err != io.EOF {
+		stream.Close()
+		return nil, err
+	}
+	if len(peeked) != 0 && !bytes.Equal(peeked, blobRef) {
+		return readCloser{Reader: head, Closer: stream}, nil
+	}
+	data, err := io.ReadAll(head)
+	stream.Close()
+	if err != nil {
+		return nil, err
+	}
+	key, _, _ := blobOf(dataCtx, data)
+	blob, err := kr.blobs.GetStream(ctx, key)
+	if err == domain.ErrNotFound && len(data) == 0 {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return nil, err
+	}
+	return blob, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// Delete removes metadata first and then the blob, a blob left by a failure
+// is unreachable and is removed with the account.
+func (kr *KeeperRepository) Delete(ctx context.Context, dataCtx domain.DataContext) error {
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	key, ok, err := kr.storedBlob(ctx, dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msgf("failed to get blob of item '%s'", dataCtx.ID)
+		return err
+	}
+	err = kr.KeeperRepository.Delete(ctx, dataCtx)
+	if err != nil {
+		return err
+	}
+	if ok {
+		kr.removeBlob(ctx, dataCtx, key)
+	}
+	return nil
+}
+func (kr *KeeperRepository) DeleteAll(ctx context.Context, userID domain.UserID) error {
+	err := kr.KeeperRepository.DeleteAll(ctx, userID)
+	if err != nil {
+		return err
+	}
+	err = kr.blobs.DeletePrefix(ctx, userPrefix(userID))
+	if err != nil {
+		log.Err(err).Msgf("failed to delete blobs of user '%s'", userID)
+		return err
+	}
+	return nil
+}
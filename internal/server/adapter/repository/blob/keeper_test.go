@@ -0,0 +1,174 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/sqlite"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fileID      domain.DataID = "4e7b1c2d-9a3f-4b6e-8d5c-1f0a2b3c4d5e"
+	bankID      domain.DataID = "6a1d2e3f-4b5c-4d7e-9f0a-b1c2d3e4f5a6"
+	oldID       domain.DataID = "7b2e3f4a-5c6d-4e8f-a0b1-c2d3e4f5a6b7"
+	otherFileID domain.DataID = "8c3f4a5b-6d7e-4f9a-b1c2-d3e4f5a6b7c8"
+	missingID   domain.DataID = "9d4a5b6c-7e8f-4a0b-c2d3-e4f5a6b7c8d9"
+)
+
+func TestKeeperRepository(t *testing.T) {
+	primary, err := sqlite.NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer primary.Close()
+	store, standIn := newTestS3(t)
+	repo := NewKeeper(primary, store)
+	ctx := context.Background()
+
+	file := domain.DataContext{ID: fileID, UserID: "user", Title: "file.bin", Type: domain.BinaryType}
+	bank := domain.DataContext{ID: bankID, UserID: "user", Title: "card", Type: domain.BankType}
+	require.NoError(t, repo.Set(ctx, file, []byte("ciphertext")))
+	require.NoError(t, repo.Set(ctx, bank, []byte("card ciphertext")))
+	require.Equal(t, [][]byte{[]byte("ciphertext")}, itemBlobs(standIn, file))
+	require.Len(t, standIn.objects, 1)
+	inline, err := primary.GetData(ctx, file)
+	require.NoError(t, err)
+	require.NotContains(t, string(inline), "ciphertext")
+
+	meta, err := repo.GetMeta(ctx, "user", fileID)
+	require.NoError(t, err)
+	require.Equal(t, file, meta)
+	data, err := repo.GetData(ctx, meta)
+	require.NoError(t, err)
+	require.Equal(t, []byte("ciphertext"), data)
+	data, err = repo.GetData(ctx, bank)
+	require.NoError(t, err)
+	require.Equal(t, []byte("card ciphertext"), data)
+
+	// files stored before the blob store stay readable
+	old := domain.DataContext{ID: oldID, UserID: "user", Type: domain.BinaryType}
+	require.NoError(t, primary.Set(ctx, old, []byte("old ciphertext")))
+	data, err = repo.GetData(ctx, old)
+	require.NoError(t, err)
+	require.Equal(t, []byte("old ciphertext"), data)
+
+	// overwrite switches to a new version and removes the replaced one
+	require.NoError(t, repo.Set(ctx, file, []byte("new ciphertext")))
+	require.Equal(t, [][]byte{[]byte("new ciphertext")}, itemBlobs(standIn, file))
+	data, err = repo.GetData(ctx, file)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new ciphertext"), data)
+
+	// replace switches to a new version only while the compared one is stored
+	require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, file, []byte("ciphertext"), []byte("stale")))
+	require.NoError(t, repo.ReplaceData(ctx, file, []byte("new ciphertext"), []byte("rewrapped")))
+	require.Equal(t, [][]byte{[]byte("rewrapped")}, itemBlobs(standIn, file))
+	require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, file, []byte("stale"), []byte("other")))
+	require.NoError(t, repo.ReplaceHead(ctx, file, []byte("re"), []byte("un")))
+	require.Equal(t, [][]byte{[]byte("unwrapped")}, itemBlobs(standIn, file))
+
+	// files of the unversioned layout are read and replaced
+	legacy := domain.DataContext{ID: missingID, UserID: "user", Type: domain.BinaryType}
+	require.NoError(t, primary.Set(ctx, legacy, []byte{}))
+	standIn.objects[legacyBlobKey(legacy.UserID, legacy.ID)] = []byte("legacy ciphertext")
+	data, err = repo.GetData(ctx, legacy)
+	require.NoError(t, err)
+	require.Equal(t, []byte("legacy ciphertext"), data)
+	require.NoError(t, repo.Set(ctx, legacy, []byte("new legacy ciphertext")))
+	require.Equal(t, [][]byte{[]byte("new legacy ciphertext")}, itemBlobs(standIn, legacy))
+
+	// type change away from binary drops the blob
+	legacy.Type = domain.TextType
+	require.NoError(t, repo.Set(ctx, legacy, []byte("text ciphertext")))
+	require.Empty(t, itemBlobs(standIn, legacy))
+	data, err = repo.GetData(ctx, legacy)
+	require.NoError(t, err)
+	require.Equal(t, []byte("text ciphertext"), data)
+	require.NoError(t, repo.Delete(ctx, legacy))
+
+	require.NoError(t, repo.Delete(ctx, file))
+	require.Empty(t, standIn.objects)
+	_, err = repo.GetMeta(ctx, "user", fileID)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, repo.Set(ctx, file, []byte("ciphertext")))
+	// item id of another user is refused and leaves no blob behind
+	require.Equal(t, domain.ErrNotFound, repo.Set(ctx, domain.DataContext{ID: fileID, UserID: "other", Type: domain.BinaryType}, []byte("stolen")))
+	require.Len(t, standIn.objects, 1)
+	require.NoError(t, repo.Set(ctx, domain.DataContext{ID: otherFileID, UserID: "other", Type: domain.BinaryType}, []byte("other")))
+	require.Equal(t, domain.ErrBadRequest, repo.DeleteAll(ctx, ""))
+	require.NoError(t, repo.DeleteAll(ctx, "user"))
+	require.Len(t, standIn.objects, 1)
+	require.Equal(t, [][]byte{[]byte("other")}, itemBlobs(standIn, domain.DataContext{ID: otherFileID, UserID: "other"}))
+	_, err = repo.GetAllData(ctx, "user")
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestKeeperRepository_Stream(t *testing.T) {
+	primary, err := sqlite.NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer primary.Close()
+	store, standIn := newTestS3(t)
+	repo := NewKeeper(primary, store)
+	ctx := context.Background()
+
+	file := domain.DataContext{ID: fileID, UserID: "user", Title: "file.bin", Type: domain.BinaryType}
+	require.NoError(t, repo.SetStream(ctx, file, strings.NewReader("ciphertext")))
+	require.Equal(t, [][]byte{[]byte("ciphertext")}, itemBlobs(standIn, file))
+	require.Equal(t, "ciphertext", readStream(t, repo, file))
+	require.NoError(t, repo.SetStream(ctx, file, strings.NewReader("new ciphertext")))
+	require.Equal(t, [][]byte{[]byte("new ciphertext")}, itemBlobs(standIn, file))
+	require.Equal(t, "new ciphertext", readStream(t, repo, file))
+
+	// files stored before the blob store stay readable
+	old := domain.DataContext{ID: oldID, UserID: "user", Type: domain.BinaryType}
+	require.NoError(t, primary.Set(ctx, old, []byte("old ciphertext")))
+	require.Equal(t, "old ciphertext", readStream(t, repo, old))
+
+	bank := domain.DataContext{ID: bankID, UserID: "user", Type: domain.BankType}
+	require.NoError(t, repo.SetStream(ctx, bank, strings.NewReader("card ciphertext")))
+	require.Len(t, standIn.objects, 1)
+	require.Equal(t, "card ciphertext", readStream(t, repo, bank))
+
+	require.Equal(t, domain.ErrNotFound, repo.SetStream(ctx, domain.DataContext{ID: fileID, UserID: "other", Type: domain.BinaryType}, strings.NewReader("stolen")))
+	require.Len(t, standIn.objects, 1)
+	_, err = repo.GetStream(ctx, domain.DataContext{ID: missingID, UserID: "user", Type: domain.BinaryType})
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+// itemBlobs returns blobs stored for item.
+func itemBlobs(standIn *minioStandIn, dataCtx domain.DataContext) [][]byte {
+	standIn.mu.Lock()
+	defer standIn.mu.Unlock()
+	var blobs [][]byte
+	for key, blob := range standIn.objects {
+		if key == legacyBlobKey(dataCtx.UserID, dataCtx.ID) || strings.HasPrefix(key, legacyBlobKey(dataCtx.UserID, dataCtx.ID)+"/") {
+			blobs = append(blobs, blob)
+		}
+	}
+	return blobs
+}
+
+func readStream(t *testing.T, repo *KeeperRepository, dataCtx domain.DataContext) string {
+	reader, err := repo.GetStream(context.Background(), dataCtx)
+	require.NoError(t, err)
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestKeeperRepository_Conformance(t *testing.T) {
+	conformance.TestKeeperRepository(t, func(t *testing.T) port.KeeperRepository {
+		primary, err := sqlite.NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+		require.NoError(t, err)
+		t.Cleanup(primary.Close)
+		store, _ := newTestS3(t)
+		return NewKeeper(primary, store)
+	})
+}
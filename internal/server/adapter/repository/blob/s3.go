@@ -0,0 +1,151 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// streamPartSize is the part of an upload of unknown size kept in memory, an
+// upload has at most 10000 parts, so streamed blobs are limited to 156 GiB.
+const streamPartSize = 16 << 20
+
+type S3Config struct {
+	// Endpoint is host and port of the service, like s3.amazonaws.com or
+	// minio:9000.
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Insecure talks plain HTTP to services inside a trusted network.
+	Insecure bool
+	// Transport replaces the default HTTP transport, nil keeps it.
+	Transport http.RoundTripper
+}
+
+// S3Store keeps blobs in a bucket of an S3 compatible service. Objects are
+// addressed by path, which every S3 compatible service supports.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3(cfg S3Config) (*S3Store, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       !cfg.Insecure,
+		Region:       cfg.Region,
+		BucketLookup: minio.BucketLookupPath,
+		Transport:    cfg.Transport,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to create s3 client")
+		return nil, err
+	}
+	return &S3Store{client: client, bucket: cfg.Bucket}, nil
+}
+
+// CheckBucket fails when the bucket does not exist or is not accessible.
+func (s *S3Store) CheckBucket(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		log.Err(err).Msgf("failed to check bucket '%s'", s.bucket)
+		return err
+	}
+	if !exists {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	})
+	if err != nil {
+		log.Err(err).Msgf("failed to put object '%s'", key)
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err, key)
+	}
+	defer object.Close()
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, s3Error(err, key)
+	}
+	return data, nil
+}
+
+// PutStream uploads src in parts, so only one part is held in memory.
+func (s *S3Store) PutStream(ctx context.Context, key string, src io.Reader) error {
+	_, err := s.client.PutObject(ctx, s.bucket, key, src, -1, minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		PartSize:    streamPartSize,
+	})
+	if err != nil {
+		log.Err(err).Msgf("failed to put object '%s'", key)
+		return err
+	}
+	return nil
+}
+
+// GetStream checks the object before returning it, objects are otherwise
+// only requested on the first read.
+func (s *S3Store) GetStream(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err, key)
+	}
+	if _, err := object.Stat(); err != nil {
+		object.Close()
+		return nil, s3Error(err, key)
+	}
+	return object, nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil {
+		err = s3Error(err, key)
+		if err == domain.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *S3Store) DeletePrefix(ctx context.Context, prefix string) error {
+	for object := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			log.Err(object.Err).Msgf("failed to list objects '%s'", prefix)
+			return object.Err
+		}
+		if err := s.Delete(ctx, object.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3Error maps missing object to domain.ErrNotFound.
+func s3Error(err error, key string) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return domain.ErrNotFound
+	}
+	log.Err(err).Msgf("failed to access object '%s'", key)
+	return err
+}
@@ -0,0 +1,264 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBucket    = "keeper"
+	testAccessKey = "minioadmin"
+)
+
+// minioStandIn serves the part of the S3 API used by S3Store from memory,
+// like a local MinIO would.
+type minioStandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	// uploads holds parts of multipart uploads by upload id.
+	uploads map[string]map[int][]byte
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+type listBucketResult struct {
+	XMLName     xml.Name `xml:"ListBucketResult"`
+	Name        string
+	Prefix      string
+	KeyCount    int
+	IsTruncated bool
+	Contents    []listObject
+}
+
+type listObject struct {
+	Key          string
+	Size         int
+	LastModified string
+	ETag         string
+}
+
+func s3ErrorResponse(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (m *minioStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+testAccessKey+"/") {
+		s3ErrorResponse(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != testBucket {
+		s3ErrorResponse(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(key) == 0 {
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			prefix := r.URL.Query().Get("prefix")
+			result := listBucketResult{Name: bucket, Prefix: prefix}
+			for objectKey, data := range m.objects {
+				if strings.HasPrefix(objectKey, prefix) {
+					result.Contents = append(result.Contents, listObject{
+						Key:          objectKey,
+						Size:         len(data),
+						LastModified: time.Now().UTC().Format(time.RFC3339),
+						ETag:         `"etag"`,
+					})
+				}
+			}
+			sort.Slice(result.Contents, func(i, j int) bool { return result.Contents[i].Key < result.Contents[j].Key })
+			result.KeyCount = len(result.Contents)
+			w.Header().Set("Content-Type", "application/xml")
+			xml.NewEncoder(w).Encode(result)
+		default:
+			s3ErrorResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+		}
+		return
+	}
+
+	if r.Method == http.MethodPost || r.URL.Query().Has("uploadId") {
+		m.serveMultipart(w, r, bucket, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3ErrorResponse(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		m.objects[key] = data
+		w.Header().Set("ETag", `"etag"`)
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		data, ok := m.objects[key]
+		if !ok {
+			s3ErrorResponse(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		delete(m.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3ErrorResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (m *minioStandIn) serveMultipart(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	query := r.URL.Query()
+	uploadID := query.Get("uploadId")
+	if r.Method == http.MethodPost && query.Has("uploads") {
+		uploadID = fmt.Sprintf("upload-%d", len(m.uploads)+1)
+		m.uploads[uploadID] = make(map[int][]byte)
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(initiateMultipartUploadResult{Bucket: bucket, Key: key, UploadId: uploadID})
+		return
+	}
+	parts, ok := m.uploads[uploadID]
+	if !ok {
+		s3ErrorResponse(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		number, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			s3ErrorResponse(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			s3ErrorResponse(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		parts[number] = data
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, number))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPost:
+		var data []byte
+		for number := 1; number <= len(parts); number++ {
+			data = append(data, parts[number]...)
+		}
+		m.objects[key] = data
+		delete(m.uploads, uploadID)
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(completeMultipartUploadResult{Bucket: bucket, Key: key, ETag: `"etag"`})
+	case http.MethodDelete:
+		delete(m.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s3ErrorResponse(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func newTestS3(t *testing.T) (*S3Store, *minioStandIn) {
+	standIn := &minioStandIn{objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	server := httptest.NewTLSServer(standIn)
+	t.Cleanup(server.Close)
+	store, err := NewS3(S3Config{
+		Endpoint:  strings.TrimPrefix(server.URL, "https://"),
+		Bucket:    testBucket,
+		Region:    "us-east-1",
+		AccessKey: testAccessKey,
+		SecretKey: "minioadmin",
+		Transport: server.Client().Transport,
+	})
+	require.NoError(t, err)
+	return store, standIn
+}
+
+func TestS3Store(t *testing.T) {
+	store, standIn := newTestS3(t)
+	ctx := context.Background()
+	require.NoError(t, store.CheckBucket(ctx))
+
+	require.NoError(t, store.Put(ctx, "user/first", []byte("first")))
+	require.NoError(t, store.Put(ctx, "user/second", []byte("second")))
+	require.NoError(t, store.Put(ctx, "other/first", []byte("other")))
+	require.Equal(t, []byte("first"), standIn.objects["user/first"])
+
+	data, err := store.Get(ctx, "user/second")
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), data)
+	_, err = store.Get(ctx, "user/missing")
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, store.Delete(ctx, "user/first"))
+	require.NoError(t, store.Delete(ctx, "user/first"))
+	_, err = store.Get(ctx, "user/first")
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, store.DeletePrefix(ctx, "user/"))
+	require.Len(t, standIn.objects, 1)
+	_, err = store.Get(ctx, "other/first")
+	require.NoError(t, err)
+}
+
+func TestS3Store_Stream(t *testing.T) {
+	store, standIn := newTestS3(t)
+	ctx := context.Background()
+
+	data := bytes.Repeat([]byte("0123456789"), streamPartSize/10+1)
+	require.NoError(t, store.PutStream(ctx, "user/large", bytes.NewReader(data)))
+	require.Equal(t, data, standIn.objects["user/large"])
+	require.Empty(t, standIn.uploads)
+
+	reader, err := store.GetStream(ctx, "user/large")
+	require.NoError(t, err)
+	actual, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, data, actual)
+
+	_, err = store.GetStream(ctx, "user/missing")
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.Error(t, store.PutStream(ctx, "user/broken", iotest.ErrReader(errors.New("broken upload"))))
+	_, ok := standIn.objects["user/broken"]
+	require.False(t, ok)
+	require.Empty(t, standIn.uploads)
+}
@@ -0,0 +1,320 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/google/uuid"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+var errUpload = errors.New("upload failed")
+
+// TestKeeperRepository runs the suite against repositories made by newRepo.
+// Items belong to unique users, so the repositories may share storage.
+// newRepo closes the repository in the cleanup of t.
+func TestKeeperRepository(t *testing.T, newRepo func(t *testing.T) port.KeeperRepository) {
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		item := newItem(newUserID(), domain.BinaryType)
+		_, err := repo.GetAllData(ctx, item.UserID)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetData(ctx, item)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetStream(ctx, item)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetMeta(ctx, item.UserID, item.ID)
+		require.Equal(t, domain.ErrNotFound, err)
+		require.NoError(t, repo.Delete(ctx, item))
+	})
+
+	t.Run("InvalidID", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		for _, id := range []domain.DataID{"", "..", "../other", "id", domain.DataID(strings.ToUpper(uuid.NewString()))} {
+			item := domain.DataContext{ID: id, UserID: newUserID(), Type: domain.BinaryType}
+			require.Equal(t, domain.ErrInvalidDataID, repo.Set(ctx, item, []byte("data")), id)
+			require.Equal(t, domain.ErrInvalidDataID, repo.SetStream(ctx, item, strings.NewReader("data")), id)
+			_, err := repo.GetData(ctx, item)
+			require.Equal(t, domain.ErrInvalidDataID, err, id)
+			_, err = repo.GetStream(ctx, item)
+			require.Equal(t, domain.ErrInvalidDataID, err, id)
+			_, err = repo.GetMeta(ctx, item.UserID, item.ID)
+			require.Equal(t, domain.ErrInvalidDataID, err, id)
+			require.Equal(t, domain.ErrInvalidDataID, repo.Delete(ctx, item), id)
+		}
+		require.Equal(t, domain.ErrBadRequest, repo.DeleteAll(ctx, ""))
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		userID := newUserID()
+		file := newItem(userID, domain.BinaryType)
+		bank := newItem(userID, domain.BankType)
+		require.NoError(t, repo.Set(ctx, file, []byte("file")))
+		require.NoError(t, repo.Set(ctx, bank, []byte("bank")))
+		requireItem(t, repo, file, []byte("file"))
+		requireItem(t, repo, bank, []byte("bank"))
+		items, err := repo.GetAllData(ctx, userID)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []domain.DataContext{file, bank}, items)
+
+		// items are replaced whole
+		file.Title = "renamed"
+		file.Meta = "replaced"
+		require.NoError(t, repo.Set(ctx, file, []byte("replaced")))
+		requireItem(t, repo, file, []byte("replaced"))
+
+		require.NoError(t, repo.Delete(ctx, file))
+		_, err = repo.GetData(ctx, file)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetMeta(ctx, file.UserID, file.ID)
+		require.Equal(t, domain.ErrNotFound, err)
+		items, err = repo.GetAllData(ctx, userID)
+		require.NoError(t, err)
+		require.Equal(t, []domain.DataContext{bank}, items)
+
+		require.NoError(t, repo.DeleteAll(ctx, userID))
+		_, err = repo.GetAllData(ctx, userID)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetData(ctx, bank)
+		require.Equal(t, domain.ErrNotFound, err)
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		file := newItem(newUserID(), domain.BinaryType)
+		content := bytes.Repeat([]byte("stream"), 200<<10)
+		require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+		requireItem(t, repo, file, content)
+
+		// failed upload keeps the stored version
+		failed := io.MultiReader(bytes.NewReader(content), iotest.ErrReader(errUpload))
+		require.ErrorIs(t, repo.SetStream(ctx, file, failed), errUpload)
+		requireItem(t, repo, file, content)
+
+		require.NoError(t, repo.SetStream(ctx, file, strings.NewReader("")))
+		requireItem(t, repo, file, []byte{})
+		require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content[:1000])))
+		requireItem(t, repo, file, content[:1000])
+		require.NoError(t, repo.Set(ctx, file, []byte("inline")))
+		requireItem(t, repo, file, []byte("inline"))
+		require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+		require.NoError(t, repo.Delete(ctx, file))
+		_, err := repo.GetStream(ctx, file)
+		require.Equal(t, domain.ErrNotFound, err)
+	})
+
+	t.Run("ReplaceData", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		text := newItem(newUserID(), domain.TextType)
+		require.NoError(t, repo.Set(ctx, text, []byte("data")))
+		require.NoError(t, repo.ReplaceData(ctx, text, []byte("data"), []byte("replaced")))
+		requireItem(t, repo, text, []byte("replaced"))
+
+		// data changed since it was read is kept
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, text, []byte("data"), []byte("stale")))
+		requireItem(t, repo, text, []byte("replaced"))
+		other := text
+		other.UserID = newUserID()
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, other, []byte("replaced"), []byte("stolen")))
+		requireItem(t, repo, text, []byte("replaced"))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, newItem(text.UserID, domain.TextType), nil, []byte("created")))
+
+		file := newItem(text.UserID, domain.BinaryType)
+		content := bytes.Repeat([]byte("stream"), 200<<10)
+		require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, file, content[:1000], []byte("stale")))
+		require.NoError(t, repo.ReplaceData(ctx, file, content, content[1000:]))
+		requireItem(t, repo, file, content[1000:])
+		require.NoError(t, repo.ReplaceData(ctx, file, content[1000:], []byte{}))
+		requireItem(t, repo, file, []byte{})
+
+		require.NoError(t, repo.Delete(ctx, text))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceData(ctx, text, []byte("replaced"), []byte("stale")))
+		_, err := repo.GetMeta(ctx, text.UserID, text.ID)
+		require.Equal(t, domain.ErrNotFound, err)
+	})
+
+	t.Run("ReplaceHead", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		// heads of ciphertext hold any bytes
+		data := []byte("\x00head\xff\x00tail\x00")
+		head := []byte("\xffHEAD\x00\x80")
+		text := newItem(newUserID(), domain.TextType)
+		require.NoError(t, repo.Set(ctx, text, data))
+		require.NoError(t, repo.ReplaceHead(ctx, text, data[:7], head))
+		replaced := append(append([]byte{}, head...), data[7:]...)
+		requireItem(t, repo, text, replaced)
+
+		// head changed since it was read is kept
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, text, data[:7], []byte("stale")))
+		requireItem(t, repo, text, replaced)
+		other := text
+		other.UserID = newUserID()
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, other, head, []byte("stolen")))
+		requireItem(t, repo, text, replaced)
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, text, append(replaced, 0), []byte("longer")))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, newItem(text.UserID, domain.TextType), nil, []byte("created")))
+
+		file := newItem(text.UserID, domain.BinaryType)
+		content := bytes.Repeat([]byte("stream\x00"), 200<<10)
+		require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, file, []byte("stale"), []byte("other")))
+		require.NoError(t, repo.ReplaceHead(ctx, file, content[:7], head))
+		requireItem(t, repo, file, append(append([]byte{}, head...), content[7:]...))
+
+		require.NoError(t, repo.Delete(ctx, text))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceHead(ctx, text, head, []byte("stale")))
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		owner := newItem(newUserID(), domain.BinaryType)
+		require.NoError(t, repo.Set(ctx, owner, []byte("owner")))
+
+		// the same item id of another user never reaches the owner item
+		other := owner
+		other.UserID = newUserID()
+		_, err := repo.GetData(ctx, other)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetStream(ctx, other)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetMeta(ctx, other.UserID, other.ID)
+		require.Equal(t, domain.ErrNotFound, err)
+		_, err = repo.GetAllData(ctx, other.UserID)
+		require.Equal(t, domain.ErrNotFound, err)
+		err = repo.Set(ctx, other, []byte("other"))
+		if err == nil {
+			requireItem(t, repo, other, []byte("other"))
+		} else {
+			require.Equal(t, domain.ErrNotFound, err)
+		}
+		require.NoError(t, repo.Delete(ctx, other))
+		require.NoError(t, repo.DeleteAll(ctx, other.UserID))
+		requireItem(t, repo, owner, []byte("owner"))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		userID := newUserID()
+		shared := newItem(userID, domain.BinaryType)
+		items := make([]domain.DataContext, concurrency)
+		errs := make([]error, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				items[i] = newItem(userID, domain.TextType)
+				errs[i] = func() error {
+					if err := repo.Set(ctx, items[i], []byte(items[i].ID)); err != nil {
+						return err
+					}
+					for j := 0; j < 5; j++ {
+						// writers of one item leave one of the versions whole
+						version := shared
+						version.Title = string(items[i].ID)
+						if err := repo.Set(ctx, version, bytes.Repeat([]byte(items[i].ID), 1000)); err != nil {
+							return err
+						}
+						if _, err := repo.GetAllData(ctx, userID); err != nil {
+							return err
+						}
+					}
+					return nil
+				}()
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+
+		for _, item := range items {
+			requireItem(t, repo, item, []byte(item.ID))
+		}
+		meta, err := repo.GetMeta(ctx, userID, shared.ID)
+		require.NoError(t, err)
+		data, err := repo.GetData(ctx, meta)
+		require.NoError(t, err)
+		require.Equal(t, bytes.Repeat([]byte(meta.Title), 1000), data)
+		all, err := repo.GetAllData(ctx, userID)
+		require.NoError(t, err)
+		require.Len(t, all, concurrency+1)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		repo := newRepo(t)
+		item := newItem(newUserID(), domain.BinaryType)
+		require.NoError(t, repo.Set(context.Background(), item, []byte("data")))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		created := newItem(item.UserID, domain.BinaryType)
+		require.ErrorIs(t, repo.Set(ctx, created, []byte("data")), context.Canceled)
+		require.ErrorIs(t, repo.SetStream(ctx, created, strings.NewReader("data")), context.Canceled)
+		require.ErrorIs(t, repo.Set(ctx, item, []byte("replaced")), context.Canceled)
+		_, err := repo.GetAllData(ctx, item.UserID)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = repo.GetData(ctx, item)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = repo.GetStream(ctx, item)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = repo.GetMeta(ctx, item.UserID, item.ID)
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, repo.Delete(ctx, item), context.Canceled)
+		require.ErrorIs(t, repo.DeleteAll(ctx, item.UserID), context.Canceled)
+
+		// nothing is changed by canceled calls
+		_, err = repo.GetMeta(context.Background(), created.UserID, created.ID)
+		require.Equal(t, domain.ErrNotFound, err)
+		requireItem(t, repo, item, []byte("data"))
+	})
+}
+
+func newUserID() domain.UserID {
+	return domain.UserID(uuid.NewString())
+}
+
+func newItem(userID domain.UserID, dataType domain.DataType) domain.DataContext {
+	return domain.DataContext{
+		ID:     domain.DataID(uuid.NewString()),
+		UserID: userID,
+		Title:  "title",
+		Meta:   "meta",
+		Type:   dataType,
+	}
+}
+
+// requireItem checks meta and data of item, read whole and as a stream.
+func requireItem(t *testing.T, repo port.KeeperRepository, item domain.DataContext, data []byte) {
+	ctx := context.Background()
+	meta, err := repo.GetMeta(ctx, item.UserID, item.ID)
+	require.NoError(t, err)
+	require.Equal(t, item, meta)
+	actual, err := repo.GetData(ctx, item)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+	stream, err := repo.GetStream(ctx, item)
+	require.NoError(t, err)
+	defer stream.Close()
+	actual, err = io.ReadAll(stream)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+}
@@ -0,0 +1,241 @@
+// Package conformance checks that repositories behave the way the services
+// expect, whatever storage they are backed by. Every repository of the tree
+// runs the suites in its own tests.
+package conformance
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+// concurrency is the number of goroutines of concurrent access checks.
+const concurrency = 8
+
+// TestUserRepository runs the suite against repositories made by newRepo.
+// Users get unique names and ids, so the repositories may share storage.
+// newRepo closes the repository in the cleanup of t.
+func TestUserRepository(t *testing.T, newRepo func(t *testing.T) port.UserRepository) {
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := newUser()
+		_, err := repo.GetUserByName(ctx, user.Name)
+		require.Equal(t, domain.ErrNotFound, err)
+		require.Equal(t, domain.ErrNotFound, repo.UpdateTwoFactor(ctx, user.ID, domain.TwoFactor{Enabled: true}))
+		require.Equal(t, domain.ErrNotFound, repo.UpdatePassword(ctx, user.ID, "password", nil))
+		require.Equal(t, domain.ErrNotFound, repo.DeleteUser(ctx, user.ID))
+	})
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := newUser()
+		user.VaultKey = []byte("vault key")
+		require.NoError(t, repo.CreateUser(ctx, user))
+		actual, err := repo.GetUserByName(ctx, user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+
+		user.TwoFactor = domain.TwoFactor{Secret: []byte("secret"), Enabled: true, LastStep: 42, RecoveryCodes: [][]byte{{1, 2}, {3, 4}}}
+		require.NoError(t, repo.UpdateTwoFactor(ctx, user.ID, user.TwoFactor))
+		user.Password = "new password"
+		user.VaultKey = []byte("new vault key")
+		require.NoError(t, repo.UpdatePassword(ctx, user.ID, user.Password, user.VaultKey))
+		actual, err = repo.GetUserByName(ctx, user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+		requireListed(t, repo, user, true)
+
+		require.NoError(t, repo.DeleteUser(ctx, user.ID))
+		_, err = repo.GetUserByName(ctx, user.Name)
+		require.Equal(t, domain.ErrNotFound, err)
+		requireListed(t, repo, user, false)
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := newUser()
+		require.NoError(t, repo.CreateUser(ctx, user))
+
+		sameName := newUser()
+		sameName.Name = user.Name
+		require.Equal(t, domain.ErrUserExists, repo.CreateUser(ctx, sameName))
+		sameID := newUser()
+		sameID.ID = user.ID
+		require.Equal(t, domain.ErrUserExists, repo.CreateUser(ctx, sameID))
+		_, err := repo.GetUserByName(ctx, sameID.Name)
+		require.Equal(t, domain.ErrNotFound, err)
+		actual, err := repo.GetUserByName(ctx, user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+	})
+
+	t.Run("Isolation", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user, other := newUser(), newUser()
+		require.NoError(t, repo.CreateUser(ctx, user))
+		require.NoError(t, repo.CreateUser(ctx, other))
+
+		require.NoError(t, repo.UpdatePassword(ctx, other.ID, "other password", []byte("other key")))
+		require.NoError(t, repo.UpdateTwoFactor(ctx, other.ID, domain.TwoFactor{Enabled: true}))
+		require.NoError(t, repo.DeleteUser(ctx, other.ID))
+		actual, err := repo.GetUserByName(ctx, user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+	})
+
+	t.Run("SecondFactor", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		user := newUser()
+		require.NoError(t, repo.CreateUser(ctx, user))
+		// disabled second factor spends nothing
+		require.Equal(t, domain.ErrInvalidCode, repo.UseTwoFactorStep(ctx, user.ID, 1))
+
+		user.TwoFactor = domain.TwoFactor{Secret: []byte("secret"), Enabled: true, LastStep: 10, RecoveryCodes: [][]byte{{1, 2}, {3, 4}}}
+		require.NoError(t, repo.UpdateTwoFactor(ctx, user.ID, user.TwoFactor))
+		require.Equal(t, domain.ErrInvalidCode, repo.UseTwoFactorStep(ctx, user.ID, 10))
+		require.NoError(t, repo.UseTwoFactorStep(ctx, user.ID, 11))
+		require.Equal(t, domain.ErrInvalidCode, repo.UseTwoFactorStep(ctx, user.ID, 11))
+		require.NoError(t, repo.UseRecoveryCode(ctx, user.ID, []byte{3, 4}))
+		require.Equal(t, domain.ErrInvalidCode, repo.UseRecoveryCode(ctx, user.ID, []byte{3, 4}))
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceTwoFactorSecret(ctx, user.ID, []byte("other"), []byte("sealed")))
+		require.NoError(t, repo.ReplaceTwoFactorSecret(ctx, user.ID, []byte("secret"), []byte("sealed")))
+
+		user.TwoFactor = domain.TwoFactor{Secret: []byte("sealed"), Enabled: true, LastStep: 11, RecoveryCodes: [][]byte{{1, 2}}}
+		actual, err := repo.GetUserByName(ctx, user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+
+		// every code is spent once however many logins race for it
+		var wg sync.WaitGroup
+		errs := make([]error, concurrency)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = repo.UseRecoveryCode(ctx, user.ID, []byte{1, 2})
+			}(i)
+		}
+		wg.Wait()
+		spent := 0
+		for _, err := range errs {
+			if err == nil {
+				spent++
+				continue
+			}
+			require.Equal(t, domain.ErrInvalidCode, err)
+		}
+		require.Equal(t, 1, spent)
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		name := newUser().Name
+		created := make([]domain.User, concurrency)
+		errs := make([]error, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				created[i] = newUser()
+				created[i].Name = name
+				errs[i] = repo.CreateUser(ctx, created[i])
+
+				// users of their own are not affected by each other
+				own := newUser()
+				if err := repo.CreateUser(ctx, own); err != nil {
+					errs[i] = err
+					return
+				}
+				for j := 0; j < 5; j++ {
+					own.Password = uuid.NewString()
+					if err := repo.UpdatePassword(ctx, own.ID, own.Password, nil); err != nil {
+						errs[i] = err
+						return
+					}
+				}
+				actual, err := repo.GetUserByName(ctx, own.Name)
+				if err == nil && actual.Password != own.Password {
+					err = domain.ErrBadRequest
+				}
+				if err != nil {
+					errs[i] = err
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		// exactly one registration of the name wins
+		var winner domain.User
+		for i, err := range errs {
+			if err == nil {
+				require.Empty(t, winner.ID, "name registered twice")
+				winner = created[i]
+				continue
+			}
+			require.Equal(t, domain.ErrUserExists, err)
+		}
+		actual, err := repo.GetUserByName(ctx, name)
+		require.NoError(t, err)
+		require.Equal(t, winner.ID, actual.ID)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		repo := newRepo(t)
+		user := newUser()
+		require.NoError(t, repo.CreateUser(context.Background(), user))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		created := newUser()
+		require.ErrorIs(t, repo.CreateUser(ctx, created), context.Canceled)
+		_, err := repo.GetUserByName(ctx, user.Name)
+		require.ErrorIs(t, err, context.Canceled)
+		_, err = repo.GetUsers(ctx)
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, repo.UpdatePassword(ctx, user.ID, "password", nil), context.Canceled)
+		require.ErrorIs(t, repo.UpdateTwoFactor(ctx, user.ID, domain.TwoFactor{Enabled: true}), context.Canceled)
+		require.ErrorIs(t, repo.DeleteUser(ctx, user.ID), context.Canceled)
+
+		// nothing is changed by canceled calls
+		_, err = repo.GetUserByName(context.Background(), created.Name)
+		require.Equal(t, domain.ErrNotFound, err)
+		actual, err := repo.GetUserByName(context.Background(), user.Name)
+		require.NoError(t, err)
+		require.Equal(t, user, actual)
+	})
+}
+
+func newUser() domain.User {
+	return domain.User{
+		ID:       domain.UserID(uuid.NewString()),
+		Name:     domain.UserName("user-" + uuid.NewString()),
+		Password: "password",
+	}
+}
+
+// requireListed checks whether GetUsers lists the user, only the id and
+// name are compared as listing is used to walk over users.
+func requireListed(t *testing.T, repo port.UserRepository, user domain.User, listed bool) {
+	users, err := repo.GetUsers(context.Background())
+	require.NoError(t, err)
+	found := false
+	for _, actual := range users {
+		if actual.ID == user.ID {
+			require.Equal(t, user.Name, actual.Name)
+			found = true
+		}
+	}
+	require.Equal(t, listed, found)
+}
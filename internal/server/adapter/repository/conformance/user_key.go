@@ -0,0 +1,106 @@
+package conformance
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUserKeyRepository runs the suite against repositories made by newRepo.
+// newRepo closes the repository in the cleanup of t.
+func TestUserKeyRepository(t *testing.T, newRepo func(t *testing.T) port.UserKeyRepository) {
+	t.Run("RoundTrip", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		userID, other := newUserID(), newUserID()
+		_, err := repo.GetUserKey(ctx, userID)
+		require.Equal(t, domain.ErrNotFound, err)
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceUserKey(ctx, userID, nil, []byte("key")))
+		require.NoError(t, repo.DeleteUserKey(ctx, userID))
+
+		require.NoError(t, repo.CreateUserKey(ctx, userID, []byte("key")))
+		require.NoError(t, repo.CreateUserKey(ctx, other, []byte("other key")))
+		// the stored key is kept
+		require.NoError(t, repo.CreateUserKey(ctx, userID, []byte("second key")))
+		requireUserKey(t, repo, userID, []byte("key"))
+
+		require.Equal(t, domain.ErrNotFound, repo.ReplaceUserKey(ctx, userID, []byte("second key"), []byte("new key")))
+		require.NoError(t, repo.ReplaceUserKey(ctx, userID, []byte("key"), []byte("new key")))
+		requireUserKey(t, repo, userID, []byte("new key"))
+
+		require.NoError(t, repo.DeleteUserKey(ctx, userID))
+		_, err = repo.GetUserKey(ctx, userID)
+		require.Equal(t, domain.ErrNotFound, err)
+		requireUserKey(t, repo, other, []byte("other key"))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		repo := newRepo(t)
+		ctx := context.Background()
+		userID := newUserID()
+		errs := make([]error, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errs[i] = repo.CreateUserKey(ctx, userID, []byte(uuid.NewString()))
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			require.NoError(t, err)
+		}
+		key, err := repo.GetUserKey(ctx, userID)
+		require.NoError(t, err)
+
+		// one of the writers seeing the same key wins
+		replaced := make([]bool, concurrency)
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := repo.ReplaceUserKey(ctx, userID, key, []byte(uuid.NewString()))
+				replaced[i] = err == nil
+				if err != nil && err != domain.ErrNotFound {
+					errs[i] = err
+				}
+			}(i)
+		}
+		wg.Wait()
+		count := 0
+		for i := range replaced {
+			require.NoError(t, errs[i])
+			if replaced[i] {
+				count++
+			}
+		}
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		repo := newRepo(t)
+		userID := newUserID()
+		require.NoError(t, repo.CreateUserKey(context.Background(), userID, []byte("key")))
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := repo.GetUserKey(ctx, userID)
+		require.ErrorIs(t, err, context.Canceled)
+		require.ErrorIs(t, repo.CreateUserKey(ctx, newUserID(), []byte("key")), context.Canceled)
+		require.ErrorIs(t, repo.ReplaceUserKey(ctx, userID, []byte("key"), []byte("new key")), context.Canceled)
+		require.ErrorIs(t, repo.DeleteUserKey(ctx, userID), context.Canceled)
+		requireUserKey(t, repo, userID, []byte("key"))
+	})
+}
+
+func requireUserKey(t *testing.T, repo port.UserKeyRepository, userID domain.UserID, expected []byte) {
+	key, err := repo.GetUserKey(context.Background(), userID)
+	require.NoError(t, err)
+	require.Equal(t, expected, key)
+}
@@ -0,0 +1,183 @@
+package repositry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+var (
+	ErrAuditLogReadOnly = errors.New("audit log is opened read-only")
+	errPageFull         = errors.New("page is full")
+)
+
+// AuditLog keeps audit events as JSON lines in a file opened for append
+// only, every event is synced to disk before it is acknowledged.
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	last *domain.AuditEvent
+}
+
+// NewAuditLog opens the log for appending. A line left without its newline
+// by an interrupted write was never acknowledged, it is cut off.
+func NewAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		log.Err(err).Msgf("failed to open audit log '%s'", path)
+		return nil, err
+	}
+	al := &AuditLog{path: path, file: file}
+	size, err := al.readLast(context.Background())
+	if err != nil {
+		file.Close()
+		log.Err(err).Msgf("failed to read audit log '%s'", path)
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		log.Err(err).Msgf("failed to stat audit log '%s'", path)
+		return nil, err
+	}
+	if info.Size() > size {
+		log.Warn().Msgf("cutting off %d bytes of torn entry from audit log '%s'", info.Size()-size, path)
+		err = file.Truncate(size)
+		if err == nil {
+			err = file.Sync()
+		}
+		if err != nil {
+			file.Close()
+			log.Err(err).Msgf("failed to truncate audit log '%s'", path)
+			return nil, err
+		}
+	}
+	return al, nil
+}
+
+// OpenAuditLog opens the log for reading only, so it can be checked while the
+// server keeps writing. Append fails with ErrAuditLogReadOnly.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	al := &AuditLog{path: path}
+	if _, err := al.readLast(context.Background()); err != nil {
+		log.Err(err).Msgf("failed to read audit log '%s'", path)
+		return nil, err
+	}
+	return al, nil
+}
+
+// readLast remembers the newest event and returns size of the complete lines.
+func (al *AuditLog) readLast(ctx context.Context) (int64, error) {
+	return al.walk(ctx, func(event domain.AuditEvent) error {
+		al.last = &event
+		return nil
+	})
+}
+
+func (al *AuditLog) Append(ctx context.Context, event domain.AuditEvent) error {
+	if al.file == nil {
+		return ErrAuditLogReadOnly
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	_, err = al.file.Write(append(line, '\n'))
+	if err != nil {
+		log.Err(err).Msg("failed to write audit event")
+		return err
+	}
+	err = al.file.Sync()
+	if err != nil {
+		log.Err(err).Msg("failed to sync audit log")
+		return err
+	}
+	al.last = &event
+	return nil
+}
+
+func (al *AuditLog) Last(ctx context.Context) (domain.AuditEvent, error) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.last == nil {
+		return domain.AuditEvent{}, domain.ErrNotFound
+	}
+	return *al.last, nil
+}
+
+// ListByUser returns at most limit events of the user following the entry
+// after, the log is read through but only the page is kept.
+func (al *AuditLog) ListByUser(ctx context.Context, userID domain.UserID, after uint64, limit int) ([]domain.AuditEvent, error) {
+	var events []domain.AuditEvent
+	err := al.Walk(ctx, func(event domain.AuditEvent) error {
+		if event.Seq > after && event.UserID == userID {
+			events = append(events, event)
+			if len(events) == limit {
+				return errPageFull
+			}
+		}
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (al *AuditLog) Walk(ctx context.Context, fn func(event domain.AuditEvent) error) error {
+	_, err := al.walk(ctx, fn)
+	return err
+}
+
+// walk calls fn for every complete line and returns their size. The line
+// being written, or torn by a crash, has no newline yet and is skipped.
+func (al *AuditLog) walk(ctx context.Context, fn func(event domain.AuditEvent) error) (int64, error) {
+	file, err := os.Open(al.path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var size int64
+	reader := bufio.NewReader(file)
+	for {
+		if err := ctx.Err(); err != nil {
+			return size, err
+		}
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != nil {
+			return size, err
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			var event domain.AuditEvent
+			if err := json.Unmarshal(line, &event); err != nil {
+				return size, err
+			}
+			if err := fn(event); err != nil {
+				return size, err
+			}
+		}
+		size += int64(len(line))
+	}
+}
+
+func (al *AuditLog) Close() {
+	if al.file != nil {
+		al.file.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package repositry
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	path := "./test_audit_log"
+	defer os.Remove(path)
+	ctx := context.Background()
+	auditLog, err := NewAuditLog(path)
+	require.NoError(t, err)
+	_, err = auditLog.Last(ctx)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	first := domain.AuditEvent{Seq: 1, Time: time.Now().UTC(), Action: domain.AuditLogin, UserID: "id", Hash: []byte("1")}
+	second := domain.AuditEvent{Seq: 2, Time: time.Now().UTC(), Action: domain.AuditGet, UserID: "other", PrevHash: []byte("1"), Hash: []byte("2")}
+	require.NoError(t, auditLog.Append(ctx, first))
+	require.NoError(t, auditLog.Append(ctx, second))
+	auditLog.Close()
+
+	auditLog, err = NewAuditLog(path)
+	require.NoError(t, err)
+	defer auditLog.Close()
+	last, err := auditLog.Last(ctx)
+	require.NoError(t, err)
+	require.Equal(t, second, last)
+	events, err := auditLog.ListByUser(ctx, "id", 0, 10)
+	require.NoError(t, err)
+	require.Equal(t, []domain.AuditEvent{first}, events)
+	events, err = auditLog.ListByUser(ctx, "id", 1, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestAuditLog_Page(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx := context.Background()
+	auditLog, err := NewAuditLog(path)
+	require.NoError(t, err)
+	defer auditLog.Close()
+	for seq := uint64(1); seq <= 5; seq++ {
+		require.NoError(t, auditLog.Append(ctx, domain.AuditEvent{Seq: seq, UserID: "id"}))
+	}
+
+	events, err := auditLog.ListByUser(ctx, "id", 1, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, uint64(2), events[0].Seq)
+	require.Equal(t, uint64(3), events[1].Seq)
+}
+
+func TestAuditLog_TornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	ctx := context.Background()
+	auditLog, err := NewAuditLog(path)
+	require.NoError(t, err)
+	first := domain.AuditEvent{Seq: 1, UserID: "id", Hash: []byte("1")}
+	require.NoError(t, auditLog.Append(ctx, first))
+	auditLog.Close()
+	intact, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2,"user_id":"i`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	// the read-only log skips the entry being written and leaves the file alone
+	readOnly, err := OpenAuditLog(path)
+	require.NoError(t, err)
+	last, err := readOnly.Last(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, last)
+	require.Equal(t, ErrAuditLogReadOnly, readOnly.Append(ctx, domain.AuditEvent{Seq: 2}))
+	readOnly.Close()
+	_, err = OpenAuditLog(filepath.Join(t.TempDir(), "missing.log"))
+	require.Error(t, err)
+
+	auditLog, err = NewAuditLog(path)
+	require.NoError(t, err)
+	defer auditLog.Close()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, intact, data)
+	second := domain.AuditEvent{Seq: 2, UserID: "id", PrevHash: []byte("1"), Hash: []byte("2")}
+	require.NoError(t, auditLog.Append(ctx, second))
+	events, err := auditLog.ListByUser(ctx, "id", 0, 10)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, second, events[1])
+
+	// a broken entry followed by others is not a torn write
+	require.NoError(t, os.WriteFile(path, append([]byte("{broken\n"), intact...), 0600))
+	_, err = NewAuditLog(path)
+	require.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package repositry
+
+import (
+	"bufio"
+	"context"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// RotationCheckpoint stores identifiers of rotated users, one per line.
+type RotationCheckpoint struct {
+	file *os.File
+	done map[domain.UserID]struct{}
+}
+
+func NewRotationCheckpoint(path string) (*RotationCheckpoint, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		log.Err(err).Msgf("failed to open rotation checkpoint '%s'", path)
+		return nil, err
+	}
+
+	done := make(map[domain.UserID]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Text()) > 0 {
+			done[domain.UserID(scanner.Text())] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		log.Err(err).Msgf("failed to read rotation checkpoint '%s'", path)
+		return nil, err
+	}
+	return &RotationCheckpoint{file: file, done: done}, nil
+}
+
+func (rc *RotationCheckpoint) IsDone(ctx context.Context, userID domain.UserID) (bool, error) {
+	_, ok := rc.done[userID]
+	return ok, nil
+}
+
+func (rc *RotationCheckpoint) MarkDone(ctx context.Context, userID domain.UserID) error {
+	_, err := rc.file.WriteString(string(userID) + "\n")
+	if err != nil {
+		return err
+	}
+	err = rc.file.Sync()
+	if err != nil {
+		return err
+	}
+	rc.done[userID] = struct{}{}
+	return nil
+}
+
+func (rc *RotationCheckpoint) Close() {
+	rc.file.Close()
+}
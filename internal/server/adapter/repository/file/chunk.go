@@ -0,0 +1,212 @@
+package repositry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// Chunks of a user are kept in <user>/.chunks/<chunk id>, next to the data
+// there is the number of items referencing the chunk. Chunked items list
+// their chunks in the chunks file of the item directory.
+const (
+	chunksDir  = ".chunks"
+	chunksFile = "chunks"
+)
+
+func (ks *KeeperRepository) chunkPath(userID domain.UserID, id domain.ChunkID) string {
+	return ks.userPath(userID) + "/" + chunksDir + "/" + id.String()
+}
+
+// lockChunks serializes reference counting of chunks of the user.
+func (ks *KeeperRepository) lockChunks(userID domain.UserID) func() {
+	return ks.chunkLocks.lock(string(userID))
+}
+
+func (ks *KeeperRepository) RefChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) (bool, error) {
+	defer ks.lockChunks(userID)()
+	refs, err := readRefs(ks.chunkPath(userID, id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		log.Err(err).Msgf("Failed to read references of chunk '%s'", id)
+		return false, err
+	}
+	return true, writeRefs(ks.chunkPath(userID, id), refs+1)
+}
+
+func (ks *KeeperRepository) PutChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error {
+	defer ks.lockChunks(userID)()
+	chunkPath := ks.chunkPath(userID, id)
+	refs, err := readRefs(chunkPath)
+	if err == nil {
+		return writeRefs(chunkPath, refs+1)
+	}
+	if !os.IsNotExist(err) {
+		log.Err(err).Msgf("Failed to read references of chunk '%s'", id)
+		return err
+	}
+
+	err = os.MkdirAll(chunkPath, dirPerm)
+	if err != nil {
+		log.Err(err).Msgf("Failed to create directory '%s'", chunkPath)
+		return err
+	}
+	err = writeFileAtomic(chunkPath+"/data", data)
+	if err != nil {
+		log.Err(err).Msgf("Failed to write chunk '%s'", chunkPath)
+		os.RemoveAll(chunkPath)
+		return err
+	}
+	// the chunk exists once it has references
+	return writeRefs(chunkPath, 1)
+}
+
+func (ks *KeeperRepository) ReleaseChunks(ctx context.Context, userID domain.UserID, ids []domain.ChunkID) error {
+	defer ks.lockChunks(userID)()
+	for _, id := range ids {
+		chunkPath := ks.chunkPath(userID, id)
+		refs, err := readRefs(chunkPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			log.Err(err).Msgf("Failed to read references of chunk '%s'", id)
+			return err
+		}
+		if refs > 1 {
+			err = writeRefs(chunkPath, refs-1)
+		} else {
+			// chunk without references is gone even if removal is interrupted
+			err = os.Remove(chunkPath + "/refs")
+			if err == nil {
+				err = os.RemoveAll(chunkPath)
+			}
+		}
+		if err != nil {
+			log.Err(err).Msgf("Failed to release chunk '%s'", chunkPath)
+			return err
+		}
+	}
+	return nil
+}
+
+func (ks *KeeperRepository) GetChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) ([]byte, error) {
+	data, err := os.ReadFile(ks.chunkPath(userID, id) + "/data")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, domain.ErrNotFound
+		}
+		log.Err(err).Msgf("Failed to read chunk '%s'", id)
+		return nil, err
+	}
+	return data, nil
+}
+
+func (ks *KeeperRepository) ListChunks(ctx context.Context, userID domain.UserID) ([]domain.ChunkID, error) {
+	entries, err := os.ReadDir(ks.userPath(userID) + "/" + chunksDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		log.Err(err).Msg("Failed to read chunks dir")
+		return nil, err
+	}
+	ids := make([]domain.ChunkID, 0, len(entries))
+	for _, entry := range entries {
+		id, err := domain.ParseChunkID(entry.Name())
+		if err != nil {
+			log.Warn().Msgf("unexpected entry '%s' in chunks of user '%s'", entry.Name(), userID)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (ks *KeeperRepository) ReplaceChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error {
+	defer ks.lockChunks(userID)()
+	chunkPath := ks.chunkPath(userID, id)
+	if _, err := readRefs(chunkPath); err != nil {
+		if os.IsNotExist(err) {
+			return domain.ErrNotFound
+		}
+		return err
+	}
+	err := writeFileAtomic(chunkPath+"/data", data)
+	if err != nil {
+		log.Err(err).Msgf("Failed to write chunk '%s'", chunkPath)
+		return err
+	}
+	return nil
+}
+
+func (ks *KeeperRepository) SetChunked(ctx context.Context, dataCtx domain.DataContext, data []byte, chunks []domain.ChunkID) error {
+	// an empty file is chunked too
+	if chunks == nil {
+		chunks = []domain.ChunkID{}
+	}
+	replaced, err := ks.write(dataCtx, bytes.NewReader(data), chunks)
+	if err != nil {
+		return err
+	}
+	return ks.ReleaseChunks(ctx, dataCtx.UserID, replaced)
+}
+
+func (ks *KeeperRepository) GetChunks(ctx context.Context, dataCtx domain.DataContext) ([]domain.ChunkID, error) {
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	defer ks.rlockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+	ids, err := readChunkList(dataPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, domain.ErrNotFound
+		}
+		log.Err(err).Msgf("Failed to read chunk list '%s'", dataPath)
+		return nil, err
+	}
+	return ids, nil
+}
+
+func readChunkList(dataPath string) ([]domain.ChunkID, error) {
+	file, err := os.Open(dataPath + "/" + chunksFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ids []domain.ChunkID
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		id, err := domain.ParseChunkID(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, scanner.Err()
+}
+
+func readRefs(chunkPath string) (int, error) {
+	data, err := os.ReadFile(chunkPath + "/refs")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+func writeRefs(chunkPath string, refs int) error {
+	err := writeFileAtomic(chunkPath+"/refs", []byte(strconv.Itoa(refs)))
+	if err != nil {
+		log.Err(err).Msgf("Failed to write references of chunk '%s'", chunkPath)
+	}
+	return err
+}
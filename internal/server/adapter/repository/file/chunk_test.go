@@ -0,0 +1,100 @@
+package repositry
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"testing"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeeperRepository_Chunks(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+	first := domain.ChunkID(sha256.Sum256([]byte("first")))
+	second := domain.ChunkID(sha256.Sum256([]byte("second")))
+
+	stored, err := repo.RefChunk(ctx, "user", first)
+	require.NoError(t, err)
+	require.False(t, stored)
+	require.NoError(t, repo.PutChunk(ctx, "user", first, []byte("first chunk")))
+	require.NoError(t, repo.PutChunk(ctx, "user", second, []byte("second chunk")))
+	item := domain.DataContext{ID: testID, UserID: "user", Type: domain.BinaryType}
+	require.NoError(t, repo.SetChunked(ctx, item, []byte("manifest"), []domain.ChunkID{first, second}))
+
+	// the second item shares the first chunk
+	stored, err = repo.RefChunk(ctx, "user", first)
+	require.NoError(t, err)
+	require.True(t, stored)
+	copied := domain.DataContext{ID: otherID, UserID: "user", Type: domain.BinaryType}
+	require.NoError(t, repo.SetChunked(ctx, copied, []byte("manifest"), []domain.ChunkID{first}))
+
+	ids, err := repo.GetChunks(ctx, item)
+	require.NoError(t, err)
+	require.Equal(t, []domain.ChunkID{first, second}, ids)
+	ids, err = repo.ListChunks(ctx, "user")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []domain.ChunkID{first, second}, ids)
+	items, err := repo.GetAllData(ctx, "user")
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	data, err := repo.GetData(ctx, item)
+	require.NoError(t, err)
+	require.Equal(t, []byte("manifest"), data)
+
+	// chunks of other users are not shared
+	stored, err = repo.RefChunk(ctx, "other", first)
+	require.NoError(t, err)
+	require.False(t, stored)
+	_, err = repo.GetChunk(ctx, "other", first)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, repo.Delete(ctx, item))
+	data, err = repo.GetChunk(ctx, "user", first)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first chunk"), data)
+	_, err = repo.GetChunk(ctx, "user", second)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, repo.ReplaceChunk(ctx, "user", first, []byte("rewrapped")))
+	require.Equal(t, domain.ErrNotFound, repo.ReplaceChunk(ctx, "user", second, []byte("rewrapped")))
+
+	// item replaced with plain data releases its chunks
+	require.NoError(t, repo.Set(ctx, copied, []byte("data")))
+	_, err = repo.GetChunks(ctx, copied)
+	require.Equal(t, domain.ErrNotFound, err)
+	ids, err = repo.ListChunks(ctx, "user")
+	require.NoError(t, err)
+	require.Empty(t, ids)
+}
+
+func TestKeeperRepository_ChunkReferences(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+	id := domain.ChunkID(sha256.Sum256([]byte("chunk")))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stored, err := repo.RefChunk(ctx, "user", id)
+			require.NoError(t, err)
+			if !stored {
+				require.NoError(t, repo.PutChunk(ctx, "user", id, []byte("chunk")))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < 19; i++ {
+		require.NoError(t, repo.ReleaseChunks(ctx, "user", []domain.ChunkID{id}))
+	}
+	_, err := repo.GetChunk(ctx, "user", id)
+	require.NoError(t, err)
+	require.NoError(t, repo.ReleaseChunks(ctx, "user", []domain.ChunkID{id}))
+	_, err = repo.GetChunk(ctx, "user", id)
+	require.Equal(t, domain.ErrNotFound, err)
+}
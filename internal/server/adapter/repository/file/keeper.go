@@ -5,29 +5,77 @@ import (
 	"context"
 	"encoding/gob"
 	"errors"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
 
+const (
+	dirPerm  = 0700
+	filePerm = 0600
+	// stagingDir of a user holds items being written, an item is moved in
+	// place once all its files are synced.
+	stagingDir = ".staging"
+	// trashDir holds removed items and users until they are deleted.
+	trashDir = ".trash"
+)
+
 type KeeperRepository struct {
 	storagePath string
+	// itemLocks holds locks of items in use, chunkLocks chunk locks of users.
+	itemLocks  keyedLocks
+	chunkLocks keyedLocks
 }
 
 func NewKeeper() (*KeeperRepository, error) {
 	storagePath := "./keeper_storage"
-	err := os.Mkdir(storagePath, os.ModePerm)
+	err := os.Mkdir(storagePath, dirPerm)
 	if err != nil && !errors.Is(err, os.ErrExist) {
 		log.Err(err).Msg("Failed to create repository")
 		return nil, err
 	}
-	return &KeeperRepository{storagePath: storagePath}, nil
+	// storage created by older versions is readable by everyone
+	err = os.Chmod(storagePath, dirPerm)
+	if err != nil {
+		log.Err(err).Msg("Failed to set repository permissions")
+		return nil, err
+	}
+	ks := &KeeperRepository{storagePath: storagePath}
+	err = ks.recoverStorage()
+	if err != nil {
+		log.Err(err).Msg("Failed to recover repository")
+		return nil, err
+	}
+	return ks, nil
+}
+
+func (ks *KeeperRepository) userPath(userID domain.UserID) string {
+	return ks.storagePath + "/" + string(userID)
+}
+
+func (ks *KeeperRepository) itemPath(userID domain.UserID, id domain.DataID) string {
+	return ks.userPath(userID) + "/" + string(id)
+}
+
+// lockItem takes lock of item for writing and returns its unlock.
+func (ks *KeeperRepository) lockItem(userID domain.UserID, id domain.DataID) func() {
+	return ks.itemLocks.lock(string(userID) + "/" + string(id))
+}
+
+// rlockItem takes lock of item for reading and returns its unlock.
+func (ks *KeeperRepository) rlockItem(userID domain.UserID, id domain.DataID) func() {
+	return ks.itemLocks.rlock(string(userID) + "/" + string(id))
 }
 
 func (ks *KeeperRepository) GetAllData(ctx context.Context, userID domain.UserID) ([]domain.DataContext, error) {
-	userPath := ks.storagePath + "/" + string(userID)
-	entries, err := os.ReadDir(userPath)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(ks.userPath(userID))
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil, domain.ErrNotFound
@@ -37,25 +85,114 @@ func (ks *KeeperRepository) GetAllData(ctx context.Context, userID domain.UserID
 	}
 	var result []domain.DataContext
 	for _, entry := range entries {
-		if entry.IsDir() {
-			meta, err := ks.GetMeta(ctx, userID, domain.DataID(entry.Name()))
-			if err != nil {
+		// chunks and staged items are kept in hidden directories
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if !domain.DataID(entry.Name()).IsValid() {
+			log.Warn().Msgf("unexpected entry '%s' in items of user '%s'", entry.Name(), userID)
+			continue
+		}
+		meta, err := ks.GetMeta(ctx, userID, domain.DataID(entry.Name()))
+		if err != nil {
+			// removed or being replaced after the directory was read
+			if err != domain.ErrNotFound {
 				log.Err(err).Msgf("failed to get meta '%s'", entry.Name())
 			}
-			result = append(result, meta)
+			continue
 		}
+		result = append(result, meta)
+	}
+	if len(result) == 0 {
+		return nil, domain.ErrNotFound
 	}
-
 	return result, nil
 }
 
 func (ks *KeeperRepository) Set(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
-	dataPath := ks.storagePath + "/" + string(dataCtx.UserID) + "/" + string(dataCtx.ID)
-	err := os.MkdirAll(dataPath, os.ModePerm)
-	if err != nil && err != os.ErrExist {
-		log.Err(err).Msgf("Failed to create directory '%s'", dataPath)
+	return ks.SetStream(ctx, dataCtx, bytes.NewReader(data))
+}
+
+// SetStream copies src into the data file, so files of any size are written
+// without holding them in memory. Chunks of the replaced item are released.
+func (ks *KeeperRepository) SetStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	replaced, err := ks.write(dataCtx, src, nil)
+	if err != nil {
 		return err
 	}
+	return ks.ReleaseChunks(ctx, dataCtx.UserID, replaced)
+}
+
+// write stores item in a staging directory and swaps it with the previous
+// version, so after a crash the item is either version whole. Not nil chunks
+// are written as chunk list of the item. It returns chunk list of the
+// replaced version.
+func (ks *KeeperRepository) write(dataCtx domain.DataContext, src io.Reader, chunks []domain.ChunkID) ([]domain.ChunkID, error) {
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	defer ks.lockItem(dataCtx.UserID, dataCtx.ID)()
+	return ks.writeLocked(dataCtx, src, chunks)
+}
+
+// writeLocked is write for the caller holding lock of the item.
+func (ks *KeeperRepository) writeLocked(dataCtx domain.DataContext, src io.Reader, chunks []domain.ChunkID) ([]domain.ChunkID, error) {
+	stagingPath := ks.userPath(dataCtx.UserID) + "/" + stagingDir
+	err := os.MkdirAll(stagingPath, dirPerm)
+	if err != nil {
+		log.Err(err).Msgf("Failed to create directory '%s'", stagingPath)
+		return nil, err
+	}
+	staged, err := os.MkdirTemp(stagingPath, string(dataCtx.ID)+".")
+	if err != nil {
+		log.Err(err).Msgf("Failed to create directory '%s'", stagingPath)
+		return nil, err
+	}
+	err = stage(staged, dataCtx, src, chunks)
+	if err != nil {
+		log.Err(err).Msgf("Failed to write item '%s'", staged)
+		// an interrupted upload must not stay listed
+		if err := os.RemoveAll(staged); err != nil {
+			log.Err(err).Msgf("Failed to remove incomplete item '%s'", staged)
+		}
+		return nil, err
+	}
+
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+	replaced, err := readChunkList(dataPath)
+	if err == nil || os.IsNotExist(err) {
+		err = swapDir(staged, dataPath)
+	}
+	if err != nil {
+		log.Err(err).Msgf("Failed to replace item '%s'", dataPath)
+		if err := os.RemoveAll(staged); err != nil {
+			log.Err(err).Msgf("Failed to remove staged item '%s'", staged)
+		}
+		return nil, err
+	}
+	return replaced, nil
+}
+
+// stage writes files of item into empty directory, meta goes last.
+func stage(dir string, dataCtx domain.DataContext, src io.Reader, chunks []domain.ChunkID) error {
+	err := writeFile(dir+"/data", src)
+	if err != nil {
+		return err
+	}
+	if chunks != nil {
+		var list strings.Builder
+		for _, id := range chunks {
+			list.WriteString(id.String())
+			list.WriteByte('\n')
+		}
+		err = writeFile(dir+"/"+chunksFile, strings.NewReader(list.String()))
+		if err != nil {
+			return err
+		}
+	}
 
 	var metaBuf bytes.Buffer
 	encoder := gob.NewEncoder(&metaBuf)
@@ -64,23 +201,126 @@ func (ks *KeeperRepository) Set(ctx context.Context, dataCtx domain.DataContext,
 		log.Err(err).Msg("Failed to encode data context")
 		return err
 	}
-
-	err = os.WriteFile(dataPath+"/meta", metaBuf.Bytes(), os.ModePerm)
+	err = writeFile(dir+"/meta", &metaBuf)
 	if err != nil {
-		log.Err(err).Msgf("Failed to write meta '%s'", dataPath)
 		return err
 	}
+	return syncDir(dir)
+}
 
-	err = os.WriteFile(dataPath+"/data", data, os.ModePerm)
+// swapDir moves staged directory to path. The previous directory is moved
+// aside next to staged one first and removed once the new one is in place.
+func swapDir(staged, path string) error {
+	old := staged + oldSuffix
+	err := os.Rename(path, old)
+	replaced := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = os.Rename(staged, path)
 	if err != nil {
-		log.Err(err).Msgf("Failed to write file '%s'", dataPath)
+		if replaced {
+			if err := os.Rename(old, path); err != nil {
+				log.Err(err).Msgf("Failed to restore item '%s'", path)
+			}
+		}
 		return err
 	}
+	err = syncDir(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	if replaced {
+		if err := os.RemoveAll(old); err != nil {
+			log.Err(err).Msgf("Failed to remove replaced item '%s'", old)
+		}
+	}
 	return nil
 }
 
+// writeFile creates file with content of src and syncs it.
+func writeFile(path string, src io.Reader) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, src)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeFileAtomic replaces file with data, readers and crashes see either
+// the previous or the new content.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes renames and new entries of directory durable.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// remove moves path to trash and deletes it there, so a crash never leaves
+// it half removed.
+func (ks *KeeperRepository) remove(path string) error {
+	trashPath := ks.storagePath + "/" + trashDir
+	err := os.MkdirAll(trashPath, dirPerm)
+	if err != nil {
+		return err
+	}
+	trash, err := os.MkdirTemp(trashPath, "")
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path, trash+"/"+filepath.Base(path))
+	if err != nil && !os.IsNotExist(err) {
+		os.Remove(trash)
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
 func (ks *KeeperRepository) GetData(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
-	dataPath := ks.storagePath + "/" + string(dataCtx.UserID) + "/" + string(dataCtx.ID)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	defer ks.rlockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
 
 	data, err := os.ReadFile(dataPath + "/data")
 	if err != nil {
@@ -93,9 +333,120 @@ func (ks *KeeperRepository) GetData(ctx context.Context, dataCtx domain.DataCont
 	return data, err
 }
 
+// ReplaceData compares and writes data holding lock of the item. Meta and
+// chunk list are written again as they are, references are kept.
+func (ks *KeeperRepository) ReplaceData(ctx context.Context, dataCtx domain.DataContext, old, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	defer ks.lockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+
+	current, err := os.ReadFile(dataPath + "/data")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return domain.ErrNotFound
+		}
+		log.Err(err).Msgf("Failed to get data '%s'", dataPath)
+		return err
+	}
+	if !bytes.Equal(current, old) {
+		return domain.ErrNotFound
+	}
+	return ks.rewriteLocked(dataPath, bytes.NewReader(data))
+}
+
+// ReplaceHead compares the head of the data file holding lock of the item
+// and writes the item again with the rest of the file copied behind head.
+func (ks *KeeperRepository) ReplaceHead(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	defer ks.lockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+
+	file, err := os.Open(dataPath + "/data")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return domain.ErrNotFound
+		}
+		log.Err(err).Msgf("Failed to get data '%s'", dataPath)
+		return err
+	}
+	defer file.Close()
+	current := make([]byte, len(old))
+	_, err = io.ReadFull(file, current)
+	if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && !bytes.Equal(current, old)) {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		log.Err(err).Msgf("Failed to get data '%s'", dataPath)
+		return err
+	}
+	return ks.rewriteLocked(dataPath, io.MultiReader(bytes.NewReader(head), file))
+}
+
+// rewriteLocked writes item at dataPath again with data read from src, meta
+// and chunk list are written again as they are, references are kept.
+func (ks *KeeperRepository) rewriteLocked(dataPath string, src io.Reader) error {
+	meta, err := readMeta(dataPath)
+	if err != nil {
+		return err
+	}
+	chunks, err := readChunkList(dataPath)
+	switch {
+	case err == nil && chunks == nil:
+		chunks = []domain.ChunkID{}
+	case os.IsNotExist(err):
+	case err != nil:
+		log.Err(err).Msgf("Failed to read chunk list '%s'", dataPath)
+		return err
+	}
+	_, err = ks.writeLocked(meta, src, chunks)
+	return err
+}
+
+// GetStream returns open data file, it stays readable when the item is
+// replaced or deleted meanwhile.
+func (ks *KeeperRepository) GetStream(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	defer ks.rlockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+
+	file, err := os.Open(dataPath + "/data")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, domain.ErrNotFound
+		}
+		log.Err(err).Msgf("Failed to get data '%s'", dataPath)
+		return nil, err
+	}
+	return file, nil
+}
+
 func (ks *KeeperRepository) GetMeta(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
-	dataPath := ks.storagePath + "/" + string(userID) + "/" + string(id)
+	if err := ctx.Err(); err != nil {
+		return domain.DataContext{}, err
+	}
+	if !id.IsValid() {
+		return domain.DataContext{}, domain.ErrInvalidDataID
+	}
+	defer ks.rlockItem(userID, id)()
+	return readMeta(ks.itemPath(userID, id))
+}
 
+func readMeta(dataPath string) (domain.DataContext, error) {
 	meta, err := os.Open(dataPath + "/meta")
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -104,6 +455,7 @@ func (ks *KeeperRepository) GetMeta(ctx context.Context, userID domain.UserID, i
 		log.Err(err).Msgf("Failed to get data '%s'", dataPath)
 		return domain.DataContext{}, err
 	}
+	defer meta.Close()
 
 	var dataCtx domain.DataContext
 	encoder := gob.NewDecoder(meta)
@@ -115,12 +467,45 @@ func (ks *KeeperRepository) GetMeta(ctx context.Context, userID domain.UserID, i
 	return dataCtx, nil
 }
 
+func (ks *KeeperRepository) DeleteAll(ctx context.Context, userID domain.UserID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// empty id would remove storage of every user
+	if len(userID) == 0 {
+		return domain.ErrBadRequest
+	}
+	defer ks.lockChunks(userID)()
+	userPath := ks.userPath(userID)
+	err := ks.remove(userPath)
+	if err != nil {
+		log.Err(err).Msgf("failed to remove user data: %s", userPath)
+		return err
+	}
+	return nil
+}
+
+// Delete removes item and releases its chunks.
 func (ks *KeeperRepository) Delete(ctx context.Context, dataCtx domain.DataContext) error {
-	dataPath := ks.storagePath + "/" + string(dataCtx.UserID) + "/" + string(dataCtx.ID)
-	err := os.RemoveAll(dataPath)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	defer ks.lockItem(dataCtx.UserID, dataCtx.ID)()
+	dataPath := ks.itemPath(dataCtx.UserID, dataCtx.ID)
+	chunks, err := readChunkList(dataPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Err(err).Msgf("failed to read chunk list: %s", dataPath)
+		return err
+	}
+	err = ks.remove(dataPath)
 	if err != nil {
 		log.Err(err).Msgf("failed to remove data: %s", dataPath)
 		return err
 	}
-	return nil
+	return ks.ReleaseChunks(ctx, dataCtx.UserID, chunks)
 }
+
+func (ks *KeeperRepository) Close() {}
@@ -2,23 +2,36 @@ package repositry
 
 import (
 	"context"
+	"errors"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
 	"github.com/stretchr/testify/require"
 )
 
+const (
+	testID  domain.DataID = "5f0c6a54-2b7e-4d1a-9c3b-8e2f1a6d4b7c"
+	otherID domain.DataID = "a3d9e1f7-6c2b-4e8a-b5f0-7d1c9e3a2b64"
+)
+
 func TestKeeperRepository(t *testing.T) {
 	err := os.Mkdir("./test_repo", os.ModePerm)
 	defer os.RemoveAll("./test_repo")
 	require.NoError(t, err)
-	repo := KeeperRepository{"./test_repo"}
+	repo := KeeperRepository{storagePath: "./test_repo"}
 	ctx := context.Background()
 	_, err = repo.GetAllData(ctx, domain.UserID("id"))
 	require.Equal(t, domain.ErrNotFound, err)
 	dataCtx := domain.DataContext{
-		ID:     "id",
+		ID:     testID,
 		UserID: "user_id",
 		Meta:   "meta",
 		Title:  "title",
@@ -30,7 +43,7 @@ func TestKeeperRepository(t *testing.T) {
 	actualData, err := repo.GetData(ctx, dataCtx)
 	require.NoError(t, err)
 	require.Equal(t, data, actualData)
-	actualMeta, err := repo.GetMeta(ctx, domain.UserID("user_id"), domain.DataID("id"))
+	actualMeta, err := repo.GetMeta(ctx, domain.UserID("user_id"), testID)
 	require.NoError(t, err)
 	require.Equal(t, dataCtx, actualMeta)
 	expectedData, err := repo.GetAllData(ctx, domain.UserID("user_id"))
@@ -41,4 +54,151 @@ func TestKeeperRepository(t *testing.T) {
 	require.NoError(t, err)
 	_, err = repo.GetData(ctx, dataCtx)
 	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, repo.Set(ctx, dataCtx, data))
+	require.Equal(t, domain.ErrBadRequest, repo.DeleteAll(ctx, ""))
+	require.NoError(t, repo.DeleteAll(ctx, dataCtx.UserID))
+	_, err = repo.GetAllData(ctx, dataCtx.UserID)
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestKeeperRepository_Stream(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+	dataCtx := domain.DataContext{ID: testID, UserID: "user_id", Title: "title", Type: domain.BinaryType}
+
+	require.NoError(t, repo.SetStream(ctx, dataCtx, strings.NewReader("data")))
+	reader, err := repo.GetStream(ctx, dataCtx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, []byte("data"), data)
+
+	// an interrupted upload leaves no item behind
+	broken := domain.DataContext{ID: otherID, UserID: "user_id", Type: domain.BinaryType}
+	src := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))
+	require.Error(t, repo.SetStream(ctx, broken, src))
+	_, err = repo.GetMeta(ctx, broken.UserID, broken.ID)
+	require.Equal(t, domain.ErrNotFound, err)
+	_, err = repo.GetStream(ctx, broken)
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestKeeperRepository_ConcurrentWrites(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		content := strings.Repeat(strconv.Itoa(i), 64<<10)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				dataCtx := domain.DataContext{ID: testID, UserID: "user_id", Title: content[:1], Type: domain.BinaryType}
+				require.NoError(t, repo.Set(ctx, dataCtx, []byte(content)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				dataCtx := domain.DataContext{ID: testID, UserID: "user_id"}
+				data, err := repo.GetData(ctx, dataCtx)
+				if err == domain.ErrNotFound {
+					continue
+				}
+				require.NoError(t, err)
+				// every version is written whole
+				require.Equal(t, strings.Repeat(string(data[:1]), 64<<10), string(data))
+			}
+		}()
+	}
+	wg.Wait()
+
+	meta, err := repo.GetMeta(ctx, "user_id", testID)
+	require.NoError(t, err)
+	data, err := repo.GetData(ctx, meta)
+	require.NoError(t, err)
+	require.Equal(t, meta.Title, string(data[:1]))
+	items, err := repo.GetAllData(ctx, "user_id")
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+}
+
+func TestKeeperRepository_Permissions(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	dataCtx := domain.DataContext{ID: testID, UserID: "user_id", Type: domain.BinaryType}
+	require.NoError(t, repo.Set(context.Background(), dataCtx, []byte("data")))
+
+	for _, path := range []string{"/user_id", "/user_id/" + string(testID)} {
+		info, err := os.Stat(repo.storagePath + path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(dirPerm), info.Mode().Perm(), path)
+	}
+	for _, path := range []string{"/user_id/" + string(testID) + "/meta", "/user_id/" + string(testID) + "/data"} {
+		info, err := os.Stat(repo.storagePath + path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(filePerm), info.Mode().Perm(), path)
+	}
+}
+
+func FuzzKeeperRepository_ID(f *testing.F) {
+	for _, seed := range []string{string(testID), "", ".", "..", "../other", "../../outside", "/", ".staging", ".chunks", "id/../..", "%2e%2e"} {
+		f.Add(seed)
+	}
+	root := f.TempDir()
+	require.NoError(f, os.WriteFile(root+"/outside", []byte("outside"), filePerm))
+	require.NoError(f, os.MkdirAll(root+"/storage/other", dirPerm))
+	require.NoError(f, os.WriteFile(root+"/storage/other/canary", []byte("canary"), filePerm))
+	repo := KeeperRepository{storagePath: root + "/storage"}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		ctx := context.Background()
+		dataCtx := domain.DataContext{ID: domain.DataID(s), UserID: "user", Type: domain.BinaryType}
+		valid := dataCtx.ID.IsValid()
+		check := func(err error) {
+			if !valid {
+				require.Equal(t, domain.ErrInvalidDataID, err)
+			}
+		}
+		check(repo.Set(ctx, dataCtx, []byte("data")))
+		check(repo.SetChunked(ctx, dataCtx, []byte("data"), nil))
+		_, err := repo.GetData(ctx, dataCtx)
+		check(err)
+		_, err = repo.GetStream(ctx, dataCtx)
+		check(err)
+		_, err = repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
+		check(err)
+		_, err = repo.GetChunks(ctx, dataCtx)
+		check(err)
+		check(repo.Delete(ctx, dataCtx))
+
+		// nothing outside of the user root is touched
+		data, err := os.ReadFile(root + "/outside")
+		require.NoError(t, err)
+		require.Equal(t, []byte("outside"), data)
+		data, err = os.ReadFile(root + "/storage/other/canary")
+		require.NoError(t, err)
+		require.Equal(t, []byte("canary"), data)
+		entries, err := os.ReadDir(root)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		entries, err = os.ReadDir(root + "/storage")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.Contains(t, []string{"user", "other", trashDir}, entry.Name())
+		}
+		entries, err = os.ReadDir(root + "/storage/user")
+		require.NoError(t, err)
+		for _, entry := range entries {
+			require.True(t, entry.Name() == stagingDir || domain.DataID(entry.Name()).IsValid(), entry.Name())
+		}
+	})
+}
+
+func TestKeeperRepository_Conformance(t *testing.T) {
+	conformance.TestKeeperRepository(t, func(t *testing.T) port.KeeperRepository {
+		return &KeeperRepository{storagePath: t.TempDir()}
+	})
 }
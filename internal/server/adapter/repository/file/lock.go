@@ -0,0 +1,59 @@
+package repositry
+
+import "sync"
+
+// keyedLocks hands out a lock per key. A lock is dropped once nobody holds or
+// waits for it, so locks of every item ever touched do not pile up.
+type keyedLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	sync.RWMutex
+	refs int
+}
+
+// lock takes lock of key exclusively and returns its unlock.
+func (kl *keyedLocks) lock(key string) func() {
+	lock := kl.acquire(key)
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		kl.release(key, lock)
+	}
+}
+
+// rlock takes lock of key shared with other readers and returns its unlock.
+func (kl *keyedLocks) rlock(key string) func() {
+	lock := kl.acquire(key)
+	lock.RLock()
+	return func() {
+		lock.RUnlock()
+		kl.release(key, lock)
+	}
+}
+
+func (kl *keyedLocks) acquire(key string) *keyedLock {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	if kl.locks == nil {
+		kl.locks = map[string]*keyedLock{}
+	}
+	lock, ok := kl.locks[key]
+	if !ok {
+		lock = &keyedLock{}
+		kl.locks[key] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+func (kl *keyedLocks) release(key string, lock *keyedLock) {
+	kl.mu.Lock()
+	defer kl.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(kl.locks, key)
+	}
+}
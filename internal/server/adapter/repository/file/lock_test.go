@@ -0,0 +1,42 @@
+package repositry
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyedLocks(t *testing.T) {
+	var locks keyedLocks
+	unlock := locks.lock("item")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		locks.rlock("item")()
+	}()
+	locks.rlock("other")()
+	unlock()
+	wg.Wait()
+	require.Empty(t, locks.locks)
+}
+
+func TestKeeperRepository_Locks(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		item := domain.DataContext{ID: domain.DataID(uuid.NewString()), UserID: "user", Type: domain.BinaryType}
+		require.NoError(t, repo.Set(ctx, item, []byte("data")))
+		_, err := repo.GetData(ctx, item)
+		require.NoError(t, err)
+		require.NoError(t, repo.SetChunked(ctx, item, []byte("list"), nil))
+		require.NoError(t, repo.Delete(ctx, item))
+	}
+	// locks of items nobody uses are dropped
+	require.Empty(t, repo.itemLocks.locks)
+	require.Empty(t, repo.chunkLocks.locks)
+}
@@ -0,0 +1,174 @@
+package repositry
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+const (
+	// oldSuffix marks previous version of item moved aside by swapDir.
+	oldSuffix = ".old"
+	// quarantineDir keeps incomplete items found at startup for inspection.
+	quarantineDir = ".quarantine"
+)
+
+// recoverStorage finishes writes interrupted by a crash: items moved aside
+// and not replaced are restored, staged and removed items are deleted, and
+// item directories missing files are moved to quarantine.
+func (ks *KeeperRepository) recoverStorage() error {
+	err := os.RemoveAll(ks.storagePath + "/" + trashDir)
+	if err != nil {
+		log.Err(err).Msg("Failed to empty trash")
+		return err
+	}
+	users, err := os.ReadDir(ks.storagePath)
+	if err != nil {
+		log.Err(err).Msg("Failed to read repository")
+		return err
+	}
+	for _, user := range users {
+		if !user.IsDir() || strings.HasPrefix(user.Name(), ".") {
+			continue
+		}
+		err = ks.recoverUser(domain.UserID(user.Name()))
+		if err != nil {
+			log.Err(err).Msgf("Failed to recover items of user '%s'", user.Name())
+			return err
+		}
+	}
+	return nil
+}
+
+func (ks *KeeperRepository) recoverUser(userID domain.UserID) error {
+	userPath := ks.userPath(userID)
+	stagingPath := userPath + "/" + stagingDir
+	staged, err := os.ReadDir(stagingPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range staged {
+		name, old := strings.CutSuffix(entry.Name(), oldSuffix)
+		dot := strings.LastIndexByte(name, '.')
+		if !old || dot < 0 {
+			continue
+		}
+		// the previous version was moved aside before the new one was in place
+		dataPath := ks.itemPath(userID, domain.DataID(name[:dot]))
+		if _, err := os.Stat(dataPath); os.IsNotExist(err) {
+			log.Warn().Msgf("Restoring interrupted write of item '%s'", dataPath)
+			if err := os.Rename(stagingPath+"/"+entry.Name(), dataPath); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.RemoveAll(stagingPath); err != nil {
+		return err
+	}
+
+	items, err := os.ReadDir(userPath)
+	if err != nil {
+		return err
+	}
+	refs := map[domain.ChunkID]int{}
+	for _, item := range items {
+		if !item.IsDir() || strings.HasPrefix(item.Name(), ".") {
+			continue
+		}
+		dataPath := userPath + "/" + item.Name()
+		if isComplete(dataPath) {
+			chunks, _ := readChunkList(dataPath)
+			for _, id := range chunks {
+				refs[id]++
+			}
+			continue
+		}
+		if err := ks.quarantine(userID, dataPath); err != nil {
+			return err
+		}
+	}
+	return ks.recoverChunks(userID, refs)
+}
+
+// isComplete reports whether item has readable meta, data and chunk list.
+func isComplete(dataPath string) bool {
+	if _, err := readMeta(dataPath); err != nil {
+		return false
+	}
+	if _, err := os.Stat(dataPath + "/data"); err != nil {
+		return false
+	}
+	_, err := readChunkList(dataPath)
+	return err == nil || os.IsNotExist(err)
+}
+
+func (ks *KeeperRepository) quarantine(userID domain.UserID, dataPath string) error {
+	quarantinePath := ks.storagePath + "/" + quarantineDir + "/" + string(userID)
+	err := os.MkdirAll(quarantinePath, dirPerm)
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("%s/%s.%d", quarantinePath, dataPath[strings.LastIndexByte(dataPath, '/')+1:], time.Now().UnixNano())
+	log.Warn().Msgf("Moving incomplete item '%s' to '%s'", dataPath, target)
+	return os.Rename(dataPath, target)
+}
+
+// recoverChunks sets reference count of every chunk to refs, the number of
+// items listing it: a crash between writing an item and updating the counts
+// leaves them off. Chunks no item lists are removed, leftovers of interrupted
+// reference updates go too. Quarantined items do not keep chunks.
+func (ks *KeeperRepository) recoverChunks(userID domain.UserID, refs map[domain.ChunkID]int) error {
+	chunksPath := ks.userPath(userID) + "/" + chunksDir
+	chunks, err := os.ReadDir(chunksPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, chunk := range chunks {
+		chunkPath := chunksPath + "/" + chunk.Name()
+		id, err := domain.ParseChunkID(chunk.Name())
+		if err != nil {
+			log.Warn().Msgf("unexpected entry '%s' in chunks of user '%s'", chunk.Name(), userID)
+			continue
+		}
+		count := refs[id]
+		delete(refs, id)
+		_, dataErr := os.Stat(chunkPath + "/data")
+		if count == 0 || dataErr != nil {
+			log.Warn().Msgf("Removing unreferenced chunk '%s'", chunkPath)
+			if err := os.RemoveAll(chunkPath); err != nil {
+				return err
+			}
+			if count > 0 {
+				log.Error().Msgf("Chunk '%s' listed by %d items has no data", chunkPath, count)
+			}
+			continue
+		}
+
+		files, err := os.ReadDir(chunkPath)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.Name() != "data" && file.Name() != "refs" {
+				if err := os.Remove(chunkPath + "/" + file.Name()); err != nil {
+					return err
+				}
+			}
+		}
+		stored, err := readRefs(chunkPath)
+		if err != nil || stored != count {
+			log.Warn().Msgf("Setting references of chunk '%s' to %d", chunkPath, count)
+			if err := writeRefs(chunkPath, count); err != nil {
+				return err
+			}
+		}
+	}
+	for id, count := range refs {
+		log.Error().Msgf("Chunk '%s' of user '%s' listed by %d items is missing", id, userID, count)
+	}
+	return nil
+}
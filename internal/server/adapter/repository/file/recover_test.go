@@ -0,0 +1,86 @@
+package repositry
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeeperRepository_Recover(t *testing.T) {
+	repo := KeeperRepository{storagePath: t.TempDir()}
+	ctx := context.Background()
+	ids := map[string]domain.DataID{}
+	item := func(name string) domain.DataContext {
+		return domain.DataContext{ID: ids[name], UserID: "user", Title: name, Type: domain.BinaryType}
+	}
+	for _, name := range []string{"complete", "moved", "replaced", "no-data", "no-meta"} {
+		ids[name] = domain.DataID(uuid.NewString())
+		require.NoError(t, repo.Set(ctx, item(name), []byte(name)))
+	}
+	userPath := repo.userPath("user")
+	stagingPath := userPath + "/" + stagingDir
+
+	// crash after the previous version was moved aside
+	require.NoError(t, os.MkdirAll(stagingPath, dirPerm))
+	moved := stagingPath + "/" + string(ids["moved"]) + ".123"
+	require.NoError(t, os.Rename(repo.itemPath("user", ids["moved"]), moved+oldSuffix))
+	require.NoError(t, os.Mkdir(moved, dirPerm))
+	// crash after the new version was moved in place
+	require.NoError(t, os.Mkdir(stagingPath+"/"+string(ids["replaced"])+".456"+oldSuffix, dirPerm))
+	// crash in the middle of writing of the item
+	require.NoError(t, os.Remove(repo.itemPath("user", ids["no-data"])+"/data"))
+	require.NoError(t, os.Remove(repo.itemPath("user", ids["no-meta"])+"/meta"))
+	// crash in the middle of removal
+	require.NoError(t, os.MkdirAll(repo.storagePath+"/"+trashDir+"/1/removed", dirPerm))
+	// crash before the chunk got references
+	unreferenced := domain.ChunkID(sha256.Sum256([]byte("unreferenced")))
+	require.NoError(t, os.MkdirAll(repo.chunkPath("user", unreferenced), dirPerm))
+	require.NoError(t, os.WriteFile(repo.chunkPath("user", unreferenced)+"/data", []byte("chunk"), filePerm))
+	referenced := domain.ChunkID(sha256.Sum256([]byte("referenced")))
+	require.NoError(t, repo.PutChunk(ctx, "user", referenced, []byte("chunk")))
+	require.NoError(t, os.WriteFile(repo.chunkPath("user", referenced)+"/refs.tmp1", []byte("2"), filePerm))
+	// crash after the item listing the chunk was written, the count is short
+	ids["chunked"] = domain.DataID(uuid.NewString())
+	require.NoError(t, repo.SetChunked(ctx, item("chunked"), []byte("list"), []domain.ChunkID{referenced, referenced}))
+	// crash before the released chunk was removed
+	released := domain.ChunkID(sha256.Sum256([]byte("released")))
+	require.NoError(t, repo.PutChunk(ctx, "user", released, []byte("chunk")))
+
+	require.NoError(t, repo.recoverStorage())
+
+	items, err := repo.GetAllData(ctx, "user")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []domain.DataContext{item("complete"), item("moved"), item("replaced"), item("chunked")}, items)
+	data, err := repo.GetData(ctx, item("moved"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("moved"), data)
+	_, err = os.Stat(stagingPath)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(repo.storagePath + "/" + trashDir)
+	require.True(t, os.IsNotExist(err))
+
+	quarantined, err := os.ReadDir(repo.storagePath + "/" + quarantineDir + "/user")
+	require.NoError(t, err)
+	require.Len(t, quarantined, 2)
+
+	chunks, err := repo.ListChunks(ctx, "user")
+	require.NoError(t, err)
+	require.Equal(t, []domain.ChunkID{referenced}, chunks)
+	files, err := os.ReadDir(repo.chunkPath("user", referenced))
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	refs, err := readRefs(repo.chunkPath("user", referenced))
+	require.NoError(t, err)
+	require.Equal(t, 2, refs)
+
+	// the counts are right again, the chunk goes with the item
+	require.NoError(t, repo.Delete(ctx, item("chunked")))
+	chunks, err = repo.ListChunks(ctx, "user")
+	require.NoError(t, err)
+	require.Empty(t, chunks)
+}
@@ -1,11 +1,16 @@
 package repositry
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"hash/crc32"
 	"io"
 	"os"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
@@ -13,62 +18,411 @@ import (
 
 var userStorageFile = "./user_repo"
 
+// journalSuffix names the journal next to the snapshot file.
+const journalSuffix = ".journal"
+
+// compactEvery is the number of journal records after which the journal is
+// folded into the snapshot.
+var compactEvery = 1000
+
+// maxRecordSize bounds length read from a damaged record header.
+const maxRecordSize = 1 << 20
+
+// journalRecord stores user as it is after a change, or removal of the
+// user with the name. Replaying records over a snapshot that already has
+// them gives the same users, so compaction may be interrupted at any point.
+type journalRecord struct {
+	User    domain.User
+	Deleted bool
+}
+
+// UserRepository keeps users in memory. The snapshot file holds users as of
+// the last compaction, every change since then is appended to the journal
+// and synced before it is applied.
 type UserRepository struct {
-	Users    map[domain.UserName]domain.User
-	FilePath string
+	mu      sync.RWMutex
+	users   map[domain.UserName]domain.User
+	path    string
+	journal *os.File
+	// size of the journal and the number of records in it
+	size     int64
+	recorded int
 }
 
 func NewUser(filepath string) (*UserRepository, error) {
 	if len(filepath) == 0 {
 		filepath = userStorageFile
 	}
-	file, err := os.OpenFile(filepath, os.O_APPEND|os.O_RDWR|os.O_CREATE, os.ModePerm)
+	users, err := readSnapshot(filepath)
+	if err != nil {
+		log.Err(err).Msg("failed to read user repository")
+		return nil, err
+	}
+	journal, err := os.OpenFile(filepath+journalSuffix, os.O_APPEND|os.O_RDWR|os.O_CREATE, filePerm)
 	if err != nil {
-		log.Err(err).Msg("failed to open user repository file")
-		return &UserRepository{}, err
+		log.Err(err).Msg("failed to open user repository journal")
+		return nil, err
 	}
 
-	userRepo := UserRepository{FilePath: filepath}
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(&userRepo.Users)
+	us := &UserRepository{users: users, path: filepath, journal: journal}
+	err = us.replay()
+	if err == nil {
+		err = us.compact()
+	}
 	if err != nil {
+		journal.Close()
+		log.Err(err).Msg("failed to recover user repository")
+		return nil, err
+	}
+	return us, nil
+}
+
+func readSnapshot(path string) (map[domain.UserName]domain.User, error) {
+	users := make(map[domain.UserName]domain.User)
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return users, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	err = gob.NewDecoder(file).Decode(&users)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return users, nil
+}
+
+// replay applies journal records over the snapshot. A crash can only leave
+// the last record incomplete or damaged, it is cut off. A torn or damaged
+// record with valid records after it means the journal itself is damaged: a
+// corrupted length can make a record look cut short by the end of the file,
+// but records after it were acknowledged, so the repository refuses to start
+// instead of dropping them.
+func (us *UserRepository) replay() error {
+	reader := bufio.NewReader(us.journal)
+	var offset int64
+	for {
+		record, size, err := readRecord(reader)
 		if err == io.EOF {
-			return &UserRepository{make(map[domain.UserName]domain.User), filepath}, nil
+			return nil
+		}
+		if err == errTornRecord || err == errDamagedRecord {
+			if err := us.checkTail(offset); err != nil {
+				return err
+			}
+			log.Warn().Msgf("user repository journal is cut at offset %d", offset)
+			return us.journal.Truncate(offset)
 		}
-		log.Err(err).Msg("failed to decode user repository")
-		return &UserRepository{}, err
+		if err != nil {
+			return err
+		}
+		us.apply(record)
+		us.recorded++
+		offset += size
+		us.size = offset
+	}
+}
+
+// checkTail fails with ErrJournalDamaged when a valid record follows the
+// torn or damaged one at offset.
+func (us *UserRepository) checkTail(offset int64) error {
+	info, err := us.journal.Stat()
+	if err != nil {
+		return err
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err := us.journal.ReadAt(tail, offset); err != nil {
+		return err
+	}
+	for i := 1; i+8 <= len(tail); i++ {
+		if isRecord(tail[i:]) {
+			log.Error().Msgf("user repository journal is damaged at offset %d, valid records follow at offset %d", offset, offset+int64(i))
+			return ErrJournalDamaged
+		}
+	}
+	return nil
+}
+
+var (
+	ErrJournalDamaged = errors.New("user repository journal is damaged")
+	// errTornRecord is a record cut short by the end of the journal.
+	errTornRecord = errors.New("torn journal record")
+	// errDamagedRecord is a complete record with wrong length or checksum.
+	errDamagedRecord = errors.New("damaged journal record")
+)
+
+func readRecord(reader *bufio.Reader) (journalRecord, int64, error) {
+	var header [8]byte
+	n, err := io.ReadFull(reader, header[:])
+	if err == io.EOF {
+		return journalRecord{}, 0, io.EOF
+	}
+	if err != nil || n != len(header) {
+		return journalRecord{}, 0, errTornRecord
+	}
+	size := binary.BigEndian.Uint32(header[:4])
+	if size > maxRecordSize {
+		return journalRecord{}, 0, errDamagedRecord
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return journalRecord{}, 0, errTornRecord
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return journalRecord{}, 0, errDamagedRecord
+	}
+	var record journalRecord
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&record); err != nil {
+		return journalRecord{}, 0, err
+	}
+	return record, int64(len(header) + len(payload)), nil
+}
+
+// isRecord reports whether data starts with a complete valid record.
+func isRecord(data []byte) bool {
+	size := binary.BigEndian.Uint32(data[:4])
+	if size == 0 || size > maxRecordSize || uint64(len(data)-8) < uint64(size) {
+		return false
+	}
+	payload := data[8 : 8+size]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[4:8]) {
+		return false
+	}
+	var record journalRecord
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(&record) == nil
+}
+
+func (us *UserRepository) apply(record journalRecord) {
+	if record.Deleted {
+		delete(us.users, record.User.Name)
+		return
+	}
+	us.users[record.User.Name] = record.User
+}
+
+// commit appends record to the journal and applies it once it is synced.
+// The caller holds the write lock.
+func (us *UserRepository) commit(record journalRecord) error {
+	var payload bytes.Buffer
+	err := gob.NewEncoder(&payload).Encode(record)
+	if err != nil {
+		log.Err(err).Msg("failed to encode user")
+		return err
+	}
+	frame := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(frame[:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload.Bytes()))
+	frame = append(frame, payload.Bytes()...)
+
+	_, err = us.journal.Write(frame)
+	if err == nil {
+		err = us.journal.Sync()
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to write user repository journal")
+		// a partial record would hide the records appended after it
+		if err := us.journal.Truncate(us.size); err != nil {
+			log.Err(err).Msg("failed to cut user repository journal")
+		}
+		return err
+	}
+	us.apply(record)
+	us.size += int64(len(frame))
+	us.recorded++
+	if us.recorded >= compactEvery {
+		// the change is durable already, compaction is retried later
+		if err := us.compact(); err != nil {
+			log.Err(err).Msg("failed to compact user repository")
+		}
+	}
+	return nil
+}
+
+// compact writes users to a new snapshot and empties the journal. The
+// caller holds the write lock.
+func (us *UserRepository) compact() error {
+	if us.recorded == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(us.users)
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(us.path, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	err = us.journal.Truncate(0)
+	if err == nil {
+		err = us.journal.Sync()
 	}
-	return &userRepo, nil
+	if err != nil {
+		return err
+	}
+	us.size = 0
+	us.recorded = 0
+	return nil
 }
 
 func (us *UserRepository) CreateUser(ctx context.Context, user domain.User) error {
-	if _, ok := us.Users[user.Name]; ok {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if _, ok := us.users[user.Name]; ok {
 		return domain.ErrUserExists
 	}
-	us.Users[user.Name] = user
-	return nil
+	for _, existing := range us.users {
+		if existing.ID == user.ID {
+			return domain.ErrUserExists
+		}
+	}
+	return us.commit(journalRecord{User: user})
 }
 
 func (us *UserRepository) GetUserByName(ctx context.Context, name domain.UserName) (domain.User, error) {
-	user, ok := us.Users[name]
+	if err := ctx.Err(); err != nil {
+		return domain.User{}, err
+	}
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	user, ok := us.users[name]
 	if !ok {
 		return domain.User{}, domain.ErrNotFound
 	}
 	return user, nil
 }
 
-func (us *UserRepository) Close() {
-	var buf bytes.Buffer
-	encoder := gob.NewEncoder(&buf)
-	err := encoder.Encode(us.Users)
-	if err != nil {
-		log.Err(err).Msg("failed to encode user repository")
-		return
+func (us *UserRepository) GetUsers(ctx context.Context) ([]domain.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	us.mu.RLock()
+	defer us.mu.RUnlock()
+	users := make([]domain.User, 0, len(us.users))
+	for _, user := range us.users {
+		users = append(users, user)
 	}
+	return users, nil
+}
 
-	err = os.WriteFile(us.FilePath, buf.Bytes(), os.ModePerm)
-	if err != nil {
-		log.Err(err).Msg("failed to write user repository")
-		return
+// update commits change of user with the id. The caller holds the write
+// lock.
+func (us *UserRepository) update(id domain.UserID, change func(user *domain.User)) error {
+	user, ok := us.userByID(id)
+	if !ok {
+		return domain.ErrNotFound
+	}
+	change(&user)
+	return us.commit(journalRecord{User: user})
+}
+
+func (us *UserRepository) UpdateTwoFactor(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.update(id, func(user *domain.User) {
+		user.TwoFactor = twoFactor
+	})
+}
+
+func (us *UserRepository) UseTwoFactorStep(ctx context.Context, id domain.UserID, step int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	user, ok := us.userByID(id)
+	if !ok || !user.TwoFactor.Enabled || user.TwoFactor.LastStep >= step {
+		return domain.ErrInvalidCode
+	}
+	user.TwoFactor.LastStep = step
+	return us.commit(journalRecord{User: user})
+}
+
+func (us *UserRepository) UseRecoveryCode(ctx context.Context, id domain.UserID, hash []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	user, ok := us.userByID(id)
+	if !ok {
+		return domain.ErrInvalidCode
+	}
+	for i, code := range user.TwoFactor.RecoveryCodes {
+		if bytes.Equal(code, hash) {
+			codes := make([][]byte, 0, len(user.TwoFactor.RecoveryCodes)-1)
+			codes = append(codes, user.TwoFactor.RecoveryCodes[:i]...)
+			user.TwoFactor.RecoveryCodes = append(codes, user.TwoFactor.RecoveryCodes[i+1:]...)
+			return us.commit(journalRecord{User: user})
+		}
+	}
+	return domain.ErrInvalidCode
+}
+
+func (us *UserRepository) ReplaceTwoFactorSecret(ctx context.Context, id domain.UserID, old, secret []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	user, ok := us.userByID(id)
+	if !ok || !bytes.Equal(user.TwoFactor.Secret, old) {
+		return domain.ErrNotFound
+	}
+	user.TwoFactor.Secret = secret
+	return us.commit(journalRecord{User: user})
+}
+
+// userByID returns user with the id. The caller holds the lock.
+func (us *UserRepository) userByID(id domain.UserID) (domain.User, bool) {
+	for _, user := range us.users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+	return domain.User{}, false
+}
+
+func (us *UserRepository) UpdatePassword(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	return us.update(id, func(user *domain.User) {
+		user.Password = password
+		user.VaultKey = vaultKey
+	})
+}
+
+func (us *UserRepository) DeleteUser(ctx context.Context, id domain.UserID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	for _, user := range us.users {
+		if user.ID == id {
+			return us.commit(journalRecord{User: domain.User{Name: user.Name}, Deleted: true})
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (us *UserRepository) Close() {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	if err := us.compact(); err != nil {
+		log.Err(err).Msgf("failed to compact user repository '%s'", us.path)
 	}
+	us.journal.Close()
 }
@@ -1,18 +1,26 @@
 package repositry
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
 	"github.com/stretchr/testify/require"
 )
 
 func TestUserRepository(t *testing.T) {
-	filePath := "./test_user_repo"
-	//defer os.Remove(filePath)
+	filePath := t.TempDir() + "/user_repo"
 	userRepo, err := NewUser(filePath)
 	require.NoError(t, err)
+	defer userRepo.Close()
 	ctx := context.Background()
 	user := domain.User{
 		ID:       "id",
@@ -21,7 +29,227 @@ func TestUserRepository(t *testing.T) {
 	}
 	err = userRepo.CreateUser(ctx, user)
 	require.NoError(t, err)
+	require.Equal(t, domain.ErrUserExists, userRepo.CreateUser(ctx, user))
 	actualUser, err := userRepo.GetUserByName(ctx, "name")
 	require.NoError(t, err)
 	require.Equal(t, user, actualUser)
+
+	require.NoError(t, userRepo.DeleteUser(ctx, user.ID))
+	_, err = userRepo.GetUserByName(ctx, "name")
+	require.Equal(t, domain.ErrNotFound, err)
+	require.Equal(t, domain.ErrNotFound, userRepo.DeleteUser(ctx, user.ID))
+}
+
+func TestUserRepository_Durable(t *testing.T) {
+	filePath := t.TempDir() + "/user_repo"
+	ctx := context.Background()
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+	alice := domain.User{ID: "alice-id", Name: "alice", Password: "password"}
+	bob := domain.User{ID: "bob-id", Name: "bob", Password: "password"}
+	require.NoError(t, userRepo.CreateUser(ctx, alice))
+	require.NoError(t, userRepo.CreateUser(ctx, bob))
+	require.NoError(t, userRepo.UpdatePassword(ctx, alice.ID, "changed", []byte("vault key")))
+	require.NoError(t, userRepo.DeleteUser(ctx, bob.ID))
+	// the process dies without closing the repository
+	require.NoError(t, userRepo.journal.Close())
+
+	info, err := os.Stat(filePath + journalSuffix)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(filePerm), info.Mode().Perm())
+
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	alice.Password = "changed"
+	alice.VaultKey = []byte("vault key")
+	users, err := userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []domain.User{alice}, users)
+	userRepo.Close()
+
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	users, err = userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []domain.User{alice}, users)
+}
+
+func TestUserRepository_TornJournal(t *testing.T) {
+	filePath := t.TempDir() + "/user_repo"
+	ctx := context.Background()
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: "alice-id", Name: "alice"}))
+	require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: "bob-id", Name: "bob"}))
+	require.NoError(t, userRepo.journal.Close())
+
+	// the last record is cut short by a crash
+	journal, err := os.ReadFile(filePath + journalSuffix)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filePath+journalSuffix, journal[:len(journal)-3], filePerm))
+
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	_, err = userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	_, err = userRepo.GetUserByName(ctx, "bob")
+	require.Equal(t, domain.ErrNotFound, err)
+	require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: "bob-id", Name: "bob"}))
+	require.NoError(t, userRepo.journal.Close())
+
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	users, err := userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+}
+
+func TestUserRepository_DamagedJournal(t *testing.T) {
+	filePath := t.TempDir() + "/user_repo"
+	ctx := context.Background()
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+	require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: "alice-id", Name: "alice"}))
+	require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: "bob-id", Name: "bob"}))
+	require.NoError(t, userRepo.journal.Close())
+	journal, err := os.ReadFile(filePath + journalSuffix)
+	require.NoError(t, err)
+
+	// bit rot in the first record hides the acknowledged second one
+	damaged := bytes.Clone(journal)
+	damaged[10] ^= 1
+	require.NoError(t, os.WriteFile(filePath+journalSuffix, damaged, filePerm))
+	_, err = NewUser(filePath)
+	require.Equal(t, ErrJournalDamaged, err)
+	kept, err := os.ReadFile(filePath + journalSuffix)
+	require.NoError(t, err)
+	require.Equal(t, damaged, kept)
+
+	// corrupted length of the first record overruns the end of the journal,
+	// the record looks torn but the acknowledged second one follows it
+	damaged = bytes.Clone(journal)
+	damaged[1] ^= 1
+	require.NoError(t, os.WriteFile(filePath+journalSuffix, damaged, filePerm))
+	_, err = NewUser(filePath)
+	require.Equal(t, ErrJournalDamaged, err)
+	kept, err = os.ReadFile(filePath + journalSuffix)
+	require.NoError(t, err)
+	require.Equal(t, damaged, kept)
+
+	// damaged last record was never acknowledged and is cut off
+	damaged = bytes.Clone(journal)
+	damaged[len(damaged)-1] ^= 1
+	require.NoError(t, os.WriteFile(filePath+journalSuffix, damaged, filePerm))
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	_, err = userRepo.GetUserByName(ctx, "alice")
+	require.NoError(t, err)
+	_, err = userRepo.GetUserByName(ctx, "bob")
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestUserRepository_Compaction(t *testing.T) {
+	defer func(every int) { compactEvery = every }(compactEvery)
+	compactEvery = 10
+	filePath := t.TempDir() + "/user_repo"
+	ctx := context.Background()
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+	for i := 0; i < 25; i++ {
+		require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: domain.UserID(fmt.Sprint(i)), Name: domain.UserName(fmt.Sprint("user", i))}))
+	}
+	require.Equal(t, 5, userRepo.recorded)
+	require.NoError(t, userRepo.journal.Close())
+
+	// the snapshot holds users of the compacted records
+	snapshot, err := readSnapshot(filePath)
+	require.NoError(t, err)
+	require.Len(t, snapshot, 20)
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	users, err := userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 25)
+	require.Zero(t, userRepo.recorded)
+}
+
+func TestUserRepository_Snapshot(t *testing.T) {
+	// repositories of older versions wrote the snapshot only
+	filePath := t.TempDir() + "/user_repo"
+	var buf bytes.Buffer
+	user := domain.User{ID: "id", Name: "name", Password: "password"}
+	require.NoError(t, gob.NewEncoder(&buf).Encode(map[domain.UserName]domain.User{user.Name: user}))
+	require.NoError(t, os.WriteFile(filePath, buf.Bytes(), filePerm))
+
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	actualUser, err := userRepo.GetUserByName(context.Background(), "name")
+	require.NoError(t, err)
+	require.Equal(t, user, actualUser)
+}
+
+func TestUserRepository_Concurrent(t *testing.T) {
+	defer func(every int) { compactEvery = every }(compactEvery)
+	compactEvery = 16
+	filePath := t.TempDir() + "/user_repo"
+	ctx := context.Background()
+	userRepo, err := NewUser(filePath)
+	require.NoError(t, err)
+
+	var created atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// only one registration of the same name succeeds
+			err := userRepo.CreateUser(ctx, domain.User{ID: domain.UserID(fmt.Sprint("same", i)), Name: "same"})
+			if err == nil {
+				created.Add(1)
+			} else {
+				require.Equal(t, domain.ErrUserExists, err)
+			}
+
+			id := domain.UserID(fmt.Sprint(i))
+			require.NoError(t, userRepo.CreateUser(ctx, domain.User{ID: id, Name: domain.UserName(fmt.Sprint("user", i))}))
+			for j := 0; j < 10; j++ {
+				require.NoError(t, userRepo.UpdatePassword(ctx, id, fmt.Sprint("password", j), nil))
+				_, err := userRepo.GetUserByName(ctx, domain.UserName(fmt.Sprint("user", i)))
+				require.NoError(t, err)
+				_, err = userRepo.GetUsers(ctx)
+				require.NoError(t, err)
+			}
+			require.NoError(t, userRepo.UpdateTwoFactor(ctx, id, domain.TwoFactor{Enabled: true}))
+		}(i)
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), created.Load())
+	require.NoError(t, userRepo.journal.Close())
+
+	userRepo, err = NewUser(filePath)
+	require.NoError(t, err)
+	defer userRepo.Close()
+	users, err := userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 9)
+	for _, user := range users {
+		if user.Name != "same" {
+			require.Equal(t, "password9", user.Password)
+			require.True(t, user.TwoFactor.Enabled)
+		}
+	}
+}
+
+func TestUserRepository_Conformance(t *testing.T) {
+	conformance.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo, err := NewUser(t.TempDir() + "/user_repo")
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
 }
@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type loginAttempts struct {
+	domain.LoginAttempts
+	lastFailure time.Time
+	window      time.Duration
+}
+
+// LoginAttemptRepository counts failed logins of a single server instance.
+type LoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+}
+
+func NewLoginAttemptRepo() *LoginAttemptRepository {
+	return &LoginAttemptRepository{attempts: make(map[string]*loginAttempts)}
+}
+
+func (ar *LoginAttemptRepository) RegisterAttempt(ctx context.Context, key string, now time.Time, window time.Duration, block func(failures int) time.Duration) (domain.LoginAttempts, bool, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	ar.purge(now)
+	attempts, ok := ar.attempts[key]
+	if ok && attempts.BlockedUntil.After(now) {
+		return attempts.LoginAttempts, false, nil
+	}
+	if !ok || now.Sub(attempts.lastFailure) > window {
+		attempts = &loginAttempts{}
+		ar.attempts[key] = attempts
+	}
+	attempts.Failures++
+	attempts.lastFailure = now
+	attempts.window = window
+	attempts.BlockedUntil = now.Add(block(attempts.Failures))
+	return attempts.LoginAttempts, true, nil
+}
+
+func (ar *LoginAttemptRepository) ForgiveAttempt(ctx context.Context, key string, now time.Time, block func(failures int) time.Duration) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	attempts, ok := ar.attempts[key]
+	if !ok {
+		return nil
+	}
+	attempts.Failures--
+	if attempts.Failures <= 0 {
+		delete(ar.attempts, key)
+		return nil
+	}
+	attempts.BlockedUntil = now.Add(block(attempts.Failures))
+	return nil
+}
+
+func (ar *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	delete(ar.attempts, key)
+	return nil
+}
+
+func (ar *LoginAttemptRepository) Close() {}
+
+// purge drops counters which would start over anyway.
+func (ar *LoginAttemptRepository) purge(now time.Time) {
+	for key, attempts := range ar.attempts {
+		if now.Sub(attempts.lastFailure) > attempts.window && now.After(attempts.BlockedUntil) {
+			delete(ar.attempts, key)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// PersonalTokenRepository keeps personal tokens in process memory, they are
+// lost on restart.
+type PersonalTokenRepository struct {
+	mu     sync.Mutex
+	tokens map[string]domain.PersonalToken
+}
+
+func NewPersonalTokenRepo() *PersonalTokenRepository {
+	return &PersonalTokenRepository{tokens: make(map[string]domain.PersonalToken)}
+}
+
+func (pr *PersonalTokenRepository) CreatePersonalToken(ctx context.Context, token domain.PersonalToken) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.tokens[string(token.Hash)] = token
+	return nil
+}
+
+func (pr *PersonalTokenRepository) GetPersonalToken(ctx context.Context, hash []byte) (domain.PersonalToken, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	token, ok := pr.tokens[string(hash)]
+	if !ok {
+		return domain.PersonalToken{}, domain.ErrNotFound
+	}
+	return token, nil
+}
+
+func (pr *PersonalTokenRepository) ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	var tokens []domain.PersonalToken
+	for _, token := range pr.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (pr *PersonalTokenRepository) DeletePersonalToken(ctx context.Context, userID domain.UserID, id string) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	for hash, token := range pr.tokens {
+		if token.UserID == userID && token.ID == id {
+			delete(pr.tokens, hash)
+			return nil
+		}
+	}
+	return domain.ErrNotFound
+}
+
+func (pr *PersonalTokenRepository) DeleteUserTokens(ctx context.Context, userID domain.UserID) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	for hash, token := range pr.tokens {
+		if token.UserID == userID {
+			delete(pr.tokens, hash)
+		}
+	}
+	return nil
+}
+
+func (pr *PersonalTokenRepository) Close() {}
@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalTokenRepository(t *testing.T) {
+	ctx := context.Background()
+	pr := NewPersonalTokenRepo()
+	now := time.Now()
+	first := domain.PersonalToken{ID: "first", UserID: "id", Hash: []byte("first"), CreatedAt: now}
+	second := domain.PersonalToken{ID: "second", UserID: "id", Hash: []byte("second"), CreatedAt: now.Add(time.Second)}
+	other := domain.PersonalToken{ID: "other", UserID: "other", Hash: []byte("other"), CreatedAt: now}
+	for _, token := range []domain.PersonalToken{second, first, other} {
+		require.NoError(t, pr.CreatePersonalToken(ctx, token))
+	}
+
+	token, err := pr.GetPersonalToken(ctx, []byte("first"))
+	require.NoError(t, err)
+	require.Equal(t, first, token)
+	_, err = pr.GetPersonalToken(ctx, []byte("unknown"))
+	require.Equal(t, domain.ErrNotFound, err)
+
+	tokens, err := pr.ListPersonalTokens(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, []domain.PersonalToken{first, second}, tokens)
+
+	require.Equal(t, domain.ErrNotFound, pr.DeletePersonalToken(ctx, "id", "other"))
+	require.NoError(t, pr.DeletePersonalToken(ctx, "id", "first"))
+	_, err = pr.GetPersonalToken(ctx, []byte("first"))
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, pr.DeleteUserTokens(ctx, "id"))
+	tokens, err = pr.ListPersonalTokens(ctx, "id")
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+	_, err = pr.GetPersonalToken(ctx, []byte("other"))
+	require.NoError(t, err)
+}
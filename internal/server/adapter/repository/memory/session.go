@@ -0,0 +1,140 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type refreshToken struct {
+	domain.RefreshToken
+	used bool
+}
+
+// SessionRepository keeps sessions in process memory, they are lost on
+// restart and users have to log in again.
+type SessionRepository struct {
+	mu            sync.Mutex
+	refreshTokens map[string]*refreshToken
+	revoked       map[string]time.Time
+	revokedUsers  map[domain.UserID]time.Time
+	challenges    map[string]domain.LoginChallenge
+}
+
+func NewSessionRepo() *SessionRepository {
+	return &SessionRepository{
+		refreshTokens: make(map[string]*refreshToken),
+		revoked:       make(map[string]time.Time),
+		revokedUsers:  make(map[domain.UserID]time.Time),
+		challenges:    make(map[string]domain.LoginChallenge),
+	}
+}
+
+func (sr *SessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.purge(time.Now())
+	sr.refreshTokens[string(token.Hash)] = &refreshToken{RefreshToken: token}
+	return nil
+}
+
+func (sr *SessionRepository) UseRefreshToken(ctx context.Context, hash []byte) (domain.RefreshToken, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	token, ok := sr.refreshTokens[string(hash)]
+	if !ok {
+		return domain.RefreshToken{}, domain.ErrNotFound
+	}
+	if token.used {
+		return token.RefreshToken, domain.ErrTokenReused
+	}
+	token.used = true
+	return token.RefreshToken, nil
+}
+
+func (sr *SessionRepository) RevokeFamily(ctx context.Context, family string) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for hash, token := range sr.refreshTokens {
+		if token.Family == family {
+			delete(sr.refreshTokens, hash)
+		}
+	}
+	return nil
+}
+
+func (sr *SessionRepository) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.purge(time.Now())
+	sr.revoked[tokenID] = expiresAt
+	return nil
+}
+
+func (sr *SessionRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	_, ok := sr.revoked[tokenID]
+	return ok, nil
+}
+
+func (sr *SessionRepository) RevokeUser(ctx context.Context, id domain.UserID, before time.Time) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for hash, token := range sr.refreshTokens {
+		if token.UserID == id {
+			delete(sr.refreshTokens, hash)
+		}
+	}
+	sr.revokedUsers[id] = before
+	return nil
+}
+
+func (sr *SessionRepository) UserRevokedBefore(ctx context.Context, id domain.UserID) (time.Time, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	return sr.revokedUsers[id], nil
+}
+
+func (sr *SessionRepository) CreateChallenge(ctx context.Context, challenge domain.LoginChallenge) error {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.purge(time.Now())
+	sr.challenges[string(challenge.Hash)] = challenge
+	return nil
+}
+
+func (sr *SessionRepository) TakeChallenge(ctx context.Context, hash []byte) (domain.LoginChallenge, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	challenge, ok := sr.challenges[string(hash)]
+	if !ok {
+		return domain.LoginChallenge{}, domain.ErrNotFound
+	}
+	delete(sr.challenges, string(hash))
+	return challenge, nil
+}
+
+// purge drops expired tokens, used refresh tokens stay until they expire to
+// detect reuse.
+func (sr *SessionRepository) purge(now time.Time) {
+	for hash, token := range sr.refreshTokens {
+		if now.After(token.ExpiresAt) {
+			delete(sr.refreshTokens, hash)
+		}
+	}
+	for tokenID, expiresAt := range sr.revoked {
+		if now.After(expiresAt) {
+			delete(sr.revoked, tokenID)
+		}
+	}
+	for hash, challenge := range sr.challenges {
+		if now.After(challenge.ExpiresAt) {
+			delete(sr.challenges, hash)
+		}
+	}
+}
+
+func (sr *SessionRepository) Close() {}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRepository(t *testing.T) {
+	ctx := context.Background()
+	sr := NewSessionRepo()
+	token := domain.RefreshToken{Hash: []byte("hash"), Family: "family", UserID: "id", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, sr.CreateRefreshToken(ctx, token))
+
+	_, err := sr.UseRefreshToken(ctx, []byte("other"))
+	require.Equal(t, domain.ErrNotFound, err)
+	used, err := sr.UseRefreshToken(ctx, token.Hash)
+	require.NoError(t, err)
+	require.Equal(t, token, used)
+	used, err = sr.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrTokenReused, err)
+	require.Equal(t, "family", used.Family)
+
+	require.NoError(t, sr.RevokeFamily(ctx, "family"))
+	_, err = sr.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, sr.RevokeAccessToken(ctx, "expired", time.Now().Add(-time.Minute)))
+	require.NoError(t, sr.RevokeAccessToken(ctx, "jti", time.Now().Add(time.Minute)))
+	revoked, err := sr.IsAccessTokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = sr.IsAccessTokenRevoked(ctx, "expired")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	before, err := sr.UserRevokedBefore(ctx, "id")
+	require.NoError(t, err)
+	require.True(t, before.IsZero())
+	require.NoError(t, sr.CreateRefreshToken(ctx, token))
+	now := time.Now()
+	require.NoError(t, sr.RevokeUser(ctx, "id", now))
+	_, err = sr.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrNotFound, err)
+	before, err = sr.UserRevokedBefore(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, now, before)
+}
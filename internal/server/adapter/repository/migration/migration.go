@@ -0,0 +1,274 @@
+// Package migration applies versioned schema migrations embedded into the
+// server. Every migration is a pair of files NNNN_name.up.sql and
+// NNNN_name.down.sql, applied versions are kept in the schema_version table.
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrInvalidMigration = errors.New("invalid migration")
+	// ErrSchemaTooNew means the database has migrations this server does
+	// not know, it was migrated by a newer version.
+	ErrSchemaTooNew = errors.New("database schema is newer than the server")
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is state of one known migration.
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Dialect holds database specific statements.
+type Dialect struct {
+	// Lock and Unlock serialize runners of several processes, they are
+	// empty for databases with a single writer.
+	Lock   string
+	Unlock string
+	// Placeholder returns bind parameter n, starting from 1.
+	Placeholder func(n int) string
+}
+
+// lockID identifies the advisory lock of gophkeeper migrations.
+const lockID = 7_302_143_991
+
+var Postgres = Dialect{
+	Lock:        fmt.Sprintf("SELECT pg_advisory_lock(%d)", lockID),
+	Unlock:      fmt.Sprintf("SELECT pg_advisory_unlock(%d)", lockID),
+	Placeholder: func(n int) string { return "$" + strconv.Itoa(n) },
+}
+
+// SQLite has a single writer, concurrent runners wait for each other on the
+// database lock.
+var SQLite = Dialect{
+	Placeholder: func(n int) string { return "?" },
+}
+
+// Load reads migrations from the root of fsys sorted by version. Versions
+// have to start from 1 without gaps and every migration needs both files.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		base := strings.TrimSuffix(name, ".sql")
+		direction := base[strings.LastIndex(base, ".")+1:]
+		base = strings.TrimSuffix(base, "."+direction)
+		number, title, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil || version <= 0 || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("%w: unexpected file name '%s'", ErrInvalidMigration, name)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if m.Name != title {
+			return nil, fmt.Errorf("%w: version %d has names '%s' and '%s'", ErrInvalidMigration, version, m.Name, title)
+		}
+		if direction == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("%w: version %d is missing", ErrInvalidMigration, i+1)
+		}
+		if len(strings.TrimSpace(m.Up)) == 0 || len(strings.TrimSpace(m.Down)) == 0 {
+			return nil, fmt.Errorf("%w: version %d needs up and down files", ErrInvalidMigration, m.Version)
+		}
+	}
+	return migrations, nil
+}
+
+// Runner applies and rolls back migrations. Every migration runs in its own
+// transaction together with its schema_version row.
+type Runner struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func New(db *sql.DB, dialect Dialect, fsys fs.FS) (*Runner, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Latest returns version of the newest known migration.
+func (r *Runner) Latest() int {
+	return len(r.migrations)
+}
+
+// Up applies pending migrations and returns how many were applied.
+func (r *Runner) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := r.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for _, m := range r.migrations {
+			if _, ok := versions[m.Version]; ok {
+				continue
+			}
+			log.Info().Msgf("applying migration %04d_%s", m.Version, m.Name)
+			insert := fmt.Sprintf("INSERT INTO schema_version (version, name, applied_at) VALUES (%s, %s, %s)",
+				r.dialect.Placeholder(1), r.dialect.Placeholder(2), r.dialect.Placeholder(3))
+			err := r.inTx(ctx, conn, m.Up, insert, m.Version, m.Name, time.Now().UTC())
+			if err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back up to steps newest applied migrations and returns how
+// many were rolled back.
+func (r *Runner) Down(ctx context.Context, steps int) (int, error) {
+	rolled := 0
+	err := r.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for i := len(r.migrations) - 1; i >= 0 && rolled < steps; i-- {
+			m := r.migrations[i]
+			if _, ok := versions[m.Version]; !ok {
+				continue
+			}
+			log.Info().Msgf("rolling back migration %04d_%s", m.Version, m.Name)
+			remove := "DELETE FROM schema_version WHERE version = " + r.dialect.Placeholder(1)
+			err := r.inTx(ctx, conn, m.Down, remove, m.Version)
+			if err != nil {
+				return fmt.Errorf("rollback of %04d_%s failed: %w", m.Version, m.Name, err)
+			}
+			rolled++
+		}
+		return nil
+	})
+	return rolled, err
+}
+
+// Status lists every known migration with the time it was applied.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := r.locked(ctx, func(conn *sql.Conn, versions map[int]time.Time) error {
+		for _, m := range r.migrations {
+			appliedAt, ok := versions[m.Version]
+			statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: appliedAt})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// locked runs fn on a connection holding the migration lock with applied
+// versions. Databases migrated by a newer server are refused.
+func (r *Runner) locked(ctx context.Context, fn func(conn *sql.Conn, versions map[int]time.Time) error) error {
+	// the lock belongs to the database session, so everything runs on
+	// one connection
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if len(r.dialect.Lock) > 0 {
+		if _, err := conn.ExecContext(ctx, r.dialect.Lock); err != nil {
+			return fmt.Errorf("failed to take migration lock: %w", err)
+		}
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), r.dialect.Unlock); err != nil {
+				log.Err(err).Msg("failed to release migration lock")
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+	versions, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+	for version := range versions {
+		if version > len(r.migrations) {
+			return fmt.Errorf("%w: version %d is applied, the server knows %d", ErrSchemaTooNew, version, len(r.migrations))
+		}
+	}
+	return fn(conn, versions)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+func (r *Runner) inTx(ctx context.Context, conn *sql.Conn, script string, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,117 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER)")},
+		"0002_second.down.sql": {Data: []byte("DROP TABLE b")},
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE a")},
+		"README":               {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []Migration{
+		{Version: 1, Name: "first", Up: "CREATE TABLE a (id INTEGER)", Down: "DROP TABLE a"},
+		{Version: 2, Name: "second", Up: "CREATE TABLE b (id INTEGER)", Down: "DROP TABLE b"},
+	}, migrations)
+
+	tests := map[string]fstest.MapFS{
+		"gap": {
+			"0001_first.up.sql":   {Data: []byte("up")},
+			"0001_first.down.sql": {Data: []byte("down")},
+			"0003_third.up.sql":   {Data: []byte("up")},
+			"0003_third.down.sql": {Data: []byte("down")},
+		},
+		"missing down": {
+			"0001_first.up.sql": {Data: []byte("up")},
+		},
+		"bad name": {
+			"first.up.sql": {Data: []byte("up")},
+		},
+		"bad direction": {
+			"0001_first.sideways.sql": {Data: []byte("up")},
+		},
+		"name mismatch": {
+			"0001_first.up.sql":   {Data: []byte("up")},
+			"0001_other.down.sql": {Data: []byte("down")},
+		},
+	}
+	for name, fsys := range tests {
+		_, err := Load(fsys)
+		require.ErrorIs(t, err, ErrInvalidMigration, name)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	files := fstest.MapFS{
+		"0001_first.up.sql":    {Data: []byte("CREATE TABLE a (id INTEGER); CREATE TABLE b (id INTEGER);")},
+		"0001_first.down.sql":  {Data: []byte("DROP TABLE b; DROP TABLE a;")},
+		"0002_second.up.sql":   {Data: []byte("ALTER TABLE a ADD COLUMN name TEXT")},
+		"0002_second.down.sql": {Data: []byte("ALTER TABLE a DROP COLUMN name")},
+	}
+	runner, err := New(db, SQLite, files)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	applied, err := runner.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, applied)
+	applied, err = runner.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, applied)
+	_, err = db.Exec("INSERT INTO a (id, name) VALUES (1, 'name')")
+	require.NoError(t, err)
+
+	rolled, err := runner.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, 1, rolled)
+	statuses, err := runner.Status(ctx)
+	require.NoError(t, err)
+	require.True(t, statuses[0].Applied)
+	require.False(t, statuses[1].Applied)
+	_, err = db.Exec("INSERT INTO a (id, name) VALUES (2, 'name')")
+	require.Error(t, err)
+
+	// failed migration leaves neither changes nor its version behind
+	broken := fstest.MapFS{
+		"0001_first.up.sql":    files["0001_first.up.sql"],
+		"0001_first.down.sql":  files["0001_first.down.sql"],
+		"0002_second.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER); ALTER TABLE missing ADD COLUMN name TEXT")},
+		"0002_second.down.sql": files["0002_second.down.sql"],
+	}
+	brokenRunner, err := New(db, SQLite, broken)
+	require.NoError(t, err)
+	_, err = brokenRunner.Up(ctx)
+	require.Error(t, err)
+	_, err = db.Exec("SELECT * FROM c")
+	require.Error(t, err)
+
+	_, err = runner.Up(ctx)
+	require.NoError(t, err)
+	older, err := New(db, SQLite, fstest.MapFS{
+		"0001_first.up.sql":   files["0001_first.up.sql"],
+		"0001_first.down.sql": files["0001_first.down.sql"],
+	})
+	require.NoError(t, err)
+	_, err = older.Up(ctx)
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+
+	rolled, err = runner.Down(ctx, 5)
+	require.NoError(t, err)
+	require.Equal(t, 2, rolled)
+	_, err = db.Exec("SELECT * FROM a")
+	require.Error(t, err)
+}
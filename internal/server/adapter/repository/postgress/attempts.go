@@ -0,0 +1,114 @@
+package postgress
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// LoginAttemptRepository shares failed login counters between server
+// replicas.
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepo(databaseDSN string) (*LoginAttemptRepository, error) {
+	db, err := sql.Open("pgx", databaseDSN)
+	if err != nil {
+		log.Err(err).Msg("failed connect to postgres")
+		return nil, err
+	}
+
+	return &LoginAttemptRepository{db: db}, nil
+}
+
+// RegisterAttempt holds the row of key locked while the attempt is
+// counted, so replicas count parallel attempts one after another.
+func (ar *LoginAttemptRepository) RegisterAttempt(ctx context.Context, key string, now time.Time, window time.Duration, block func(failures int) time.Duration) (domain.LoginAttempts, bool, error) {
+	_, err := ar.db.ExecContext(ctx,
+		"DELETE FROM login_attempts WHERE last_failure < $1 AND blocked_until < $2", now.Add(-window), now)
+	if err != nil {
+		log.Err(err).Msg("failed to purge login attempts")
+		return domain.LoginAttempts{}, false, err
+	}
+
+	tx, err := ar.db.BeginTx(ctx, nil)
+	if err != nil {
+		return domain.LoginAttempts{}, false, err
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_attempts (key, failures, last_failure, blocked_until)
+		VALUES ($1, 0, $2, $2) ON CONFLICT (key) DO NOTHING`, key, now)
+	if err != nil {
+		log.Err(err).Msg("failed to register login attempt")
+		return domain.LoginAttempts{}, false, err
+	}
+	var attempts domain.LoginAttempts
+	var lastFailure time.Time
+	row := tx.QueryRowContext(ctx, "SELECT failures, last_failure, blocked_until FROM login_attempts WHERE key = $1 FOR UPDATE", key)
+	err = row.Scan(&attempts.Failures, &lastFailure, &attempts.BlockedUntil)
+	if err != nil {
+		log.Err(err).Msg("failed to get login attempts")
+		return domain.LoginAttempts{}, false, err
+	}
+	if attempts.BlockedUntil.After(now) {
+		return attempts, false, nil
+	}
+	if lastFailure.Before(now.Add(-window)) {
+		attempts.Failures = 0
+	}
+	attempts.Failures++
+	attempts.BlockedUntil = now.Add(block(attempts.Failures))
+	_, err = tx.ExecContext(ctx, "UPDATE login_attempts SET failures = $2, last_failure = $3, blocked_until = $4 WHERE key = $1",
+		key, attempts.Failures, now, attempts.BlockedUntil)
+	if err != nil {
+		log.Err(err).Msg("failed to register login attempt")
+		return domain.LoginAttempts{}, false, err
+	}
+	return attempts, true, tx.Commit()
+}
+
+func (ar *LoginAttemptRepository) ForgiveAttempt(ctx context.Context, key string, now time.Time, block func(failures int) time.Duration) error {
+	tx, err := ar.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var failures int
+	err = tx.QueryRowContext(ctx, "SELECT failures FROM login_attempts WHERE key = $1 FOR UPDATE", key).Scan(&failures)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		log.Err(err).Msg("failed to get login attempts")
+		return err
+	}
+	failures--
+	if failures <= 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE login_attempts SET failures = $2, blocked_until = $3 WHERE key = $1",
+			key, failures, now.Add(block(failures)))
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to forgive login attempt")
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ar *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := ar.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key)
+	if err != nil {
+		log.Err(err).Msg("failed to reset login attempts")
+		return err
+	}
+	return nil
+}
+
+func (ar *LoginAttemptRepository) Close() {
+	ar.db.Close()
+}
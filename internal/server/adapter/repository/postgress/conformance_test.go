@@ -0,0 +1,56 @@
+package postgress
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+// testDSN returns the database named by TEST_DATABASE_DSN with the schema
+// migrated, the repositories are checked against a real Postgres only.
+func testDSN(t *testing.T) string {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	migrator, err := NewMigrator(dsn)
+	require.NoError(t, err)
+	defer migrator.Close()
+	_, err = migrator.Up(context.Background())
+	require.NoError(t, err)
+	return dsn
+}
+
+func TestUserRepository_Conformance(t *testing.T) {
+	dsn := testDSN(t)
+	conformance.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo, err := NewUserRepo(dsn)
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
+
+func TestKeeperRepository_Conformance(t *testing.T) {
+	dsn := testDSN(t)
+	conformance.TestKeeperRepository(t, func(t *testing.T) port.KeeperRepository {
+		repo, err := NewKeeperRepo(dsn)
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
+
+func TestUserKeyRepository_Conformance(t *testing.T) {
+	dsn := testDSN(t)
+	conformance.TestUserKeyRepository(t, func(t *testing.T) port.UserKeyRepository {
+		repo, err := NewUserKeyRepo(dsn)
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
@@ -0,0 +1,43 @@
+package postgress
+
+import (
+	"database/sql"
+	"embed"
+	"io/fs"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/migration"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrator applies schema migrations of the Postgres repositories, the
+// repositories expect the schema to be up to date.
+type Migrator struct {
+	*migration.Runner
+	db *sql.DB
+}
+
+func NewMigrator(databaseDSN string) (*Migrator, error) {
+	db, err := sql.Open("pgx", databaseDSN)
+	if err != nil {
+		log.Err(err).Msg("failed connect to postgres")
+		return nil, err
+	}
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	runner, err := migration.New(db, migration.Postgres, files)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Migrator{Runner: runner, db: db}, nil
+}
+
+func (m *Migrator) Close() {
+	m.db.Close()
+}
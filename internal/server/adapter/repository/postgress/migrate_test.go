@@ -0,0 +1,43 @@
+package postgress
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// The embedded migrations are checked without a database, sql.Open does not
+// connect.
+func TestNewMigrator(t *testing.T) {
+	migrator, err := NewMigrator("host=localhost")
+	require.NoError(t, err)
+	defer migrator.Close()
+	require.Equal(t, 6, migrator.Latest())
+}
+
+// Every down migration has to undo its up migration on a real Postgres, the
+// schema is left migrated for the other tests.
+func TestMigrator_RoundTrip(t *testing.T) {
+	dsn := testDSN(t)
+	migrator, err := NewMigrator(dsn)
+	require.NoError(t, err)
+	defer migrator.Close()
+	ctx := context.Background()
+
+	rolled, err := migrator.Down(ctx, migrator.Latest())
+	require.NoError(t, err)
+	require.Equal(t, migrator.Latest(), rolled)
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		require.False(t, status.Applied, status.Version)
+	}
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, migrator.Latest(), applied)
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, applied)
+}
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS items;
+DROP TABLE IF EXISTS personal_tokens;
+DROP TABLE IF EXISTS login_attempts;
+DROP TABLE IF EXISTS login_challenges;
+DROP TABLE IF EXISTS revoked_users;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS users;
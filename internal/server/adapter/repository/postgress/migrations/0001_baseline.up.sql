@@ -0,0 +1,58 @@
+-- Schema created by the servers which made tables on start, it is a no-op
+-- on databases they created.
+CREATE TABLE IF NOT EXISTS users (
+	id VARCHAR (50) UNIQUE NOT NULL,
+	name VARCHAR (50) NOT NULL,
+	password VARCHAR (100) NOT NULL);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vault_key BYTEA;
+ALTER TABLE users ALTER COLUMN password TYPE TEXT;
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS totp_secret BYTEA,
+	ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS recovery_codes TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+	hash BYTEA PRIMARY KEY,
+	family VARCHAR (50) NOT NULL,
+	user_id VARCHAR (50) NOT NULL,
+	user_name VARCHAR (50) NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL,
+	used BOOLEAN NOT NULL DEFAULT FALSE);
+CREATE INDEX IF NOT EXISTS refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX IF NOT EXISTS refresh_tokens_user ON refresh_tokens (user_id);
+CREATE TABLE IF NOT EXISTS revoked_tokens (jti VARCHAR (50) PRIMARY KEY, expires_at TIMESTAMPTZ NOT NULL);
+CREATE TABLE IF NOT EXISTS revoked_users (user_id VARCHAR (50) PRIMARY KEY, revoked_before TIMESTAMPTZ NOT NULL);
+CREATE TABLE IF NOT EXISTS login_challenges (
+	hash BYTEA PRIMARY KEY,
+	user_name VARCHAR (50) NOT NULL,
+	attempts INTEGER NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL);
+
+CREATE TABLE IF NOT EXISTS login_attempts (
+	key VARCHAR (100) PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure TIMESTAMPTZ NOT NULL,
+	blocked_until TIMESTAMPTZ NOT NULL);
+
+CREATE TABLE IF NOT EXISTS personal_tokens (
+	hash BYTEA PRIMARY KEY,
+	id VARCHAR (50) UNIQUE NOT NULL,
+	user_id VARCHAR (50) NOT NULL,
+	user_name VARCHAR (50) NOT NULL,
+	name TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	item_ids TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL);
+CREATE INDEX IF NOT EXISTS personal_tokens_user ON personal_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS items (
+	id VARCHAR (50) PRIMARY KEY,
+	user_id VARCHAR (50) NOT NULL,
+	type VARCHAR (20) NOT NULL,
+	title TEXT NOT NULL,
+	meta TEXT NOT NULL,
+	encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+	data BYTEA NOT NULL);
+CREATE INDEX IF NOT EXISTS items_user ON items (user_id);
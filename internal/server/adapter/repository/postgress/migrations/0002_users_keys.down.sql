@@ -0,0 +1,3 @@
+ALTER TABLE users DROP CONSTRAINT users_name_key;
+ALTER TABLE users DROP CONSTRAINT users_pkey;
+ALTER TABLE users ADD CONSTRAINT users_id_key UNIQUE (id);
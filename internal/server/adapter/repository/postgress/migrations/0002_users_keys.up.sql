@@ -0,0 +1,5 @@
+-- Fails when several users share a name, duplicates have to be removed by
+-- hand first.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_id_key;
+ALTER TABLE users ADD CONSTRAINT users_pkey PRIMARY KEY (id);
+ALTER TABLE users ADD CONSTRAINT users_name_key UNIQUE (name);
@@ -0,0 +1,3 @@
+CREATE TABLE user_keys (
+	user_id VARCHAR (50) PRIMARY KEY,
+	wrapped_key BYTEA NOT NULL);
@@ -0,0 +1,2 @@
+DROP TABLE item_chunks;
+ALTER TABLE items DROP COLUMN chunk_version;
@@ -0,0 +1,8 @@
+ALTER TABLE items ADD COLUMN chunk_version VARCHAR (50);
+
+CREATE TABLE item_chunks (
+	item_id VARCHAR (50) NOT NULL,
+	version VARCHAR (50) NOT NULL,
+	seq INTEGER NOT NULL,
+	data BYTEA NOT NULL,
+	PRIMARY KEY (item_id, version, seq));
@@ -0,0 +1 @@
+ALTER TABLE item_chunks ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now();
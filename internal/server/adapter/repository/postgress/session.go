@@ -0,0 +1,162 @@
+package postgress
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepo(databaseDSN string) (*SessionRepository, error) {
+	db, err := sql.Open("pgx", databaseDSN)
+	if err != nil {
+		log.Err(err).Msg("failed connect to postgres")
+		return nil, err
+	}
+
+	return &SessionRepository{db: db}, nil
+}
+
+func (sr *SessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < now()")
+	if err != nil {
+		log.Err(err).Msg("failed to purge refresh tokens")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (hash, family, user_id, user_name, expires_at, session_start) VALUES ($1, $2, $3, $4, $5, $6)",
+		token.Hash, token.Family, token.UserID, token.UserName, token.ExpiresAt, token.SessionStart)
+	if err != nil {
+		log.Err(err).Msg("failed to create refresh token")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) UseRefreshToken(ctx context.Context, hash []byte) (domain.RefreshToken, error) {
+	token := domain.RefreshToken{Hash: hash}
+	// used is read before the update, so only one of concurrent callers
+	// sees the token unused.
+	row := sr.db.QueryRowContext(ctx, `UPDATE refresh_tokens AS t SET used = TRUE
+		FROM (SELECT hash, used FROM refresh_tokens WHERE hash = $1 FOR UPDATE) AS old
+		WHERE t.hash = old.hash
+		RETURNING t.family, t.user_id, t.user_name, t.expires_at, t.session_start, old.used`, hash)
+	var used bool
+	err := row.Scan(&token.Family, &token.UserID, &token.UserName, &token.ExpiresAt, &token.SessionStart, &used)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.RefreshToken{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to use refresh token")
+		return domain.RefreshToken{}, err
+	}
+	if used {
+		return token, domain.ErrTokenReused
+	}
+	return token, nil
+}
+
+func (sr *SessionRepository) RevokeFamily(ctx context.Context, family string) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE family = $1", family)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke refresh tokens")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < now()")
+	if err != nil {
+		log.Err(err).Msg("failed to purge revoked tokens")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING",
+		tokenID, expiresAt)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke access token")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	err := sr.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)", tokenID).Scan(&revoked)
+	if err != nil {
+		log.Err(err).Msg("failed to check revoked token")
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (sr *SessionRepository) RevokeUser(ctx context.Context, id domain.UserID, before time.Time) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = $1", id)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke refresh tokens of user")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		`INSERT INTO revoked_users (user_id, revoked_before) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = EXCLUDED.revoked_before`, id, before)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke user tokens")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) UserRevokedBefore(ctx context.Context, id domain.UserID) (time.Time, error) {
+	var before time.Time
+	err := sr.db.QueryRowContext(ctx, "SELECT revoked_before FROM revoked_users WHERE user_id = $1", id).Scan(&before)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		log.Err(err).Msg("failed to get user revocation")
+		return time.Time{}, err
+	}
+	return before, nil
+}
+
+func (sr *SessionRepository) CreateChallenge(ctx context.Context, challenge domain.LoginChallenge) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM login_challenges WHERE expires_at < now()")
+	if err != nil {
+		log.Err(err).Msg("failed to purge login challenges")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO login_challenges (hash, user_name, attempts, expires_at) VALUES ($1, $2, $3, $4)",
+		challenge.Hash, challenge.UserName, challenge.Attempts, challenge.ExpiresAt)
+	if err != nil {
+		log.Err(err).Msg("failed to create login challenge")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) TakeChallenge(ctx context.Context, hash []byte) (domain.LoginChallenge, error) {
+	challenge := domain.LoginChallenge{Hash: hash}
+	row := sr.db.QueryRowContext(ctx,
+		"DELETE FROM login_challenges WHERE hash = $1 RETURNING user_name, attempts, expires_at", hash)
+	err := row.Scan(&challenge.UserName, &challenge.Attempts, &challenge.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.LoginChallenge{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to take login challenge")
+		return domain.LoginChallenge{}, err
+	}
+	return challenge, nil
+}
+
+func (sr *SessionRepository) Close() {
+	sr.db.Close()
+}
@@ -1,14 +1,22 @@
 package postgress
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
 
+// uniqueViolation is SQLSTATE of a duplicate key.
+const uniqueViolation = "23505"
+
 type UserRepository struct {
 	db *sql.DB
 }
@@ -20,18 +28,16 @@ func NewUserRepo(databaseDSN string) (*UserRepository, error) {
 		return nil, err
 	}
 
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS users (id VARCHAR (50) UNIQUE NOT NULL, name VARCHAR (50) NOT NULL, password VARCHAR(100) NOT NULL)")
-	if err != nil {
-		log.Err(err).Msg("failed to create users table")
-		return nil, err
-	}
-
 	return &UserRepository{db: db}, nil
 }
 
 func (us *UserRepository) CreateUser(ctx context.Context, user domain.User) error {
-	_, err := us.db.Exec("INSERT INTO users (id, name, password) Values ($1, $2, $3)", user.ID, user.Name, user.Password)
+	_, err := us.db.ExecContext(ctx, "INSERT INTO users (id, name, password, vault_key) Values ($1, $2, $3, $4)", user.ID, user.Name, user.Password, user.VaultKey)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return domain.ErrUserExists
+		}
 		log.Err(err).Msg("failed to create user")
 		return err
 	}
@@ -39,21 +45,207 @@ func (us *UserRepository) CreateUser(ctx context.Context, user domain.User) erro
 }
 
 func (us *UserRepository) GetUserByName(ctx context.Context, name domain.UserName) (domain.User, error) {
-	row := us.db.QueryRow("SELECT id, password FROM users WHERE name=$1", name)
+	row := us.db.QueryRowContext(ctx, "SELECT id, password, vault_key, totp_secret, totp_enabled, totp_last_step, recovery_codes FROM users WHERE name=$1", name)
 	var id string
 	var password string
-	err := row.Scan(&id, &password)
+	var vaultKey []byte
+	var twoFactor domain.TwoFactor
+	var recoveryCodes string
+	err := row.Scan(&id, &password, &vaultKey, &twoFactor.Secret, &twoFactor.Enabled, &twoFactor.LastStep, &recoveryCodes)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.User{}, domain.ErrNotFound
+		}
 		log.Err(err).Msg("failed to get user")
 		return domain.User{}, err
 	}
+	twoFactor.RecoveryCodes, err = decodeHashes(recoveryCodes)
+	if err != nil {
+		log.Err(err).Msg("failed to decode recovery codes")
+		return domain.User{}, err
+	}
 	return domain.User{
-		ID:       domain.UserID(id),
-		Name:     name,
-		Password: password,
+		ID:        domain.UserID(id),
+		Name:      name,
+		Password:  password,
+		VaultKey:  vaultKey,
+		TwoFactor: twoFactor,
 	}, nil
 }
 
+func (us *UserRepository) GetUsers(ctx context.Context) ([]domain.User, error) {
+	rows, err := us.db.QueryContext(ctx, "SELECT id, name, password, vault_key FROM users")
+	if err != nil {
+		log.Err(err).Msg("failed to get users")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var user domain.User
+		err = rows.Scan(&user.ID, &user.Name, &user.Password, &user.VaultKey)
+		if err != nil {
+			log.Err(err).Msg("failed to scan user")
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (us *UserRepository) UpdateTwoFactor(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret=$2, totp_enabled=$3, totp_last_step=$4, recovery_codes=$5 WHERE id=$1",
+		id, twoFactor.Secret, twoFactor.Enabled, twoFactor.LastStep, encodeHashes(twoFactor.RecoveryCodes))
+	if err != nil {
+		log.Err(err).Msg("failed to update two factor")
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (us *UserRepository) UseTwoFactorStep(ctx context.Context, id domain.UserID, step int64) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_last_step = $1 WHERE id = $2 AND totp_enabled AND totp_last_step < $1", step, id)
+	if err != nil {
+		log.Err(err).Msg("failed to use totp step")
+		return err
+	}
+	return expectRow(result, domain.ErrInvalidCode)
+}
+
+// UseRecoveryCode swaps the codes only when no other code was used since
+// they were read, and reads them again otherwise.
+func (us *UserRepository) UseRecoveryCode(ctx context.Context, id domain.UserID, hash []byte) error {
+	for {
+		var encoded string
+		err := us.db.QueryRowContext(ctx, "SELECT recovery_codes FROM users WHERE id = $1", id).Scan(&encoded)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrInvalidCode
+			}
+			log.Err(err).Msg("failed to get recovery codes")
+			return err
+		}
+		codes, err := decodeHashes(encoded)
+		if err != nil {
+			log.Err(err).Msg("failed to decode recovery codes")
+			return err
+		}
+		remaining, ok := removeHash(codes, hash)
+		if !ok {
+			return domain.ErrInvalidCode
+		}
+		result, err := us.db.ExecContext(ctx,
+			"UPDATE users SET recovery_codes = $1 WHERE id = $2 AND recovery_codes = $3", encodeHashes(remaining), id, encoded)
+		if err != nil {
+			log.Err(err).Msg("failed to use recovery code")
+			return err
+		}
+		if expectRow(result, domain.ErrNotFound) == nil {
+			return nil
+		}
+	}
+}
+
+func (us *UserRepository) ReplaceTwoFactorSecret(ctx context.Context, id domain.UserID, old, secret []byte) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = $1 WHERE id = $2 AND totp_secret = $3", secret, id, old)
+	if err != nil {
+		log.Err(err).Msg("failed to replace totp secret")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (us *UserRepository) UpdatePassword(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+	result, err := us.db.ExecContext(ctx, "UPDATE users SET password=$2, vault_key=$3 WHERE id=$1", id, password, vaultKey)
+	if err != nil {
+		log.Err(err).Msg("failed to update password")
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func (us *UserRepository) DeleteUser(ctx context.Context, id domain.UserID) error {
+	result, err := us.db.ExecContext(ctx, "DELETE FROM users WHERE id=$1", id)
+	if err != nil {
+		log.Err(err).Msg("failed to delete user")
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// removeHash returns hashes without hash and whether it was there.
+func removeHash(hashes [][]byte, hash []byte) ([][]byte, bool) {
+	for i, stored := range hashes {
+		if bytes.Equal(stored, hash) {
+			remaining := make([][]byte, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			return append(remaining, hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
+
+// encodeHashes stores recovery code hashes as comma separated hex.
+func encodeHashes(hashes [][]byte) string {
+	encoded := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		encoded = append(encoded, hex.EncodeToString(hash))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func decodeHashes(encoded string) ([][]byte, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	var hashes [][]byte
+	for _, field := range strings.Split(encoded, ",") {
+		hash, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
 func (us *UserRepository) Close() {
 	us.db.Close()
 }
+
+// expectRow returns errNone when statement changed no rows.
+func expectRow(result sql.Result, errNone error) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errNone
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// LoginAttemptRepository keeps failed login counters in the database file,
+// a restart does not lift a lockout.
+type LoginAttemptRepository struct {
+	db *sql.DB
+}
+
+func NewLoginAttemptRepo(path string) (*LoginAttemptRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginAttemptRepository{db: db}, nil
+}
+
+// RegisterAttempt counts the attempt in a transaction holding the write
+// lock, so parallel attempts are counted one after another.
+func (ar *LoginAttemptRepository) RegisterAttempt(ctx context.Context, key string, now time.Time, window time.Duration, block func(failures int) time.Duration) (domain.LoginAttempts, bool, error) {
+	tx, err := ar.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return domain.LoginAttempts{}, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		"DELETE FROM login_attempts WHERE last_failure < ? AND blocked_until < ?", now.Add(-window).UnixNano(), now.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to purge login attempts")
+		return domain.LoginAttempts{}, false, err
+	}
+	var attempts domain.LoginAttempts
+	var lastFailure, blockedUntil int64
+	err = tx.QueryRowContext(ctx, "SELECT failures, last_failure, blocked_until FROM login_attempts WHERE key = ?", key).
+		Scan(&attempts.Failures, &lastFailure, &blockedUntil)
+	if err != nil && err != sql.ErrNoRows {
+		log.Err(err).Msg("failed to get login attempts")
+		return domain.LoginAttempts{}, false, err
+	}
+	if err == nil {
+		attempts.BlockedUntil = time.Unix(0, blockedUntil)
+		if attempts.BlockedUntil.After(now) {
+			return attempts, false, nil
+		}
+		if time.Unix(0, lastFailure).Before(now.Add(-window)) {
+			attempts.Failures = 0
+		}
+	}
+	attempts.Failures++
+	attempts.BlockedUntil = now.Add(block(attempts.Failures))
+	_, err = tx.ExecContext(ctx, `INSERT INTO login_attempts (key, failures, last_failure, blocked_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET failures = excluded.failures, last_failure = excluded.last_failure, blocked_until = excluded.blocked_until`,
+		key, attempts.Failures, now.UnixNano(), attempts.BlockedUntil.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to register login attempt")
+		return domain.LoginAttempts{}, false, err
+	}
+	return attempts, true, tx.Commit()
+}
+
+func (ar *LoginAttemptRepository) ForgiveAttempt(ctx context.Context, key string, now time.Time, block func(failures int) time.Duration) error {
+	tx, err := ar.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+	var failures int
+	err = tx.QueryRowContext(ctx, "SELECT failures FROM login_attempts WHERE key = ?", key).Scan(&failures)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		log.Err(err).Msg("failed to get login attempts")
+		return err
+	}
+	failures--
+	if failures <= 0 {
+		_, err = tx.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = ?", key)
+	} else {
+		_, err = tx.ExecContext(ctx, "UPDATE login_attempts SET failures = ?, blocked_until = ? WHERE key = ?",
+			failures, now.Add(block(failures)).UnixNano(), key)
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to forgive login attempt")
+		return err
+	}
+	return tx.Commit()
+}
+
+func (ar *LoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	_, err := ar.db.ExecContext(ctx, "DELETE FROM login_attempts WHERE key = ?", key)
+	if err != nil {
+		log.Err(err).Msg("failed to reset login attempts")
+		return err
+	}
+	return nil
+}
+
+func (ar *LoginAttemptRepository) Close() {
+	ar.db.Close()
+}
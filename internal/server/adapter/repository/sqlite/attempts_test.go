@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoginAttemptRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	ar, err := NewLoginAttemptRepo(path)
+	require.NoError(t, err)
+	defer ar.Close()
+	ctx := context.Background()
+	now := time.Now().Round(0)
+	free := func(failures int) time.Duration { return 0 }
+
+	for i := 1; i <= 3; i++ {
+		attempts, allowed, err := ar.RegisterAttempt(ctx, "key", now, time.Minute, free)
+		require.NoError(t, err)
+		require.True(t, allowed)
+		require.Equal(t, i, attempts.Failures)
+	}
+	lock := func(failures int) time.Duration { return time.Hour }
+	attempts, allowed, err := ar.RegisterAttempt(ctx, "key", now, time.Minute, lock)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Equal(t, 4, attempts.Failures)
+	require.Equal(t, now.Add(time.Hour), attempts.BlockedUntil)
+
+	// a lockout survives a restart, blocked attempts are refused and not
+	// counted
+	reopened, err := NewLoginAttemptRepo(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	attempts, allowed, err = reopened.RegisterAttempt(ctx, "key", now.Add(time.Minute), time.Minute, free)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, 4, attempts.Failures)
+
+	require.NoError(t, ar.ForgiveAttempt(ctx, "key", now, free))
+	attempts, allowed, err = ar.RegisterAttempt(ctx, "key", now, time.Minute, free)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Equal(t, 4, attempts.Failures)
+
+	attempts, _, err = ar.RegisterAttempt(ctx, "key", now.Add(2*time.Minute), time.Minute, free)
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+
+	require.NoError(t, ar.Reset(ctx, "key"))
+	attempts, _, err = ar.RegisterAttempt(ctx, "key", now, time.Minute, free)
+	require.NoError(t, err)
+	require.Equal(t, 1, attempts.Failures)
+}
+
+func TestLoginAttemptRepository_Parallel(t *testing.T) {
+	ar, err := NewLoginAttemptRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer ar.Close()
+	ctx := context.Background()
+	now := time.Now()
+	// the second attempt blocks the key
+	block := func(failures int) time.Duration {
+		if failures >= 2 {
+			return time.Hour
+		}
+		return 0
+	}
+
+	var allowedCount atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, allowed, err := ar.RegisterAttempt(ctx, "key", now, time.Minute, block)
+			require.NoError(t, err)
+			if allowed {
+				allowedCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(2), allowedCount.Load())
+}
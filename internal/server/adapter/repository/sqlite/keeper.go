@@ -0,0 +1,450 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// itemChunkSize is the size of rows streamed items are split into.
+const itemChunkSize = 1 << 20
+
+// KeeperRepository stores item metadata next to the ciphertext, items are
+// always addressed together with their owner. Streamed items are kept in
+// item_chunks rows, so neither side holds the whole file in memory.
+type KeeperRepository struct {
+	db *sql.DB
+}
+
+func NewKeeperRepo(path string) (*KeeperRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &KeeperRepository{db: db}, nil
+}
+
+func (kr *KeeperRepository) GetAllData(ctx context.Context, userID domain.UserID) ([]domain.DataContext, error) {
+	rows, err := kr.db.QueryContext(ctx, "SELECT id, type, title, meta, encrypted FROM items WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		log.Err(err).Msg("failed to list items")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []domain.DataContext
+	for rows.Next() {
+		dataCtx := domain.DataContext{UserID: userID}
+		err = rows.Scan(&dataCtx.ID, &dataCtx.Type, &dataCtx.Title, &dataCtx.Meta, &dataCtx.Encrypted)
+		if err != nil {
+			log.Err(err).Msg("failed to scan item")
+			return nil, err
+		}
+		result = append(result, dataCtx)
+	}
+	if err = rows.Err(); err != nil {
+		log.Err(err).Msg("failed to list items")
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, domain.ErrNotFound
+	}
+	return result, nil
+}
+
+// Set creates item or replaces it when it belongs to the same user, item id
+// of another user is reported as domain.ErrNotFound.
+func (kr *KeeperRepository) Set(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
+	if len(dataCtx.UserID) == 0 {
+		return domain.ErrBadRequest
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	return kr.replace(ctx, dataCtx, data, sql.NullString{})
+}
+
+// replace stores item with data kept inline or, with version, with the chunks
+// written under it. Chunks of the replaced version are dropped once the item
+// no longer refers to them.
+func (kr *KeeperRepository) replace(ctx context.Context, dataCtx domain.DataContext, data []byte, version sql.NullString) error {
+	tx, err := kr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	var replaced sql.NullString
+	err = tx.QueryRowContext(ctx, "SELECT chunk_version FROM items WHERE user_id = ? AND id = ?", dataCtx.UserID, dataCtx.ID).Scan(&replaced)
+	if err != nil && err != sql.ErrNoRows {
+		log.Err(err).Msg("failed to get item chunks")
+		return err
+	}
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO items (id, user_id, type, title, meta, encrypted, data, chunk_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET type = excluded.type, title = excluded.title, meta = excluded.meta,
+			encrypted = excluded.encrypted, data = excluded.data, chunk_version = excluded.chunk_version
+		WHERE items.user_id = excluded.user_id`,
+		dataCtx.ID, dataCtx.UserID, dataCtx.Type, dataCtx.Title, dataCtx.Meta, dataCtx.Encrypted, data, version)
+	if err != nil {
+		log.Err(err).Msg("failed to set item")
+		return err
+	}
+	err = expectRow(result, domain.ErrNotFound)
+	if err == domain.ErrNotFound {
+		log.Warn().Msgf("user '%s' tried to overwrite item '%s' of another user", dataCtx.UserID, dataCtx.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Err(err).Msg("failed to commit item")
+		return err
+	}
+	if replaced.Valid {
+		kr.dropChunks(ctx, dataCtx.ID, replaced.String)
+	}
+	return nil
+}
+
+func (kr *KeeperRepository) GetData(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+	stream, err := kr.GetStream(ctx, dataCtx)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		log.Err(err).Msg("failed to read item chunks")
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReplaceData replaces data of item only while it still holds old. Data kept
+// inline is compared by the update itself, chunked data is compared with the
+// chunks of the current version, which is then switched to a new one only if
+// no writer switched it meanwhile.
+func (kr *KeeperRepository) ReplaceData(ctx context.Context, dataCtx domain.DataContext, old, data []byte) error {
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	result, err := kr.db.ExecContext(ctx, "UPDATE items SET data = ? WHERE user_id = ? AND id = ? AND chunk_version IS NULL AND data = ?",
+		data, dataCtx.UserID, dataCtx.ID, old)
+	if err != nil {
+		log.Err(err).Msg("failed to replace item data")
+		return err
+	}
+	err = expectRow(result, domain.ErrNotFound)
+	if err != domain.ErrNotFound {
+		return err
+	}
+
+	var version sql.NullString
+	err = kr.db.QueryRowContext(ctx, "SELECT chunk_version FROM items WHERE user_id = ? AND id = ?", dataCtx.UserID, dataCtx.ID).
+		Scan(&version)
+	if err == sql.ErrNoRows || (err == nil && !version.Valid) {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to get item chunks")
+		return err
+	}
+	current, err := io.ReadAll(&chunkReader{ctx: ctx, db: kr.db, id: dataCtx.ID, version: version.String})
+	if err == io.ErrUnexpectedEOF || (err == nil && !bytes.Equal(current, old)) {
+		return domain.ErrNotFound
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to read item chunks")
+		return err
+	}
+
+	replacement := uuid.NewString()
+	err = kr.writeChunks(ctx, dataCtx.ID, replacement, bytes.NewReader(data))
+	if err == nil {
+		err = kr.switchChunks(ctx, dataCtx, version.String, replacement)
+	}
+	if err != nil {
+		kr.dropChunks(ctx, dataCtx.ID, replacement)
+		return err
+	}
+	kr.dropChunks(ctx, dataCtx.ID, version.String)
+	return nil
+}
+
+// ReplaceHead overwrites the head of data kept inline, or the head of the
+// first chunk row of the current version, with a single update comparing it
+// in place. The rest of the data never leaves the database.
+func (kr *KeeperRepository) ReplaceHead(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	// || works on text, the cast keeps bytes of the blobs as they are
+	result, err := kr.db.ExecContext(ctx,
+		`UPDATE items SET data = CAST(? || substr(data, ?) AS BLOB)
+		WHERE user_id = ? AND id = ? AND chunk_version IS NULL AND length(data) >= ? AND substr(data, 1, ?) = ?`,
+		head, len(old)+1, dataCtx.UserID, dataCtx.ID, len(old), len(old), old)
+	if err != nil {
+		log.Err(err).Msg("failed to replace item head")
+		return err
+	}
+	err = expectRow(result, domain.ErrNotFound)
+	if err != domain.ErrNotFound {
+		return err
+	}
+
+	result, err = kr.db.ExecContext(ctx,
+		`UPDATE item_chunks SET data = CAST(? || substr(data, ?) AS BLOB)
+		WHERE item_id = ? AND seq = 0 AND length(data) >= ? AND substr(data, 1, ?) = ?
+			AND version = (SELECT chunk_version FROM items WHERE user_id = ? AND id = ?)`,
+		head, len(old)+1, dataCtx.ID, len(old), len(old), old, dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msg("failed to replace item head")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+// switchChunks moves item from chunks of version to chunks of replacement,
+// item switched by another writer is reported as domain.ErrNotFound.
+func (kr *KeeperRepository) switchChunks(ctx context.Context, dataCtx domain.DataContext, version, replacement string) error {
+	tx, err := kr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE items SET chunk_version = ? WHERE user_id = ? AND id = ? AND chunk_version = ?",
+		replacement, dataCtx.UserID, dataCtx.ID, version)
+	if err != nil {
+		log.Err(err).Msg("failed to switch item chunks")
+		return err
+	}
+	if err = expectRow(result, domain.ErrNotFound); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Err(err).Msg("failed to commit item")
+		return err
+	}
+	return nil
+}
+
+// SetStream writes src in rows of itemChunkSize bytes under a new version and
+// then switches the item to it, so a failed upload leaves the stored version
+// untouched.
+func (kr *KeeperRepository) SetStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	if len(dataCtx.UserID) == 0 {
+		return domain.ErrBadRequest
+	}
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	version := uuid.NewString()
+	err := kr.writeChunks(ctx, dataCtx.ID, version, src)
+	if err == nil {
+		err = kr.replace(ctx, dataCtx, []byte{}, sql.NullString{String: version, Valid: true})
+	}
+	if err != nil {
+		kr.dropChunks(ctx, dataCtx.ID, version)
+		return err
+	}
+	return nil
+}
+
+func (kr *KeeperRepository) writeChunks(ctx context.Context, id domain.DataID, version string, src io.Reader) error {
+	chunk := make([]byte, itemChunkSize)
+	for seq := 0; ; seq++ {
+		n, err := io.ReadFull(src, chunk)
+		if err == io.EOF && seq > 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			log.Err(err).Msg("failed to read item data")
+			return err
+		}
+		_, execErr := kr.db.ExecContext(ctx, "INSERT INTO item_chunks (item_id, version, seq, data, created_at) VALUES (?, ?, ?, ?, ?)",
+			id, version, seq, chunk[:n], time.Now().UnixNano())
+		if execErr != nil {
+			log.Err(execErr).Msg("failed to write item chunk")
+			return execErr
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// dropChunks removes chunks of version, failures only leave unreferenced
+// rows behind.
+func (kr *KeeperRepository) dropChunks(ctx context.Context, id domain.DataID, version string) {
+	_, err := kr.db.ExecContext(context.WithoutCancel(ctx), "DELETE FROM item_chunks WHERE item_id = ? AND version = ?", id, version)
+	if err != nil {
+		log.Err(err).Msgf("failed to drop chunks of item '%s'", id)
+	}
+}
+
+// DropStaleChunks removes chunk rows of versions no item refers to whose
+// newest row was written before the given time: uploads cut off by a crash
+// and versions dropChunks failed to remove. An upload in progress keeps
+// writing rows, so its version is never stale.
+func (kr *KeeperRepository) DropStaleChunks(ctx context.Context, before time.Time) (int64, error) {
+	result, err := kr.db.ExecContext(ctx,
+		`DELETE FROM item_chunks WHERE (item_id, version) IN (
+			SELECT c.item_id, c.version FROM item_chunks c
+			WHERE NOT EXISTS (SELECT 1 FROM items i WHERE i.id = c.item_id AND i.chunk_version = c.version)
+			GROUP BY c.item_id, c.version HAVING max(c.created_at) < ?)`,
+		before.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to drop stale item chunks")
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetStream returns data kept inline or reader fetching one chunk row at a
+// time. Chunks of a version replaced while it is read are gone, the reader
+// then fails.
+func (kr *KeeperRepository) GetStream(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+	if !dataCtx.ID.IsValid() {
+		return nil, domain.ErrInvalidDataID
+	}
+	var data []byte
+	var version sql.NullString
+	err := kr.db.QueryRowContext(ctx, "SELECT data, chunk_version FROM items WHERE user_id = ? AND id = ?", dataCtx.UserID, dataCtx.ID).
+		Scan(&data, &version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to get item data")
+		return nil, err
+	}
+	if !version.Valid {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return &chunkReader{ctx: ctx, db: kr.db, id: dataCtx.ID, version: version.String}, nil
+}
+
+// chunkReader reads chunk rows of an item version in order.
+type chunkReader struct {
+	ctx     context.Context
+	db      *sql.DB
+	id      domain.DataID
+	version string
+	seq     int
+	chunk   []byte
+	done    bool
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.chunk) == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		var last bool
+		err := cr.db.QueryRowContext(cr.ctx,
+			`SELECT data, NOT EXISTS (SELECT 1 FROM item_chunks WHERE item_id = ? AND version = ? AND seq = ?)
+			FROM item_chunks WHERE item_id = ? AND version = ? AND seq = ?`,
+			cr.id, cr.version, cr.seq+1, cr.id, cr.version, cr.seq).Scan(&cr.chunk, &last)
+		if err == sql.ErrNoRows {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			log.Err(err).Msg("failed to read item chunk")
+			return 0, err
+		}
+		cr.seq++
+		cr.done = last
+	}
+	n := copy(p, cr.chunk)
+	cr.chunk = cr.chunk[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) Close() error {
+	return nil
+}
+
+func (kr *KeeperRepository) GetMeta(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
+	if !id.IsValid() {
+		return domain.DataContext{}, domain.ErrInvalidDataID
+	}
+	dataCtx := domain.DataContext{ID: id, UserID: userID}
+	err := kr.db.QueryRowContext(ctx, "SELECT type, title, meta, encrypted FROM items WHERE user_id = ? AND id = ?", userID, id).
+		Scan(&dataCtx.Type, &dataCtx.Title, &dataCtx.Meta, &dataCtx.Encrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.DataContext{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to get item meta")
+		return domain.DataContext{}, err
+	}
+	return dataCtx, nil
+}
+
+func (kr *KeeperRepository) Delete(ctx context.Context, dataCtx domain.DataContext) error {
+	if !dataCtx.ID.IsValid() {
+		return domain.ErrInvalidDataID
+	}
+	err := kr.deleteItems(ctx, "DELETE FROM items WHERE user_id = ? AND id = ? RETURNING id, chunk_version", dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msg("failed to delete item")
+		return err
+	}
+	return nil
+}
+
+func (kr *KeeperRepository) DeleteAll(ctx context.Context, userID domain.UserID) error {
+	if len(userID) == 0 {
+		return domain.ErrBadRequest
+	}
+	err := kr.deleteItems(ctx, "DELETE FROM items WHERE user_id = ? RETURNING id, chunk_version", userID)
+	if err != nil {
+		log.Err(err).Msg("failed to delete items of user")
+		return err
+	}
+	return nil
+}
+
+// deleteItems runs query deleting items and drops chunks of the deleted
+// versions.
+func (kr *KeeperRepository) deleteItems(ctx context.Context, query string, args ...any) error {
+	rows, err := kr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	chunked := map[domain.DataID]string{}
+	for rows.Next() {
+		var id domain.DataID
+		var version sql.NullString
+		if err := rows.Scan(&id, &version); err != nil {
+			return err
+		}
+		if version.Valid {
+			chunked[id] = version.String
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	for id, version := range chunked {
+		kr.dropChunks(ctx, id, version)
+	}
+	return nil
+}
+
+func (kr *KeeperRepository) Close() {
+	kr.db.Close()
+}
@@ -0,0 +1,155 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeeperRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	repo, err := NewKeeperRepo(path)
+	require.NoError(t, err)
+	defer repo.Close()
+	ctx := context.Background()
+	_, err = repo.GetAllData(ctx, domain.UserID("id"))
+	require.Equal(t, domain.ErrNotFound, err)
+	dataCtx := domain.DataContext{
+		ID:     "5f0c6a54-2b7e-4d1a-9c3b-8e2f1a6d4b7c",
+		UserID: "user_id",
+		Meta:   "meta",
+		Title:  "title",
+		Type:   domain.BinaryType,
+	}
+	data := []byte("data")
+	require.NoError(t, repo.Set(ctx, dataCtx, data))
+	actualData, err := repo.GetData(ctx, dataCtx)
+	require.NoError(t, err)
+	require.Equal(t, data, actualData)
+	actualMeta, err := repo.GetMeta(ctx, domain.UserID("user_id"), dataCtx.ID)
+	require.NoError(t, err)
+	require.Equal(t, dataCtx, actualMeta)
+	expectedData, err := repo.GetAllData(ctx, domain.UserID("user_id"))
+	require.NoError(t, err)
+	require.Equal(t, []domain.DataContext{dataCtx}, expectedData)
+
+	// items of another user are neither readable nor replaceable
+	stolen := dataCtx
+	stolen.UserID = "other"
+	_, err = repo.GetData(ctx, stolen)
+	require.Equal(t, domain.ErrNotFound, err)
+	require.Equal(t, domain.ErrNotFound, repo.Set(ctx, stolen, []byte("other")))
+	require.NoError(t, repo.Delete(ctx, stolen))
+	require.Equal(t, domain.ErrInvalidDataID, repo.Delete(ctx, domain.DataContext{ID: "..", UserID: dataCtx.UserID}))
+	actualData, err = repo.GetData(ctx, dataCtx)
+	require.NoError(t, err)
+	require.Equal(t, data, actualData)
+
+	// the user repository shares the database file
+	users, err := NewUserRepo(path)
+	require.NoError(t, err)
+	users.Close()
+
+	require.NoError(t, repo.Delete(ctx, dataCtx))
+	_, err = repo.GetData(ctx, dataCtx)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, repo.Set(ctx, dataCtx, data))
+	require.Equal(t, domain.ErrBadRequest, repo.DeleteAll(ctx, ""))
+	require.NoError(t, repo.DeleteAll(ctx, dataCtx.UserID))
+	_, err = repo.GetAllData(ctx, dataCtx.UserID)
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestKeeperRepository_Chunks(t *testing.T) {
+	repo, err := NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer repo.Close()
+	ctx := context.Background()
+	chunks := func() int {
+		var count int
+		require.NoError(t, repo.db.QueryRow("SELECT count(*) FROM item_chunks").Scan(&count))
+		return count
+	}
+
+	file := domain.DataContext{ID: "5f0c6a54-2b7e-4d1a-9c3b-8e2f1a6d4b7c", UserID: "user_id", Type: domain.BinaryType}
+	content := bytes.Repeat([]byte("x"), 2*itemChunkSize+1)
+	require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+	require.Equal(t, 3, chunks())
+	var inline []byte
+	require.NoError(t, repo.db.QueryRow("SELECT data FROM items WHERE id = ?", file.ID).Scan(&inline))
+	require.Empty(t, inline)
+
+	// the replaced version is dropped
+	require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content[:itemChunkSize])))
+	require.Equal(t, 1, chunks())
+	require.NoError(t, repo.Set(ctx, file, []byte("inline")))
+	require.Zero(t, chunks())
+
+	// upload to an item of another user leaves nothing behind
+	stolen := file
+	stolen.UserID = "other"
+	require.Equal(t, domain.ErrNotFound, repo.SetStream(ctx, stolen, bytes.NewReader(content)))
+	require.Zero(t, chunks())
+
+	require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+	require.NoError(t, repo.Delete(ctx, file))
+	require.Zero(t, chunks())
+	require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+	require.NoError(t, repo.DeleteAll(ctx, file.UserID))
+	require.Zero(t, chunks())
+}
+
+func TestKeeperRepository_DropStaleChunks(t *testing.T) {
+	repo, err := NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer repo.Close()
+	ctx := context.Background()
+
+	file := domain.DataContext{ID: "5f0c6a54-2b7e-4d1a-9c3b-8e2f1a6d4b7c", UserID: "user_id", Type: domain.BinaryType}
+	content := bytes.Repeat([]byte("x"), itemChunkSize+1)
+	require.NoError(t, repo.SetStream(ctx, file, bytes.NewReader(content)))
+	var current string
+	require.NoError(t, repo.db.QueryRow("SELECT chunk_version FROM items WHERE id = ?", file.ID).Scan(&current))
+
+	old := time.Now().Add(-48 * time.Hour).UnixNano()
+	insert := func(id domain.DataID, version string, createdAt int64) {
+		_, err := repo.db.Exec("INSERT INTO item_chunks (item_id, version, seq, data, created_at) VALUES (?, ?, 0, ?, ?)",
+			id, version, []byte("x"), createdAt)
+		require.NoError(t, err)
+	}
+	// interrupted uploads of an existing and of a never created item
+	insert(file.ID, "crashed", old)
+	insert("1b2e6c0a-7d4f-4e8b-a3c9-5d6f7a8b9c0d", "orphan", old)
+	// upload in progress
+	insert(file.ID, "uploading", time.Now().UnixNano())
+	_, err = repo.db.Exec("UPDATE item_chunks SET created_at = ? WHERE item_id = ? AND version = ?", old, file.ID, current)
+	require.NoError(t, err)
+
+	dropped, err := repo.DropStaleChunks(ctx, time.Now().Add(-24*time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 2, dropped)
+
+	var left int
+	require.NoError(t, repo.db.QueryRow("SELECT count(*) FROM item_chunks WHERE version = ?", "uploading").Scan(&left))
+	require.Equal(t, 1, left)
+	data, err := repo.GetData(ctx, file)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+}
+
+func TestKeeperRepository_Conformance(t *testing.T) {
+	conformance.TestKeeperRepository(t, func(t *testing.T) port.KeeperRepository {
+		repo, err := NewKeeperRepo(filepath.Join(t.TempDir(), "keeper.db"))
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
@@ -0,0 +1,19 @@
+CREATE TABLE users (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	password TEXT NOT NULL,
+	vault_key BLOB,
+	totp_secret BLOB,
+	totp_enabled INTEGER NOT NULL DEFAULT 0,
+	totp_last_step INTEGER NOT NULL DEFAULT 0,
+	recovery_codes TEXT NOT NULL DEFAULT '');
+
+CREATE TABLE items (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	title TEXT NOT NULL,
+	meta TEXT NOT NULL,
+	encrypted INTEGER NOT NULL DEFAULT 0,
+	data BLOB NOT NULL);
+CREATE INDEX items_user ON items (user_id);
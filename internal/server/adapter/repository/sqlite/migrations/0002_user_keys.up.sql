@@ -0,0 +1,3 @@
+CREATE TABLE user_keys (
+	user_id TEXT PRIMARY KEY,
+	wrapped_key BLOB NOT NULL);
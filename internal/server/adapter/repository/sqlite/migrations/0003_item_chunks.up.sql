@@ -0,0 +1,8 @@
+ALTER TABLE items ADD COLUMN chunk_version TEXT;
+
+CREATE TABLE item_chunks (
+	item_id TEXT NOT NULL,
+	version TEXT NOT NULL,
+	seq INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	PRIMARY KEY (item_id, version, seq));
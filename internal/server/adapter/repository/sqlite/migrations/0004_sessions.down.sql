@@ -0,0 +1,6 @@
+DROP TABLE personal_tokens;
+DROP TABLE login_attempts;
+DROP TABLE login_challenges;
+DROP TABLE revoked_users;
+DROP TABLE revoked_tokens;
+DROP TABLE refresh_tokens;
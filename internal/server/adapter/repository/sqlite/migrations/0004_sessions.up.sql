@@ -0,0 +1,35 @@
+CREATE TABLE refresh_tokens (
+	hash BLOB PRIMARY KEY,
+	family TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	user_name TEXT NOT NULL,
+	expires_at INTEGER NOT NULL,
+	session_start INTEGER NOT NULL,
+	used INTEGER NOT NULL DEFAULT 0);
+CREATE INDEX refresh_tokens_family ON refresh_tokens (family);
+CREATE INDEX refresh_tokens_user ON refresh_tokens (user_id);
+CREATE TABLE revoked_tokens (jti TEXT PRIMARY KEY, expires_at INTEGER NOT NULL);
+CREATE TABLE revoked_users (user_id TEXT PRIMARY KEY, revoked_before INTEGER NOT NULL);
+CREATE TABLE login_challenges (
+	hash BLOB PRIMARY KEY,
+	user_name TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL);
+
+CREATE TABLE login_attempts (
+	key TEXT PRIMARY KEY,
+	failures INTEGER NOT NULL,
+	last_failure INTEGER NOT NULL,
+	blocked_until INTEGER NOT NULL);
+
+CREATE TABLE personal_tokens (
+	hash BLOB PRIMARY KEY,
+	id TEXT UNIQUE NOT NULL,
+	user_id TEXT NOT NULL,
+	user_name TEXT NOT NULL,
+	name TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	item_ids TEXT NOT NULL DEFAULT '',
+	created_at INTEGER NOT NULL,
+	expires_at INTEGER NOT NULL);
+CREATE INDEX personal_tokens_user ON personal_tokens (user_id);
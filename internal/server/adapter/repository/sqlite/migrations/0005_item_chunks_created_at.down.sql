@@ -0,0 +1 @@
+ALTER TABLE item_chunks DROP COLUMN created_at;
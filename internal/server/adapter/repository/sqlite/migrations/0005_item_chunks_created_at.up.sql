@@ -0,0 +1 @@
+ALTER TABLE item_chunks ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type PersonalTokenRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalTokenRepo(path string) (*PersonalTokenRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &PersonalTokenRepository{db: db}, nil
+}
+
+func (pr *PersonalTokenRepository) CreatePersonalToken(ctx context.Context, token domain.PersonalToken) error {
+	_, err := pr.db.ExecContext(ctx, "DELETE FROM personal_tokens WHERE expires_at < ?", time.Now().UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to purge personal tokens")
+		return err
+	}
+	_, err = pr.db.ExecContext(ctx,
+		`INSERT INTO personal_tokens (hash, id, user_id, user_name, name, scopes, item_ids, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		token.Hash, token.ID, token.UserID, token.UserName, token.Name,
+		encodeScopes(token.Scopes), encodeItemIDs(token.ItemIDs), token.CreatedAt.UnixNano(), token.ExpiresAt.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to create personal token")
+		return err
+	}
+	return nil
+}
+
+func (pr *PersonalTokenRepository) GetPersonalToken(ctx context.Context, hash []byte) (domain.PersonalToken, error) {
+	row := pr.db.QueryRowContext(ctx,
+		"SELECT hash, id, user_id, user_name, name, scopes, item_ids, created_at, expires_at FROM personal_tokens WHERE hash = ?", hash)
+	token, err := scanPersonalToken(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.PersonalToken{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to get personal token")
+		return domain.PersonalToken{}, err
+	}
+	return token, nil
+}
+
+func (pr *PersonalTokenRepository) ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error) {
+	rows, err := pr.db.QueryContext(ctx,
+		"SELECT hash, id, user_id, user_name, name, scopes, item_ids, created_at, expires_at FROM personal_tokens WHERE user_id = ? ORDER BY created_at", userID)
+	if err != nil {
+		log.Err(err).Msg("failed to list personal tokens")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []domain.PersonalToken
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			log.Err(err).Msg("failed to scan personal token")
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (pr *PersonalTokenRepository) DeletePersonalToken(ctx context.Context, userID domain.UserID, id string) error {
+	result, err := pr.db.ExecContext(ctx, "DELETE FROM personal_tokens WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		log.Err(err).Msg("failed to delete personal token")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (pr *PersonalTokenRepository) DeleteUserTokens(ctx context.Context, userID domain.UserID) error {
+	_, err := pr.db.ExecContext(ctx, "DELETE FROM personal_tokens WHERE user_id = ?", userID)
+	if err != nil {
+		log.Err(err).Msg("failed to delete personal tokens of user")
+		return err
+	}
+	return nil
+}
+
+func (pr *PersonalTokenRepository) Close() {
+	pr.db.Close()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPersonalToken(row rowScanner) (domain.PersonalToken, error) {
+	var token domain.PersonalToken
+	var scopes, itemIDs string
+	var createdAt, expiresAt int64
+	err := row.Scan(&token.Hash, &token.ID, &token.UserID, &token.UserName, &token.Name, &scopes, &itemIDs, &createdAt, &expiresAt)
+	if err != nil {
+		return domain.PersonalToken{}, err
+	}
+	token.CreatedAt = time.Unix(0, createdAt)
+	token.ExpiresAt = time.Unix(0, expiresAt)
+	for _, scope := range splitList(scopes) {
+		token.Scopes = append(token.Scopes, domain.Scope(scope))
+	}
+	for _, id := range splitList(itemIDs) {
+		token.ItemIDs = append(token.ItemIDs, domain.DataID(id))
+	}
+	return token, nil
+}
+
+// scopes and item ids never contain commas, they are stored comma separated.
+func encodeScopes(scopes []domain.Scope) string {
+	fields := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		fields = append(fields, string(scope))
+	}
+	return strings.Join(fields, ",")
+}
+
+func encodeItemIDs(ids []domain.DataID) string {
+	fields := make([]string, 0, len(ids))
+	for _, id := range ids {
+		fields = append(fields, string(id))
+	}
+	return strings.Join(fields, ",")
+}
+
+func splitList(encoded string) []string {
+	if len(encoded) == 0 {
+		return nil
+	}
+	return strings.Split(encoded, ",")
+}
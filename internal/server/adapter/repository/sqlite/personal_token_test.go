@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalTokenRepository(t *testing.T) {
+	pr, err := NewPersonalTokenRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer pr.Close()
+	ctx := context.Background()
+	now := time.Now().Round(0)
+	expiresAt := now.Add(time.Hour)
+	first := domain.PersonalToken{ID: "first", UserID: "id", UserName: "name", Name: "ci", Hash: []byte("first"),
+		Scopes: []domain.Scope{domain.ScopeReadItems, domain.ScopeReadFile}, ItemIDs: []domain.DataID{"item"},
+		CreatedAt: now, ExpiresAt: expiresAt}
+	second := domain.PersonalToken{ID: "second", UserID: "id", Hash: []byte("second"), CreatedAt: now.Add(time.Second), ExpiresAt: expiresAt}
+	other := domain.PersonalToken{ID: "other", UserID: "other", Hash: []byte("other"), CreatedAt: now, ExpiresAt: expiresAt}
+	for _, token := range []domain.PersonalToken{second, first, other} {
+		require.NoError(t, pr.CreatePersonalToken(ctx, token))
+	}
+
+	token, err := pr.GetPersonalToken(ctx, []byte("first"))
+	require.NoError(t, err)
+	require.Equal(t, first, token)
+	_, err = pr.GetPersonalToken(ctx, []byte("unknown"))
+	require.Equal(t, domain.ErrNotFound, err)
+
+	tokens, err := pr.ListPersonalTokens(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, []domain.PersonalToken{first, second}, tokens)
+
+	require.Equal(t, domain.ErrNotFound, pr.DeletePersonalToken(ctx, "id", "other"))
+	require.NoError(t, pr.DeletePersonalToken(ctx, "id", "first"))
+	_, err = pr.GetPersonalToken(ctx, []byte("first"))
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, pr.DeleteUserTokens(ctx, "id"))
+	tokens, err = pr.ListPersonalTokens(ctx, "id")
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+	_, err = pr.GetPersonalToken(ctx, []byte("other"))
+	require.NoError(t, err)
+}
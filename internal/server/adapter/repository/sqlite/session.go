@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// SessionRepository keeps sessions in the database file, so they survive a
+// restart of a single node server. Times are stored as unix nanoseconds.
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepo(path string) (*SessionRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SessionRepository{db: db}, nil
+}
+
+func (sr *SessionRepository) CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE expires_at < ?", time.Now().UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to purge refresh tokens")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO refresh_tokens (hash, family, user_id, user_name, expires_at, session_start) VALUES (?, ?, ?, ?, ?, ?)",
+		token.Hash, token.Family, token.UserID, token.UserName, token.ExpiresAt.UnixNano(), token.SessionStart.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to create refresh token")
+		return err
+	}
+	return nil
+}
+
+// UseRefreshToken reads and marks the token in one transaction, it takes the
+// write lock when it begins, so only one of concurrent callers sees the token
+// unused.
+func (sr *SessionRepository) UseRefreshToken(ctx context.Context, hash []byte) (domain.RefreshToken, error) {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return domain.RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	token := domain.RefreshToken{Hash: hash}
+	var expiresAt, sessionStart int64
+	var used bool
+	err = tx.QueryRowContext(ctx,
+		"SELECT family, user_id, user_name, expires_at, session_start, used FROM refresh_tokens WHERE hash = ?", hash).
+		Scan(&token.Family, &token.UserID, &token.UserName, &expiresAt, &sessionStart, &used)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.RefreshToken{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to use refresh token")
+		return domain.RefreshToken{}, err
+	}
+	token.ExpiresAt = time.Unix(0, expiresAt)
+	token.SessionStart = time.Unix(0, sessionStart)
+	if used {
+		return token, domain.ErrTokenReused
+	}
+
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET used = 1 WHERE hash = ?", hash)
+	if err != nil {
+		log.Err(err).Msg("failed to use refresh token")
+		return domain.RefreshToken{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Err(err).Msg("failed to commit refresh token")
+		return domain.RefreshToken{}, err
+	}
+	return token, nil
+}
+
+func (sr *SessionRepository) RevokeFamily(ctx context.Context, family string) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE family = ?", family)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke refresh tokens")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to purge revoked tokens")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?) ON CONFLICT (jti) DO NOTHING",
+		tokenID, expiresAt.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to revoke access token")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	var revoked bool
+	err := sr.db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = ?)", tokenID).Scan(&revoked)
+	if err != nil {
+		log.Err(err).Msg("failed to check revoked token")
+		return false, err
+	}
+	return revoked, nil
+}
+
+func (sr *SessionRepository) RevokeUser(ctx context.Context, id domain.UserID, before time.Time) error {
+	tx, err := sr.db.BeginTx(ctx, nil)
+	if err != nil {
+		log.Err(err).Msg("failed to begin transaction")
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = ?", id)
+	if err != nil {
+		log.Err(err).Msg("failed to revoke refresh tokens of user")
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO revoked_users (user_id, revoked_before) VALUES (?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = excluded.revoked_before`, id, before.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to revoke user tokens")
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		log.Err(err).Msg("failed to commit user revocation")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) UserRevokedBefore(ctx context.Context, id domain.UserID) (time.Time, error) {
+	var before int64
+	err := sr.db.QueryRowContext(ctx, "SELECT revoked_before FROM revoked_users WHERE user_id = ?", id).Scan(&before)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, nil
+		}
+		log.Err(err).Msg("failed to get user revocation")
+		return time.Time{}, err
+	}
+	return time.Unix(0, before), nil
+}
+
+func (sr *SessionRepository) CreateChallenge(ctx context.Context, challenge domain.LoginChallenge) error {
+	_, err := sr.db.ExecContext(ctx, "DELETE FROM login_challenges WHERE expires_at < ?", time.Now().UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to purge login challenges")
+		return err
+	}
+	_, err = sr.db.ExecContext(ctx,
+		"INSERT INTO login_challenges (hash, user_name, attempts, expires_at) VALUES (?, ?, ?, ?)",
+		challenge.Hash, challenge.UserName, challenge.Attempts, challenge.ExpiresAt.UnixNano())
+	if err != nil {
+		log.Err(err).Msg("failed to create login challenge")
+		return err
+	}
+	return nil
+}
+
+func (sr *SessionRepository) TakeChallenge(ctx context.Context, hash []byte) (domain.LoginChallenge, error) {
+	challenge := domain.LoginChallenge{Hash: hash}
+	var expiresAt int64
+	row := sr.db.QueryRowContext(ctx,
+		"DELETE FROM login_challenges WHERE hash = ? RETURNING user_name, attempts, expires_at", hash)
+	err := row.Scan(&challenge.UserName, &challenge.Attempts, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.LoginChallenge{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to take login challenge")
+		return domain.LoginChallenge{}, err
+	}
+	challenge.ExpiresAt = time.Unix(0, expiresAt)
+	return challenge, nil
+}
+
+func (sr *SessionRepository) Close() {
+	sr.db.Close()
+}
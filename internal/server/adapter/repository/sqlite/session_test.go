@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keeper.db")
+	sr, err := NewSessionRepo(path)
+	require.NoError(t, err)
+	defer sr.Close()
+	ctx := context.Background()
+	now := time.Now().Round(0)
+	token := domain.RefreshToken{Hash: []byte("hash"), Family: "family", UserID: "id", UserName: "name",
+		ExpiresAt: now.Add(time.Hour), SessionStart: now}
+	require.NoError(t, sr.CreateRefreshToken(ctx, token))
+
+	_, err = sr.UseRefreshToken(ctx, []byte("other"))
+	require.Equal(t, domain.ErrNotFound, err)
+	used, err := sr.UseRefreshToken(ctx, token.Hash)
+	require.NoError(t, err)
+	require.Equal(t, token, used)
+
+	// sessions survive a restart
+	reopened, err := NewSessionRepo(path)
+	require.NoError(t, err)
+	defer reopened.Close()
+	used, err = reopened.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrTokenReused, err)
+	require.Equal(t, "family", used.Family)
+
+	require.NoError(t, sr.RevokeFamily(ctx, "family"))
+	_, err = sr.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrNotFound, err)
+
+	require.NoError(t, sr.RevokeAccessToken(ctx, "expired", now.Add(-time.Minute)))
+	require.NoError(t, sr.RevokeAccessToken(ctx, "jti", now.Add(time.Minute)))
+	revoked, err := sr.IsAccessTokenRevoked(ctx, "jti")
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = sr.IsAccessTokenRevoked(ctx, "expired")
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	before, err := sr.UserRevokedBefore(ctx, "id")
+	require.NoError(t, err)
+	require.True(t, before.IsZero())
+	require.NoError(t, sr.CreateRefreshToken(ctx, token))
+	require.NoError(t, sr.RevokeUser(ctx, "id", now))
+	_, err = sr.UseRefreshToken(ctx, token.Hash)
+	require.Equal(t, domain.ErrNotFound, err)
+	before, err = sr.UserRevokedBefore(ctx, "id")
+	require.NoError(t, err)
+	require.Equal(t, now, before)
+
+	challenge := domain.LoginChallenge{Hash: []byte("challenge"), UserName: "name", Attempts: 2, ExpiresAt: now.Add(time.Minute)}
+	require.NoError(t, sr.CreateChallenge(ctx, challenge))
+	taken, err := sr.TakeChallenge(ctx, challenge.Hash)
+	require.NoError(t, err)
+	require.Equal(t, challenge, taken)
+	_, err = sr.TakeChallenge(ctx, challenge.Hash)
+	require.Equal(t, domain.ErrNotFound, err)
+}
+
+func TestSessionRepository_Reuse(t *testing.T) {
+	sr, err := NewSessionRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer sr.Close()
+	ctx := context.Background()
+	token := domain.RefreshToken{Hash: []byte("hash"), Family: "family", UserID: "id", ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, sr.CreateRefreshToken(ctx, token))
+
+	// only one of parallel refreshes gets the token unused
+	results := make(chan error, 20)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			_, err := sr.UseRefreshToken(ctx, token.Hash)
+			results <- err
+		}()
+	}
+	unused := 0
+	for i := 0; i < cap(results); i++ {
+		err := <-results
+		if err == nil {
+			unused++
+			continue
+		}
+		require.Equal(t, domain.ErrTokenReused, err)
+	}
+	require.Equal(t, 1, unused)
+}
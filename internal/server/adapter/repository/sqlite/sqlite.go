@@ -0,0 +1,97 @@
+// Package sqlite stores users and items in a single SQLite file, for single
+// node deployments without a database server.
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"io/fs"
+	"net/url"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/migration"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// open opens the database in WAL mode, so readers do not block the writer,
+// and applies pending migrations. Writers of several connections wait for
+// each other up to the busy timeout, transactions take the write lock when
+// they begin, so one reading before it writes does not fail on a concurrent
+// commit.
+func open(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma": {
+			"journal_mode(WAL)",
+			"busy_timeout(5000)",
+			"synchronous(NORMAL)",
+			"foreign_keys(ON)",
+		},
+		"_txlock": {"immediate"},
+	}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		log.Err(err).Msg("failed to open sqlite database")
+		return nil, err
+	}
+
+	files, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	runner, err := migration.New(db, migration.SQLite, files)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	_, err = runner.Up(context.Background())
+	if err != nil {
+		log.Err(err).Msg("failed to migrate sqlite database")
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// removeHash returns hashes without hash and whether it was there.
+func removeHash(hashes [][]byte, hash []byte) ([][]byte, bool) {
+	for i, stored := range hashes {
+		if bytes.Equal(stored, hash) {
+			remaining := make([][]byte, 0, len(hashes)-1)
+			remaining = append(remaining, hashes[:i]...)
+			return append(remaining, hashes[i+1:]...), true
+		}
+	}
+	return hashes, false
+}
+
+// encodeHashes stores recovery code hashes as comma separated hex.
+func encodeHashes(hashes [][]byte) string {
+	encoded := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		encoded = append(encoded, hex.EncodeToString(hash))
+	}
+	return strings.Join(encoded, ",")
+}
+
+func decodeHashes(encoded string) ([][]byte, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	var hashes [][]byte
+	for _, field := range strings.Split(encoded, ",") {
+		hash, err := hex.DecodeString(field)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
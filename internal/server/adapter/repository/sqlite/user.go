@@ -0,0 +1,173 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type UserRepository struct {
+	db *sql.DB
+}
+
+func NewUserRepo(path string) (*UserRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &UserRepository{db: db}, nil
+}
+
+func (us *UserRepository) CreateUser(ctx context.Context, user domain.User) error {
+	result, err := us.db.ExecContext(ctx,
+		"INSERT INTO users (id, name, password, vault_key) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+		user.ID, user.Name, user.Password, user.VaultKey)
+	if err != nil {
+		log.Err(err).Msg("failed to create user")
+		return err
+	}
+	return expectRow(result, domain.ErrUserExists)
+}
+
+func (us *UserRepository) GetUserByName(ctx context.Context, name domain.UserName) (domain.User, error) {
+	row := us.db.QueryRowContext(ctx,
+		"SELECT id, password, vault_key, totp_secret, totp_enabled, totp_last_step, recovery_codes FROM users WHERE name = ?", name)
+	user := domain.User{Name: name}
+	var recoveryCodes string
+	err := row.Scan(&user.ID, &user.Password, &user.VaultKey, &user.TwoFactor.Secret, &user.TwoFactor.Enabled, &user.TwoFactor.LastStep, &recoveryCodes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return domain.User{}, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to get user")
+		return domain.User{}, err
+	}
+	user.TwoFactor.RecoveryCodes, err = decodeHashes(recoveryCodes)
+	if err != nil {
+		log.Err(err).Msg("failed to decode recovery codes")
+		return domain.User{}, err
+	}
+	return user, nil
+}
+
+func (us *UserRepository) GetUsers(ctx context.Context) ([]domain.User, error) {
+	rows, err := us.db.QueryContext(ctx, "SELECT id, name, password, vault_key FROM users")
+	if err != nil {
+		log.Err(err).Msg("failed to get users")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []domain.User
+	for rows.Next() {
+		var user domain.User
+		err = rows.Scan(&user.ID, &user.Name, &user.Password, &user.VaultKey)
+		if err != nil {
+			log.Err(err).Msg("failed to scan user")
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (us *UserRepository) UpdateTwoFactor(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = ?, totp_enabled = ?, totp_last_step = ?, recovery_codes = ? WHERE id = ?",
+		twoFactor.Secret, twoFactor.Enabled, twoFactor.LastStep, encodeHashes(twoFactor.RecoveryCodes), id)
+	if err != nil {
+		log.Err(err).Msg("failed to update two factor")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (us *UserRepository) UseTwoFactorStep(ctx context.Context, id domain.UserID, step int64) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_last_step = ?1 WHERE id = ?2 AND totp_enabled AND totp_last_step < ?1", step, id)
+	if err != nil {
+		log.Err(err).Msg("failed to use totp step")
+		return err
+	}
+	return expectRow(result, domain.ErrInvalidCode)
+}
+
+// UseRecoveryCode swaps the codes only when no other code was used since
+// they were read, and reads them again otherwise.
+func (us *UserRepository) UseRecoveryCode(ctx context.Context, id domain.UserID, hash []byte) error {
+	for {
+		var encoded string
+		err := us.db.QueryRowContext(ctx, "SELECT recovery_codes FROM users WHERE id = ?1", id).Scan(&encoded)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return domain.ErrInvalidCode
+			}
+			log.Err(err).Msg("failed to get recovery codes")
+			return err
+		}
+		codes, err := decodeHashes(encoded)
+		if err != nil {
+			log.Err(err).Msg("failed to decode recovery codes")
+			return err
+		}
+		remaining, ok := removeHash(codes, hash)
+		if !ok {
+			return domain.ErrInvalidCode
+		}
+		result, err := us.db.ExecContext(ctx,
+			"UPDATE users SET recovery_codes = ?1 WHERE id = ?2 AND recovery_codes = ?3", encodeHashes(remaining), id, encoded)
+		if err != nil {
+			log.Err(err).Msg("failed to use recovery code")
+			return err
+		}
+		if expectRow(result, domain.ErrNotFound) == nil {
+			return nil
+		}
+	}
+}
+
+func (us *UserRepository) ReplaceTwoFactorSecret(ctx context.Context, id domain.UserID, old, secret []byte) error {
+	result, err := us.db.ExecContext(ctx,
+		"UPDATE users SET totp_secret = ?1 WHERE id = ?2 AND totp_secret = ?3", secret, id, old)
+	if err != nil {
+		log.Err(err).Msg("failed to replace totp secret")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (us *UserRepository) UpdatePassword(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+	result, err := us.db.ExecContext(ctx, "UPDATE users SET password = ?, vault_key = ? WHERE id = ?", password, vaultKey, id)
+	if err != nil {
+		log.Err(err).Msg("failed to update password")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (us *UserRepository) DeleteUser(ctx context.Context, id domain.UserID) error {
+	result, err := us.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		log.Err(err).Msg("failed to delete user")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (us *UserRepository) Close() {
+	us.db.Close()
+}
+
+// expectRow returns errNone when statement changed no rows.
+func expectRow(result sql.Result, errNone error) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errNone
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// UserKeyRepository keeps wrapped user keys in their own table, apart from
+// the items encrypted under them.
+type UserKeyRepository struct {
+	db *sql.DB
+}
+
+func NewUserKeyRepo(path string) (*UserKeyRepository, error) {
+	db, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &UserKeyRepository{db: db}, nil
+}
+
+func (kr *UserKeyRepository) GetUserKey(ctx context.Context, userID domain.UserID) ([]byte, error) {
+	var key []byte
+	err := kr.db.QueryRowContext(ctx, "SELECT wrapped_key FROM user_keys WHERE user_id = ?", userID).Scan(&key)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrNotFound
+		}
+		log.Err(err).Msg("failed to get user key")
+		return nil, err
+	}
+	return key, nil
+}
+
+func (kr *UserKeyRepository) CreateUserKey(ctx context.Context, userID domain.UserID, key []byte) error {
+	_, err := kr.db.ExecContext(ctx, "INSERT INTO user_keys (user_id, wrapped_key) VALUES (?, ?) ON CONFLICT DO NOTHING", userID, key)
+	if err != nil {
+		log.Err(err).Msg("failed to create user key")
+		return err
+	}
+	return nil
+}
+
+func (kr *UserKeyRepository) ReplaceUserKey(ctx context.Context, userID domain.UserID, old, key []byte) error {
+	result, err := kr.db.ExecContext(ctx, "UPDATE user_keys SET wrapped_key = ? WHERE user_id = ? AND wrapped_key = ?", key, userID, old)
+	if err != nil {
+		log.Err(err).Msg("failed to replace user key")
+		return err
+	}
+	return expectRow(result, domain.ErrNotFound)
+}
+
+func (kr *UserKeyRepository) DeleteUserKey(ctx context.Context, userID domain.UserID) error {
+	_, err := kr.db.ExecContext(ctx, "DELETE FROM user_keys WHERE user_id = ?", userID)
+	if err != nil {
+		log.Err(err).Msg("failed to delete user key")
+		return err
+	}
+	return nil
+}
+
+func (kr *UserKeyRepository) Close() {
+	kr.db.Close()
+}
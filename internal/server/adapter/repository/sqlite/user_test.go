@@ -0,0 +1,65 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rutkin/gophkeeper/internal/server/adapter/repository/conformance"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserRepository(t *testing.T) {
+	userRepo, err := NewUserRepo(filepath.Join(t.TempDir(), "keeper.db"))
+	require.NoError(t, err)
+	defer userRepo.Close()
+	ctx := context.Background()
+	user := domain.User{
+		ID:       "id",
+		Name:     "name",
+		Password: "password",
+	}
+	require.NoError(t, userRepo.CreateUser(ctx, user))
+	require.Equal(t, domain.ErrUserExists, userRepo.CreateUser(ctx, domain.User{ID: "other", Name: "name", Password: "password"}))
+	actualUser, err := userRepo.GetUserByName(ctx, "name")
+	require.NoError(t, err)
+	require.Equal(t, user, actualUser)
+
+	twoFactor := domain.TwoFactor{Secret: []byte("secret"), Enabled: true, LastStep: 42, RecoveryCodes: [][]byte{{1, 2}, {3, 4}}}
+	require.NoError(t, userRepo.UpdateTwoFactor(ctx, user.ID, twoFactor))
+	require.NoError(t, userRepo.UpdatePassword(ctx, user.ID, "new password", []byte("wrapped")))
+	actualUser, err = userRepo.GetUserByName(ctx, "name")
+	require.NoError(t, err)
+	require.Equal(t, twoFactor, actualUser.TwoFactor)
+	require.Equal(t, "new password", actualUser.Password)
+	require.Equal(t, []byte("wrapped"), actualUser.VaultKey)
+	users, err := userRepo.GetUsers(ctx)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	require.NoError(t, userRepo.DeleteUser(ctx, user.ID))
+	_, err = userRepo.GetUserByName(ctx, "name")
+	require.Equal(t, domain.ErrNotFound, err)
+	require.Equal(t, domain.ErrNotFound, userRepo.DeleteUser(ctx, user.ID))
+	require.Equal(t, domain.ErrNotFound, userRepo.UpdatePassword(ctx, user.ID, "password", nil))
+}
+
+func TestUserRepository_Conformance(t *testing.T) {
+	conformance.TestUserRepository(t, func(t *testing.T) port.UserRepository {
+		repo, err := NewUserRepo(filepath.Join(t.TempDir(), "keeper.db"))
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
+
+func TestUserKeyRepository_Conformance(t *testing.T) {
+	conformance.TestUserKeyRepository(t, func(t *testing.T) port.UserKeyRepository {
+		repo, err := NewUserKeyRepo(filepath.Join(t.TempDir(), "keeper.db"))
+		require.NoError(t, err)
+		t.Cleanup(repo.Close)
+		return repo
+	})
+}
@@ -0,0 +1,82 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Reloader serves TLS with certificate and key read from files. Reload reads
+// them again, handshakes started after it use the new files, while the old
+// ones stay in use when reading fails.
+type Reloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+	current      atomic.Pointer[tls.Config]
+}
+
+// New loads server certificate. With clientCAFile set, clients have to
+// present a certificate signed by one of its CAs.
+func New(certFile, keyFile, clientCAFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, clientCAFile: clientCAFile}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		log.Err(err).Msgf("failed to load TLS certificate '%s'", r.certFile)
+		return err
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if len(r.clientCAFile) > 0 {
+		pool, err := LoadCertPool(r.clientCAFile)
+		if err != nil {
+			log.Err(err).Msgf("failed to load client CA '%s'", r.clientCAFile)
+			return err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.current.Store(config)
+	return nil
+}
+
+// Config returns configuration for the listener, every handshake picks the
+// certificates loaded last.
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// RequiresClientCert reports whether clients authenticate with certificates.
+func (r *Reloader) RequiresClientCert() bool {
+	return len(r.clientCAFile) > 0
+}
+
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in '%s'", path)
+	}
+	return pool, nil
+}
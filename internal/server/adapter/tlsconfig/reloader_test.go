@@ -0,0 +1,157 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, name string, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return testCert{cert: cert, key: key}
+}
+
+func (tc testCert) write(t *testing.T, certFile, keyFile string) {
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.cert.Raw}), 0600))
+	if len(keyFile) == 0 {
+		return
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(tc.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+}
+
+func (tc testCert) tls() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.cert.Raw}, PrivateKey: tc.key}
+}
+
+// handshake connects to listener and returns certificate served to client.
+func handshake(t *testing.T, listener net.Listener, config *tls.Config) (*x509.Certificate, error) {
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn.(*tls.Conn).Handshake()
+		conn.Close()
+	}()
+	conn, err := tls.Dial("tcp", listener.Addr().String(), config)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// TLS 1.3 reports rejected client certificate on the first read
+	_, err = conn.Read(make([]byte, 1))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, caFile, "")
+	first := newTestCert(t, "first", &ca)
+	first.write(t, certFile, keyFile)
+
+	reloader, err := New(certFile, keyFile, "")
+	require.NoError(t, err)
+	require.False(t, reloader.RequiresClientCert())
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.Config())
+	require.NoError(t, err)
+	defer listener.Close()
+
+	pool, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+	client := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	served, err := handshake(t, listener, client)
+	require.NoError(t, err)
+	require.Equal(t, "first", served.Subject.CommonName)
+
+	second := newTestCert(t, "second", &ca)
+	second.write(t, certFile, keyFile)
+	require.NoError(t, reloader.Reload())
+	served, err = handshake(t, listener, client)
+	require.NoError(t, err)
+	require.Equal(t, "second", served.Subject.CommonName)
+
+	// broken files keep the loaded certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	require.Error(t, reloader.Reload())
+	served, err = handshake(t, listener, client)
+	require.NoError(t, err)
+	require.Equal(t, "second", served.Subject.CommonName)
+}
+
+func TestReloader_ClientCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, caFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+	ca := newTestCert(t, "ca", nil)
+	ca.write(t, caFile, "")
+	newTestCert(t, "server", &ca).write(t, certFile, keyFile)
+
+	reloader, err := New(certFile, keyFile, caFile)
+	require.NoError(t, err)
+	require.True(t, reloader.RequiresClientCert())
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", reloader.Config())
+	require.NoError(t, err)
+	defer listener.Close()
+
+	pool, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+	_, err = handshake(t, listener, &tls.Config{RootCAs: pool, ServerName: "localhost"})
+	require.Error(t, err)
+
+	other := newTestCert(t, "other ca", nil)
+	_, err = handshake(t, listener, &tls.Config{RootCAs: pool, ServerName: "localhost",
+		Certificates: []tls.Certificate{newTestCert(t, "user", &other).tls()}})
+	require.Error(t, err)
+
+	_, err = handshake(t, listener, &tls.Config{RootCAs: pool, ServerName: "localhost",
+		Certificates: []tls.Certificate{newTestCert(t, "user", &ca).tls()}})
+	require.NoError(t, err)
+}
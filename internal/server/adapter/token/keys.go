@@ -0,0 +1,194 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+const (
+	tokenKeyPurpose = "gophkeeper token hs256"
+	minRSAKeyBits   = 2048
+)
+
+var (
+	ErrInvalidPEM         = errors.New("failed to find PEM block in key file")
+	ErrUnsupportedKeyType = errors.New("unsupported token key type, expected Ed25519 or RSA")
+	ErrWeakRSAKey         = errors.New("RSA token key must be at least 2048 bits")
+)
+
+// Key is a token signing or verification key. Verification keys have no
+// private part, HMAC keys keep the secret in both.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+func (k Key) canSign() bool {
+	return k.Private != nil
+}
+
+func (k Key) isSymmetric() bool {
+	return k.Method == jwt.SigningMethodHS256
+}
+
+// NewHMACKeys derives HS256 keys from the master key and from previous master
+// keys, so tokens survive master key rotation. The first key signs.
+func NewHMACKeys(keys port.KeyProvider) ([]Key, error) {
+	masterKey, err := keys.MasterKey()
+	if err != nil {
+		return nil, err
+	}
+	previousKeys, err := keys.PreviousKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var hmacKeys []Key
+	for _, master := range append([][]byte{masterKey}, previousKeys...) {
+		secret, err := util.DeriveKey(master, tokenKeyPurpose)
+		if err != nil {
+			return nil, err
+		}
+		hmacKeys = append(hmacKeys, Key{
+			ID:      fmt.Sprintf("hs256-%08x", util.NewKey(secret).ID),
+			Method:  jwt.SigningMethodHS256,
+			Private: secret,
+			Public:  secret,
+		})
+	}
+	return hmacKeys, nil
+}
+
+// LoadPrivateKeyFile reads PKCS#8 (or PKCS#1 for RSA) PEM private key. The
+// signing method follows the key type: EdDSA for Ed25519, RS256 for RSA.
+func LoadPrivateKeyFile(path string) (Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return Key{}, err
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return Key{}, err
+		}
+		private = rsaKey
+	}
+
+	switch private := private.(type) {
+	case ed25519.PrivateKey:
+		return newPublicKey(private.Public(), private)
+	case *rsa.PrivateKey:
+		return newPublicKey(&private.PublicKey, private)
+	}
+	return Key{}, ErrUnsupportedKeyType
+}
+
+// LoadPublicKeyFile reads PKIX PEM public key, used to verify tokens signed
+// by a retired or an upcoming signing key.
+func LoadPublicKeyFile(path string) (Key, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return Key{}, err
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Key{}, err
+	}
+	return newPublicKey(public, nil)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrInvalidPEM
+	}
+	return block, nil
+}
+
+func newPublicKey(public, private interface{}) (Key, error) {
+	key := Key{Public: public, Private: private}
+	switch public := public.(type) {
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return Key{}, ErrWeakRSAKey
+		}
+		key.Method = jwt.SigningMethodRS256
+	default:
+		return Key{}, ErrUnsupportedKeyType
+	}
+
+	jwk := publicJWK(key)
+	thumbprint, err := jwkThumbprint(jwk)
+	if err != nil {
+		return Key{}, err
+	}
+	key.ID = thumbprint
+	return key, nil
+}
+
+// publicJWK returns key without kid in JSON Web Key form.
+func publicJWK(key Key) domain.PublicKey {
+	jwk := domain.PublicKey{Algorithm: key.Method.Alg(), Use: "sig"}
+	switch public := key.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	}
+	return jwk
+}
+
+// jwkThumbprint computes RFC 7638 thumbprint used as kid, so every service
+// derives the same kid for the same public key.
+func jwkThumbprint(jwk domain.PublicKey) (string, error) {
+	var members interface{}
+	switch jwk.KeyType {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
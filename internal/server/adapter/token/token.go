@@ -1,47 +1,81 @@
 package token
 
 import (
+	"errors"
+	"math"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
 
 var (
-	secretKey   = []byte("secret-key")
-	userIDKey   = "userid"
-	userNameKey = "username"
+	userIDKey    = "userid"
+	userNameKey  = "username"
+	encryptedKey = "encrypted"
 )
 
+var ErrNoSigningKey = errors.New("token signing key has no private part")
+
 type TokenService struct {
-	Exp time.Duration
+	Exp        time.Duration
+	signingKey Key
+	// verifyKeys holds the signing key and every key tokens may still be
+	// signed with, so keys can roll over without logging users out.
+	verifyKeys []Key
+	methods    []string
 }
 
-func New(exp time.Duration) *TokenService {
-	return &TokenService{Exp: exp}
+func New(exp time.Duration, signingKey Key, verifyKeys ...Key) (*TokenService, error) {
+	if !signingKey.canSign() {
+		return nil, ErrNoSigningKey
+	}
+	ts := &TokenService{Exp: exp, signingKey: signingKey}
+	for _, key := range append([]Key{signingKey}, verifyKeys...) {
+		if _, ok := ts.verifyKey(key.ID); ok {
+			continue
+		}
+		ts.verifyKeys = append(ts.verifyKeys, key)
+		ts.addMethod(key.Method.Alg())
+	}
+	return ts, nil
 }
 
-func (ts *TokenService) CreateToken(user domain.User) (domain.Token, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256,
+func (ts *TokenService) addMethod(alg string) {
+	for _, method := range ts.methods {
+		if method == alg {
+			return
+		}
+	}
+	ts.methods = append(ts.methods, alg)
+}
+
+func (ts *TokenService) CreateToken(user domain.User) (domain.Token, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ts.Exp)
+	token := jwt.NewWithClaims(ts.signingKey.Method,
 		jwt.MapClaims{
-			userIDKey:   user.ID,
-			userNameKey: user.Name,
-			"exp":       time.Now().Add(ts.Exp).Unix(),
+			userIDKey:    user.ID,
+			userNameKey:  user.Name,
+			encryptedKey: user.IsEncrypted(),
+			"jti":        uuid.NewString(),
+			"iat":        numericDate(now),
+			"exp":        expiresAt.Unix(),
 		})
+	token.Header["kid"] = ts.signingKey.ID
 
-	tokenString, err := token.SignedString(secretKey)
+	tokenString, err := token.SignedString(ts.signingKey.Private)
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
-	return domain.Token(tokenString), nil
+	return domain.Token(tokenString), expiresAt, nil
 }
 
 func (ts *TokenService) VerifyToken(tokenStr string) (domain.TokenPayload, error) {
-	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+	token, err := jwt.Parse(tokenStr, ts.verificationKey, jwt.WithValidMethods(ts.methods))
 
 	if err != nil {
 		return domain.TokenPayload{}, err
@@ -67,8 +101,84 @@ func (ts *TokenService) VerifyToken(tokenStr string) (domain.TokenPayload, error
 		return domain.TokenPayload{}, domain.ErrInvalidToken
 	}
 
+	encrypted, _ := claims[encryptedKey].(bool)
+	tokenID, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return domain.TokenPayload{}, domain.ErrInvalidToken
+	}
+	issuedAt := parseNumericDate(claims["iat"])
+
 	return domain.TokenPayload{
-		ID:   domain.UserID(userID),
-		Name: userName,
+		ID:        domain.UserID(userID),
+		Name:      userName,
+		Encrypted: encrypted,
+		TokenID:   tokenID,
+		IssuedAt:  issuedAt,
+		ExpiresAt: expiresAt.Time,
 	}, nil
 }
+
+// numericDate keeps microseconds of t, so tokens issued right after the
+// sessions of a user were revoked are told apart from the revoked ones.
+func numericDate(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// parseNumericDate returns zero time for missing claim.
+func parseNumericDate(claim any) time.Time {
+	seconds, ok := claim.(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(math.Round(seconds * 1e6)))
+}
+
+// verificationKey picks key by kid and checks the token is signed with the
+// algorithm of that key. Tokens issued before kid was stamped are checked
+// against every HMAC key.
+func (ts *TokenService) verificationKey(t *jwt.Token) (interface{}, error) {
+	kid, ok := t.Header["kid"].(string)
+	if !ok {
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, domain.ErrInvalidToken
+		}
+		var keySet jwt.VerificationKeySet
+		for _, key := range ts.verifyKeys {
+			if key.isSymmetric() {
+				keySet.Keys = append(keySet.Keys, key.Public)
+			}
+		}
+		return keySet, nil
+	}
+
+	key, ok := ts.verifyKey(kid)
+	if !ok || key.Method.Alg() != t.Method.Alg() {
+		return nil, domain.ErrInvalidToken
+	}
+	return key.Public, nil
+}
+
+func (ts *TokenService) verifyKey(kid string) (Key, bool) {
+	for _, key := range ts.verifyKeys {
+		if key.ID == kid {
+			return key, true
+		}
+	}
+	return Key{}, false
+}
+
+// PublicKeys returns asymmetric verification keys, HMAC keys are never
+// published.
+func (ts *TokenService) PublicKeys() []domain.PublicKey {
+	keys := []domain.PublicKey{}
+	for _, key := range ts.verifyKeys {
+		if key.isSymmetric() {
+			continue
+		}
+		jwk := publicJWK(key)
+		jwk.KeyID = key.ID
+		keys = append(keys, jwk)
+	}
+	return keys
+}
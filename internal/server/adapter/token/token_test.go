@@ -0,0 +1,160 @@
+package token
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/stretchr/testify/require"
+)
+
+type staticKeys struct {
+	master   []byte
+	previous [][]byte
+}
+
+func (sk staticKeys) MasterKey() ([]byte, error) {
+	return sk.master, nil
+}
+
+func (sk staticKeys) PreviousKeys() ([][]byte, error) {
+	return sk.previous, nil
+}
+
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	path := filepath.Join(t.TempDir(), "key.pem")
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	require.NoError(t, err)
+	return path
+}
+
+func newEd25519Key(t *testing.T) (Key, Key) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+
+	signingKey, err := LoadPrivateKeyFile(writePEM(t, "PRIVATE KEY", privateDER))
+	require.NoError(t, err)
+	verifyKey, err := LoadPublicKeyFile(writePEM(t, "PUBLIC KEY", publicDER))
+	require.NoError(t, err)
+	return signingKey, verifyKey
+}
+
+func TestTokenService_Algorithms(t *testing.T) {
+	user := domain.User{ID: "id", Name: "user"}
+	hmacKeys, err := NewHMACKeys(staticKeys{master: []byte("master-key")})
+	require.NoError(t, err)
+	edKey, _ := newEd25519Key(t)
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaKey, err := LoadPrivateKeyFile(writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate)))
+	require.NoError(t, err)
+
+	for _, key := range []Key{hmacKeys[0], edKey, rsaKey} {
+		t.Run(key.Method.Alg(), func(t *testing.T) {
+			ts, err := New(time.Hour, key)
+			require.NoError(t, err)
+			issuedAfter := time.Now().Truncate(time.Microsecond)
+			token, expiresAt, err := ts.CreateToken(user)
+			require.NoError(t, err)
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(string(token), jwt.MapClaims{})
+			require.NoError(t, err)
+			require.Equal(t, key.ID, parsed.Header["kid"])
+			require.Equal(t, key.Method.Alg(), parsed.Header["alg"])
+
+			payload, err := ts.VerifyToken(string(token))
+			require.NoError(t, err)
+			require.NotEmpty(t, payload.TokenID)
+			require.Equal(t, expiresAt.Unix(), payload.ExpiresAt.Unix())
+			// iat keeps microseconds
+			require.False(t, payload.IssuedAt.Before(issuedAfter))
+			require.False(t, payload.IssuedAt.After(time.Now()))
+			require.Equal(t, domain.UserID("id"), payload.ID)
+			require.Equal(t, "user", payload.Name)
+		})
+	}
+}
+
+func TestTokenService_Rollover(t *testing.T) {
+	user := domain.User{ID: "id", Name: "user"}
+	oldSigningKey, oldVerifyKey := newEd25519Key(t)
+	newSigningKey, _ := newEd25519Key(t)
+	require.Equal(t, oldSigningKey.ID, oldVerifyKey.ID)
+
+	oldService, err := New(time.Hour, oldSigningKey)
+	require.NoError(t, err)
+	token, _, err := oldService.CreateToken(user)
+	require.NoError(t, err)
+
+	newService, err := New(time.Hour, newSigningKey)
+	require.NoError(t, err)
+	_, err = newService.VerifyToken(string(token))
+	require.Error(t, err)
+
+	newService, err = New(time.Hour, newSigningKey, oldVerifyKey)
+	require.NoError(t, err)
+	_, err = newService.VerifyToken(string(token))
+	require.NoError(t, err)
+
+	keys := newService.PublicKeys()
+	require.Len(t, keys, 2)
+	require.Equal(t, newSigningKey.ID, keys[0].KeyID)
+	require.Equal(t, oldVerifyKey.ID, keys[1].KeyID)
+	require.Equal(t, "OKP", keys[0].KeyType)
+	require.Equal(t, "EdDSA", keys[0].Algorithm)
+
+	_, err = New(time.Hour, oldVerifyKey)
+	require.Equal(t, ErrNoSigningKey, err)
+}
+
+func TestTokenService_LegacyHMAC(t *testing.T) {
+	hmacKeys, err := NewHMACKeys(staticKeys{master: []byte("new-master-key"), previous: [][]byte{[]byte("old-master-key")}})
+	require.NoError(t, err)
+	require.Len(t, hmacKeys, 2)
+	edKey, _ := newEd25519Key(t)
+	ts, err := New(time.Hour, edKey, hmacKeys...)
+	require.NoError(t, err)
+	require.Len(t, ts.PublicKeys(), 1)
+
+	// tokens issued before kid was stamped
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		userIDKey:   "id",
+		userNameKey: "user",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	legacyToken, err := legacy.SignedString(hmacKeys[1].Private)
+	require.NoError(t, err)
+	_, err = ts.VerifyToken(legacyToken)
+	require.NoError(t, err)
+
+	// HMAC signed with the public key under the EdDSA kid
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		userIDKey:   "id",
+		userNameKey: "user",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	confused.Header["kid"] = edKey.ID
+	confusedToken, err := confused.SignedString([]byte(edKey.Public.(ed25519.PublicKey)))
+	require.NoError(t, err)
+	_, err = ts.VerifyToken(confusedToken)
+	require.Error(t, err)
+}
+
+func TestLoadPrivateKeyFile_WeakRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = LoadPrivateKeyFile(writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private)))
+	require.Equal(t, ErrWeakRSAKey, err)
+}
@@ -0,0 +1,53 @@
+package domain
+
+import (
+	"context"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditRegister       AuditAction = "register"
+	AuditLogin          AuditAction = "login"
+	AuditLoginFailed    AuditAction = "login_failed"
+	AuditPasswordChange AuditAction = "password_change"
+	AuditAccountDelete  AuditAction = "account_delete"
+	AuditTokenCreate    AuditAction = "token_create"
+	AuditTokenRevoke    AuditAction = "token_revoke"
+	AuditSet            AuditAction = "set"
+	AuditGet            AuditAction = "get"
+	AuditDelete         AuditAction = "delete"
+)
+
+// AuditEvent is an entry of the audit log. Hash covers every other field and
+// the hash of the previous entry, so an edited, removed or reordered entry
+// breaks the chain. Entries with KeyID carry HMAC under the audit key derived
+// from the master key, entries written before have a plain SHA-256.
+type AuditEvent struct {
+	Seq      uint64      `json:"seq"`
+	Time     time.Time   `json:"time"`
+	Action   AuditAction `json:"action"`
+	Success  bool        `json:"success"`
+	UserID   UserID      `json:"user_id,omitempty"`
+	UserName UserName    `json:"user_name,omitempty"`
+	ItemID   DataID      `json:"item_id,omitempty"`
+	ItemType DataType    `json:"item_type,omitempty"`
+	ClientIP string      `json:"client_ip,omitempty"`
+	KeyID    uint32      `json:"key_id,omitempty"`
+	PrevHash []byte      `json:"prev_hash"`
+	Hash     []byte      `json:"hash"`
+}
+
+type clientIPKey struct{}
+
+// WithClientIP stores address of the client the request came from, audit
+// events take it from the context.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+func ClientIP(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey{}).(string)
+	return ip
+}
@@ -1,5 +1,7 @@
 package domain
 
+import "time"
+
 type UserID string
 type UserName string
 
@@ -7,11 +9,81 @@ type User struct {
 	ID       UserID
 	Name     UserName
 	Password string
+	// VaultKey is the vault key wrapped on the client side. Accounts with
+	// vault key keep only client side encrypted items.
+	VaultKey  []byte
+	TwoFactor TwoFactor
+}
+
+func (u User) IsEncrypted() bool {
+	return len(u.VaultKey) > 0
 }
 
 type Token string
 
 type TokenPayload struct {
-	ID   UserID
-	Name string
+	ID        UserID
+	Name      string
+	Encrypted bool
+	// TokenID is the jti claim, revoked tokens are looked up by it.
+	TokenID   string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	// PersonalTokenID is set for personal access tokens, they are limited
+	// to Scopes and, when set, to ItemIDs.
+	PersonalTokenID string
+	Scopes          []Scope
+	ItemIDs         []DataID
+}
+
+// HasScope reports whether the token has scope, session tokens have every
+// scope.
+func (p TokenPayload) HasScope(scope Scope) bool {
+	if len(p.PersonalTokenID) == 0 {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the token may act with scope on item, id is empty
+// for requests not addressing a single item. Tokens limited to items may
+// only address them.
+func (p TokenPayload) Allows(scope Scope, id DataID) bool {
+	if !p.HasScope(scope) {
+		return false
+	}
+	if len(p.ItemIDs) == 0 {
+		return true
+	}
+	for _, itemID := range p.ItemIDs {
+		if len(id) > 0 && itemID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordChange carries the current password, the new one and, for client
+// side encrypted accounts, the vault key wrapped for the new password.
+type PasswordChange struct {
+	OldPassword string
+	NewPassword string
+	VaultKey    []byte
+}
+
+// PublicKey is a token verification key in JSON Web Key form.
+type PublicKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
 }
@@ -0,0 +1,32 @@
+package domain
+
+import (
+	"encoding/hex"
+	"errors"
+)
+
+// ChunkIDSize is the size of the keyed hash addressing a chunk.
+const ChunkIDSize = 32
+
+var ErrInvalidChunkID = errors.New("invalid chunk id")
+
+// ChunkID addresses a chunk of binary items by keyed hash of its content.
+// The hash is keyed per user, so equal chunks of different users get
+// different ids.
+type ChunkID [ChunkIDSize]byte
+
+func (id ChunkID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// ParseChunkID parses id in the form returned by String.
+func ParseChunkID(s string) (ChunkID, error) {
+	var id ChunkID
+	if hex.DecodedLen(len(s)) != ChunkIDSize {
+		return id, ErrInvalidChunkID
+	}
+	if _, err := hex.Decode(id[:], []byte(s)); err != nil {
+		return id, ErrInvalidChunkID
+	}
+	return id, nil
+}
@@ -11,4 +11,15 @@ var (
 	ErrInvalidAuthorizationHeader = errors.New("invalid authorization header")
 	ErrInvalidAuthorizationType   = errors.New("invalid authorization type")
 	ErrBadRequest                 = errors.New("bad request")
+	ErrEncryptionMode             = errors.New("item encryption mode does not match account")
+	ErrDecryptionFailed           = errors.New("item does not match its owner or was modified")
+	ErrTokenReused                = errors.New("refresh token is already used")
+	ErrTwoFactorEnabled           = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorNotEnrolled       = errors.New("two factor authentication is not enrolled")
+	ErrInvalidCode                = errors.New("invalid authentication code")
+	ErrTooManyAttempts            = errors.New("too many failed login attempts")
+	ErrAuditChainBroken           = errors.New("audit log chain is broken")
+	ErrClientCertificate          = errors.New("client certificate does not belong to the user")
+	ErrInsufficientScope          = errors.New("token does not grant access to the resource")
+	ErrInvalidDataID              = errors.New("item id is not a canonical uuid")
 )
@@ -11,12 +11,52 @@ const (
 
 type DataID string
 
+// ParseDataID accepts only canonical UUIDs, the form ids are generated in.
+// Ids end up in storage paths and keys, so anything else is rejected.
+func ParseDataID(s string) (DataID, error) {
+	id := DataID(s)
+	if !id.IsValid() {
+		return "", ErrInvalidDataID
+	}
+	return id, nil
+}
+
+// IsValid reports whether id is a UUID in canonical form: 8-4-4-4-12 groups
+// of lower case hex digits separated by hyphens.
+func (id DataID) IsValid() bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		switch c := id[i]; {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 type DataContext struct {
 	ID     DataID
 	UserID UserID
 	Meta   string
 	Title  string
 	Type   DataType
+	// Encrypted items are encrypted by the client, their title is ciphertext too.
+	Encrypted bool
+}
+
+func (dt DataType) IsValid() bool {
+	switch dt {
+	case TextType, BinaryType, CredentialsType, BankType:
+		return true
+	}
+	return false
 }
 
 type TextData struct {
@@ -49,3 +89,8 @@ type BankData struct {
 	Ctx  DataContext
 	Card Card
 }
+
+type EncryptedData struct {
+	Ctx  DataContext
+	Data []byte
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzParseDataID(f *testing.F) {
+	for _, seed := range []string{
+		uuid.NewString(),
+		"",
+		"..",
+		"../../etc/passwd",
+		"6F9619FF-8B86-D011-B42D-00C04FC964FF",
+		"{6f9619ff-8b86-d011-b42d-00c04fc964ff}",
+		"urn:uuid:6f9619ff-8b86-d011-b42d-00c04fc964ff",
+		"6f9619ff8b86d011b42d00c04fc964ff",
+		"6f9619ff-8b86-d011-b42d-00c04fc964f/",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		id, err := ParseDataID(s)
+		parsed, uuidErr := uuid.Parse(s)
+		canonical := uuidErr == nil && parsed.String() == s
+		if !canonical {
+			require.Equal(t, ErrInvalidDataID, err)
+			require.Empty(t, id)
+			return
+		}
+		require.NoError(t, err)
+		require.Equal(t, DataID(s), id)
+	})
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "time"
+
+// LoginAttempts is failed login state of a username or a client address.
+type LoginAttempts struct {
+	Failures     int
+	BlockedUntil time.Time
+}
+
+// RetryError is returned while login is blocked after failed attempts.
+type RetryError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return ErrTooManyAttempts
+}
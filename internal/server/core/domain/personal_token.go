@@ -0,0 +1,54 @@
+package domain
+
+import "time"
+
+// PersonalTokenPrefix starts every personal access token, so they are told
+// apart from session tokens.
+const PersonalTokenPrefix = "gkp_"
+
+// Scope grants a personal access token one kind of access.
+type Scope string
+
+const (
+	ScopeReadItems        Scope = "read:items"
+	ScopeDeleteItems      Scope = "delete:items"
+	ScopeReadFile         Scope = "read:file"
+	ScopeWriteFile        Scope = "write:file"
+	ScopeReadCredentials  Scope = "read:credentials"
+	ScopeWriteCredentials Scope = "write:credentials"
+	ScopeReadBank         Scope = "read:bank"
+	ScopeWriteBank        Scope = "write:bank"
+	ScopeReadVault        Scope = "read:vault"
+	ScopeWriteVault       Scope = "write:vault"
+)
+
+func (s Scope) IsValid() bool {
+	switch s {
+	case ScopeReadItems, ScopeDeleteItems, ScopeReadFile, ScopeWriteFile, ScopeReadCredentials,
+		ScopeWriteCredentials, ScopeReadBank, ScopeWriteBank, ScopeReadVault, ScopeWriteVault:
+		return true
+	}
+	return false
+}
+
+// PersonalToken is a named API token for automation. Only hash of the token
+// is stored. Tokens with ItemIDs reach only these items.
+type PersonalToken struct {
+	ID        string
+	UserID    UserID
+	UserName  UserName
+	Name      string
+	Hash      []byte
+	Scopes    []Scope
+	ItemIDs   []DataID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// PersonalTokenRequest describes a token to create.
+type PersonalTokenRequest struct {
+	Name      string
+	Scopes    []Scope
+	ItemIDs   []DataID
+	ExpiresIn time.Duration
+}
@@ -0,0 +1,9 @@
+package domain
+
+type RotationStats struct {
+	Users   int
+	Items   int
+	Rotated int
+	Skipped int
+	Failed  int
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Tokens is a short lived access token together with the refresh token which
+// renews it. Accounts with second factor get only Challenge after password.
+type Tokens struct {
+	AccessToken  Token
+	RefreshToken Token
+	ExpiresAt    time.Time
+	Challenge    Token
+}
+
+// RefreshToken is a stored refresh token. Only the token hash is kept. Every
+// refresh rotates the token inside its family, using a rotated token again
+// revokes the whole family. SessionStart is the login which created the
+// family, refreshes carry it over.
+type RefreshToken struct {
+	Hash         []byte
+	Family       string
+	UserID       UserID
+	UserName     UserName
+	ExpiresAt    time.Time
+	SessionStart time.Time
+}
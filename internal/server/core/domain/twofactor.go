@@ -0,0 +1,28 @@
+package domain
+
+import "time"
+
+// TwoFactor is the TOTP second factor of an account. Secret is kept as soon as
+// enrollment starts, the factor is enabled once the first code is confirmed.
+type TwoFactor struct {
+	Secret  []byte
+	Enabled bool
+	// LastStep is the last accepted time step, codes are single use.
+	LastStep int64
+	// RecoveryCodes holds SHA-256 hashes of unused recovery codes.
+	RecoveryCodes [][]byte
+}
+
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginChallenge is issued after a valid password when the account has the
+// second factor enabled. Only the challenge hash is kept.
+type LoginChallenge struct {
+	Hash      []byte
+	UserName  UserName
+	Attempts  int
+	ExpiresAt time.Time
+}
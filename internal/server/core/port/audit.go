@@ -0,0 +1,26 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type Audit interface {
+	// ListEvents returns a page of at most limit events of the user following
+	// the entry after, oldest first.
+	ListEvents(ctx context.Context, userID domain.UserID, after uint64, limit int) ([]domain.AuditEvent, error)
+}
+
+// AuditRepository is an append-only event store.
+type AuditRepository interface {
+	Append(ctx context.Context, event domain.AuditEvent) error
+	// Last returns the newest event, domain.ErrNotFound when the log is empty.
+	Last(ctx context.Context) (domain.AuditEvent, error)
+	// ListByUser returns at most limit events of the user with sequence
+	// number above after, oldest first.
+	ListByUser(ctx context.Context, userID domain.UserID, after uint64, limit int) ([]domain.AuditEvent, error)
+	// Walk calls fn for every event, oldest first, and stops on its error.
+	Walk(ctx context.Context, fn func(event domain.AuditEvent) error) error
+	Close()
+}
@@ -2,22 +2,65 @@ package port
 
 import (
 	"context"
+	"time"
 
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
 
 type TokenService interface {
-	CreateToken(user domain.User) (domain.Token, error)
+	// CreateToken returns access token and the time it expires at.
+	CreateToken(user domain.User) (domain.Token, time.Time, error)
 	VerifyToken(token string) (domain.TokenPayload, error)
+	PublicKeys() []domain.PublicKey
 }
 
 type AuthService interface {
 	Register(ctx context.Context, user domain.User) error
-	Login(ctx context.Context, user domain.User) (domain.Token, error)
+	Login(ctx context.Context, user domain.User, clientIP string) (domain.Tokens, error)
+	Refresh(ctx context.Context, refreshToken domain.Token) (domain.Tokens, error)
+	Logout(ctx context.Context, payload domain.TokenPayload, refreshToken domain.Token) error
+	IsTokenRevoked(ctx context.Context, payload domain.TokenPayload) (bool, error)
+	// LoginTwoFactor completes login challenge with a TOTP or recovery code.
+	LoginTwoFactor(ctx context.Context, challenge domain.Token, code string) (domain.Tokens, error)
+	EnrollTwoFactor(ctx context.Context, name domain.UserName) (domain.TOTPEnrollment, error)
+	// ConfirmTwoFactor enables second factor and returns recovery codes.
+	ConfirmTwoFactor(ctx context.Context, name domain.UserName, code string) ([]string, error)
+	// ChangePassword checks the current password, stores the new one and
+	// revokes other sessions of the user.
+	ChangePassword(ctx context.Context, name domain.UserName, change domain.PasswordChange) (domain.Tokens, error)
+	GetVaultKey(ctx context.Context, name domain.UserName) ([]byte, error)
+	// IsEncrypted reports whether the account of payload encrypts items on
+	// the client, read from the user record rather than from the token.
+	IsEncrypted(ctx context.Context, payload domain.TokenPayload) (bool, error)
+	// DeleteAccount checks the password and removes the user with every
+	// item and session.
+	DeleteAccount(ctx context.Context, name domain.UserName, password string) error
+	// CreatePersonalToken returns the token, it is not stored and can not
+	// be shown again.
+	CreatePersonalToken(ctx context.Context, payload domain.TokenPayload, req domain.PersonalTokenRequest) (domain.Token, domain.PersonalToken, error)
+	ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error)
+	RevokePersonalToken(ctx context.Context, payload domain.TokenPayload, id string) error
+	VerifyPersonalToken(ctx context.Context, token domain.Token) (domain.TokenPayload, error)
 }
 
 type UserRepository interface {
 	CreateUser(ctx context.Context, user domain.User) error
 	GetUserByName(ctx context.Context, name domain.UserName) (domain.User, error)
+	GetUsers(ctx context.Context) ([]domain.User, error)
+	UpdateTwoFactor(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error
+	// UseTwoFactorStep records step as the last used TOTP step of enabled
+	// second factor, domain.ErrInvalidCode means the step or a later one was
+	// used already.
+	UseTwoFactorStep(ctx context.Context, id domain.UserID, step int64) error
+	// UseRecoveryCode removes recovery code with hash, domain.ErrInvalidCode
+	// means it is not there or was used meanwhile.
+	UseRecoveryCode(ctx context.Context, id domain.UserID, hash []byte) error
+	// ReplaceTwoFactorSecret replaces sealed TOTP secret unless it is no
+	// longer old, then domain.ErrNotFound is returned.
+	ReplaceTwoFactorSecret(ctx context.Context, id domain.UserID, old, secret []byte) error
+	// UpdatePassword replaces password hash and the wrapped vault key, which
+	// is wrapped by a key derived from the password on e2e accounts.
+	UpdatePassword(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error
+	DeleteUser(ctx context.Context, id domain.UserID) error
 	Close()
 }
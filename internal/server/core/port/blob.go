@@ -0,0 +1,21 @@
+package port
+
+import (
+	"context"
+	"io"
+)
+
+// BlobStore keeps large ciphertext outside of the keeper repository.
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte) error
+	// Get returns domain.ErrNotFound for missing blob.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// PutStream stores blob of unknown size read from src.
+	PutStream(ctx context.Context, key string, src io.Reader) error
+	// GetStream returns domain.ErrNotFound for missing blob, the reader must
+	// be closed.
+	GetStream(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete does not fail for missing blob.
+	Delete(ctx context.Context, key string) error
+	DeletePrefix(ctx context.Context, prefix string) error
+}
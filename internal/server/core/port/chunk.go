@@ -0,0 +1,33 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// ChunkRepository stores binary items as lists of content addressed chunks.
+// Every chunk is stored once per user and counts the items referencing it,
+// the keeper repository releases chunks of deleted and replaced items.
+type ChunkRepository interface {
+	// RefChunk adds a reference to a stored chunk, it reports false when the
+	// user has no such chunk.
+	RefChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) (bool, error)
+	// PutChunk stores chunk with one reference, a chunk stored meanwhile
+	// gets another reference and keeps its data.
+	PutChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error
+	// ReleaseChunks drops one reference of each chunk, chunks left without
+	// references are removed.
+	ReleaseChunks(ctx context.Context, userID domain.UserID, ids []domain.ChunkID) error
+	// GetChunk returns domain.ErrNotFound for missing chunk.
+	GetChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) ([]byte, error)
+	ListChunks(ctx context.Context, userID domain.UserID) ([]domain.ChunkID, error)
+	// ReplaceChunk replaces data of a stored chunk, references are kept.
+	ReplaceChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error
+	// SetChunked stores item with data listing chunks the caller already
+	// holds references to. References of the replaced item are released,
+	// like when it is deleted or replaced with Set.
+	SetChunked(ctx context.Context, dataCtx domain.DataContext, data []byte, chunks []domain.ChunkID) error
+	// GetChunks returns domain.ErrNotFound for item not stored in chunks.
+	GetChunks(ctx context.Context, dataCtx domain.DataContext) ([]domain.ChunkID, error)
+}
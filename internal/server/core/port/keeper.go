@@ -2,6 +2,7 @@ package port
 
 import (
 	"context"
+	"io"
 
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 )
@@ -12,10 +13,17 @@ type Keeper interface {
 	GetTextData(ctx context.Context, dataCtx domain.DataContext) (string, error)
 	SetBinaryData(ctx context.Context, data domain.BinaryData) error
 	GetBinaryData(ctx context.Context, dataCtx domain.DataContext) (domain.BinaryData, error)
+	// SetBinaryStream stores file read from src without holding it in memory.
+	SetBinaryStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error
+	// GetBinaryStream returns meta and content of the file, the reader must
+	// be closed.
+	GetBinaryStream(ctx context.Context, dataCtx domain.DataContext) (domain.DataContext, io.ReadCloser, error)
 	SetCredentialsData(ctx context.Context, data domain.CredentialsData) error
 	GetCredentialsData(ctx context.Context, dataCtx domain.DataContext) (domain.CredentialsData, error)
 	SetBankData(ctx context.Context, data domain.BankData) error
 	GetBankData(ctx context.Context, dataCtx domain.DataContext) (domain.BankData, error)
+	SetEncryptedData(ctx context.Context, data domain.EncryptedData) error
+	GetEncryptedData(ctx context.Context, dataCtx domain.DataContext) (domain.EncryptedData, error)
 	Delete(ctx context.Context, dataCtx domain.DataContext) error
 }
 
@@ -23,6 +31,21 @@ type KeeperRepository interface {
 	GetAllData(ctx context.Context, userID domain.UserID) ([]domain.DataContext, error)
 	Set(ctx context.Context, dataCtx domain.DataContext, data []byte) error
 	GetData(ctx context.Context, dataCtx domain.DataContext) ([]byte, error)
+	// ReplaceData replaces data of the item only while it still holds old,
+	// meta and chunk list are kept. Item changed or deleted meanwhile is
+	// reported as domain.ErrNotFound.
+	ReplaceData(ctx context.Context, dataCtx domain.DataContext, old, data []byte) error
+	// ReplaceHead overwrites the first len(old) bytes of data of the item
+	// with head only while they still hold old, the rest of the data is kept
+	// without being read into memory. Item changed or deleted meanwhile is
+	// reported as domain.ErrNotFound.
+	ReplaceHead(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error
 	GetMeta(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error)
+	// SetStream stores item with data read from src, GetStream reads it back.
+	SetStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error
+	GetStream(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error)
 	Delete(ctx context.Context, dataCtx domain.DataContext) error
+	// DeleteAll destroys every item of the user.
+	DeleteAll(ctx context.Context, userID domain.UserID) error
+	Close()
 }
@@ -0,0 +1,8 @@
+package port
+
+type KeyProvider interface {
+	MasterKey() ([]byte, error)
+	// PreviousKeys returns retired master keys which are still accepted
+	// for reading until key rotation is over.
+	PreviousKeys() ([][]byte, error)
+}
@@ -0,0 +1,23 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type LoginAttemptRepository interface {
+	// RegisterAttempt counts attempt as a failure up front and blocks key
+	// for block(failures) unless key is blocked at now. The check and the
+	// count are atomic, so parallel attempts can not pass a block together.
+	// Counters without attempts for window start over. It returns the state
+	// of key and whether the attempt was allowed, refused attempts are not
+	// counted.
+	RegisterAttempt(ctx context.Context, key string, now time.Time, window time.Duration, block func(failures int) time.Duration) (domain.LoginAttempts, bool, error)
+	// ForgiveAttempt takes back attempt counted by RegisterAttempt, key is
+	// blocked as if the attempt was never made.
+	ForgiveAttempt(ctx context.Context, key string, now time.Time, block func(failures int) time.Duration) error
+	Reset(ctx context.Context, key string) error
+	Close()
+}
@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type PersonalTokenRepository interface {
+	CreatePersonalToken(ctx context.Context, token domain.PersonalToken) error
+	// GetPersonalToken returns domain.ErrNotFound for unknown hash.
+	GetPersonalToken(ctx context.Context, hash []byte) (domain.PersonalToken, error)
+	ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error)
+	// DeletePersonalToken returns domain.ErrNotFound when the user has no
+	// token with id.
+	DeletePersonalToken(ctx context.Context, userID domain.UserID, id string) error
+	DeleteUserTokens(ctx context.Context, userID domain.UserID) error
+	Close()
+}
@@ -0,0 +1,14 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// RotationCheckpoint remembers users whose items are already rotated, so an
+// interrupted rotation can be resumed.
+type RotationCheckpoint interface {
+	IsDone(ctx context.Context, userID domain.UserID) (bool, error)
+	MarkDone(ctx context.Context, userID domain.UserID) error
+}
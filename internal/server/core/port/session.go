@@ -0,0 +1,29 @@
+package port
+
+import (
+	"context"
+	"time"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+type SessionRepository interface {
+	CreateRefreshToken(ctx context.Context, token domain.RefreshToken) error
+	// UseRefreshToken marks token as used and returns it. Tokens which are
+	// already used come back with domain.ErrTokenReused.
+	UseRefreshToken(ctx context.Context, hash []byte) (domain.RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+	// RevokeAccessToken keeps jti revoked until the token expires.
+	RevokeAccessToken(ctx context.Context, tokenID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, tokenID string) (bool, error)
+	// RevokeUser drops every refresh token of user and revokes access tokens
+	// issued up to the given time.
+	RevokeUser(ctx context.Context, id domain.UserID, before time.Time) error
+	// UserRevokedBefore returns the time set by RevokeUser, zero when the
+	// user was never revoked.
+	UserRevokedBefore(ctx context.Context, id domain.UserID) (time.Time, error)
+	CreateChallenge(ctx context.Context, challenge domain.LoginChallenge) error
+	// TakeChallenge removes challenge and returns it.
+	TakeChallenge(ctx context.Context, hash []byte) (domain.LoginChallenge, error)
+	Close()
+}
@@ -0,0 +1,25 @@
+package port
+
+import (
+	"context"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// UserKeyRepository keeps data keys of users wrapped by the master key,
+// apart from the items encrypted under them. Removing the key of a deleted
+// account leaves copies of its items, in backups too, undecryptable.
+type UserKeyRepository interface {
+	// GetUserKey returns domain.ErrNotFound for user without key.
+	GetUserKey(ctx context.Context, userID domain.UserID) ([]byte, error)
+	// CreateUserKey stores key of user, a key stored meanwhile is kept and
+	// callers read the key again.
+	CreateUserKey(ctx context.Context, userID domain.UserID, key []byte) error
+	// ReplaceUserKey returns domain.ErrNotFound when the stored key is not
+	// old anymore.
+	ReplaceUserKey(ctx context.Context, userID domain.UserID, old, key []byte) error
+	// DeleteUserKey succeeds for user without key, so deletion may be
+	// repeated.
+	DeleteUserKey(ctx context.Context, userID domain.UserID) error
+	Close()
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+)
+
+// WithKeeperRepository lets DeleteAccount destroy items of the user.
+func (a *AuthService) WithKeeperRepository(items port.KeeperRepository) *AuthService {
+	a.items = items
+	return a
+}
+
+// WithUserKeys lets DeleteAccount destroy the key items of the user are
+// encrypted under.
+func (a *AuthService) WithUserKeys(userKeys port.UserKeyRepository) *AuthService {
+	a.userKeys = userKeys
+	return a
+}
+
+// DeleteAccount removes the user after checking the password. Sessions are
+// revoked first, then the user key and items are destroyed and the user
+// record goes last, so a failed deletion can be repeated. Without the user
+// key copies of the items left in backups cannot be decrypted, the record
+// holds the wrapped vault key of client side encrypted accounts likewise.
+func (a *AuthService) DeleteAccount(ctx context.Context, name domain.UserName, password string) error {
+	if a.items == nil {
+		return errors.New("account deletion needs keeper repository")
+	}
+	now := time.Now()
+	if a.guard != nil {
+		if err := a.guard.attempt(ctx, []attemptKey{a.guard.reauthKey(name)}, now); err != nil {
+			return err
+		}
+	}
+
+	user, err := a.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = a.hasher.Verify(password, user.Password)
+	if err != nil {
+		a.record(ctx, domain.AuditEvent{Action: domain.AuditAccountDelete, UserID: user.ID, UserName: user.Name})
+		return domain.ErrInvalidCredentials
+	}
+
+	err = a.sessions.RevokeUser(ctx, user.ID, now.Add(time.Second))
+	if err != nil {
+		return err
+	}
+	err = a.deletePersonalTokens(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if a.userKeys != nil {
+		err = a.userKeys.DeleteUserKey(ctx, user.ID)
+		if err != nil {
+			log.Err(err).Msgf("failed to delete key of user '%s'", user.ID)
+			return err
+		}
+	}
+	err = a.items.DeleteAll(ctx, user.ID)
+	if err != nil {
+		log.Err(err).Msgf("failed to delete items of user '%s'", user.ID)
+		return err
+	}
+	err = a.repo.DeleteUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	a.record(ctx, domain.AuditEvent{Action: domain.AuditAccountDelete, Success: true, UserID: user.ID, UserName: user.Name})
+	if a.guard != nil {
+		if err := a.guard.succeed(ctx, a.guard.reauthKey(name)); err != nil {
+			log.Err(err).Msgf("failed to reset attempts of '%s'", name)
+		}
+	}
+	log.Info().Msgf("account of user '%s' is deleted", user.ID)
+	return nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_DeleteAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	hasher := util.NewPasswordHasher(util.Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	password, err := hasher.Hash("password")
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password, VaultKey: []byte("wrapped")}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil).Times(2)
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockItems := mock_port.NewMockKeeperRepository(ctrl)
+	mockUserKeys := mock_port.NewMockUserKeyRepository(ctrl)
+	as := NewAuthService(mockRepo, mock_port.NewMockTokenService(ctrl), mockSessions, time.Hour).
+		WithPasswordHasher(hasher).
+		WithUserKeys(mockUserKeys)
+	ctx := context.Background()
+
+	require.Error(t, as.DeleteAccount(ctx, user.Name, "password"))
+	as.WithKeeperRepository(mockItems)
+	require.Equal(t, domain.ErrInvalidCredentials, as.DeleteAccount(ctx, user.Name, "wrong"))
+
+	gomock.InOrder(
+		mockSessions.EXPECT().RevokeUser(gomock.Any(), user.ID, gomock.Any()).Return(nil),
+		mockUserKeys.EXPECT().DeleteUserKey(gomock.Any(), user.ID).Return(nil),
+		mockItems.EXPECT().DeleteAll(gomock.Any(), user.ID).Return(nil),
+		mockRepo.EXPECT().DeleteUser(gomock.Any(), user.ID).Return(nil),
+	)
+	require.NoError(t, as.DeleteAccount(ctx, user.Name, "password"))
+}
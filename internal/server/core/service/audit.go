@@ -0,0 +1,183 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+const (
+	auditKeyPurpose = "gophkeeper audit"
+
+	// MaxAuditPage limits events returned by one ListEvents call.
+	MaxAuditPage = 1000
+)
+
+// AuditService appends events to the audit log. Every event carries HMAC of
+// its fields and of the previous hash under a key derived from the master
+// key, so the log can be checked offline with Verify and can not be rewritten
+// without the key.
+type AuditService struct {
+	repo port.AuditRepository
+	keys []util.Key
+	mu   sync.Mutex
+	seq  uint64
+	hash []byte
+}
+
+// NewAuditService derives audit keys from the current and previous master
+// keys, the current one authenticates new events.
+func NewAuditService(repo port.AuditRepository, keys port.KeyProvider) (*AuditService, error) {
+	masterKey, err := keys.MasterKey()
+	if err != nil {
+		log.Err(err).Msg("failed to get master key")
+		return nil, err
+	}
+	previousKeys, err := keys.PreviousKeys()
+	if err != nil {
+		log.Err(err).Msg("failed to get previous master keys")
+		return nil, err
+	}
+	as := &AuditService{repo: repo}
+	for _, master := range append([][]byte{masterKey}, previousKeys...) {
+		secret, err := util.DeriveKey(master, auditKeyPurpose)
+		if err != nil {
+			log.Err(err).Msg("failed to derive audit key")
+			return nil, err
+		}
+		as.keys = append(as.keys, util.NewKey(secret))
+	}
+
+	last, err := repo.Last(context.Background())
+	if err != nil && err != domain.ErrNotFound {
+		log.Err(err).Msg("failed to read audit log")
+		return nil, err
+	}
+	if err == nil {
+		as.seq = last.Seq
+		as.hash = last.Hash
+	}
+	return as, nil
+}
+
+// Record chains event to the log. Time and client address are filled in
+// when empty.
+func (as *AuditService) Record(ctx context.Context, event domain.AuditEvent) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	if len(event.ClientIP) == 0 {
+		event.ClientIP = domain.ClientIP(ctx)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	event.Seq = as.seq + 1
+	event.PrevHash = as.hash
+	event.KeyID = uint32(as.keys[0].ID)
+	event.Hash = hashAuditEvent(hmac.New(sha256.New, as.keys[0].Secret), event)
+	err := as.repo.Append(ctx, event)
+	if err != nil {
+		log.Err(err).Msgf("failed to record audit event '%s' of user '%s'", event.Action, event.UserID)
+		return err
+	}
+	as.seq = event.Seq
+	as.hash = event.Hash
+	return nil
+}
+
+func (as *AuditService) ListEvents(ctx context.Context, userID domain.UserID, after uint64, limit int) ([]domain.AuditEvent, error) {
+	if limit <= 0 || limit > MaxAuditPage {
+		limit = MaxAuditPage
+	}
+	return as.repo.ListByUser(ctx, userID, after, limit)
+}
+
+// Verify checks every entry of the log and returns the last one. Entries
+// written before the log was keyed are only accepted ahead of the keyed
+// ones, the first keyed entry authenticates their hash. Truncated tail is not
+// detected by the chain itself, compare the last hash with a copy kept
+// elsewhere.
+func (as *AuditService) Verify(ctx context.Context) (domain.AuditEvent, error) {
+	var last domain.AuditEvent
+	err := as.repo.Walk(ctx, func(event domain.AuditEvent) error {
+		if event.Seq != last.Seq+1 {
+			return fmt.Errorf("%w: entry %d follows entry %d", domain.ErrAuditChainBroken, event.Seq, last.Seq)
+		}
+		if !bytes.Equal(event.PrevHash, last.Hash) {
+			return fmt.Errorf("%w: entry %d does not follow the previous hash", domain.ErrAuditChainBroken, event.Seq)
+		}
+		var h hash.Hash
+		if event.KeyID == 0 {
+			if last.KeyID != 0 {
+				return fmt.Errorf("%w: entry %d is not authenticated", domain.ErrAuditChainBroken, event.Seq)
+			}
+			h = sha256.New()
+		} else {
+			key, ok := as.key(event.KeyID)
+			if !ok {
+				return fmt.Errorf("%w: entry %d is authenticated with unknown key %08x", domain.ErrAuditChainBroken, event.Seq, event.KeyID)
+			}
+			h = hmac.New(sha256.New, key.Secret)
+		}
+		if !hmac.Equal(event.Hash, hashAuditEvent(h, event)) {
+			return fmt.Errorf("%w: entry %d is modified", domain.ErrAuditChainBroken, event.Seq)
+		}
+		last = event
+		return nil
+	})
+	if err != nil {
+		return last, err
+	}
+	return last, nil
+}
+
+func (as *AuditService) key(id uint32) (util.Key, bool) {
+	for _, key := range as.keys {
+		if uint32(key.ID) == id {
+			return key, true
+		}
+	}
+	return util.Key{}, false
+}
+
+// hashAuditEvent hashes length prefixed fields of event with h, so no two
+// events encode the same.
+func hashAuditEvent(h hash.Hash, event domain.AuditEvent) []byte {
+	var num [8]byte
+	binary.BigEndian.PutUint64(num[:], event.Seq)
+	h.Write(num[:])
+	binary.BigEndian.PutUint64(num[:], uint64(event.Time.UnixNano()))
+	h.Write(num[:])
+	success := byte(0)
+	if event.Success {
+		success = 1
+	}
+	h.Write([]byte{success})
+	for _, field := range [][]byte{
+		[]byte(event.Action),
+		[]byte(event.UserID),
+		[]byte(event.UserName),
+		[]byte(event.ItemID),
+		[]byte(event.ItemType),
+		[]byte(event.ClientIP),
+		event.PrevHash,
+	} {
+		var size [4]byte
+		binary.BigEndian.PutUint32(size[:], uint32(len(field)))
+		h.Write(size[:])
+		h.Write(field)
+	}
+	return h.Sum(nil)
+}
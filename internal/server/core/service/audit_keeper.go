@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+)
+
+// AuditedKeeper records every item access of the wrapped keeper. Item is not
+// returned when its read cannot be recorded, changes are already made by then
+// and their audit failures are only logged.
+type AuditedKeeper struct {
+	keeper port.Keeper
+	audit  *AuditService
+}
+
+func NewAuditedKeeper(keeper port.Keeper, audit *AuditService) *AuditedKeeper {
+	return &AuditedKeeper{keeper: keeper, audit: audit}
+}
+
+func (ak *AuditedKeeper) record(ctx context.Context, action domain.AuditAction, dataCtx domain.DataContext, err error) error {
+	return ak.audit.Record(ctx, domain.AuditEvent{
+		Action:   action,
+		Success:  err == nil,
+		UserID:   dataCtx.UserID,
+		ItemID:   dataCtx.ID,
+		ItemType: dataCtx.Type,
+	})
+}
+
+// recordRead returns the read error, or the audit error of a successful read.
+func (ak *AuditedKeeper) recordRead(ctx context.Context, dataCtx domain.DataContext, err error) error {
+	auditErr := ak.record(ctx, domain.AuditGet, dataCtx, err)
+	if err != nil {
+		return err
+	}
+	return auditErr
+}
+
+func (ak *AuditedKeeper) ListAll(ctx context.Context, id domain.UserID) ([]domain.DataContext, error) {
+	return ak.keeper.ListAll(ctx, id)
+}
+
+func (ak *AuditedKeeper) SetTextData(ctx context.Context, data domain.TextData) error {
+	err := ak.keeper.SetTextData(ctx, data)
+	ak.record(ctx, domain.AuditSet, withType(data.Ctx, domain.TextType), err)
+	return err
+}
+
+func (ak *AuditedKeeper) GetTextData(ctx context.Context, dataCtx domain.DataContext) (string, error) {
+	data, err := ak.keeper.GetTextData(ctx, dataCtx)
+	if err := ak.recordRead(ctx, withType(dataCtx, domain.TextType), err); err != nil {
+		return "", err
+	}
+	return data, nil
+}
+
+func (ak *AuditedKeeper) SetBinaryData(ctx context.Context, data domain.BinaryData) error {
+	err := ak.keeper.SetBinaryData(ctx, data)
+	ak.record(ctx, domain.AuditSet, withType(data.Ctx, domain.BinaryType), err)
+	return err
+}
+
+func (ak *AuditedKeeper) GetBinaryData(ctx context.Context, dataCtx domain.DataContext) (domain.BinaryData, error) {
+	data, err := ak.keeper.GetBinaryData(ctx, dataCtx)
+	if err := ak.recordRead(ctx, withType(dataCtx, domain.BinaryType), err); err != nil {
+		return domain.BinaryData{}, err
+	}
+	return data, nil
+}
+
+func (ak *AuditedKeeper) SetBinaryStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	err := ak.keeper.SetBinaryStream(ctx, dataCtx, src)
+	ak.record(ctx, domain.AuditSet, withType(dataCtx, domain.BinaryType), err)
+	return err
+}
+
+// GetBinaryStream records the read when the file is opened, before any of it
+// is returned.
+func (ak *AuditedKeeper) GetBinaryStream(ctx context.Context, dataCtx domain.DataContext) (domain.DataContext, io.ReadCloser, error) {
+	meta, data, err := ak.keeper.GetBinaryStream(ctx, dataCtx)
+	if err := ak.recordRead(ctx, withType(dataCtx, domain.BinaryType), err); err != nil {
+		if data != nil {
+			data.Close()
+		}
+		return domain.DataContext{}, nil, err
+	}
+	return meta, data, nil
+}
+
+func (ak *AuditedKeeper) SetCredentialsData(ctx context.Context, data domain.CredentialsData) error {
+	err := ak.keeper.SetCredentialsData(ctx, data)
+	ak.record(ctx, domain.AuditSet, withType(data.Ctx, domain.CredentialsType), err)
+	return err
+}
+
+func (ak *AuditedKeeper) GetCredentialsData(ctx context.Context, dataCtx domain.DataContext) (domain.CredentialsData, error) {
+	data, err := ak.keeper.GetCredentialsData(ctx, dataCtx)
+	if err := ak.recordRead(ctx, withType(dataCtx, domain.CredentialsType), err); err != nil {
+		return domain.CredentialsData{}, err
+	}
+	return data, nil
+}
+
+func (ak *AuditedKeeper) SetBankData(ctx context.Context, data domain.BankData) error {
+	err := ak.keeper.SetBankData(ctx, data)
+	ak.record(ctx, domain.AuditSet, withType(data.Ctx, domain.BankType), err)
+	return err
+}
+
+func (ak *AuditedKeeper) GetBankData(ctx context.Context, dataCtx domain.DataContext) (domain.BankData, error) {
+	data, err := ak.keeper.GetBankData(ctx, dataCtx)
+	if err := ak.recordRead(ctx, withType(dataCtx, domain.BankType), err); err != nil {
+		return domain.BankData{}, err
+	}
+	return data, nil
+}
+
+func (ak *AuditedKeeper) SetEncryptedData(ctx context.Context, data domain.EncryptedData) error {
+	err := ak.keeper.SetEncryptedData(ctx, data)
+	ak.record(ctx, domain.AuditSet, data.Ctx, err)
+	return err
+}
+
+func (ak *AuditedKeeper) GetEncryptedData(ctx context.Context, dataCtx domain.DataContext) (domain.EncryptedData, error) {
+	data, err := ak.keeper.GetEncryptedData(ctx, dataCtx)
+	if err == nil {
+		dataCtx.Type = data.Ctx.Type
+	}
+	if err := ak.recordRead(ctx, dataCtx, err); err != nil {
+		return domain.EncryptedData{}, err
+	}
+	return data, nil
+}
+
+func (ak *AuditedKeeper) Delete(ctx context.Context, dataCtx domain.DataContext) error {
+	err := ak.keeper.Delete(ctx, dataCtx)
+	ak.record(ctx, domain.AuditDelete, dataCtx, err)
+	return err
+}
+
+// withType fills the type the keeper method works with, requests for reading
+// items do not carry it.
+func withType(dataCtx domain.DataContext, dataType domain.DataType) domain.DataContext {
+	if len(dataCtx.Type) == 0 {
+		dataCtx.Type = dataType
+	}
+	return dataCtx
+}
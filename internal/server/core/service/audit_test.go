@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newMockAuditRepository(ctrl *gomock.Controller, events *[]domain.AuditEvent) *mock_port.MockAuditRepository {
+	repo := mock_port.NewMockAuditRepository(ctrl)
+	repo.EXPECT().Last(gomock.Any()).DoAndReturn(
+		func(ctx context.Context) (domain.AuditEvent, error) {
+			if len(*events) == 0 {
+				return domain.AuditEvent{}, domain.ErrNotFound
+			}
+			return (*events)[len(*events)-1], nil
+		},
+	).AnyTimes()
+	repo.EXPECT().Append(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, event domain.AuditEvent) error {
+			*events = append(*events, event)
+			return nil
+		},
+	).AnyTimes()
+	repo.EXPECT().Walk(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, fn func(event domain.AuditEvent) error) error {
+			for _, event := range *events {
+				if err := fn(event); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	).AnyTimes()
+	return repo
+}
+
+func newMockAuditKeys(ctrl *gomock.Controller, master string, previous ...string) *mock_port.MockKeyProvider {
+	keys := mock_port.NewMockKeyProvider(ctrl)
+	keys.EXPECT().MasterKey().Return([]byte(master), nil).AnyTimes()
+	var previousKeys [][]byte
+	for _, key := range previous {
+		previousKeys = append(previousKeys, []byte(key))
+	}
+	keys.EXPECT().PreviousKeys().Return(previousKeys, nil).AnyTimes()
+	return keys
+}
+
+func TestAuditService_Chain(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	var events []domain.AuditEvent
+	repo := newMockAuditRepository(ctrl, &events)
+	keys := newMockAuditKeys(ctrl, "master")
+	audit, err := NewAuditService(repo, keys)
+	require.NoError(t, err)
+
+	ctx := domain.WithClientIP(context.Background(), "10.0.0.1")
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditLogin, Success: true, UserID: "id"}))
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditGet, Success: true, UserID: "id", ItemID: "item"}))
+	require.Equal(t, "10.0.0.1", events[0].ClientIP)
+	require.Empty(t, events[0].PrevHash)
+	require.Equal(t, events[0].Hash, events[1].PrevHash)
+
+	// restarted service continues the chain
+	audit, err = NewAuditService(repo, keys)
+	require.NoError(t, err)
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditDelete, UserID: "id", ItemID: "item"}))
+	last, err := audit.Verify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), last.Seq)
+	require.NotZero(t, last.KeyID)
+
+	events[1].ItemID = "other"
+	_, err = audit.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+
+	// the chain can not be rewritten without the key
+	events[1].Hash = hashAuditEvent(hmac.New(sha256.New, []byte("guess")), events[1])
+	events[2].PrevHash = events[1].Hash
+	events[2].Hash = hashAuditEvent(hmac.New(sha256.New, []byte("guess")), events[2])
+	_, err = audit.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+	for i := range events {
+		events[i].KeyID = 0
+		if i > 0 {
+			events[i].PrevHash = events[i-1].Hash
+		}
+		events[i].Hash = hashAuditEvent(sha256.New(), events[i])
+	}
+	last, err = audit.Verify(ctx)
+	require.NoError(t, err)
+	require.Zero(t, last.KeyID)
+	// keyed entry authenticates the unkeyed ones before it
+	audit, err = NewAuditService(repo, keys)
+	require.NoError(t, err)
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditLogin, UserID: "id"}))
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditLogin, UserID: "id"}))
+	events[0].KeyID = events[3].KeyID
+	_, err = audit.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+	events[0].KeyID = 0
+	_, err = audit.Verify(ctx)
+	require.NoError(t, err)
+	events[4].KeyID = 0
+	events[4].Hash = hashAuditEvent(sha256.New(), events[4])
+	_, err = audit.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+	events = events[:3]
+
+	// entries of the previous master key stay valid after rotation
+	audit, err = NewAuditService(repo, keys)
+	require.NoError(t, err)
+	require.NoError(t, audit.Record(ctx, domain.AuditEvent{Action: domain.AuditLogin, UserID: "id"}))
+	rotated, err := NewAuditService(repo, newMockAuditKeys(ctrl, "new master", "master"))
+	require.NoError(t, err)
+	require.NoError(t, rotated.Record(ctx, domain.AuditEvent{Action: domain.AuditLogin, UserID: "id"}))
+	require.NotEqual(t, events[3].KeyID, events[4].KeyID)
+	last, err = rotated.Verify(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), last.Seq)
+	_, err = audit.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+
+	events = append(events[:1], events[2:]...)
+	_, err = rotated.Verify(ctx)
+	require.True(t, errors.Is(err, domain.ErrAuditChainBroken))
+}
+
+func TestAuditService_ListEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	repo := newMockAuditRepository(ctrl, &[]domain.AuditEvent{})
+	audit, err := NewAuditService(repo, newMockAuditKeys(ctrl, "master"))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	repo.EXPECT().ListByUser(gomock.Any(), domain.UserID("id"), uint64(7), 10).Return(nil, nil)
+	_, err = audit.ListEvents(ctx, "id", 7, 10)
+	require.NoError(t, err)
+	repo.EXPECT().ListByUser(gomock.Any(), domain.UserID("id"), uint64(0), MaxAuditPage).Return(nil, nil).Times(2)
+	_, err = audit.ListEvents(ctx, "id", 0, 0)
+	require.NoError(t, err)
+	_, err = audit.ListEvents(ctx, "id", 0, MaxAuditPage+1)
+	require.NoError(t, err)
+}
+
+func TestAuditedKeeper(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	var events []domain.AuditEvent
+	audit, err := NewAuditService(newMockAuditRepository(ctrl, &events), newMockAuditKeys(ctrl, "master"))
+	require.NoError(t, err)
+	mockKeeper := mock_port.NewMockKeeper(ctrl)
+	keeper := NewAuditedKeeper(mockKeeper, audit)
+	ctx := context.Background()
+
+	dataCtx := domain.DataContext{ID: "item", UserID: "id"}
+	mockKeeper.EXPECT().GetBankData(gomock.Any(), dataCtx).Return(domain.BankData{Ctx: dataCtx}, nil)
+	_, err = keeper.GetBankData(ctx, dataCtx)
+	require.NoError(t, err)
+	mockKeeper.EXPECT().Delete(gomock.Any(), dataCtx).Return(domain.ErrNotFound)
+	require.Equal(t, domain.ErrNotFound, keeper.Delete(ctx, dataCtx))
+
+	require.Len(t, events, 2)
+	require.Equal(t, domain.AuditGet, events[0].Action)
+	require.Equal(t, domain.BankType, events[0].ItemType)
+	require.True(t, events[0].Success)
+	require.Equal(t, domain.AuditDelete, events[1].Action)
+	require.False(t, events[1].Success)
+}
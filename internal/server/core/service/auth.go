@@ -2,52 +2,314 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 	"github.com/rutkin/gophkeeper/internal/server/core/port"
 	"github.com/rutkin/gophkeeper/internal/server/core/util"
 )
 
+const refreshTokenSize = 32
+
 type AuthService struct {
-	repo port.UserRepository
-	ts   port.TokenService
+	repo       port.UserRepository
+	ts         port.TokenService
+	sessions   port.SessionRepository
+	refreshExp time.Duration
+	maxSession time.Duration
+	guard      *loginGuard
+	hasher     *util.PasswordHasher
+	items      port.KeeperRepository
+	userKeys   port.UserKeyRepository
+	audit      *AuditService
+	secrets    *util.KeyRing
+
+	personalTokens port.PersonalTokenRepository
 }
 
-func NewAuthService(repo port.UserRepository, ts port.TokenService) *AuthService {
+func NewAuthService(repo port.UserRepository, ts port.TokenService, sessions port.SessionRepository, refreshExp time.Duration) *AuthService {
 	return &AuthService{
-		repo: repo,
-		ts:   ts,
+		repo:       repo,
+		ts:         ts,
+		sessions:   sessions,
+		refreshExp: refreshExp,
+		hasher:     util.NewPasswordHasher(util.DefaultArgon2Params),
 	}
 }
 
+// WithMaxSession limits lifetime of a session counted from its login,
+// refresh tokens are not issued past it.
+func (a *AuthService) WithMaxSession(lifetime time.Duration) *AuthService {
+	a.maxSession = lifetime
+	return a
+}
+
+// WithPasswordHasher sets parameters new password hashes are written with,
+// older hashes are upgraded on login.
+func (a *AuthService) WithPasswordHasher(hasher *util.PasswordHasher) *AuthService {
+	a.hasher = hasher
+	return a
+}
+
 func (a *AuthService) Register(ctx context.Context, user domain.User) error {
-	hashPassword, err := util.HashPassword(user.Password)
+	hashPassword, err := a.hasher.Hash(user.Password)
 	if err != nil {
 		return err
 	}
 	user.ID = domain.UserID(uuid.NewString())
 	user.Password = hashPassword
-	return a.repo.CreateUser(ctx, user)
+	err = a.repo.CreateUser(ctx, user)
+	if err != nil {
+		return err
+	}
+	a.record(ctx, domain.AuditEvent{Action: domain.AuditRegister, Success: true, UserID: user.ID, UserName: user.Name})
+	return nil
 }
 
-func (a *AuthService) Login(ctx context.Context, user domain.User) (domain.Token, error) {
+// Login checks the password. With lockout enabled the attempt is counted
+// as failed up front, the username counter is reset only when the whole
+// login including the second factor passed.
+func (a *AuthService) Login(ctx context.Context, user domain.User, clientIP string) (domain.Tokens, error) {
+	now := time.Now()
+	if a.guard != nil {
+		if err := a.guard.attempt(ctx, a.guard.loginKeys(user.Name, clientIP), now); err != nil {
+			return domain.Tokens{}, err
+		}
+	}
+
 	curUser, err := a.repo.GetUserByName(ctx, user.Name)
+	if err != nil && err != domain.ErrNotFound {
+		return domain.Tokens{}, err
+	}
+	var rehash bool
+	if err == nil {
+		rehash, err = a.hasher.Verify(user.Password, curUser.Password)
+	} else {
+		err = a.hasher.VerifyMissing(user.Password)
+	}
+	if err != nil {
+		a.record(ctx, domain.AuditEvent{Action: domain.AuditLoginFailed, UserID: curUser.ID, UserName: user.Name, ClientIP: clientIP})
+		return domain.Tokens{}, domain.ErrInvalidCredentials
+	}
+
+	if a.guard != nil && len(clientIP) > 0 {
+		// the address did not guess, its counter is left as it was
+		a.guard.forgive(ctx, []attemptKey{a.guard.ipKey(clientIP)}, now)
+	}
+	if rehash {
+		a.rehashPassword(ctx, curUser, user.Password)
+	}
+	if curUser.TwoFactor.Enabled {
+		return a.createChallenge(ctx, curUser)
+	}
+	err = a.record(ctx, domain.AuditEvent{Action: domain.AuditLogin, Success: true, UserID: curUser.ID, UserName: curUser.Name, ClientIP: clientIP})
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	if err := a.loginPassed(ctx, curUser.Name); err != nil {
+		return domain.Tokens{}, err
+	}
+	return a.createTokens(ctx, curUser, newSessionFamily(), time.Now())
+}
+
+// loginPassed resets failed logins of the user.
+func (a *AuthService) loginPassed(ctx context.Context, name domain.UserName) error {
+	if a.guard == nil {
+		return nil
+	}
+	err := a.guard.succeed(ctx, a.guard.userKey(name))
+	if err != nil {
+		log.Err(err).Msg("failed to reset failed logins")
+	}
+	return err
+}
+
+// rehashPassword upgrades outdated password hash, login goes on when it
+// fails, the hash is upgraded next time.
+func (a *AuthService) rehashPassword(ctx context.Context, user domain.User, password string) {
+	hash, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Err(err).Msg("failed to rehash password")
+		return
+	}
+	err = a.repo.UpdatePassword(ctx, user.ID, hash, user.VaultKey)
+	if err != nil {
+		log.Err(err).Msgf("failed to update password hash of user '%s'", user.ID)
+	}
+}
+
+// WithAudit records registrations, logins and account changes.
+func (a *AuthService) WithAudit(audit *AuditService) *AuthService {
+	a.audit = audit
+	return a
+}
+
+// record appends event to the audit log when it is enabled. Logins are
+// refused when they cannot be recorded, events of changes already made and
+// of failed attempts are only logged.
+func (a *AuthService) record(ctx context.Context, event domain.AuditEvent) error {
+	if a.audit == nil {
+		return nil
+	}
+	return a.audit.Record(ctx, event)
+}
+
+// Refresh exchanges refresh token for a new token pair. Refresh tokens are
+// single use, presenting a used one means it leaked, so every token of its
+// family is revoked. The new token keeps the session start, a session older
+// than its maximum lifetime needs a new login.
+func (a *AuthService) Refresh(ctx context.Context, refreshToken domain.Token) (domain.Tokens, error) {
+	stored, err := a.sessions.UseRefreshToken(ctx, hashToken(refreshToken))
 	if err != nil {
+		if err == domain.ErrTokenReused {
+			log.Warn().Msgf("refresh token of user '%s' is reused, revoking session", stored.UserID)
+			if err := a.sessions.RevokeFamily(ctx, stored.Family); err != nil {
+				return domain.Tokens{}, err
+			}
+			return domain.Tokens{}, domain.ErrInvalidToken
+		}
 		if err == domain.ErrNotFound {
-			return domain.Token(""), domain.ErrInvalidCredentials
+			return domain.Tokens{}, domain.ErrInvalidToken
 		}
-		return domain.Token(""), err
+		return domain.Tokens{}, err
+	}
+	now := time.Now()
+	if now.After(stored.ExpiresAt) {
+		return domain.Tokens{}, domain.ErrInvalidToken
+	}
+	if a.maxSession > 0 && !stored.SessionStart.IsZero() && now.After(stored.SessionStart.Add(a.maxSession)) {
+		return domain.Tokens{}, domain.ErrInvalidToken
 	}
 
-	err = util.ComparePassword(user.Password, curUser.Password)
+	user, err := a.repo.GetUserByName(ctx, stored.UserName)
 	if err != nil {
-		return domain.Token(""), domain.ErrInvalidCredentials
+		if err == domain.ErrNotFound {
+			return domain.Tokens{}, domain.ErrInvalidToken
+		}
+		return domain.Tokens{}, err
+	}
+	if user.ID != stored.UserID {
+		return domain.Tokens{}, domain.ErrInvalidToken
+	}
+	return a.createTokens(ctx, user, stored.Family, stored.SessionStart)
+}
+
+// Logout revokes access token and, when given, the session of refresh token.
+func (a *AuthService) Logout(ctx context.Context, payload domain.TokenPayload, refreshToken domain.Token) error {
+	if len(payload.TokenID) > 0 {
+		err := a.sessions.RevokeAccessToken(ctx, payload.TokenID, payload.ExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+	if len(refreshToken) == 0 {
+		return nil
+	}
+
+	stored, err := a.sessions.UseRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil && err != domain.ErrTokenReused {
+		if err == domain.ErrNotFound {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != payload.ID {
+		return domain.ErrInvalidToken
 	}
+	return a.sessions.RevokeFamily(ctx, stored.Family)
+}
 
-	token, err := a.ts.CreateToken(curUser)
+// IsTokenRevoked reports whether access token was revoked by logout or by a
+// password change, tokens issued at the revocation time are revoked too.
+// Tokens without jti were issued before revocation existed.
+func (a *AuthService) IsTokenRevoked(ctx context.Context, payload domain.TokenPayload) (bool, error) {
+	before, err := a.sessions.UserRevokedBefore(ctx, payload.ID)
 	if err != nil {
-		return domain.Token(""), err
+		return false, err
+	}
+	if !before.IsZero() && !payload.IssuedAt.After(before) {
+		return true, nil
+	}
+	if len(payload.TokenID) == 0 {
+		return false, nil
+	}
+	return a.sessions.IsAccessTokenRevoked(ctx, payload.TokenID)
+}
+
+// createTokens issues a token pair in family of the session started at
+// start, the refresh token expires no later than the session.
+func (a *AuthService) createTokens(ctx context.Context, user domain.User, family string, start time.Time) (domain.Tokens, error) {
+	accessToken, expiresAt, err := a.ts.CreateToken(user)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+
+	secret := make([]byte, refreshTokenSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return domain.Tokens{}, err
+	}
+	refreshToken := domain.Token(base64.RawURLEncoding.EncodeToString(secret))
+	now := time.Now()
+	if start.IsZero() {
+		start = now
+	}
+	refreshExpiresAt := now.Add(a.refreshExp)
+	if a.maxSession > 0 && refreshExpiresAt.After(start.Add(a.maxSession)) {
+		refreshExpiresAt = start.Add(a.maxSession)
+	}
+	err = a.sessions.CreateRefreshToken(ctx, domain.RefreshToken{
+		Hash:         hashToken(refreshToken),
+		Family:       family,
+		UserID:       user.ID,
+		UserName:     user.Name,
+		ExpiresAt:    refreshExpiresAt,
+		SessionStart: start,
+	})
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	return domain.Tokens{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresAt: expiresAt}, nil
+}
+
+func newSessionFamily() string {
+	return uuid.NewString()
+}
+
+func hashToken(token domain.Token) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// IsEncrypted reads encryption mode of the account, a token of a user that
+// is gone or was registered again under the same name is invalid.
+func (a *AuthService) IsEncrypted(ctx context.Context, payload domain.TokenPayload) (bool, error) {
+	user, err := a.repo.GetUserByName(ctx, domain.UserName(payload.Name))
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return false, domain.ErrInvalidToken
+		}
+		return false, err
+	}
+	if user.ID != payload.ID {
+		return false, domain.ErrInvalidToken
+	}
+	return user.IsEncrypted(), nil
+}
+
+// GetVaultKey returns wrapped vault key of client side encrypted account.
+func (a *AuthService) GetVaultKey(ctx context.Context, name domain.UserName) ([]byte, error) {
+	user, err := a.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsEncrypted() {
+		return nil, domain.ErrEncryptionMode
 	}
-	return token, nil
+	return user.VaultKey, nil
 }
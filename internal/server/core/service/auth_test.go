@@ -3,11 +3,14 @@ package service
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestAuthService_RegisterAndLogin(t *testing.T) {
@@ -28,11 +31,13 @@ func TestAuthService_RegisterAndLogin(t *testing.T) {
 	mockToken := mock_port.NewMockTokenService(ctrl)
 	expectedToken := domain.Token("token")
 	mockToken.EXPECT().CreateToken(gomock.Any()).DoAndReturn(
-		func(user domain.User) (domain.Token, error) {
-			return expectedToken, nil
+		func(user domain.User) (domain.Token, time.Time, error) {
+			return expectedToken, time.Now().Add(time.Minute), nil
 		},
 	)
-	as := NewAuthService(mockRepo, mockToken)
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour)
 	user := domain.User{
 		ID:       "id",
 		Name:     "name",
@@ -41,7 +46,191 @@ func TestAuthService_RegisterAndLogin(t *testing.T) {
 	ctx := context.Background()
 	err := as.Register(ctx, user)
 	require.NoError(t, err)
-	token, err := as.Login(ctx, user)
+	tokens, err := as.Login(ctx, user, "127.0.0.1")
 	require.NoError(t, err)
-	require.Equal(t, token, expectedToken)
+	require.Equal(t, tokens.AccessToken, expectedToken)
+	require.NotEmpty(t, tokens.RefreshToken)
+}
+
+func TestAuthService_LoginRehash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: string(bcryptHash)}
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).DoAndReturn(
+		func(ctx context.Context, name domain.UserName) (domain.User, error) {
+			return user, nil
+		},
+	).Times(2)
+	mockRepo.EXPECT().UpdatePassword(gomock.Any(), user.ID, gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+			user.Password = password
+			return nil
+		},
+	)
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(gomock.Any()).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).Times(2)
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil).Times(2)
+
+	hasher := util.NewPasswordHasher(util.Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour).WithPasswordHasher(hasher)
+	ctx := context.Background()
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+	rehash, err := hasher.Verify("password", user.Password)
+	require.NoError(t, err)
+	require.False(t, rehash)
+
+	// current hash is kept
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+}
+
+func TestAuthService_LoginUnknownUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), domain.UserName("nobody")).Return(domain.User{}, domain.ErrNotFound)
+	hasher := util.NewPasswordHasher(util.Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	as := NewAuthService(mockRepo, mock_port.NewMockTokenService(ctrl), mock_port.NewMockSessionRepository(ctrl), time.Hour).WithPasswordHasher(hasher)
+
+	// the password is still hashed, unknown user answers like a wrong password
+	_, err := as.Login(context.Background(), domain.User{Name: "nobody", Password: "password"}, "")
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+}
+
+func TestAuthService_Refresh(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	user := domain.User{ID: "id", Name: "name"}
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil).AnyTimes()
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(user).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+
+	stored := map[string]domain.RefreshToken{}
+	used := map[string]bool{}
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, token domain.RefreshToken) error {
+			stored[string(token.Hash)] = token
+			return nil
+		},
+	).Times(2)
+	mockSessions.EXPECT().UseRefreshToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, hash []byte) (domain.RefreshToken, error) {
+			token, ok := stored[string(hash)]
+			if !ok {
+				return domain.RefreshToken{}, domain.ErrNotFound
+			}
+			if used[string(hash)] {
+				return token, domain.ErrTokenReused
+			}
+			used[string(hash)] = true
+			return token, nil
+		},
+	).Times(3)
+
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour)
+	ctx := context.Background()
+	start := time.Now()
+	login, err := as.createTokens(ctx, user, "family", start)
+	require.NoError(t, err)
+	refreshed, err := as.Refresh(ctx, login.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	require.Equal(t, "family", stored[string(hashToken(refreshed.RefreshToken))].Family)
+	require.True(t, start.Equal(stored[string(hashToken(refreshed.RefreshToken))].SessionStart))
+
+	mockSessions.EXPECT().RevokeFamily(gomock.Any(), "family").Return(nil)
+	_, err = as.Refresh(ctx, login.RefreshToken)
+	require.Equal(t, domain.ErrInvalidToken, err)
+
+	_, err = as.Refresh(ctx, domain.Token("unknown"))
+	require.Equal(t, domain.ErrInvalidToken, err)
+}
+
+func TestAuthService_MaxSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	user := domain.User{ID: "id", Name: "name"}
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil).AnyTimes()
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(user).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+
+	stored := map[string]domain.RefreshToken{}
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, token domain.RefreshToken) error {
+			stored[string(token.Hash)] = token
+			return nil
+		},
+	).Times(2)
+	mockSessions.EXPECT().UseRefreshToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, hash []byte) (domain.RefreshToken, error) {
+			return stored[string(hash)], nil
+		},
+	).Times(2)
+
+	as := NewAuthService(mockRepo, mockToken, mockSessions, 24*time.Hour).WithMaxSession(2 * time.Hour)
+	ctx := context.Background()
+
+	// refresh token of an old session expires with the session
+	start := time.Now().Add(-time.Hour)
+	login, err := as.createTokens(ctx, user, "family", start)
+	require.NoError(t, err)
+	require.True(t, start.Add(2*time.Hour).Equal(stored[string(hashToken(login.RefreshToken))].ExpiresAt))
+	_, err = as.Refresh(ctx, login.RefreshToken)
+	require.NoError(t, err)
+
+	// session past its lifetime is not refreshed however fresh the token is
+	expired := domain.RefreshToken{Hash: hashToken("expired"), Family: "old", UserID: user.ID, UserName: user.Name,
+		ExpiresAt: time.Now().Add(time.Hour), SessionStart: time.Now().Add(-3 * time.Hour)}
+	stored[string(expired.Hash)] = expired
+	_, err = as.Refresh(ctx, "expired")
+	require.Equal(t, domain.ErrInvalidToken, err)
+}
+
+func TestAuthService_Logout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	expiresAt := time.Now().Add(time.Minute)
+	payload := domain.TokenPayload{ID: "id", TokenID: "jti", ExpiresAt: expiresAt}
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().RevokeAccessToken(gomock.Any(), "jti", expiresAt).Return(nil)
+	mockSessions.EXPECT().UseRefreshToken(gomock.Any(), hashToken("refresh")).Return(domain.RefreshToken{UserID: "id", Family: "family"}, nil)
+	mockSessions.EXPECT().RevokeFamily(gomock.Any(), "family").Return(nil)
+	mockSessions.EXPECT().IsAccessTokenRevoked(gomock.Any(), "jti").Return(true, nil)
+	mockSessions.EXPECT().UserRevokedBefore(gomock.Any(), domain.UserID("id")).Return(time.Time{}, nil).Times(2)
+
+	as := NewAuthService(mock_port.NewMockUserRepository(ctrl), mock_port.NewMockTokenService(ctrl), mockSessions, time.Hour)
+	ctx := context.Background()
+	err := as.Logout(ctx, payload, "refresh")
+	require.NoError(t, err)
+	revoked, err := as.IsTokenRevoked(ctx, payload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = as.IsTokenRevoked(ctx, domain.TokenPayload{ID: "id"})
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
+
+func TestAuthService_IsEncrypted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	user := domain.User{ID: "id", Name: "name", VaultKey: []byte("wrapped")}
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil).Times(2)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), domain.UserName("gone")).Return(domain.User{}, domain.ErrNotFound)
+	as := NewAuthService(mockRepo, nil, nil, time.Hour)
+	ctx := context.Background()
+
+	// the account decides, not the claim of the token
+	encrypted, err := as.IsEncrypted(ctx, domain.TokenPayload{ID: user.ID, Name: string(user.Name)})
+	require.NoError(t, err)
+	require.True(t, encrypted)
+
+	// account registered again under the name is not the one of the token
+	_, err = as.IsEncrypted(ctx, domain.TokenPayload{ID: "old", Name: string(user.Name)})
+	require.Equal(t, domain.ErrInvalidToken, err)
+	_, err = as.IsEncrypted(ctx, domain.TokenPayload{ID: "id", Name: "gone"})
+	require.Equal(t, domain.ErrInvalidToken, err)
 }
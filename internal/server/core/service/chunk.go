@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+const chunkKeyPurpose = "gophkeeper chunk id"
+
+// WithChunks stores binary items in content defined chunks shared between
+// items of the same user. Chunks are addressed by a hash keyed with the user
+// id and a key derived from the user key, so the storage learns nothing
+// about equal files of different users. Rotation of the master key only
+// rewraps user keys, so new files keep sharing chunks with older ones;
+// without user keys the hash key follows the master key. Items stay readable
+// when chunks are disabled again, as long as the repository keeps them.
+func (ks *KeeperService) WithChunks(chunks port.ChunkRepository) *KeeperService {
+	ks.chunks = chunks
+	return ks
+}
+
+// chunkID returns hash of chunk of the user keyed with key.
+func chunkID(key []byte, userID domain.UserID, chunk []byte) domain.ChunkID {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(binary.BigEndian.AppendUint32(nil, uint32(len(userID))))
+	mac.Write([]byte(userID))
+	mac.Write(chunk)
+	var id domain.ChunkID
+	mac.Sum(id[:0])
+	return id
+}
+
+// chunkAssociatedData binds chunk ciphertext to its owner and id.
+func chunkAssociatedData(userID domain.UserID, id domain.ChunkID) []byte {
+	return associatedData(domain.DataContext{UserID: userID, ID: domain.DataID(id.String()), Type: "chunk"})
+}
+
+// setChunked stores chunks of src missing for the user and then the item
+// with the sealed list of its chunks. References taken before a failure are
+// released again.
+func (ks *KeeperService) setChunked(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	var ids []domain.ChunkID
+	ring, err := ks.ring(ctx, dataCtx.UserID, true)
+	if err != nil {
+		return err
+	}
+	chunkKey, err := ring.DeriveKey(chunkKeyPurpose)
+	if err != nil {
+		return err
+	}
+	err = func() error {
+		chunker := util.NewChunker(src)
+		for {
+			chunk, err := chunker.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			id := chunkID(chunkKey, dataCtx.UserID, chunk)
+			if err := ks.putChunk(ctx, ring, dataCtx.UserID, id, chunk); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+	}()
+	if err == nil {
+		var manifest []byte
+		manifest, err = ring.Seal(encodeManifest(ids), associatedData(dataCtx))
+		if err == nil {
+			err = ks.chunks.SetChunked(ctx, dataCtx, manifest, ids)
+		}
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to store chunks of item '%s'", dataCtx.ID)
+		if err := ks.chunks.ReleaseChunks(ctx, dataCtx.UserID, ids); err != nil {
+			log.Err(err).Msgf("failed to release chunks of item '%s'", dataCtx.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// putChunk references chunk the user already has, only new chunks are
+// encrypted and written.
+func (ks *KeeperService) putChunk(ctx context.Context, ring *util.KeyRing, userID domain.UserID, id domain.ChunkID, chunk []byte) error {
+	stored, err := ks.chunks.RefChunk(ctx, userID, id)
+	if err != nil || stored {
+		return err
+	}
+	sealed, err := ring.Seal(chunk, chunkAssociatedData(userID, id))
+	if err != nil {
+		return err
+	}
+	return ks.chunks.PutChunk(ctx, userID, id, sealed)
+}
+
+// openChunked returns reader of chunked item, requested is the owner and id
+// the manifest has to be bound to.
+func (ks *KeeperService) openChunked(ctx context.Context, requested, meta domain.DataContext) (io.ReadCloser, error) {
+	sealed, err := ks.repo.GetData(ctx, meta)
+	if err != nil {
+		log.Err(err).Msg("failed to get data from repository")
+		return nil, err
+	}
+	ring, err := ks.ring(ctx, requested.UserID, false)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := ring.Open(sealed, associatedData(domain.DataContext{UserID: requested.UserID, ID: requested.ID, Type: meta.Type}))
+	if err != nil {
+		log.Err(err).Msg("failed to decrypt chunk list")
+		return nil, decryptError(err)
+	}
+	ids, err := decodeManifest(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkReader{ctx: ctx, chunks: ks.chunks, ring: ring, userID: requested.UserID, ids: ids}, nil
+}
+
+// encodeManifest lists chunk ids of item in order.
+func encodeManifest(ids []domain.ChunkID) []byte {
+	manifest := make([]byte, 0, len(ids)*domain.ChunkIDSize)
+	for _, id := range ids {
+		manifest = append(manifest, id[:]...)
+	}
+	return manifest
+}
+
+func decodeManifest(manifest []byte) ([]domain.ChunkID, error) {
+	if len(manifest)%domain.ChunkIDSize != 0 {
+		return nil, domain.ErrDecryptionFailed
+	}
+	ids := make([]domain.ChunkID, len(manifest)/domain.ChunkIDSize)
+	for i := range ids {
+		copy(ids[i][:], manifest[i*domain.ChunkIDSize:])
+	}
+	return ids, nil
+}
+
+// chunkReader reads and decrypts chunks one at a time.
+type chunkReader struct {
+	ctx     context.Context
+	chunks  port.ChunkRepository
+	ring    *util.KeyRing
+	userID  domain.UserID
+	ids     []domain.ChunkID
+	pending []byte
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for len(cr.pending) == 0 {
+		if len(cr.ids) == 0 {
+			return 0, io.EOF
+		}
+		id := cr.ids[0]
+		sealed, err := cr.chunks.GetChunk(cr.ctx, cr.userID, id)
+		if err != nil {
+			log.Err(err).Msgf("failed to get chunk '%s'", id)
+			return 0, err
+		}
+		cr.pending, err = cr.ring.Open(sealed, chunkAssociatedData(cr.userID, id))
+		if err != nil {
+			return 0, decryptError(err)
+		}
+		cr.ids = cr.ids[1:]
+	}
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	return n, nil
+}
+
+func (cr *chunkReader) Close() error {
+	return nil
+}
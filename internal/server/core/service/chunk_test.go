@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeeperService_Chunks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockChunks := mock_port.NewMockChunkRepository(ctrl)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	ks.WithChunks(mockChunks)
+
+	chunks := map[domain.ChunkID][]byte{}
+	refs := map[domain.ChunkID]int{}
+	items := map[domain.DataID]domain.DataContext{}
+	manifests := map[domain.DataID][]byte{}
+	mockChunks.EXPECT().RefChunk(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.ChunkID) (bool, error) {
+			if _, ok := chunks[id]; !ok {
+				return false, nil
+			}
+			refs[id]++
+			return true, nil
+		},
+	).AnyTimes()
+	mockChunks.EXPECT().PutChunk(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error {
+			chunks[id] = data
+			refs[id]++
+			return nil
+		},
+	).AnyTimes()
+	mockChunks.EXPECT().GetChunk(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.ChunkID) ([]byte, error) {
+			return chunks[id], nil
+		},
+	).AnyTimes()
+	mockChunks.EXPECT().SetChunked(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, data []byte, ids []domain.ChunkID) error {
+			require.Equal(t, domain.BinaryType, dataCtx.Type)
+			items[dataCtx.ID] = dataCtx
+			manifests[dataCtx.ID] = data
+			return nil
+		},
+	).AnyTimes()
+	mockChunks.EXPECT().GetChunks(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	mockRepo.EXPECT().GetMeta(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
+			return items[id], nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().GetData(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+			return manifests[dataCtx.ID], nil
+		},
+	).AnyTimes()
+
+	ctx := context.Background()
+	content := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(content)
+	require.NoError(t, ks.SetBinaryData(ctx, domain.BinaryData{
+		Ctx:  domain.DataContext{ID: "first", UserID: "owner"},
+		Data: content,
+	}))
+	stored := len(chunks)
+	require.Greater(t, stored, 1)
+
+	// the copy with appended data stores only its last chunks
+	edited := append(append([]byte(nil), content...), "appended"...)
+	require.NoError(t, ks.SetBinaryData(ctx, domain.BinaryData{
+		Ctx:  domain.DataContext{ID: "second", UserID: "owner"},
+		Data: edited,
+	}))
+	require.LessOrEqual(t, len(chunks), stored+2)
+	shared := 0
+	for _, n := range refs {
+		if n == 2 {
+			shared++
+		}
+	}
+	require.GreaterOrEqual(t, shared, stored-1)
+
+	binary, err := ks.GetBinaryData(ctx, domain.DataContext{ID: "first", UserID: "owner"})
+	require.NoError(t, err)
+	require.Equal(t, content, binary.Data)
+	_, reader, err := ks.GetBinaryStream(ctx, domain.DataContext{ID: "second", UserID: "owner"})
+	require.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.Equal(t, edited, data)
+
+	_, _, err = ks.GetBinaryStream(ctx, domain.DataContext{ID: "first", UserID: "other"})
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+
+	for id := range chunks {
+		chunks[id][len(chunks[id])-1] ^= 1
+	}
+	_, err = ks.GetBinaryData(ctx, domain.DataContext{ID: "first", UserID: "owner"})
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+}
+
+func TestChunkID(t *testing.T) {
+	key := []byte("chunk-key")
+	chunk := []byte("chunk")
+	require.Equal(t, chunkID(key, "owner", chunk), chunkID(key, "owner", chunk))
+	require.NotEqual(t, chunkID(key, "owner", chunk), chunkID(key, "other", chunk))
+	require.NotEqual(t, chunkID(key, "ab", []byte("cchunk")), chunkID(key, "abc", chunk))
+	require.NotEqual(t, chunkID(key, "owner", chunk), chunkID([]byte("other-key"), "owner", chunk))
+}
+
+// Chunk ids follow the user key, so they do not change with the master key.
+func TestKeeperService_ChunkKeyRotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	userKeys := map[domain.UserID][]byte{}
+	chunkKey := func(master []byte, previous ...[]byte) []byte {
+		mockKeys := mock_port.NewMockKeyProvider(ctrl)
+		mockKeys.EXPECT().MasterKey().Return(master, nil).Times(2)
+		mockKeys.EXPECT().PreviousKeys().Return(previous, nil).Times(2)
+		ks, err := NewKeeperService(mock_port.NewMockKeeperRepository(ctrl), mockKeys)
+		require.NoError(t, err)
+		ks, err = ks.WithUserKeys(newMockUserKeys(ctrl, userKeys), mockKeys)
+		require.NoError(t, err)
+		ring, err := ks.ring(context.Background(), "owner", true)
+		require.NoError(t, err)
+		key, err := ring.DeriveKey(chunkKeyPurpose)
+		require.NoError(t, err)
+		return key
+	}
+
+	before := chunkKey([]byte("old-master-key"))
+	require.Equal(t, before, chunkKey([]byte("new-master-key"), []byte("old-master-key")))
+	delete(userKeys, "owner")
+	require.NotEqual(t, before, chunkKey([]byte("new-master-key"), []byte("old-master-key")))
+}
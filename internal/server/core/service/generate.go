@@ -2,3 +2,10 @@ package service
 
 //go:generate mockgen -source=../port/keeper.go -destination=mock/keeper.go
 //go:generate mockgen -source=../port/auth.go -destination=mock/auth.go
+//go:generate mockgen -source=../port/key.go -destination=mock/key.go
+//go:generate mockgen -source=../port/rotation.go -destination=mock/rotation.go
+//go:generate mockgen -source=../port/session.go -destination=mock/session.go
+//go:generate mockgen -source=../port/lockout.go -destination=mock/lockout.go
+//go:generate mockgen -source=../port/audit.go -destination=mock/audit.go
+//go:generate mockgen -source=../port/personal_token.go -destination=mock/personal_token.go
+//go:generate mockgen -source=../port/chunk.go -destination=mock/chunk.go
@@ -3,25 +3,52 @@ package service
 import (
 	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/sha256"
+	"encoding/binary"
 	"encoding/gob"
+	"errors"
+	"io"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
 )
 
-var password = []byte("secret-key")
+const keeperKeyPurpose = "gophkeeper keeper kek"
+
+// legacyKey opens items stored before the master key became configurable.
+var legacyKey = sha256.Sum256([]byte("secret-key"))
 
 type KeeperService struct {
-	repo port.KeeperRepository
+	repo     port.KeeperRepository
+	keys     *util.KeyRing
+	chunks   port.ChunkRepository
+	userKeys *userKeys
+}
+
+func NewKeeperService(repo port.KeeperRepository, keys port.KeyProvider) (*KeeperService, error) {
+	ring, err := newKeeperKeyRing(keys)
+	if err != nil {
+		return nil, err
+	}
+	return &KeeperService{repo: repo, keys: ring}, nil
+}
+
+// WithBoundOnly refuses items sealed in formats that do not bind them to their
+// owner, id and type. Enable it once rotate-keys has resealed every item.
+func (ks *KeeperService) WithBoundOnly() *KeeperService {
+	ks.keys.WithBoundOnly()
+	return ks
 }
 
-func NewKeeperService(repo port.KeeperRepository) *KeeperService {
-	return &KeeperService{repo: repo}
+func newKeeperKeyRing(keys port.KeyProvider) (*util.KeyRing, error) {
+	ring, err := newKeyRing(keys, keeperKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return ring.WithLegacy(legacyKey[:]), nil
 }
 
 func (ks *KeeperService) ListAll(ctx context.Context, id domain.UserID) ([]domain.DataContext, error) {
@@ -29,7 +56,7 @@ func (ks *KeeperService) ListAll(ctx context.Context, id domain.UserID) ([]domai
 }
 
 func (ks *KeeperService) SetTextData(ctx context.Context, data domain.TextData) error {
-	encryptedData, err := encrypt([]byte(data.Data))
+	encryptedData, err := ks.encrypt(ctx, data.Ctx, []byte(data.Data))
 	if err != nil {
 		log.Err(err).Msg("failed to encrypt text data")
 		return err
@@ -39,28 +66,20 @@ func (ks *KeeperService) SetTextData(ctx context.Context, data domain.TextData)
 }
 
 func (ks *KeeperService) GetTextData(ctx context.Context, dataCtx domain.DataContext) (string, error) {
-	dataCtx, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
-	if err != nil {
-		log.Err(err).Msg("failed to get text data from repository")
-		return "", err
-	}
-
-	data, err := ks.repo.GetData(ctx, dataCtx)
+	_, data, err := ks.getData(ctx, dataCtx, domain.TextType, false)
 	if err != nil {
-		log.Err(err).Msg("failed to get text data from repository")
+		log.Err(err).Msg("failed to get text data")
 		return "", err
 	}
-
-	decryptedData, err := decrypt(data)
-	if err != nil {
-		log.Err(err).Msg("failed to decrypt text data")
-		return "", err
-	}
-	return string(decryptedData), nil
+	return string(data), nil
 }
 
 func (ks *KeeperService) SetBinaryData(ctx context.Context, data domain.BinaryData) error {
-	encryptedData, err := encrypt([]byte(data.Data))
+	data.Ctx.Type = domain.BinaryType
+	if ks.chunks != nil {
+		return ks.SetBinaryStream(ctx, data.Ctx, bytes.NewReader(data.Data))
+	}
+	encryptedData, err := ks.encrypt(ctx, data.Ctx, []byte(data.Data))
 	if err != nil {
 		log.Err(err).Msg("failed to encrypt text data")
 		return err
@@ -70,23 +89,104 @@ func (ks *KeeperService) SetBinaryData(ctx context.Context, data domain.BinaryDa
 }
 
 func (ks *KeeperService) GetBinaryData(ctx context.Context, dataCtx domain.DataContext) (domain.BinaryData, error) {
-	dataCtx, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
+	if ks.chunks != nil {
+		meta, reader, err := ks.GetBinaryStream(ctx, dataCtx)
+		if err != nil {
+			return domain.BinaryData{}, err
+		}
+		defer reader.Close()
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return domain.BinaryData{}, err
+		}
+		return domain.BinaryData{Ctx: meta, Data: data}, nil
+	}
+	dataCtx, data, err := ks.getData(ctx, dataCtx, domain.BinaryType, false)
 	if err != nil {
-		log.Err(err).Msg("failed to get text data from repository")
+		log.Err(err).Msg("failed to get binary data")
 		return domain.BinaryData{}, err
 	}
-	data, err := ks.repo.GetData(ctx, dataCtx)
+	return domain.BinaryData{Ctx: dataCtx, Data: data}, nil
+}
+
+// SetBinaryStream encrypts src chunk by chunk while the repository writes it,
+// so memory use does not depend on the file size.
+func (ks *KeeperService) SetBinaryStream(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+	dataCtx.Type = domain.BinaryType
+	if ks.chunks != nil {
+		return ks.setChunked(ctx, dataCtx, src)
+	}
+	ring, err := ks.ring(ctx, dataCtx.UserID, true)
 	if err != nil {
-		log.Err(err).Msg("failed to get binary data from repository")
-		return domain.BinaryData{}, err
+		return err
+	}
+	encrypted, err := ring.SealReader(src, associatedData(dataCtx))
+	if err != nil {
+		log.Err(err).Msg("failed to encrypt binary data")
+		return err
+	}
+	return ks.repo.SetStream(ctx, dataCtx, encrypted)
+}
+
+// GetBinaryStream returns reader decrypting the file while it is read. Data
+// of a damaged file is returned up to the damaged chunk, then the reader fails
+// with domain.ErrDecryptionFailed. Items other than files are reported as
+// missing.
+func (ks *KeeperService) GetBinaryStream(ctx context.Context, dataCtx domain.DataContext) (domain.DataContext, io.ReadCloser, error) {
+	meta, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
+	if err != nil {
+		log.Err(err).Msg("failed to get meta from repository")
+		return domain.DataContext{}, nil, err
+	}
+	if meta.Type != domain.BinaryType {
+		return domain.DataContext{}, nil, domain.ErrNotFound
+	}
+	if meta.Encrypted {
+		return domain.DataContext{}, nil, domain.ErrEncryptionMode
+	}
+	if ks.chunks != nil {
+		_, err := ks.chunks.GetChunks(ctx, meta)
+		if err == nil {
+			reader, err := ks.openChunked(ctx, dataCtx, meta)
+			if err != nil {
+				return domain.DataContext{}, nil, err
+			}
+			return meta, reader, nil
+		}
+		if err != domain.ErrNotFound {
+			log.Err(err).Msg("failed to get chunks from repository")
+			return domain.DataContext{}, nil, err
+		}
 	}
 
-	decryptedData, err := decrypt(data)
+	data, err := ks.repo.GetStream(ctx, meta)
 	if err != nil {
-		log.Err(err).Msg("failed to decrypt text data")
-		return domain.BinaryData{}, err
+		log.Err(err).Msg("failed to get data from repository")
+		return domain.DataContext{}, nil, err
+	}
+	ring, err := ks.ring(ctx, dataCtx.UserID, false)
+	if err != nil {
+		data.Close()
+		return domain.DataContext{}, nil, err
+	}
+	decrypted, err := ring.OpenReader(data, associatedData(domain.DataContext{UserID: dataCtx.UserID, ID: dataCtx.ID, Type: meta.Type}))
+	if err != nil {
+		data.Close()
+		log.Err(err).Msg("failed to decrypt binary data")
+		return domain.DataContext{}, nil, decryptError(err)
 	}
-	return domain.BinaryData{Ctx: dataCtx, Data: decryptedData}, nil
+	return meta, decryptingReader{Reader: decrypted, Closer: data}, nil
+}
+
+// decryptingReader reports damaged chunks as domain.ErrDecryptionFailed.
+type decryptingReader struct {
+	io.Reader
+	io.Closer
+}
+
+func (dr decryptingReader) Read(p []byte) (int, error) {
+	n, err := dr.Reader.Read(p)
+	return n, decryptError(err)
 }
 
 func (ks *KeeperService) SetCredentialsData(ctx context.Context, data domain.CredentialsData) error {
@@ -97,7 +197,7 @@ func (ks *KeeperService) SetCredentialsData(ctx context.Context, data domain.Cre
 		log.Err(err).Msg("failed to encode credentials")
 		return err
 	}
-	encrypted, err := encrypt(dataBuf.Bytes())
+	encrypted, err := ks.encrypt(ctx, data.Ctx, dataBuf.Bytes())
 	if err != nil {
 		log.Err(err).Msg("failed to encrypt credentials")
 		return err
@@ -112,24 +212,13 @@ func (ks *KeeperService) SetCredentialsData(ctx context.Context, data domain.Cre
 }
 
 func (ks *KeeperService) GetCredentialsData(ctx context.Context, dataCtx domain.DataContext) (domain.CredentialsData, error) {
-	dataCtx, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
-	if err != nil {
-		log.Err(err).Msg("failed to get credentials meta from repository")
-		return domain.CredentialsData{}, err
-	}
-	data, err := ks.repo.GetData(ctx, dataCtx)
-	if err != nil {
-		log.Err(err).Msg("failed to credentials from repository")
-		return domain.CredentialsData{}, err
-	}
-
-	decryptedData, err := decrypt(data)
+	dataCtx, data, err := ks.getData(ctx, dataCtx, domain.CredentialsType, false)
 	if err != nil {
-		log.Err(err).Msg("failed to decrypt text data")
+		log.Err(err).Msg("failed to get credentials")
 		return domain.CredentialsData{}, err
 	}
 
-	decoder := gob.NewDecoder(bytes.NewReader(decryptedData))
+	decoder := gob.NewDecoder(bytes.NewReader(data))
 	var cred domain.Credentials
 	err = decoder.Decode(&cred)
 	if err != nil {
@@ -140,42 +229,52 @@ func (ks *KeeperService) GetCredentialsData(ctx context.Context, dataCtx domain.
 }
 
 func (ks *KeeperService) SetBankData(ctx context.Context, data domain.BankData) error {
-	return SetDataImpl(ctx, ks.repo, data.Ctx, data.Card)
+	return SetDataImpl(ctx, ks, data.Ctx, data.Card)
 }
 
 func (ks *KeeperService) GetBankData(ctx context.Context, dataCtx domain.DataContext) (domain.BankData, error) {
-	dataCtx, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
+	dataCtx, data, err := ks.getData(ctx, dataCtx, domain.BankType, false)
 	if err != nil {
-		log.Err(err).Msg("failed to get credentials meta from repository")
+		log.Err(err).Msg("failed to get bank data")
 		return domain.BankData{}, err
 	}
-	data, err := ks.repo.GetData(ctx, dataCtx)
+
+	decoder := gob.NewDecoder(bytes.NewReader(data))
+	var card domain.Card
+	err = decoder.Decode(&card)
 	if err != nil {
-		log.Err(err).Msg("failed to credentials from repository")
+		log.Err(err).Msg("failed to decode bank data")
 		return domain.BankData{}, err
 	}
+	return domain.BankData{Ctx: dataCtx, Card: card}, nil
+}
 
-	decryptedData, err := decrypt(data)
+// SetEncryptedData stores item encrypted by the client. The server envelope
+// is still applied on top, so such items follow master key rotation.
+func (ks *KeeperService) SetEncryptedData(ctx context.Context, data domain.EncryptedData) error {
+	data.Ctx.Encrypted = true
+	encrypted, err := ks.encrypt(ctx, data.Ctx, data.Data)
 	if err != nil {
-		log.Err(err).Msg("failed to decrypt text data")
-		return domain.BankData{}, err
+		log.Err(err).Msg("failed to encrypt data")
+		return err
 	}
+	return ks.repo.Set(ctx, data.Ctx, encrypted)
+}
 
-	decoder := gob.NewDecoder(bytes.NewReader(decryptedData))
-	var card domain.Card
-	err = decoder.Decode(&card)
+func (ks *KeeperService) GetEncryptedData(ctx context.Context, dataCtx domain.DataContext) (domain.EncryptedData, error) {
+	dataCtx, data, err := ks.getData(ctx, dataCtx, "", true)
 	if err != nil {
-		log.Err(err).Msg("failed to decode credentials")
-		return domain.BankData{}, err
+		log.Err(err).Msg("failed to get encrypted data")
+		return domain.EncryptedData{}, err
 	}
-	return domain.BankData{Ctx: dataCtx, Card: card}, nil
+	return domain.EncryptedData{Ctx: dataCtx, Data: data}, nil
 }
 
 func (ks *KeeperService) Delete(ctx context.Context, dataCtx domain.DataContext) error {
 	return ks.repo.Delete(ctx, dataCtx)
 }
 
-func SetDataImpl[TData any](ctx context.Context, repo port.KeeperRepository, dataCtx domain.DataContext, data TData) error {
+func SetDataImpl[TData any](ctx context.Context, ks *KeeperService, dataCtx domain.DataContext, data TData) error {
 	var dataBuf bytes.Buffer
 	encoder := gob.NewEncoder(&dataBuf)
 	err := encoder.Encode(&data)
@@ -183,13 +282,13 @@ func SetDataImpl[TData any](ctx context.Context, repo port.KeeperRepository, dat
 		log.Err(err).Msg("failed to encode data")
 		return err
 	}
-	encrypted, err := encrypt(dataBuf.Bytes())
+	encrypted, err := ks.encrypt(ctx, dataCtx, dataBuf.Bytes())
 	if err != nil {
 		log.Err(err).Msg("failed to encrypt data")
 		return err
 	}
 
-	err = repo.Set(ctx, dataCtx, encrypted)
+	err = ks.repo.Set(ctx, dataCtx, encrypted)
 	if err != nil {
 		log.Err(err).Msg("failed to set data in repository")
 		return err
@@ -197,41 +296,73 @@ func SetDataImpl[TData any](ctx context.Context, repo port.KeeperRepository, dat
 	return nil
 }
 
-func encrypt(src []byte) ([]byte, error) {
-	key := sha256.Sum256([]byte(password))
-	aesblock, err := aes.NewCipher(key[:])
+// getData reads item meta and decrypted data, items encrypted by the client
+// are only returned when encrypted is set and vice versa. Items of another
+// type than dataType are reported as missing, so the route of one type can
+// not read the others, empty dataType allows any type. The ciphertext is
+// opened against the requested owner and id, so items moved between users or
+// ids in the repository fail to decrypt.
+func (ks *KeeperService) getData(ctx context.Context, dataCtx domain.DataContext, dataType domain.DataType, encrypted bool) (domain.DataContext, []byte, error) {
+	meta, err := ks.repo.GetMeta(ctx, dataCtx.UserID, dataCtx.ID)
 	if err != nil {
-		return nil, err
+		log.Err(err).Msg("failed to get meta from repository")
+		return domain.DataContext{}, nil, err
+	}
+	if len(dataType) != 0 && meta.Type != dataType {
+		return domain.DataContext{}, nil, domain.ErrNotFound
+	}
+	if meta.Encrypted != encrypted {
+		return domain.DataContext{}, nil, domain.ErrEncryptionMode
 	}
 
-	aesgcm, err := cipher.NewGCM(aesblock)
+	data, err := ks.repo.GetData(ctx, meta)
 	if err != nil {
-		return nil, err
+		log.Err(err).Msg("failed to get data from repository")
+		return domain.DataContext{}, nil, err
 	}
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
-
-	dst := aesgcm.Seal(nil, nonce, src, nil)
-	return dst, err
+	decrypted, err := ks.decrypt(ctx, domain.DataContext{UserID: dataCtx.UserID, ID: dataCtx.ID, Type: meta.Type}, data)
+	if err != nil {
+		log.Err(err).Msg("failed to decrypt data")
+		return domain.DataContext{}, nil, err
+	}
+	return meta, decrypted, nil
 }
 
-func decrypt(src []byte) ([]byte, error) {
-	key := sha256.Sum256([]byte(password))
-	aesblock, err := aes.NewCipher(key[:])
+func (ks *KeeperService) encrypt(ctx context.Context, dataCtx domain.DataContext, src []byte) ([]byte, error) {
+	ring, err := ks.ring(ctx, dataCtx.UserID, true)
 	if err != nil {
 		return nil, err
 	}
+	return ring.Seal(src, associatedData(dataCtx))
+}
 
-	aesgcm, err := cipher.NewGCM(aesblock)
+func (ks *KeeperService) decrypt(ctx context.Context, dataCtx domain.DataContext, src []byte) ([]byte, error) {
+	ring, err := ks.ring(ctx, dataCtx.UserID, false)
 	if err != nil {
 		return nil, err
 	}
+	data, err := ring.Open(src, associatedData(dataCtx))
+	return data, decryptError(err)
+}
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
+func decryptError(err error) error {
+	if errors.Is(err, util.ErrDecrypt) {
+		return domain.ErrDecryptionFailed
+	}
+	if errors.Is(err, util.ErrUnboundEnvelope) {
+		log.Warn().Msg("item is sealed in a format without associated data, run rotate-keys")
+		return domain.ErrDecryptionFailed
+	}
+	return err
+}
 
-	dst, err := aesgcm.Open(nil, nonce, src, nil)
-	if err != nil {
-		return nil, err
+// associatedData binds ciphertext to the item owner, id and type.
+func associatedData(dataCtx domain.DataContext) []byte {
+	var aad []byte
+	for _, field := range []string{string(dataCtx.UserID), string(dataCtx.ID), string(dataCtx.Type)} {
+		aad = binary.BigEndian.AppendUint32(aad, uint32(len(field)))
+		aad = append(aad, field...)
 	}
-	return dst, err
+	return aad
 }
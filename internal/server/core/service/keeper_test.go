@@ -1,20 +1,27 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"io"
 	"testing"
 
 	"github.com/golang/mock/gomock"
 	"github.com/magiconair/properties/assert"
 	"github.com/rutkin/gophkeeper/internal/server/core/domain"
 	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
 	"github.com/stretchr/testify/require"
 )
 
 func TestKeeperService_SetTextData(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
-	ks := NewKeeperService(mockRepo)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
 	var storedDataCtx domain.DataContext
 	var storedData []byte
 	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
@@ -39,7 +46,7 @@ func TestKeeperService_SetTextData(t *testing.T) {
 	ctx := context.Background()
 
 	textData := "text"
-	err := ks.SetTextData(ctx, domain.TextData{Data: textData})
+	err = ks.SetTextData(ctx, domain.TextData{Ctx: domain.DataContext{Type: domain.TextType}, Data: textData})
 	require.NoError(t, err)
 	data, err := ks.GetTextData(ctx, domain.DataContext{})
 	require.NoError(t, err)
@@ -49,7 +56,11 @@ func TestKeeperService_SetTextData(t *testing.T) {
 func TestKeeperService_SetCredentialsData(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
-	ks := NewKeeperService(mockRepo)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
 	var storedDataCtx domain.DataContext
 	var storedData []byte
 	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
@@ -73,12 +84,13 @@ func TestKeeperService_SetCredentialsData(t *testing.T) {
 
 	ctx := context.Background()
 	expectedData := domain.CredentialsData{
+		Ctx: domain.DataContext{Type: domain.CredentialsType},
 		Cred: domain.Credentials{
 			Username: "user",
 			Password: "password",
 		},
 	}
-	err := ks.SetCredentialsData(ctx, expectedData)
+	err = ks.SetCredentialsData(ctx, expectedData)
 	require.NoError(t, err)
 	data, err := ks.GetCredentialsData(ctx, domain.DataContext{})
 	require.NoError(t, err)
@@ -88,7 +100,11 @@ func TestKeeperService_SetCredentialsData(t *testing.T) {
 func TestKeeperService_SetBankData(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
-	ks := NewKeeperService(mockRepo)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
 	var storedDataCtx domain.DataContext
 	var storedData []byte
 	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
@@ -112,13 +128,14 @@ func TestKeeperService_SetBankData(t *testing.T) {
 
 	ctx := context.Background()
 	expectedData := domain.BankData{
+		Ctx: domain.DataContext{Type: domain.BankType},
 		Card: domain.Card{
 			CardNumber: "number",
 			CardHolder: "holder",
 			Cvv:        111,
 		},
 	}
-	err := ks.SetBankData(ctx, expectedData)
+	err = ks.SetBankData(ctx, expectedData)
 	require.NoError(t, err)
 	data, err := ks.GetBankData(ctx, domain.DataContext{})
 	require.NoError(t, err)
@@ -128,7 +145,11 @@ func TestKeeperService_SetBankData(t *testing.T) {
 func TestKeeperService_SetBinaryData(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
-	ks := NewKeeperService(mockRepo)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
 	var storedDataCtx domain.DataContext
 	var storedData []byte
 	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
@@ -152,11 +173,111 @@ func TestKeeperService_SetBinaryData(t *testing.T) {
 
 	ctx := context.Background()
 	expectedData := domain.BinaryData{
+		Ctx:  domain.DataContext{Type: domain.BinaryType},
 		Data: []byte("data"),
 	}
-	err := ks.SetBinaryData(ctx, expectedData)
+	err = ks.SetBinaryData(ctx, expectedData)
 	require.NoError(t, err)
 	data, err := ks.GetBinaryData(ctx, domain.DataContext{})
 	require.NoError(t, err)
 	assert.Equal(t, data, expectedData)
 }
+
+func TestKeeperService_MovedItem(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	storedDataCtx := domain.DataContext{ID: "id", UserID: "owner", Type: domain.TextType}
+	var storedData []byte
+	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
+			storedData = data
+			return nil
+		},
+	)
+	mockRepo.EXPECT().GetData(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+			return storedData, nil
+		},
+	).Times(3)
+	mockRepo.EXPECT().GetMeta(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
+			return domain.DataContext{ID: id, UserID: userID, Type: domain.TextType}, nil
+		},
+	).Times(3)
+
+	ctx := context.Background()
+	err = ks.SetTextData(ctx, domain.TextData{Ctx: storedDataCtx, Data: "text"})
+	require.NoError(t, err)
+
+	data, err := ks.GetTextData(ctx, storedDataCtx)
+	require.NoError(t, err)
+	require.Equal(t, "text", data)
+
+	_, err = ks.GetTextData(ctx, domain.DataContext{ID: "id", UserID: "other"})
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+	_, err = ks.GetTextData(ctx, domain.DataContext{ID: "other", UserID: "owner"})
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+}
+
+func TestKeeperService_BinaryStream(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	storedDataCtx := domain.DataContext{ID: "id", UserID: "owner", Title: "file.bin"}
+	var storedData []byte
+	mockRepo.EXPECT().SetStream(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, src io.Reader) error {
+			require.Equal(t, domain.BinaryType, dataCtx.Type)
+			storedDataCtx = dataCtx
+			storedData, err = io.ReadAll(src)
+			return err
+		},
+	)
+	mockRepo.EXPECT().GetStream(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(storedData)), nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().GetMeta(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
+			return storedDataCtx, nil
+		},
+	).AnyTimes()
+
+	ctx := context.Background()
+	content := bytes.Repeat([]byte("content"), util.StreamChunkSize/3)
+	require.NoError(t, ks.SetBinaryStream(ctx, storedDataCtx, bytes.NewReader(content)))
+	require.NotContains(t, string(storedData), "content")
+
+	meta, reader, err := ks.GetBinaryStream(ctx, domain.DataContext{ID: "id", UserID: "owner"})
+	require.NoError(t, err)
+	require.Equal(t, storedDataCtx, meta)
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	require.NoError(t, reader.Close())
+	require.Equal(t, content, data)
+
+	// files read whole see the same content
+	mockRepo.EXPECT().GetData(gomock.Any(), gomock.Any()).Return(storedData, nil)
+	binary, err := ks.GetBinaryData(ctx, domain.DataContext{ID: "id", UserID: "owner"})
+	require.NoError(t, err)
+	require.Equal(t, content, binary.Data)
+
+	_, _, err = ks.GetBinaryStream(ctx, domain.DataContext{ID: "id", UserID: "other"})
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+
+	storedData[len(storedData)-1] ^= 1
+	_, reader, err = ks.GetBinaryStream(ctx, domain.DataContext{ID: "id", UserID: "owner"})
+	require.NoError(t, err)
+	_, err = io.ReadAll(reader)
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+}
@@ -0,0 +1,38 @@
+package service
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+// newKeyRing derives key encryption keys for purpose from the current and
+// previous master keys.
+func newKeyRing(keys port.KeyProvider, purpose string) (*util.KeyRing, error) {
+	masterKey, err := keys.MasterKey()
+	if err != nil {
+		log.Err(err).Msg("failed to get master key")
+		return nil, err
+	}
+	kek, err := util.DeriveKey(masterKey, purpose)
+	if err != nil {
+		log.Err(err).Msg("failed to derive key")
+		return nil, err
+	}
+
+	previousKeys, err := keys.PreviousKeys()
+	if err != nil {
+		log.Err(err).Msg("failed to get previous master keys")
+		return nil, err
+	}
+	previous := make([]util.Key, 0, len(previousKeys))
+	for _, previousKey := range previousKeys {
+		previousKek, err := util.DeriveKey(previousKey, purpose)
+		if err != nil {
+			log.Err(err).Msg("failed to derive previous key")
+			return nil, err
+		}
+		previous = append(previous, util.NewKey(previousKek))
+	}
+	return util.NewKeyRing(util.NewKey(kek), previous...), nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+)
+
+// LockoutPolicy slows down password guessing. Every failure blocks the next
+// attempt for a delay doubling from BaseDelay up to MaxDelay, reaching the
+// failure limit blocks login for Lockout. Counters start over after Lockout
+// without failures.
+type LockoutPolicy struct {
+	MaxUserFailures int
+	MaxIPFailures   int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	Lockout         time.Duration
+}
+
+type loginGuard struct {
+	attempts port.LoginAttemptRepository
+	policy   LockoutPolicy
+}
+
+// WithLockout enables brute-force protection of Login.
+func (a *AuthService) WithLockout(attempts port.LoginAttemptRepository, policy LockoutPolicy) *AuthService {
+	a.guard = &loginGuard{attempts: attempts, policy: policy}
+	return a
+}
+
+func userAttemptKey(name domain.UserName) string {
+	return "user:" + string(name)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+func reauthAttemptKey(name domain.UserName) string {
+	return "reauth:" + string(name)
+}
+
+// attemptKey is a counter of attempts and the failures it is locked after.
+type attemptKey struct {
+	key         string
+	maxFailures int
+}
+
+func (g *loginGuard) userKey(name domain.UserName) attemptKey {
+	return attemptKey{key: userAttemptKey(name), maxFailures: g.policy.MaxUserFailures}
+}
+
+func (g *loginGuard) ipKey(ip string) attemptKey {
+	return attemptKey{key: ipAttemptKey(ip), maxFailures: g.policy.MaxIPFailures}
+}
+
+// reauthKey counts passwords signed in users confirm changes with, it is
+// apart from the login counter so a stolen session can not lock the owner
+// out of login.
+func (g *loginGuard) reauthKey(name domain.UserName) attemptKey {
+	return attemptKey{key: reauthAttemptKey(name), maxFailures: g.policy.MaxUserFailures}
+}
+
+// loginKeys returns counters of username and, when known, client address.
+func (g *loginGuard) loginKeys(name domain.UserName, ip string) []attemptKey {
+	keys := []attemptKey{g.userKey(name)}
+	if len(ip) > 0 {
+		keys = append(keys, g.ipKey(ip))
+	}
+	return keys
+}
+
+// attempt counts attempt of every key as failed before the secret is
+// checked, so guesses sent in parallel are counted as well. It returns
+// domain.RetryError while any key is blocked, then no key is counted.
+func (g *loginGuard) attempt(ctx context.Context, keys []attemptKey, now time.Time) error {
+	var counted []attemptKey
+	var retryAfter time.Duration
+	for _, key := range keys {
+		attempts, allowed, err := g.attempts.RegisterAttempt(ctx, key.key, now, g.policy.Lockout, g.policy.block(key.maxFailures))
+		if err != nil {
+			g.forgive(ctx, counted, now)
+			return err
+		}
+		if !allowed {
+			if wait := attempts.BlockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+			continue
+		}
+		counted = append(counted, key)
+		if key.maxFailures > 0 && attempts.Failures == key.maxFailures {
+			log.Warn().Msgf("login of '%s' is locked after %d attempts", key.key, attempts.Failures)
+		}
+	}
+	if retryAfter > 0 {
+		g.forgive(ctx, counted, now)
+		return &domain.RetryError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// forgive takes back attempts of keys which turned out to be valid or were
+// never made.
+func (g *loginGuard) forgive(ctx context.Context, keys []attemptKey, now time.Time) {
+	for _, key := range keys {
+		err := g.attempts.ForgiveAttempt(ctx, key.key, now, g.policy.block(key.maxFailures))
+		if err != nil {
+			log.Err(err).Msgf("failed to forgive attempt of '%s'", key.key)
+		}
+	}
+}
+
+// block returns how long a key locked after maxFailures is blocked after
+// failures.
+func (p LockoutPolicy) block(maxFailures int) func(failures int) time.Duration {
+	return func(failures int) time.Duration {
+		if maxFailures > 0 && failures >= maxFailures {
+			return p.Lockout
+		}
+		return p.delay(failures)
+	}
+}
+
+// delay returns backoff after failures, the first failure is free.
+func (p LockoutPolicy) delay(failures int) time.Duration {
+	if failures <= 1 || p.BaseDelay <= 0 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 2; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// succeed resets counter of key once the whole login passed.
+func (g *loginGuard) succeed(ctx context.Context, key attemptKey) error {
+	return g.attempts.Reset(ctx, key.key)
+}
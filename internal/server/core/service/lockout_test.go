@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockoutPolicy_Delay(t *testing.T) {
+	policy := LockoutPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	delays := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for failures, delay := range delays {
+		require.Equal(t, delay, policy.delay(failures), "failures %d", failures)
+	}
+}
+
+func TestAuthService_Lockout(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	password, err := util.HashPassword("password")
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), gomock.Any()).Return(user, nil).AnyTimes()
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(gomock.Any()).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	state, mockAttempts := newMockAttempts(ctrl)
+
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour).WithLockout(mockAttempts, LockoutPolicy{
+		MaxUserFailures: 3,
+		MaxIPFailures:   10,
+		BaseDelay:       time.Minute,
+		MaxDelay:        time.Minute,
+		Lockout:         time.Hour,
+	})
+	ctx := context.Background()
+
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "wrong"}, "10.0.0.1")
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "10.0.0.1")
+	require.NoError(t, err)
+	require.Empty(t, state["user:name"])
+	require.Equal(t, 1, state["ip:10.0.0.1"].Failures)
+
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "wrong"}, "10.0.0.1")
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "wrong"}, "10.0.0.2")
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+
+	// backoff after the second failure blocks even the right password
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "10.0.0.3")
+	var retryErr *domain.RetryError
+	require.True(t, errors.As(err, &retryErr))
+	require.True(t, errors.Is(err, domain.ErrTooManyAttempts))
+	require.InDelta(t, time.Minute.Seconds(), retryErr.RetryAfter.Seconds(), 1)
+
+	attempts := state["user:name"]
+	attempts.BlockedUntil = time.Time{}
+	state["user:name"] = attempts
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "wrong"}, "10.0.0.3")
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "10.0.0.4")
+	require.True(t, errors.As(err, &retryErr))
+	require.InDelta(t, time.Hour.Seconds(), retryErr.RetryAfter.Seconds(), 1)
+}
+
+// newMockAttempts returns attempt repository counting in state.
+func newMockAttempts(ctrl *gomock.Controller) (map[string]domain.LoginAttempts, *mock_port.MockLoginAttemptRepository) {
+	state := map[string]domain.LoginAttempts{}
+	mockAttempts := mock_port.NewMockLoginAttemptRepository(ctrl)
+	mockAttempts.EXPECT().RegisterAttempt(gomock.Any(), gomock.Any(), gomock.Any(), time.Hour, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key string, now time.Time, window time.Duration, block func(int) time.Duration) (domain.LoginAttempts, bool, error) {
+			attempts := state[key]
+			if attempts.BlockedUntil.After(now) {
+				return attempts, false, nil
+			}
+			attempts.Failures++
+			attempts.BlockedUntil = now.Add(block(attempts.Failures))
+			state[key] = attempts
+			return attempts, true, nil
+		},
+	).AnyTimes()
+	mockAttempts.EXPECT().ForgiveAttempt(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key string, now time.Time, block func(int) time.Duration) error {
+			attempts := state[key]
+			attempts.Failures--
+			attempts.BlockedUntil = now.Add(block(attempts.Failures))
+			state[key] = attempts
+			return nil
+		},
+	).AnyTimes()
+	mockAttempts.EXPECT().Reset(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, key string) error {
+			delete(state, key)
+			return nil
+		},
+	).AnyTimes()
+	return state, mockAttempts
+}
+
+// The password step of a user with second factor does not reset failures,
+// wrong codes are counted like wrong passwords.
+func TestAuthService_LockoutTwoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	password, err := util.HashPassword("password")
+	require.NoError(t, err)
+	secret, err := util.NewTOTPSecret()
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password, TwoFactor: domain.TwoFactor{Secret: secret, Enabled: true}}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), gomock.Any()).Return(user, nil).AnyTimes()
+	challenges := map[string]domain.LoginChallenge{}
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateChallenge(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, challenge domain.LoginChallenge) error {
+			challenges[string(challenge.Hash)] = challenge
+			return nil
+		},
+	).AnyTimes()
+	mockSessions.EXPECT().TakeChallenge(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, hash []byte) (domain.LoginChallenge, error) {
+			challenge, ok := challenges[string(hash)]
+			if !ok {
+				return domain.LoginChallenge{}, domain.ErrNotFound
+			}
+			delete(challenges, string(hash))
+			return challenge, nil
+		},
+	).AnyTimes()
+	state, mockAttempts := newMockAttempts(ctrl)
+
+	as := NewAuthService(mockRepo, mock_port.NewMockTokenService(ctrl), mockSessions, time.Hour).WithLockout(mockAttempts, LockoutPolicy{
+		MaxUserFailures: 3,
+		MaxIPFailures:   10,
+		BaseDelay:       time.Minute,
+		MaxDelay:        time.Minute,
+		Lockout:         time.Hour,
+	})
+	ctx := context.Background()
+
+	tokens, err := as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "10.0.0.1")
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.Challenge)
+	require.Equal(t, 1, state["user:name"].Failures)
+	require.Zero(t, state["ip:10.0.0.1"].Failures)
+
+	_, err = as.LoginTwoFactor(ctx, tokens.Challenge, "000000")
+	require.Equal(t, domain.ErrInvalidCode, err)
+	require.Equal(t, 2, state["user:name"].Failures)
+
+	// the next code waits for the backoff, the challenge is kept
+	_, err = as.LoginTwoFactor(ctx, tokens.Challenge, "000000")
+	require.True(t, errors.Is(err, domain.ErrTooManyAttempts))
+	require.Equal(t, 2, state["user:name"].Failures)
+	require.Len(t, challenges, 1)
+}
+
+// Wrong current passwords of signed in users are counted apart from login.
+func TestAuthService_LockoutReauth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	password, err := util.HashPassword("password")
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), gomock.Any()).Return(user, nil).AnyTimes()
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(gomock.Any()).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	state, mockAttempts := newMockAttempts(ctrl)
+
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour).WithLockout(mockAttempts, LockoutPolicy{
+		MaxUserFailures: 2,
+		MaxIPFailures:   10,
+		Lockout:         time.Hour,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err = as.ChangePassword(ctx, user.Name, domain.PasswordChange{OldPassword: "wrong", NewPassword: "new password"})
+		require.Equal(t, domain.ErrInvalidCredentials, err)
+	}
+	_, err = as.ChangePassword(ctx, user.Name, domain.PasswordChange{OldPassword: "password", NewPassword: "new password"})
+	require.True(t, errors.Is(err, domain.ErrTooManyAttempts))
+	as.WithKeeperRepository(mock_port.NewMockKeeperRepository(ctrl))
+	require.True(t, errors.Is(as.DeleteAccount(ctx, user.Name, "password"), domain.ErrTooManyAttempts))
+	require.Empty(t, state["user:name"])
+
+	// the owner still logs in
+	_, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "10.0.0.1")
+	require.NoError(t, err)
+}
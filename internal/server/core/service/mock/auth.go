@@ -7,6 +7,7 @@ package mock_port
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
@@ -36,12 +37,13 @@ func (m *MockTokenService) EXPECT() *MockTokenServiceMockRecorder {
 }
 
 // CreateToken mocks base method.
-func (m *MockTokenService) CreateToken(user domain.User) (domain.Token, error) {
+func (m *MockTokenService) CreateToken(user domain.User) (domain.Token, time.Time, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "CreateToken", user)
 	ret0, _ := ret[0].(domain.Token)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(time.Time)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // CreateToken indicates an expected call of CreateToken.
@@ -50,6 +52,20 @@ func (mr *MockTokenServiceMockRecorder) CreateToken(user interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateToken", reflect.TypeOf((*MockTokenService)(nil).CreateToken), user)
 }
 
+// PublicKeys mocks base method.
+func (m *MockTokenService) PublicKeys() []domain.PublicKey {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PublicKeys")
+	ret0, _ := ret[0].([]domain.PublicKey)
+	return ret0
+}
+
+// PublicKeys indicates an expected call of PublicKeys.
+func (mr *MockTokenServiceMockRecorder) PublicKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PublicKeys", reflect.TypeOf((*MockTokenService)(nil).PublicKeys))
+}
+
 // VerifyToken mocks base method.
 func (m *MockTokenService) VerifyToken(token string) (domain.TokenPayload, error) {
 	m.ctrl.T.Helper()
@@ -88,19 +104,198 @@ func (m *MockAuthService) EXPECT() *MockAuthServiceMockRecorder {
 	return m.recorder
 }
 
-// Login mocks base method.
-func (m *MockAuthService) Login(ctx context.Context, user domain.User) (domain.Token, error) {
+// ChangePassword mocks base method.
+func (m *MockAuthService) ChangePassword(ctx context.Context, name domain.UserName, change domain.PasswordChange) (domain.Tokens, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Login", ctx, user)
+	ret := m.ctrl.Call(m, "ChangePassword", ctx, name, change)
+	ret0, _ := ret[0].(domain.Tokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ChangePassword indicates an expected call of ChangePassword.
+func (mr *MockAuthServiceMockRecorder) ChangePassword(ctx, name, change interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangePassword", reflect.TypeOf((*MockAuthService)(nil).ChangePassword), ctx, name, change)
+}
+
+// ConfirmTwoFactor mocks base method.
+func (m *MockAuthService) ConfirmTwoFactor(ctx context.Context, name domain.UserName, code string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConfirmTwoFactor", ctx, name, code)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConfirmTwoFactor indicates an expected call of ConfirmTwoFactor.
+func (mr *MockAuthServiceMockRecorder) ConfirmTwoFactor(ctx, name, code interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConfirmTwoFactor", reflect.TypeOf((*MockAuthService)(nil).ConfirmTwoFactor), ctx, name, code)
+}
+
+// CreatePersonalToken mocks base method.
+func (m *MockAuthService) CreatePersonalToken(ctx context.Context, payload domain.TokenPayload, req domain.PersonalTokenRequest) (domain.Token, domain.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalToken", ctx, payload, req)
 	ret0, _ := ret[0].(domain.Token)
+	ret1, _ := ret[1].(domain.PersonalToken)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// CreatePersonalToken indicates an expected call of CreatePersonalToken.
+func (mr *MockAuthServiceMockRecorder) CreatePersonalToken(ctx, payload, req interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalToken", reflect.TypeOf((*MockAuthService)(nil).CreatePersonalToken), ctx, payload, req)
+}
+
+// DeleteAccount mocks base method.
+func (m *MockAuthService) DeleteAccount(ctx context.Context, name domain.UserName, password string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAccount", ctx, name, password)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAccount indicates an expected call of DeleteAccount.
+func (mr *MockAuthServiceMockRecorder) DeleteAccount(ctx, name, password interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccount", reflect.TypeOf((*MockAuthService)(nil).DeleteAccount), ctx, name, password)
+}
+
+// EnrollTwoFactor mocks base method.
+func (m *MockAuthService) EnrollTwoFactor(ctx context.Context, name domain.UserName) (domain.TOTPEnrollment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnrollTwoFactor", ctx, name)
+	ret0, _ := ret[0].(domain.TOTPEnrollment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// EnrollTwoFactor indicates an expected call of EnrollTwoFactor.
+func (mr *MockAuthServiceMockRecorder) EnrollTwoFactor(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnrollTwoFactor", reflect.TypeOf((*MockAuthService)(nil).EnrollTwoFactor), ctx, name)
+}
+
+// GetVaultKey mocks base method.
+func (m *MockAuthService) GetVaultKey(ctx context.Context, name domain.UserName) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetVaultKey", ctx, name)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVaultKey indicates an expected call of GetVaultKey.
+func (mr *MockAuthServiceMockRecorder) GetVaultKey(ctx, name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVaultKey", reflect.TypeOf((*MockAuthService)(nil).GetVaultKey), ctx, name)
+}
+
+// IsEncrypted mocks base method.
+func (m *MockAuthService) IsEncrypted(ctx context.Context, payload domain.TokenPayload) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsEncrypted", ctx, payload)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsEncrypted indicates an expected call of IsEncrypted.
+func (mr *MockAuthServiceMockRecorder) IsEncrypted(ctx, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsEncrypted", reflect.TypeOf((*MockAuthService)(nil).IsEncrypted), ctx, payload)
+}
+
+// IsTokenRevoked mocks base method.
+func (m *MockAuthService) IsTokenRevoked(ctx context.Context, payload domain.TokenPayload) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsTokenRevoked", ctx, payload)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsTokenRevoked indicates an expected call of IsTokenRevoked.
+func (mr *MockAuthServiceMockRecorder) IsTokenRevoked(ctx, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsTokenRevoked", reflect.TypeOf((*MockAuthService)(nil).IsTokenRevoked), ctx, payload)
+}
+
+// ListPersonalTokens mocks base method.
+func (m *MockAuthService) ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPersonalTokens", ctx, userID)
+	ret0, _ := ret[0].([]domain.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPersonalTokens indicates an expected call of ListPersonalTokens.
+func (mr *MockAuthServiceMockRecorder) ListPersonalTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPersonalTokens", reflect.TypeOf((*MockAuthService)(nil).ListPersonalTokens), ctx, userID)
+}
+
+// Login mocks base method.
+func (m *MockAuthService) Login(ctx context.Context, user domain.User, clientIP string) (domain.Tokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Login", ctx, user, clientIP)
+	ret0, _ := ret[0].(domain.Tokens)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Login indicates an expected call of Login.
-func (mr *MockAuthServiceMockRecorder) Login(ctx, user interface{}) *gomock.Call {
+func (mr *MockAuthServiceMockRecorder) Login(ctx, user, clientIP interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockAuthService)(nil).Login), ctx, user, clientIP)
+}
+
+// LoginTwoFactor mocks base method.
+func (m *MockAuthService) LoginTwoFactor(ctx context.Context, challenge domain.Token, code string) (domain.Tokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LoginTwoFactor", ctx, challenge, code)
+	ret0, _ := ret[0].(domain.Tokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LoginTwoFactor indicates an expected call of LoginTwoFactor.
+func (mr *MockAuthServiceMockRecorder) LoginTwoFactor(ctx, challenge, code interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockAuthService)(nil).Login), ctx, user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LoginTwoFactor", reflect.TypeOf((*MockAuthService)(nil).LoginTwoFactor), ctx, challenge, code)
+}
+
+// Logout mocks base method.
+func (m *MockAuthService) Logout(ctx context.Context, payload domain.TokenPayload, refreshToken domain.Token) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Logout", ctx, payload, refreshToken)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Logout indicates an expected call of Logout.
+func (mr *MockAuthServiceMockRecorder) Logout(ctx, payload, refreshToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockAuthService)(nil).Logout), ctx, payload, refreshToken)
+}
+
+// Refresh mocks base method.
+func (m *MockAuthService) Refresh(ctx context.Context, refreshToken domain.Token) (domain.Tokens, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Refresh", ctx, refreshToken)
+	ret0, _ := ret[0].(domain.Tokens)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Refresh indicates an expected call of Refresh.
+func (mr *MockAuthServiceMockRecorder) Refresh(ctx, refreshToken interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Refresh", reflect.TypeOf((*MockAuthService)(nil).Refresh), ctx, refreshToken)
 }
 
 // Register mocks base method.
@@ -117,6 +312,35 @@ func (mr *MockAuthServiceMockRecorder) Register(ctx, user interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Register", reflect.TypeOf((*MockAuthService)(nil).Register), ctx, user)
 }
 
+// RevokePersonalToken mocks base method.
+func (m *MockAuthService) RevokePersonalToken(ctx context.Context, payload domain.TokenPayload, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokePersonalToken", ctx, payload, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokePersonalToken indicates an expected call of RevokePersonalToken.
+func (mr *MockAuthServiceMockRecorder) RevokePersonalToken(ctx, payload, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokePersonalToken", reflect.TypeOf((*MockAuthService)(nil).RevokePersonalToken), ctx, payload, id)
+}
+
+// VerifyPersonalToken mocks base method.
+func (m *MockAuthService) VerifyPersonalToken(ctx context.Context, token domain.Token) (domain.TokenPayload, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VerifyPersonalToken", ctx, token)
+	ret0, _ := ret[0].(domain.TokenPayload)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VerifyPersonalToken indicates an expected call of VerifyPersonalToken.
+func (mr *MockAuthServiceMockRecorder) VerifyPersonalToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VerifyPersonalToken", reflect.TypeOf((*MockAuthService)(nil).VerifyPersonalToken), ctx, token)
+}
+
 // MockUserRepository is a mock of UserRepository interface.
 type MockUserRepository struct {
 	ctrl     *gomock.Controller
@@ -166,6 +390,20 @@ func (mr *MockUserRepositoryMockRecorder) CreateUser(ctx, user interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepository)(nil).CreateUser), ctx, user)
 }
 
+// DeleteUser mocks base method.
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id domain.UserID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserRepositoryMockRecorder) DeleteUser(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserRepository)(nil).DeleteUser), ctx, id)
+}
+
 // GetUserByName mocks base method.
 func (m *MockUserRepository) GetUserByName(ctx context.Context, name domain.UserName) (domain.User, error) {
 	m.ctrl.T.Helper()
@@ -180,3 +418,88 @@ func (mr *MockUserRepositoryMockRecorder) GetUserByName(ctx, name interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByName", reflect.TypeOf((*MockUserRepository)(nil).GetUserByName), ctx, name)
 }
+
+// GetUsers mocks base method.
+func (m *MockUserRepository) GetUsers(ctx context.Context) ([]domain.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsers", ctx)
+	ret0, _ := ret[0].([]domain.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsers indicates an expected call of GetUsers.
+func (mr *MockUserRepositoryMockRecorder) GetUsers(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockUserRepository)(nil).GetUsers), ctx)
+}
+
+// ReplaceTwoFactorSecret mocks base method.
+func (m *MockUserRepository) ReplaceTwoFactorSecret(ctx context.Context, id domain.UserID, old, secret []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceTwoFactorSecret", ctx, id, old, secret)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceTwoFactorSecret indicates an expected call of ReplaceTwoFactorSecret.
+func (mr *MockUserRepositoryMockRecorder) ReplaceTwoFactorSecret(ctx, id, old, secret interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceTwoFactorSecret", reflect.TypeOf((*MockUserRepository)(nil).ReplaceTwoFactorSecret), ctx, id, old, secret)
+}
+
+// UpdatePassword mocks base method.
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePassword", ctx, id, password, vaultKey)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdatePassword indicates an expected call of UpdatePassword.
+func (mr *MockUserRepositoryMockRecorder) UpdatePassword(ctx, id, password, vaultKey interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePassword", reflect.TypeOf((*MockUserRepository)(nil).UpdatePassword), ctx, id, password, vaultKey)
+}
+
+// UpdateTwoFactor mocks base method.
+func (m *MockUserRepository) UpdateTwoFactor(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateTwoFactor", ctx, id, twoFactor)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateTwoFactor indicates an expected call of UpdateTwoFactor.
+func (mr *MockUserRepositoryMockRecorder) UpdateTwoFactor(ctx, id, twoFactor interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateTwoFactor", reflect.TypeOf((*MockUserRepository)(nil).UpdateTwoFactor), ctx, id, twoFactor)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockUserRepository) UseRecoveryCode(ctx context.Context, id domain.UserID, hash []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", ctx, id, hash)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockUserRepositoryMockRecorder) UseRecoveryCode(ctx, id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockUserRepository)(nil).UseRecoveryCode), ctx, id, hash)
+}
+
+// UseTwoFactorStep mocks base method.
+func (m *MockUserRepository) UseTwoFactorStep(ctx context.Context, id domain.UserID, step int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTwoFactorStep", ctx, id, step)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseTwoFactorStep indicates an expected call of UseTwoFactorStep.
+func (mr *MockUserRepositoryMockRecorder) UseTwoFactorStep(ctx, id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTwoFactorStep", reflect.TypeOf((*MockUserRepository)(nil).UseTwoFactorStep), ctx, id, step)
+}
@@ -0,0 +1,152 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../port/chunk.go
+
+// Package mock_port is a generated GoMock package.
+package mock_port
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// MockChunkRepository is a mock of ChunkRepository interface.
+type MockChunkRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockChunkRepositoryMockRecorder
+}
+
+// MockChunkRepositoryMockRecorder is the mock recorder for MockChunkRepository.
+type MockChunkRepositoryMockRecorder struct {
+	mock *MockChunkRepository
+}
+
+// NewMockChunkRepository creates a new mock instance.
+func NewMockChunkRepository(ctrl *gomock.Controller) *MockChunkRepository {
+	mock := &MockChunkRepository{ctrl: ctrl}
+	mock.recorder = &MockChunkRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChunkRepository) EXPECT() *MockChunkRepositoryMockRecorder {
+	return m.recorder
+}
+
+// GetChunk mocks base method.
+func (m *MockChunkRepository) GetChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChunk", ctx, userID, id)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChunk indicates an expected call of GetChunk.
+func (mr *MockChunkRepositoryMockRecorder) GetChunk(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChunk", reflect.TypeOf((*MockChunkRepository)(nil).GetChunk), ctx, userID, id)
+}
+
+// GetChunks mocks base method.
+func (m *MockChunkRepository) GetChunks(ctx context.Context, dataCtx domain.DataContext) ([]domain.ChunkID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChunks", ctx, dataCtx)
+	ret0, _ := ret[0].([]domain.ChunkID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChunks indicates an expected call of GetChunks.
+func (mr *MockChunkRepositoryMockRecorder) GetChunks(ctx, dataCtx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChunks", reflect.TypeOf((*MockChunkRepository)(nil).GetChunks), ctx, dataCtx)
+}
+
+// ListChunks mocks base method.
+func (m *MockChunkRepository) ListChunks(ctx context.Context, userID domain.UserID) ([]domain.ChunkID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChunks", ctx, userID)
+	ret0, _ := ret[0].([]domain.ChunkID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChunks indicates an expected call of ListChunks.
+func (mr *MockChunkRepositoryMockRecorder) ListChunks(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChunks", reflect.TypeOf((*MockChunkRepository)(nil).ListChunks), ctx, userID)
+}
+
+// PutChunk mocks base method.
+func (m *MockChunkRepository) PutChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PutChunk", ctx, userID, id, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// PutChunk indicates an expected call of PutChunk.
+func (mr *MockChunkRepositoryMockRecorder) PutChunk(ctx, userID, id, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PutChunk", reflect.TypeOf((*MockChunkRepository)(nil).PutChunk), ctx, userID, id, data)
+}
+
+// RefChunk mocks base method.
+func (m *MockChunkRepository) RefChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RefChunk", ctx, userID, id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RefChunk indicates an expected call of RefChunk.
+func (mr *MockChunkRepositoryMockRecorder) RefChunk(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefChunk", reflect.TypeOf((*MockChunkRepository)(nil).RefChunk), ctx, userID, id)
+}
+
+// ReleaseChunks mocks base method.
+func (m *MockChunkRepository) ReleaseChunks(ctx context.Context, userID domain.UserID, ids []domain.ChunkID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseChunks", ctx, userID, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseChunks indicates an expected call of ReleaseChunks.
+func (mr *MockChunkRepositoryMockRecorder) ReleaseChunks(ctx, userID, ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseChunks", reflect.TypeOf((*MockChunkRepository)(nil).ReleaseChunks), ctx, userID, ids)
+}
+
+// ReplaceChunk mocks base method.
+func (m *MockChunkRepository) ReplaceChunk(ctx context.Context, userID domain.UserID, id domain.ChunkID, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceChunk", ctx, userID, id, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceChunk indicates an expected call of ReplaceChunk.
+func (mr *MockChunkRepositoryMockRecorder) ReplaceChunk(ctx, userID, id, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceChunk", reflect.TypeOf((*MockChunkRepository)(nil).ReplaceChunk), ctx, userID, id, data)
+}
+
+// SetChunked mocks base method.
+func (m *MockChunkRepository) SetChunked(ctx context.Context, dataCtx domain.DataContext, data []byte, chunks []domain.ChunkID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetChunked", ctx, dataCtx, data, chunks)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetChunked indicates an expected call of SetChunked.
+func (mr *MockChunkRepositoryMockRecorder) SetChunked(ctx, dataCtx, data, chunks interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetChunked", reflect.TypeOf((*MockChunkRepository)(nil).SetChunked), ctx, dataCtx, data, chunks)
+}
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../port/lockout.go
+
+// Package mock_port is a generated GoMock package.
+package mock_port
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// MockLoginAttemptRepository is a mock of LoginAttemptRepository interface.
+type MockLoginAttemptRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptRepositoryMockRecorder
+}
+
+// MockLoginAttemptRepositoryMockRecorder is the mock recorder for MockLoginAttemptRepository.
+type MockLoginAttemptRepositoryMockRecorder struct {
+	mock *MockLoginAttemptRepository
+}
+
+// NewMockLoginAttemptRepository creates a new mock instance.
+func NewMockLoginAttemptRepository(ctrl *gomock.Controller) *MockLoginAttemptRepository {
+	mock := &MockLoginAttemptRepository{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginAttemptRepository) EXPECT() *MockLoginAttemptRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockLoginAttemptRepository) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockLoginAttemptRepositoryMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockLoginAttemptRepository)(nil).Close))
+}
+
+// ForgiveAttempt mocks base method.
+func (m *MockLoginAttemptRepository) ForgiveAttempt(ctx context.Context, key string, now time.Time, block func(int) time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ForgiveAttempt", ctx, key, now, block)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ForgiveAttempt indicates an expected call of ForgiveAttempt.
+func (mr *MockLoginAttemptRepositoryMockRecorder) ForgiveAttempt(ctx, key, now, block interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ForgiveAttempt", reflect.TypeOf((*MockLoginAttemptRepository)(nil).ForgiveAttempt), ctx, key, now, block)
+}
+
+// RegisterAttempt mocks base method.
+func (m *MockLoginAttemptRepository) RegisterAttempt(ctx context.Context, key string, now time.Time, window time.Duration, block func(int) time.Duration) (domain.LoginAttempts, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterAttempt", ctx, key, now, window, block)
+	ret0, _ := ret[0].(domain.LoginAttempts)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// RegisterAttempt indicates an expected call of RegisterAttempt.
+func (mr *MockLoginAttemptRepositoryMockRecorder) RegisterAttempt(ctx, key, now, window, block interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterAttempt", reflect.TypeOf((*MockLoginAttemptRepository)(nil).RegisterAttempt), ctx, key, now, window, block)
+}
+
+// Reset mocks base method.
+func (m *MockLoginAttemptRepository) Reset(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reset", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reset indicates an expected call of Reset.
+func (mr *MockLoginAttemptRepositoryMockRecorder) Reset(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reset", reflect.TypeOf((*MockLoginAttemptRepository)(nil).Reset), ctx, key)
+}
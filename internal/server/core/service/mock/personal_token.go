@@ -0,0 +1,120 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../port/personal_token.go
+
+// Package mock_port is a generated GoMock package.
+package mock_port
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// MockPersonalTokenRepository is a mock of PersonalTokenRepository interface.
+type MockPersonalTokenRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockPersonalTokenRepositoryMockRecorder
+}
+
+// MockPersonalTokenRepositoryMockRecorder is the mock recorder for MockPersonalTokenRepository.
+type MockPersonalTokenRepositoryMockRecorder struct {
+	mock *MockPersonalTokenRepository
+}
+
+// NewMockPersonalTokenRepository creates a new mock instance.
+func NewMockPersonalTokenRepository(ctrl *gomock.Controller) *MockPersonalTokenRepository {
+	mock := &MockPersonalTokenRepository{ctrl: ctrl}
+	mock.recorder = &MockPersonalTokenRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockPersonalTokenRepository) EXPECT() *MockPersonalTokenRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockPersonalTokenRepository) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockPersonalTokenRepositoryMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockPersonalTokenRepository)(nil).Close))
+}
+
+// CreatePersonalToken mocks base method.
+func (m *MockPersonalTokenRepository) CreatePersonalToken(ctx context.Context, token domain.PersonalToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePersonalToken", ctx, token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePersonalToken indicates an expected call of CreatePersonalToken.
+func (mr *MockPersonalTokenRepositoryMockRecorder) CreatePersonalToken(ctx, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePersonalToken", reflect.TypeOf((*MockPersonalTokenRepository)(nil).CreatePersonalToken), ctx, token)
+}
+
+// DeletePersonalToken mocks base method.
+func (m *MockPersonalTokenRepository) DeletePersonalToken(ctx context.Context, userID domain.UserID, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePersonalToken", ctx, userID, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeletePersonalToken indicates an expected call of DeletePersonalToken.
+func (mr *MockPersonalTokenRepositoryMockRecorder) DeletePersonalToken(ctx, userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePersonalToken", reflect.TypeOf((*MockPersonalTokenRepository)(nil).DeletePersonalToken), ctx, userID, id)
+}
+
+// DeleteUserTokens mocks base method.
+func (m *MockPersonalTokenRepository) DeleteUserTokens(ctx context.Context, userID domain.UserID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserTokens", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserTokens indicates an expected call of DeleteUserTokens.
+func (mr *MockPersonalTokenRepositoryMockRecorder) DeleteUserTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserTokens", reflect.TypeOf((*MockPersonalTokenRepository)(nil).DeleteUserTokens), ctx, userID)
+}
+
+// GetPersonalToken mocks base method.
+func (m *MockPersonalTokenRepository) GetPersonalToken(ctx context.Context, hash []byte) (domain.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPersonalToken", ctx, hash)
+	ret0, _ := ret[0].(domain.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPersonalToken indicates an expected call of GetPersonalToken.
+func (mr *MockPersonalTokenRepositoryMockRecorder) GetPersonalToken(ctx, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPersonalToken", reflect.TypeOf((*MockPersonalTokenRepository)(nil).GetPersonalToken), ctx, hash)
+}
+
+// ListPersonalTokens mocks base method.
+func (m *MockPersonalTokenRepository) ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListPersonalTokens", ctx, userID)
+	ret0, _ := ret[0].([]domain.PersonalToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListPersonalTokens indicates an expected call of ListPersonalTokens.
+func (mr *MockPersonalTokenRepositoryMockRecorder) ListPersonalTokens(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListPersonalTokens", reflect.TypeOf((*MockPersonalTokenRepository)(nil).ListPersonalTokens), ctx, userID)
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../port/rotation.go
+
+// Package mock_port is a generated GoMock package.
+package mock_port
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// MockRotationCheckpoint is a mock of RotationCheckpoint interface.
+type MockRotationCheckpoint struct {
+	ctrl     *gomock.Controller
+	recorder *MockRotationCheckpointMockRecorder
+}
+
+// MockRotationCheckpointMockRecorder is the mock recorder for MockRotationCheckpoint.
+type MockRotationCheckpointMockRecorder struct {
+	mock *MockRotationCheckpoint
+}
+
+// NewMockRotationCheckpoint creates a new mock instance.
+func NewMockRotationCheckpoint(ctrl *gomock.Controller) *MockRotationCheckpoint {
+	mock := &MockRotationCheckpoint{ctrl: ctrl}
+	mock.recorder = &MockRotationCheckpointMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRotationCheckpoint) EXPECT() *MockRotationCheckpointMockRecorder {
+	return m.recorder
+}
+
+// IsDone mocks base method.
+func (m *MockRotationCheckpoint) IsDone(ctx context.Context, userID domain.UserID) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsDone", ctx, userID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IsDone indicates an expected call of IsDone.
+func (mr *MockRotationCheckpointMockRecorder) IsDone(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsDone", reflect.TypeOf((*MockRotationCheckpoint)(nil).IsDone), ctx, userID)
+}
+
+// MarkDone mocks base method.
+func (m *MockRotationCheckpoint) MarkDone(ctx context.Context, userID domain.UserID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkDone", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MarkDone indicates an expected call of MarkDone.
+func (mr *MockRotationCheckpointMockRecorder) MarkDone(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkDone", reflect.TypeOf((*MockRotationCheckpoint)(nil).MarkDone), ctx, userID)
+}
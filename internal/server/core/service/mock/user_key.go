@@ -0,0 +1,105 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ../port/user_key.go
+
+// Package mock_port is a generated GoMock package.
+package mock_port
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	domain "github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// MockUserKeyRepository is a mock of UserKeyRepository interface.
+type MockUserKeyRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserKeyRepositoryMockRecorder
+}
+
+// MockUserKeyRepositoryMockRecorder is the mock recorder for MockUserKeyRepository.
+type MockUserKeyRepositoryMockRecorder struct {
+	mock *MockUserKeyRepository
+}
+
+// NewMockUserKeyRepository creates a new mock instance.
+func NewMockUserKeyRepository(ctrl *gomock.Controller) *MockUserKeyRepository {
+	mock := &MockUserKeyRepository{ctrl: ctrl}
+	mock.recorder = &MockUserKeyRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserKeyRepository) EXPECT() *MockUserKeyRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Close mocks base method.
+func (m *MockUserKeyRepository) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockUserKeyRepositoryMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockUserKeyRepository)(nil).Close))
+}
+
+// CreateUserKey mocks base method.
+func (m *MockUserKeyRepository) CreateUserKey(ctx context.Context, userID domain.UserID, key []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUserKey", ctx, userID, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUserKey indicates an expected call of CreateUserKey.
+func (mr *MockUserKeyRepositoryMockRecorder) CreateUserKey(ctx, userID, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserKey", reflect.TypeOf((*MockUserKeyRepository)(nil).CreateUserKey), ctx, userID, key)
+}
+
+// DeleteUserKey mocks base method.
+func (m *MockUserKeyRepository) DeleteUserKey(ctx context.Context, userID domain.UserID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserKey", ctx, userID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserKey indicates an expected call of DeleteUserKey.
+func (mr *MockUserKeyRepositoryMockRecorder) DeleteUserKey(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserKey", reflect.TypeOf((*MockUserKeyRepository)(nil).DeleteUserKey), ctx, userID)
+}
+
+// GetUserKey mocks base method.
+func (m *MockUserKeyRepository) GetUserKey(ctx context.Context, userID domain.UserID) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserKey", ctx, userID)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserKey indicates an expected call of GetUserKey.
+func (mr *MockUserKeyRepositoryMockRecorder) GetUserKey(ctx, userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserKey", reflect.TypeOf((*MockUserKeyRepository)(nil).GetUserKey), ctx, userID)
+}
+
+// ReplaceUserKey mocks base method.
+func (m *MockUserKeyRepository) ReplaceUserKey(ctx context.Context, userID domain.UserID, old, key []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceUserKey", ctx, userID, old, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceUserKey indicates an expected call of ReplaceUserKey.
+func (mr *MockUserKeyRepositoryMockRecorder) ReplaceUserKey(ctx, userID, old, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceUserKey", reflect.TypeOf((*MockUserKeyRepository)(nil).ReplaceUserKey), ctx, userID, old, key)
+}
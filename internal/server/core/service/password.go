@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+)
+
+// ChangePassword replaces password of the user after checking the current
+// one. Client side encrypted accounts pass the vault key wrapped for the new
+// password, the items themselves stay encrypted with the same vault key.
+// Every session of the user is revoked once the new password is stored, the
+// caller gets a new one. When revocation fails the password is changed
+// nonetheless, the error says so and the change can be repeated with the new
+// password to revoke the sessions.
+func (a *AuthService) ChangePassword(ctx context.Context, name domain.UserName, change domain.PasswordChange) (domain.Tokens, error) {
+	if a.guard != nil {
+		if err := a.guard.attempt(ctx, []attemptKey{a.guard.reauthKey(name)}, time.Now()); err != nil {
+			return domain.Tokens{}, err
+		}
+	}
+
+	user, err := a.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	_, err = a.hasher.Verify(change.OldPassword, user.Password)
+	if err != nil {
+		a.record(ctx, domain.AuditEvent{Action: domain.AuditPasswordChange, UserID: user.ID, UserName: user.Name})
+		return domain.Tokens{}, domain.ErrInvalidCredentials
+	}
+	if a.guard != nil {
+		if err := a.guard.succeed(ctx, a.guard.reauthKey(name)); err != nil {
+			log.Err(err).Msgf("failed to reset attempts of '%s'", name)
+		}
+	}
+	if user.IsEncrypted() != (len(change.VaultKey) > 0) {
+		return domain.Tokens{}, domain.ErrEncryptionMode
+	}
+
+	hash, err := a.hasher.Hash(change.NewPassword)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	err = a.repo.UpdatePassword(ctx, user.ID, hash, change.VaultKey)
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	user.Password = hash
+	user.VaultKey = change.VaultKey
+	a.record(ctx, domain.AuditEvent{Action: domain.AuditPasswordChange, Success: true, UserID: user.ID, UserName: user.Name})
+
+	// tokens issued up to now are revoked, the new pair is issued later
+	err = a.sessions.RevokeUser(ctx, user.ID, time.Now().Truncate(time.Microsecond))
+	if err != nil {
+		log.Err(err).Msgf("password of user '%s' is changed, failed to revoke sessions", user.ID)
+		return domain.Tokens{}, fmt.Errorf("%w: password is changed, sessions are not revoked", err)
+	}
+	return a.createTokens(ctx, user, newSessionFamily(), time.Now())
+}
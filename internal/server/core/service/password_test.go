@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	hasher := util.NewPasswordHasher(util.Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	password, err := hasher.Hash("password")
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password, VaultKey: []byte("wrapped")}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).DoAndReturn(
+		func(ctx context.Context, name domain.UserName) (domain.User, error) {
+			return user, nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().UpdatePassword(gomock.Any(), user.ID, gomock.Any(), []byte("rewrapped")).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, password string, vaultKey []byte) error {
+			user.Password = password
+			user.VaultKey = vaultKey
+			return nil
+		},
+	)
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(gomock.Any()).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+	var revokedBefore time.Time
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil)
+	mockSessions.EXPECT().RevokeUser(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, before time.Time) error {
+			revokedBefore = before
+			return nil
+		},
+	)
+	mockSessions.EXPECT().UserRevokedBefore(gomock.Any(), user.ID).DoAndReturn(
+		func(ctx context.Context, id domain.UserID) (time.Time, error) {
+			return revokedBefore, nil
+		},
+	).Times(4)
+	mockSessions.EXPECT().IsAccessTokenRevoked(gomock.Any(), gomock.Any()).Return(false, nil).Times(2)
+	as := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour).WithPasswordHasher(hasher)
+	ctx := context.Background()
+
+	oldPayload := domain.TokenPayload{ID: user.ID, TokenID: "old", IssuedAt: time.Now().Add(-time.Minute)}
+	// issued within the second before the change
+	recentPayload := domain.TokenPayload{ID: user.ID, TokenID: "recent", IssuedAt: time.Now().Truncate(time.Microsecond)}
+
+	_, err = as.ChangePassword(ctx, user.Name, domain.PasswordChange{OldPassword: "wrong", NewPassword: "new password", VaultKey: []byte("rewrapped")})
+	require.Equal(t, domain.ErrInvalidCredentials, err)
+	_, err = as.ChangePassword(ctx, user.Name, domain.PasswordChange{OldPassword: "password", NewPassword: "new password"})
+	require.Equal(t, domain.ErrEncryptionMode, err)
+	revoked, err := as.IsTokenRevoked(ctx, oldPayload)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	tokens, err := as.ChangePassword(ctx, user.Name, domain.PasswordChange{OldPassword: "password", NewPassword: "new password", VaultKey: []byte("rewrapped")})
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.RefreshToken)
+	_, err = hasher.Verify("new password", user.Password)
+	require.NoError(t, err)
+
+	revoked, err = as.IsTokenRevoked(ctx, oldPayload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = as.IsTokenRevoked(ctx, recentPayload)
+	require.NoError(t, err)
+	require.True(t, revoked)
+	revoked, err = as.IsTokenRevoked(ctx, domain.TokenPayload{ID: user.ID, TokenID: "new", IssuedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, revoked)
+}
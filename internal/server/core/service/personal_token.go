@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+)
+
+const (
+	personalTokenSize = 32
+	// MaxPersonalTokenLifetime limits how long a personal token may live,
+	// tokens for automation have to be renewed at least once a year.
+	MaxPersonalTokenLifetime = 365 * 24 * time.Hour
+)
+
+// WithPersonalTokens enables personal access tokens, they are deleted with
+// the account.
+func (a *AuthService) WithPersonalTokens(tokens port.PersonalTokenRepository) *AuthService {
+	a.personalTokens = tokens
+	return a
+}
+
+// CreatePersonalToken mints a token of the user limited to req scopes and,
+// when given, to req items. Only hash of the token is stored.
+func (a *AuthService) CreatePersonalToken(ctx context.Context, payload domain.TokenPayload, req domain.PersonalTokenRequest) (domain.Token, domain.PersonalToken, error) {
+	if a.personalTokens == nil {
+		return "", domain.PersonalToken{}, errors.New("personal tokens are not enabled")
+	}
+	if len(req.Name) == 0 || len(req.Scopes) == 0 || req.ExpiresIn <= 0 || req.ExpiresIn > MaxPersonalTokenLifetime {
+		return "", domain.PersonalToken{}, domain.ErrBadRequest
+	}
+	for _, scope := range req.Scopes {
+		if !scope.IsValid() {
+			return "", domain.PersonalToken{}, domain.ErrBadRequest
+		}
+	}
+
+	secret := make([]byte, personalTokenSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return "", domain.PersonalToken{}, err
+	}
+	token := domain.Token(domain.PersonalTokenPrefix + base64.RawURLEncoding.EncodeToString(secret))
+	now := time.Now().UTC()
+	stored := domain.PersonalToken{
+		ID:        uuid.NewString(),
+		UserID:    payload.ID,
+		UserName:  domain.UserName(payload.Name),
+		Name:      req.Name,
+		Hash:      hashToken(token),
+		Scopes:    req.Scopes,
+		ItemIDs:   req.ItemIDs,
+		CreatedAt: now,
+		ExpiresAt: now.Add(req.ExpiresIn),
+	}
+	err := a.personalTokens.CreatePersonalToken(ctx, stored)
+	if err != nil {
+		return "", domain.PersonalToken{}, err
+	}
+	a.record(ctx, domain.AuditEvent{Action: domain.AuditTokenCreate, Success: true, UserID: payload.ID, UserName: domain.UserName(payload.Name)})
+	return token, stored, nil
+}
+
+func (a *AuthService) ListPersonalTokens(ctx context.Context, userID domain.UserID) ([]domain.PersonalToken, error) {
+	if a.personalTokens == nil {
+		return nil, nil
+	}
+	return a.personalTokens.ListPersonalTokens(ctx, userID)
+}
+
+func (a *AuthService) RevokePersonalToken(ctx context.Context, payload domain.TokenPayload, id string) error {
+	if a.personalTokens == nil {
+		return domain.ErrNotFound
+	}
+	err := a.personalTokens.DeletePersonalToken(ctx, payload.ID, id)
+	if err != nil {
+		return err
+	}
+	a.record(ctx, domain.AuditEvent{Action: domain.AuditTokenRevoke, Success: true, UserID: payload.ID, UserName: domain.UserName(payload.Name)})
+	return nil
+}
+
+// VerifyPersonalToken returns payload of a valid personal token. Encryption
+// mode comes from the user, so it follows the account like in session tokens.
+func (a *AuthService) VerifyPersonalToken(ctx context.Context, token domain.Token) (domain.TokenPayload, error) {
+	if a.personalTokens == nil {
+		return domain.TokenPayload{}, domain.ErrInvalidToken
+	}
+	stored, err := a.personalTokens.GetPersonalToken(ctx, hashToken(token))
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return domain.TokenPayload{}, domain.ErrInvalidToken
+		}
+		return domain.TokenPayload{}, err
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return domain.TokenPayload{}, domain.ErrInvalidToken
+	}
+
+	user, err := a.repo.GetUserByName(ctx, stored.UserName)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return domain.TokenPayload{}, domain.ErrInvalidToken
+		}
+		return domain.TokenPayload{}, err
+	}
+	if user.ID != stored.UserID {
+		return domain.TokenPayload{}, domain.ErrInvalidToken
+	}
+	return domain.TokenPayload{
+		ID:              user.ID,
+		Name:            string(user.Name),
+		Encrypted:       user.IsEncrypted(),
+		IssuedAt:        stored.CreatedAt,
+		ExpiresAt:       stored.ExpiresAt,
+		PersonalTokenID: stored.ID,
+		Scopes:          stored.Scopes,
+		ItemIDs:         stored.ItemIDs,
+	}, nil
+}
+
+// deletePersonalTokens drops tokens of a deleted account.
+func (a *AuthService) deletePersonalTokens(ctx context.Context, userID domain.UserID) error {
+	if a.personalTokens == nil {
+		return nil
+	}
+	err := a.personalTokens.DeleteUserTokens(ctx, userID)
+	if err != nil {
+		log.Err(err).Msgf("failed to delete personal tokens of user '%s'", userID)
+	}
+	return err
+}
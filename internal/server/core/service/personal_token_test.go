@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_PersonalToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	user := domain.User{ID: "id", Name: "name", VaultKey: []byte("wrapped")}
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil).AnyTimes()
+	stored := make(map[string]domain.PersonalToken)
+	mockTokens := mock_port.NewMockPersonalTokenRepository(ctrl)
+	mockTokens.EXPECT().CreatePersonalToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, token domain.PersonalToken) error {
+			stored[string(token.Hash)] = token
+			return nil
+		},
+	)
+	mockTokens.EXPECT().GetPersonalToken(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, hash []byte) (domain.PersonalToken, error) {
+			token, ok := stored[string(hash)]
+			if !ok {
+				return domain.PersonalToken{}, domain.ErrNotFound
+			}
+			return token, nil
+		},
+	).AnyTimes()
+	as := NewAuthService(mockRepo, mock_port.NewMockTokenService(ctrl), mock_port.NewMockSessionRepository(ctrl), time.Hour).
+		WithPersonalTokens(mockTokens)
+	ctx := context.Background()
+	payload := domain.TokenPayload{ID: user.ID, Name: string(user.Name)}
+
+	_, _, err := as.CreatePersonalToken(ctx, payload, domain.PersonalTokenRequest{Name: "ci", Scopes: []domain.Scope{"admin"}, ExpiresIn: time.Hour})
+	require.Equal(t, domain.ErrBadRequest, err)
+	_, _, err = as.CreatePersonalToken(ctx, payload, domain.PersonalTokenRequest{Name: "ci", Scopes: []domain.Scope{domain.ScopeReadVault}, ExpiresIn: 2 * MaxPersonalTokenLifetime})
+	require.Equal(t, domain.ErrBadRequest, err)
+
+	token, created, err := as.CreatePersonalToken(ctx, payload, domain.PersonalTokenRequest{
+		Name:      "ci",
+		Scopes:    []domain.Scope{domain.ScopeReadVault},
+		ItemIDs:   []domain.DataID{"item"},
+		ExpiresIn: time.Hour,
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(token), domain.PersonalTokenPrefix))
+	require.NotContains(t, string(created.Hash), string(token))
+
+	verified, err := as.VerifyPersonalToken(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, created.ID, verified.PersonalTokenID)
+	require.True(t, verified.Encrypted)
+	require.True(t, verified.Allows(domain.ScopeReadVault, "item"))
+	require.False(t, verified.Allows(domain.ScopeReadVault, "other"))
+	require.False(t, verified.Allows(domain.ScopeWriteVault, ""))
+
+	_, err = as.VerifyPersonalToken(ctx, "gkp_unknown")
+	require.Equal(t, domain.ErrInvalidToken, err)
+
+	expired := stored[string(created.Hash)]
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	stored[string(created.Hash)] = expired
+	_, err = as.VerifyPersonalToken(ctx, token)
+	require.Equal(t, domain.ErrInvalidToken, err)
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+// RotationService moves every stored item and TOTP secret under the primary
+// master key. Items already sealed with the primary key are skipped, so
+// rotation may run next to the serving keeper and may be restarted at any
+// point. Every item is replaced with compare-and-swap, so a write racing with
+// rotation is never overwritten by the rewrapped old data. Secrets and user
+// keys are counted as items.
+type RotationService struct {
+	users    port.UserRepository
+	repo     port.KeeperRepository
+	chunks   port.ChunkRepository
+	keys     *util.KeyRing
+	secrets  *util.KeyRing
+	userKeys *userKeys
+}
+
+func NewRotationService(users port.UserRepository, repo port.KeeperRepository, keys port.KeyProvider) (*RotationService, error) {
+	ring, err := newKeeperKeyRing(keys)
+	if err != nil {
+		return nil, err
+	}
+	secrets, err := newKeyRing(keys, twoFactorKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return &RotationService{users: users, repo: repo, keys: ring, secrets: secrets}, nil
+}
+
+// WithChunks rotates chunks of binary items too, they are counted as items.
+func (rs *RotationService) WithChunks(chunks port.ChunkRepository) *RotationService {
+	rs.chunks = chunks
+	return rs
+}
+
+// WithUserKeys wraps user keys with the primary master key and moves items
+// under the key of their user, users without key get one.
+func (rs *RotationService) WithUserKeys(repo port.UserKeyRepository, keys port.KeyProvider) (*RotationService, error) {
+	userKeys, err := newUserKeys(repo, keys)
+	if err != nil {
+		return nil, err
+	}
+	rs.userKeys = userKeys
+	return rs, nil
+}
+
+// KeyID returns identifier of the key items are rotated to.
+func (rs *RotationService) KeyID() util.KeyID {
+	return rs.keys.PrimaryID()
+}
+
+func (rs *RotationService) Rotate(ctx context.Context, checkpoint port.RotationCheckpoint) (domain.RotationStats, error) {
+	var stats domain.RotationStats
+	users, err := rs.users.GetUsers(ctx)
+	if err != nil {
+		log.Err(err).Msg("failed to get users")
+		return stats, err
+	}
+
+	for i, user := range users {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		done, err := checkpoint.IsDone(ctx, user.ID)
+		if err != nil {
+			log.Err(err).Msg("failed to read rotation checkpoint")
+			return stats, err
+		}
+		if done {
+			stats.Users++
+			log.Info().Msgf("user %d/%d '%s' already rotated", i+1, len(users), user.ID)
+			continue
+		}
+
+		failed := stats.Failed
+		err = rs.rotateUser(ctx, user, &stats)
+		if err != nil {
+			return stats, err
+		}
+		stats.Users++
+		if stats.Failed == failed {
+			err = checkpoint.MarkDone(ctx, user.ID)
+			if err != nil {
+				log.Err(err).Msg("failed to write rotation checkpoint")
+				return stats, err
+			}
+		}
+		log.Info().Msgf("user %d/%d '%s' rotated, items: %d rotated: %d skipped: %d failed: %d",
+			i+1, len(users), user.ID, stats.Items, stats.Rotated, stats.Skipped, stats.Failed)
+	}
+	return stats, nil
+}
+
+func (rs *RotationService) rotateUser(ctx context.Context, user domain.User, stats *domain.RotationStats) error {
+	rotated, err := rs.rotateSecret(ctx, user.Name)
+	if err != nil {
+		log.Err(err).Msgf("failed to rotate totp secret of user '%s'", user.ID)
+	}
+	countRotation(stats, rotated, err)
+
+	userID := user.ID
+	ring := rs.keys
+	if rs.userKeys != nil {
+		rotated, err := rs.userKeys.rotate(ctx, userID)
+		if err != nil {
+			log.Err(err).Msgf("failed to rotate key of user '%s'", userID)
+		}
+		countRotation(stats, rotated, err)
+		ring, err = rs.userKeys.ring(ctx, rs.keys, userID, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	items, err := rs.repo.GetAllData(ctx, userID)
+	if err != nil && err != domain.ErrNotFound {
+		log.Err(err).Msgf("failed to list items of user '%s'", userID)
+		return err
+	}
+
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rotated, err := rs.rotateItem(ctx, ring, userID, item)
+		if err != nil {
+			log.Err(err).Msgf("failed to rotate item '%s' of user '%s'", item.ID, userID)
+		}
+		countRotation(stats, rotated, err)
+	}
+	return rs.rotateChunks(ctx, ring, userID, stats)
+}
+
+func (rs *RotationService) rotateChunks(ctx context.Context, ring *util.KeyRing, userID domain.UserID, stats *domain.RotationStats) error {
+	if rs.chunks == nil {
+		return nil
+	}
+	ids, err := rs.chunks.ListChunks(ctx, userID)
+	if err != nil {
+		log.Err(err).Msgf("failed to list chunks of user '%s'", userID)
+		return err
+	}
+
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rotated, err := rs.rotateChunk(ctx, ring, userID, id)
+		if err != nil {
+			log.Err(err).Msgf("failed to rotate chunk '%s' of user '%s'", id, userID)
+		}
+		countRotation(stats, rotated, err)
+	}
+	return nil
+}
+
+func countRotation(stats *domain.RotationStats, rotated bool, err error) {
+	stats.Items++
+	switch {
+	case err != nil:
+		stats.Failed++
+	case rotated:
+		stats.Rotated++
+	default:
+		stats.Skipped++
+	}
+}
+
+// rotateItem moves item under the primary key of ring. Items in the current
+// formats only get the data key in their head wrapped again, so files are
+// neither read whole nor held in memory. Items in older formats were written
+// in one piece and are sealed again whole. The data is replaced only if it
+// was not changed since it was read, an item written or deleted meanwhile is
+// skipped and its chunk list is kept as it is.
+func (rs *RotationService) rotateItem(ctx context.Context, ring *util.KeyRing, userID domain.UserID, item domain.DataContext) (bool, error) {
+	head, err := rs.readHead(ctx, item)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if ring.IsPrimary(head) {
+		return false, nil
+	}
+
+	aad := associatedData(domain.DataContext{UserID: userID, ID: item.ID, Type: item.Type})
+	rewrapped, err := ring.RewrapHead(head, aad)
+	if err == util.ErrOutdatedEnvelope {
+		return rs.resealItem(ctx, ring, item, aad)
+	}
+	if err != nil {
+		return false, err
+	}
+	err = rs.repo.ReplaceHead(ctx, item, head, rewrapped)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readHead returns the envelope head of item data, shorter data is returned
+// whole.
+func (rs *RotationService) readHead(ctx context.Context, item domain.DataContext) ([]byte, error) {
+	stream, err := rs.repo.GetStream(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	head := make([]byte, util.EnvelopeHeadSize)
+	n, err := io.ReadFull(stream, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return head[:n], nil
+	}
+	return head, err
+}
+
+// resealItem seals item in an older format again with the primary key.
+func (rs *RotationService) resealItem(ctx context.Context, ring *util.KeyRing, item domain.DataContext, aad []byte) (bool, error) {
+	data, err := rs.repo.GetData(ctx, item)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	rewrapped, err := ring.Rewrap(data, aad)
+	if err != nil {
+		return false, err
+	}
+	err = rs.repo.ReplaceData(ctx, item, data, rewrapped)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// rotateSecret seals TOTP secret of user under the primary key, secrets
+// stored before sealing are sealed too. The secret is replaced only if it was
+// not changed since it was read, a secret enrolled meanwhile is skipped.
+func (rs *RotationService) rotateSecret(ctx context.Context, name domain.UserName) (bool, error) {
+	user, err := rs.users.GetUserByName(ctx, name)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	secret := user.TwoFactor.Secret
+	if len(secret) == 0 || rs.secrets.IsPrimary(secret) {
+		return false, nil
+	}
+
+	aad := twoFactorAssociatedData(user.ID)
+	var sealed []byte
+	if util.IsSealed(secret) {
+		sealed, err = rs.secrets.Rewrap(secret, aad)
+	} else {
+		sealed, err = rs.secrets.Seal(secret, aad)
+	}
+	if err != nil {
+		return false, err
+	}
+	err = rs.users.ReplaceTwoFactorSecret(ctx, user.ID, secret, sealed)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// rotateChunk skips chunks released since they were listed.
+func (rs *RotationService) rotateChunk(ctx context.Context, ring *util.KeyRing, userID domain.UserID, id domain.ChunkID) (bool, error) {
+	data, err := rs.chunks.GetChunk(ctx, userID, id)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	if ring.IsPrimary(data) {
+		return false, nil
+	}
+
+	rewrapped, err := ring.Rewrap(data, chunkAssociatedData(userID, id))
+	if err != nil {
+		return false, err
+	}
+	err = rs.chunks.ReplaceChunk(ctx, userID, id, rewrapped)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
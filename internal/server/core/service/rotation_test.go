@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotationService_Rotate(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	oldKey := []byte("old-master-key")
+	newKey := []byte("new-master-key")
+
+	oldKeys := mock_port.NewMockKeyProvider(ctrl)
+	oldKeys.EXPECT().MasterKey().Return(oldKey, nil)
+	oldKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	oldRing, err := newKeeperKeyRing(oldKeys)
+	require.NoError(t, err)
+
+	newKeys := mock_port.NewMockKeyProvider(ctrl)
+	newKeys.EXPECT().MasterKey().Return(newKey, nil).Times(4)
+	newKeys.EXPECT().PreviousKeys().Return([][]byte{oldKey}, nil).Times(4)
+	newRing, err := newKeeperKeyRing(newKeys)
+	require.NoError(t, err)
+
+	oldItem := domain.DataContext{ID: "old", UserID: "user"}
+	newItem := domain.DataContext{ID: "new", UserID: "user"}
+	changedItem := domain.DataContext{ID: "changed", UserID: "user"}
+	oldData, err := oldRing.Seal([]byte("old data"), associatedData(oldItem))
+	require.NoError(t, err)
+	changedData, err := oldRing.Seal([]byte("changed data"), associatedData(changedItem))
+	require.NoError(t, err)
+	newData, err := newRing.Seal([]byte("new data"), associatedData(newItem))
+	require.NoError(t, err)
+	storage := map[domain.DataID][]byte{oldItem.ID: oldData, newItem.ID: newData, changedItem.ID: changedData}
+
+	mockUsers := mock_port.NewMockUserRepository(ctrl)
+	user := domain.User{ID: "user", Name: "name", TwoFactor: domain.TwoFactor{Secret: []byte("totp secret")}}
+	mockUsers.EXPECT().GetUsers(gomock.Any()).Return([]domain.User{{ID: "done"}, {ID: user.ID, Name: user.Name}}, nil)
+	mockUsers.EXPECT().GetUserByName(gomock.Any(), user.Name).Return(user, nil)
+	var secret []byte
+	mockUsers.EXPECT().ReplaceTwoFactorSecret(gomock.Any(), user.ID, user.TwoFactor.Secret, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, old, sealed []byte) error {
+			secret = sealed
+			return nil
+		},
+	)
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockRepo.EXPECT().GetAllData(gomock.Any(), domain.UserID("user")).Return([]domain.DataContext{oldItem, newItem, changedItem}, nil)
+	// only heads of items in the current format are read and replaced
+	mockRepo.EXPECT().GetStream(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(storage[dataCtx.ID])), nil
+		},
+	).Times(3)
+	mockRepo.EXPECT().ReplaceHead(gomock.Any(), oldItem, oldData[:util.EnvelopeHeadSize], gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+			storage[dataCtx.ID] = append(head, storage[dataCtx.ID][len(old):]...)
+			return nil
+		},
+	)
+	// the item written meanwhile keeps the new data and is skipped
+	mockRepo.EXPECT().ReplaceHead(gomock.Any(), changedItem, changedData[:util.EnvelopeHeadSize], gomock.Any()).Return(domain.ErrNotFound)
+	checkpoint := mock_port.NewMockRotationCheckpoint(ctrl)
+	checkpoint.EXPECT().IsDone(gomock.Any(), domain.UserID("done")).Return(true, nil)
+	checkpoint.EXPECT().IsDone(gomock.Any(), domain.UserID("user")).Return(false, nil)
+	checkpoint.EXPECT().MarkDone(gomock.Any(), domain.UserID("user")).Return(nil)
+
+	rs, err := NewRotationService(mockUsers, mockRepo, newKeys)
+	require.NoError(t, err)
+	stats, err := rs.Rotate(context.Background(), checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, domain.RotationStats{Users: 2, Items: 4, Rotated: 2, Skipped: 2}, stats)
+
+	require.True(t, newRing.IsPrimary(storage[oldItem.ID]))
+	require.Equal(t, changedData, storage[changedItem.ID])
+	data, err := newRing.Open(storage[oldItem.ID], associatedData(oldItem))
+	require.NoError(t, err)
+	require.Equal(t, []byte("old data"), data)
+
+	secrets, err := newKeyRing(newKeys, twoFactorKeyPurpose)
+	require.NoError(t, err)
+	require.True(t, secrets.IsPrimary(secret))
+	data, err = secrets.Open(secret, twoFactorAssociatedData(user.ID))
+	require.NoError(t, err)
+	require.Equal(t, user.TwoFactor.Secret, data)
+}
+
+func TestRotationService_ResealsUnbound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil).AnyTimes()
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil).AnyTimes()
+
+	// items stored before envelopes were sealed with the legacy key only
+	aesblock, err := aes.NewCipher(legacyKey[:])
+	require.NoError(t, err)
+	aesgcm, err := cipher.NewGCM(aesblock)
+	require.NoError(t, err)
+	item := domain.DataContext{ID: "item", UserID: "user", Type: domain.TextType}
+	data := aesgcm.Seal(nil, legacyKey[len(legacyKey)-aesgcm.NonceSize():], []byte("text"), nil)
+
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockRepo.EXPECT().GetMeta(gomock.Any(), item.UserID, item.ID).Return(item, nil).AnyTimes()
+	mockRepo.EXPECT().GetData(gomock.Any(), item).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+			return data, nil
+		},
+	).AnyTimes()
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	ks.WithBoundOnly()
+	_, err = ks.GetTextData(context.Background(), item)
+	require.Equal(t, domain.ErrDecryptionFailed, err)
+
+	mockUsers := mock_port.NewMockUserRepository(ctrl)
+	mockUsers.EXPECT().GetUsers(gomock.Any()).Return([]domain.User{{ID: item.UserID, Name: "name"}}, nil)
+	mockUsers.EXPECT().GetUserByName(gomock.Any(), domain.UserName("name")).Return(domain.User{ID: item.UserID, Name: "name"}, nil)
+	mockRepo.EXPECT().GetAllData(gomock.Any(), item.UserID).Return([]domain.DataContext{item}, nil)
+	mockRepo.EXPECT().GetStream(gomock.Any(), item).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		},
+	)
+	mockRepo.EXPECT().ReplaceData(gomock.Any(), item, data, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, old, resealed []byte) error {
+			data = resealed
+			return nil
+		},
+	)
+	checkpoint := mock_port.NewMockRotationCheckpoint(ctrl)
+	checkpoint.EXPECT().IsDone(gomock.Any(), item.UserID).Return(false, nil)
+	checkpoint.EXPECT().MarkDone(gomock.Any(), item.UserID).Return(nil)
+	rs, err := NewRotationService(mockUsers, mockRepo, mockKeys)
+	require.NoError(t, err)
+	stats, err := rs.Rotate(context.Background(), checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, domain.RotationStats{Users: 1, Items: 2, Rotated: 1, Skipped: 1}, stats)
+
+	// resealed item is bound to its owner, id and type
+	text, err := ks.GetTextData(context.Background(), item)
+	require.NoError(t, err)
+	require.Equal(t, "text", text)
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+const (
+	totpIssuer        = "gophkeeper"
+	recoveryCodeCount = 10
+	recoveryCodeSize  = 10
+	challengeSize     = 32
+	challengeExp      = 5 * time.Minute
+	challengeAttempts = 5
+)
+
+const twoFactorKeyPurpose = "gophkeeper totp secret"
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EnrollTwoFactor starts enrollment with a new secret, the second factor is
+// not required until the first code is confirmed.
+func (a *AuthService) EnrollTwoFactor(ctx context.Context, name domain.UserName) (domain.TOTPEnrollment, error) {
+	user, err := a.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+	if user.TwoFactor.Enabled {
+		return domain.TOTPEnrollment{}, domain.ErrTwoFactorEnabled
+	}
+
+	secret, err := util.NewTOTPSecret()
+	if err != nil {
+		return domain.TOTPEnrollment{}, err
+	}
+	sealed, err := a.sealSecret(user.ID, secret)
+	if err != nil {
+		log.Err(err).Msg("failed to seal totp secret")
+		return domain.TOTPEnrollment{}, err
+	}
+	err = a.repo.UpdateTwoFactor(ctx, user.ID, domain.TwoFactor{Secret: sealed})
+	if err != nil {
+		log.Err(err).Msg("failed to store totp secret")
+		return domain.TOTPEnrollment{}, err
+	}
+	return domain.TOTPEnrollment{
+		Secret: util.EncodeTOTPSecret(secret),
+		URI:    util.TOTPURI(totpIssuer, string(user.Name), secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables second factor once the authenticator shows a valid
+// code. Recovery codes are returned only here, the server keeps their hashes.
+func (a *AuthService) ConfirmTwoFactor(ctx context.Context, name domain.UserName, code string) ([]string, error) {
+	user, err := a.repo.GetUserByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactor.Enabled {
+		return nil, domain.ErrTwoFactorEnabled
+	}
+	if len(user.TwoFactor.Secret) == 0 {
+		return nil, domain.ErrTwoFactorNotEnrolled
+	}
+	secret, err := a.openSecret(user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := util.VerifyTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, domain.ErrInvalidCode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	err = a.repo.UpdateTwoFactor(ctx, user.ID, domain.TwoFactor{
+		Secret:        user.TwoFactor.Secret,
+		Enabled:       true,
+		LastStep:      step,
+		RecoveryCodes: hashes,
+	})
+	if err != nil {
+		log.Err(err).Msg("failed to enable two factor authentication")
+		return nil, err
+	}
+	return codes, nil
+}
+
+// LoginTwoFactor completes login challenge. A wrong code costs one of the
+// challenge attempts, after that the password has to be entered again, and
+// counts as a failed login of the user.
+func (a *AuthService) LoginTwoFactor(ctx context.Context, challenge domain.Token, code string) (domain.Tokens, error) {
+	stored, err := a.sessions.TakeChallenge(ctx, hashToken(challenge))
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return domain.Tokens{}, domain.ErrInvalidToken
+		}
+		return domain.Tokens{}, err
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return domain.Tokens{}, domain.ErrInvalidToken
+	}
+
+	user, err := a.repo.GetUserByName(ctx, stored.UserName)
+	if err != nil {
+		if err == domain.ErrNotFound {
+			return domain.Tokens{}, domain.ErrInvalidToken
+		}
+		return domain.Tokens{}, err
+	}
+
+	now := time.Now()
+	if a.guard != nil {
+		// codes count against the username like passwords do
+		if err := a.guard.attempt(ctx, []attemptKey{a.guard.userKey(user.Name)}, now); err != nil {
+			if err := a.sessions.CreateChallenge(ctx, stored); err != nil {
+				return domain.Tokens{}, err
+			}
+			return domain.Tokens{}, err
+		}
+	}
+	err = a.useSecondFactor(ctx, user, code, now)
+	if err == domain.ErrInvalidCode {
+		a.record(ctx, domain.AuditEvent{Action: domain.AuditLoginFailed, UserID: user.ID, UserName: user.Name})
+		stored.Attempts++
+		if stored.Attempts < challengeAttempts {
+			if err := a.sessions.CreateChallenge(ctx, stored); err != nil {
+				return domain.Tokens{}, err
+			}
+		}
+		return domain.Tokens{}, domain.ErrInvalidCode
+	}
+	if err != nil {
+		log.Err(err).Msg("failed to use second factor")
+		return domain.Tokens{}, err
+	}
+	err = a.record(ctx, domain.AuditEvent{Action: domain.AuditLogin, Success: true, UserID: user.ID, UserName: user.Name})
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	if err := a.loginPassed(ctx, user.Name); err != nil {
+		return domain.Tokens{}, err
+	}
+	return a.createTokens(ctx, user, newSessionFamily(), time.Now())
+}
+
+// createChallenge issues login challenge for user with second factor.
+func (a *AuthService) createChallenge(ctx context.Context, user domain.User) (domain.Tokens, error) {
+	secret := make([]byte, challengeSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return domain.Tokens{}, err
+	}
+	challenge := domain.Token(base64.RawURLEncoding.EncodeToString(secret))
+	err := a.sessions.CreateChallenge(ctx, domain.LoginChallenge{
+		Hash:      hashToken(challenge),
+		UserName:  user.Name,
+		ExpiresAt: time.Now().Add(challengeExp),
+	})
+	if err != nil {
+		return domain.Tokens{}, err
+	}
+	return domain.Tokens{Challenge: challenge}, nil
+}
+
+// useSecondFactor spends a TOTP code newer than the last used one or an
+// unused recovery code. The repository spends them conditionally, so a code
+// used by a parallel login is refused with domain.ErrInvalidCode.
+func (a *AuthService) useSecondFactor(ctx context.Context, user domain.User, code string, now time.Time) error {
+	if !user.TwoFactor.Enabled {
+		return domain.ErrInvalidCode
+	}
+	secret, err := a.openSecret(user)
+	if err != nil {
+		return err
+	}
+	if step, ok := util.VerifyTOTP(secret, code, now); ok {
+		if step <= user.TwoFactor.LastStep {
+			return domain.ErrInvalidCode
+		}
+		return a.repo.UseTwoFactorStep(ctx, user.ID, step)
+	}
+
+	hash := hashRecoveryCode(code)
+	for _, stored := range user.TwoFactor.RecoveryCodes {
+		if subtle.ConstantTimeCompare(stored, hash) == 1 {
+			return a.repo.UseRecoveryCode(ctx, user.ID, hash)
+		}
+	}
+	return domain.ErrInvalidCode
+}
+
+// newRecoveryCode returns code like "abcde-fghij".
+func newRecoveryCode() (string, error) {
+	random := make([]byte, recoveryCodeSize)
+	if _, err := io.ReadFull(rand.Reader, random); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(random))[:recoveryCodeSize]
+	return code[:recoveryCodeSize/2] + "-" + code[recoveryCodeSize/2:], nil
+}
+
+func hashRecoveryCode(code string) []byte {
+	code = strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(code))
+	return sum[:]
+}
+
+// WithTwoFactorKeys seals TOTP secrets with a key derived from the master
+// key. Secrets stored in plaintext before stay readable, rotate-keys seals
+// them.
+func (a *AuthService) WithTwoFactorKeys(keys port.KeyProvider) (*AuthService, error) {
+	ring, err := newKeyRing(keys, twoFactorKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	a.secrets = ring
+	return a, nil
+}
+
+// twoFactorAssociatedData binds sealed TOTP secret to its owner.
+func twoFactorAssociatedData(id domain.UserID) []byte {
+	return associatedData(domain.DataContext{UserID: id, Type: "totp"})
+}
+
+func (a *AuthService) sealSecret(id domain.UserID, secret []byte) ([]byte, error) {
+	if a.secrets == nil {
+		return secret, nil
+	}
+	return a.secrets.Seal(secret, twoFactorAssociatedData(id))
+}
+
+// openSecret returns TOTP secret of user, secrets without envelope were
+// stored before sealing.
+func (a *AuthService) openSecret(user domain.User) ([]byte, error) {
+	if !util.IsSealed(user.TwoFactor.Secret) {
+		return user.TwoFactor.Secret, nil
+	}
+	if a.secrets == nil {
+		return nil, util.ErrUnknownKey
+	}
+	secret, err := a.secrets.Open(user.TwoFactor.Secret, twoFactorAssociatedData(user.ID))
+	if err != nil {
+		log.Err(err).Msgf("failed to open totp secret of user '%s'", user.ID)
+		return nil, decryptError(err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/base32"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthService_TwoFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	password, err := util.HashPassword("password")
+	require.NoError(t, err)
+	user := domain.User{ID: "id", Name: "name", Password: password}
+
+	mockRepo := mock_port.NewMockUserRepository(ctrl)
+	mockRepo.EXPECT().GetUserByName(gomock.Any(), user.Name).DoAndReturn(
+		func(ctx context.Context, name domain.UserName) (domain.User, error) {
+			return user, nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().UpdateTwoFactor(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, twoFactor domain.TwoFactor) error {
+			user.TwoFactor = twoFactor
+			return nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().UseTwoFactorStep(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, step int64) error {
+			if step <= user.TwoFactor.LastStep {
+				return domain.ErrInvalidCode
+			}
+			user.TwoFactor.LastStep = step
+			return nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().UseRecoveryCode(gomock.Any(), user.ID, gomock.Any()).DoAndReturn(
+		func(ctx context.Context, id domain.UserID, hash []byte) error {
+			for i, code := range user.TwoFactor.RecoveryCodes {
+				if bytes.Equal(code, hash) {
+					user.TwoFactor.RecoveryCodes = append(user.TwoFactor.RecoveryCodes[:i:i], user.TwoFactor.RecoveryCodes[i+1:]...)
+					return nil
+				}
+			}
+			return domain.ErrInvalidCode
+		},
+	).AnyTimes()
+	mockToken := mock_port.NewMockTokenService(ctrl)
+	mockToken.EXPECT().CreateToken(gomock.Any()).Return(domain.Token("access"), time.Now().Add(time.Minute), nil).AnyTimes()
+
+	challenges := map[string]domain.LoginChallenge{}
+	mockSessions := mock_port.NewMockSessionRepository(ctrl)
+	mockSessions.EXPECT().CreateRefreshToken(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockSessions.EXPECT().CreateChallenge(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, challenge domain.LoginChallenge) error {
+			challenges[string(challenge.Hash)] = challenge
+			return nil
+		},
+	).AnyTimes()
+	mockSessions.EXPECT().TakeChallenge(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, hash []byte) (domain.LoginChallenge, error) {
+			challenge, ok := challenges[string(hash)]
+			if !ok {
+				return domain.LoginChallenge{}, domain.ErrNotFound
+			}
+			delete(challenges, string(hash))
+			return challenge, nil
+		},
+	).AnyTimes()
+
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil)
+	as, err := NewAuthService(mockRepo, mockToken, mockSessions, time.Hour).WithTwoFactorKeys(mockKeys)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = as.ConfirmTwoFactor(ctx, user.Name, "000000")
+	require.Equal(t, domain.ErrTwoFactorNotEnrolled, err)
+	enrollment, err := as.EnrollTwoFactor(ctx, user.Name)
+	require.NoError(t, err)
+	// the secret is stored sealed
+	require.True(t, util.IsSealed(user.TwoFactor.Secret))
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(enrollment.Secret)
+	require.NoError(t, err)
+	require.NotContains(t, string(user.TwoFactor.Secret), string(secret))
+	require.False(t, user.TwoFactor.Enabled)
+
+	tokens, err := as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+	require.Empty(t, tokens.Challenge)
+
+	step := util.TOTPStep(time.Now())
+	codes, err := as.ConfirmTwoFactor(ctx, user.Name, util.TOTPCode(secret, step))
+	require.NoError(t, err)
+	require.Len(t, codes, recoveryCodeCount)
+	require.True(t, user.TwoFactor.Enabled)
+	_, err = as.EnrollTwoFactor(ctx, user.Name)
+	require.Equal(t, domain.ErrTwoFactorEnabled, err)
+
+	tokens, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+	require.Empty(t, tokens.AccessToken)
+	require.NotEmpty(t, tokens.Challenge)
+
+	// code of the confirmed step is already used
+	_, err = as.LoginTwoFactor(ctx, tokens.Challenge, util.TOTPCode(secret, step))
+	require.Equal(t, domain.ErrInvalidCode, err)
+	tokens, err = as.LoginTwoFactor(ctx, tokens.Challenge, util.TOTPCode(secret, step+1))
+	require.NoError(t, err)
+	require.Equal(t, domain.Token("access"), tokens.AccessToken)
+
+	tokens, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+	challenge := tokens.Challenge
+	tokens, err = as.LoginTwoFactor(ctx, challenge, codes[0])
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.AccessToken)
+	require.Len(t, user.TwoFactor.RecoveryCodes, recoveryCodeCount-1)
+	_, err = as.LoginTwoFactor(ctx, challenge, codes[1])
+	require.Equal(t, domain.ErrInvalidToken, err)
+
+	tokens, err = as.Login(ctx, domain.User{Name: user.Name, Password: "password"}, "")
+	require.NoError(t, err)
+	for i := 0; i < challengeAttempts; i++ {
+		_, err = as.LoginTwoFactor(ctx, tokens.Challenge, codes[0])
+		require.Equal(t, domain.ErrInvalidCode, err)
+	}
+	_, err = as.LoginTwoFactor(ctx, tokens.Challenge, codes[1])
+	require.Equal(t, domain.ErrInvalidToken, err)
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+
+	"github.com/rs/zerolog/log"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	"github.com/rutkin/gophkeeper/internal/server/core/port"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+)
+
+const (
+	userKeyPurpose = "gophkeeper user kek"
+	userKeySize    = 32
+)
+
+// userKeys opens data keys of users, the keys are stored wrapped by a key
+// derived from the master key.
+type userKeys struct {
+	repo port.UserKeyRepository
+	wrap *util.KeyRing
+}
+
+func newUserKeys(repo port.UserKeyRepository, keys port.KeyProvider) (*userKeys, error) {
+	wrap, err := newKeyRing(keys, userKeyPurpose)
+	if err != nil {
+		return nil, err
+	}
+	return &userKeys{repo: repo, wrap: wrap}, nil
+}
+
+// userKeyAssociatedData binds wrapped key to its owner.
+func userKeyAssociatedData(userID domain.UserID) []byte {
+	return associatedData(domain.DataContext{UserID: userID, Type: "user key"})
+}
+
+// ring returns key ring sealing items of user with the user key, it still
+// opens items sealed with items before. User without key gets one when
+// create is set, otherwise items is returned.
+func (uk *userKeys) ring(ctx context.Context, items *util.KeyRing, userID domain.UserID, create bool) (*util.KeyRing, error) {
+	wrapped, err := uk.repo.GetUserKey(ctx, userID)
+	if err == domain.ErrNotFound && create {
+		wrapped, err = uk.create(ctx, userID)
+	}
+	if err == domain.ErrNotFound {
+		return items, nil
+	}
+	if err != nil {
+		log.Err(err).Msgf("failed to get key of user '%s'", userID)
+		return nil, err
+	}
+	key, err := uk.wrap.Open(wrapped, userKeyAssociatedData(userID))
+	if err != nil {
+		log.Err(err).Msgf("failed to open key of user '%s'", userID)
+		return nil, err
+	}
+	return items.WithPrimary(util.NewKey(key)), nil
+}
+
+// create stores a new key of user, the key of a concurrent caller wins.
+func (uk *userKeys) create(ctx context.Context, userID domain.UserID) ([]byte, error) {
+	key := make([]byte, userKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	wrapped, err := uk.wrap.Seal(key, userKeyAssociatedData(userID))
+	if err != nil {
+		return nil, err
+	}
+	err = uk.repo.CreateUserKey(ctx, userID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return uk.repo.GetUserKey(ctx, userID)
+}
+
+// rotate wraps key of user with the primary master key.
+func (uk *userKeys) rotate(ctx context.Context, userID domain.UserID) (bool, error) {
+	wrapped, err := uk.repo.GetUserKey(ctx, userID)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if uk.wrap.IsPrimary(wrapped) {
+		return false, nil
+	}
+	rewrapped, err := uk.wrap.Rewrap(wrapped, userKeyAssociatedData(userID))
+	if err != nil {
+		return false, err
+	}
+	err = uk.repo.ReplaceUserKey(ctx, userID, wrapped, rewrapped)
+	if err == domain.ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// WithUserKeys encrypts items of every user under a data key of their own,
+// wrapped by the master key. Items stored before stay readable and move
+// under the user key with the next rotation. Deleting the key of an account
+// leaves copies of its items undecryptable.
+func (ks *KeeperService) WithUserKeys(repo port.UserKeyRepository, keys port.KeyProvider) (*KeeperService, error) {
+	userKeys, err := newUserKeys(repo, keys)
+	if err != nil {
+		return nil, err
+	}
+	ks.userKeys = userKeys
+	return ks, nil
+}
+
+// ring returns key ring of user items, see userKeys.ring.
+func (ks *KeeperService) ring(ctx context.Context, userID domain.UserID, create bool) (*util.KeyRing, error) {
+	if ks.userKeys == nil {
+		return ks.keys, nil
+	}
+	return ks.userKeys.ring(ctx, ks.keys, userID, create)
+}
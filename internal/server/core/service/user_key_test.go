@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/rutkin/gophkeeper/internal/server/core/domain"
+	mock_port "github.com/rutkin/gophkeeper/internal/server/core/service/mock"
+	"github.com/rutkin/gophkeeper/internal/server/core/util"
+	"github.com/stretchr/testify/require"
+)
+
+// newMockUserKeys returns user key repository backed by keys.
+func newMockUserKeys(ctrl *gomock.Controller, keys map[domain.UserID][]byte) *mock_port.MockUserKeyRepository {
+	mockUserKeys := mock_port.NewMockUserKeyRepository(ctrl)
+	mockUserKeys.EXPECT().GetUserKey(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID) ([]byte, error) {
+			key, ok := keys[userID]
+			if !ok {
+				return nil, domain.ErrNotFound
+			}
+			return key, nil
+		},
+	).AnyTimes()
+	mockUserKeys.EXPECT().CreateUserKey(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, key []byte) error {
+			if _, ok := keys[userID]; !ok {
+				keys[userID] = key
+			}
+			return nil
+		},
+	).AnyTimes()
+	mockUserKeys.EXPECT().DeleteUserKey(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID) error {
+			delete(keys, userID)
+			return nil
+		},
+	).AnyTimes()
+	return mockUserKeys
+}
+
+func TestKeeperService_UserKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil).Times(3)
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil).Times(3)
+	items := map[domain.DataID][]byte{}
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockRepo.EXPECT().Set(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, data []byte) error {
+			items[dataCtx.ID] = data
+			return nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().GetData(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext) ([]byte, error) {
+			return items[dataCtx.ID], nil
+		},
+	).AnyTimes()
+	mockRepo.EXPECT().GetMeta(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, userID domain.UserID, id domain.DataID) (domain.DataContext, error) {
+			return domain.DataContext{ID: id, UserID: userID, Type: domain.TextType}, nil
+		},
+	).AnyTimes()
+	userKeys := map[domain.UserID][]byte{}
+	ctx := context.Background()
+
+	// items stored before user keys stay readable
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	old := domain.DataContext{ID: "old", UserID: "user", Type: domain.TextType}
+	require.NoError(t, ks.SetTextData(ctx, domain.TextData{Ctx: old, Data: "old"}))
+	mockUserKeys := newMockUserKeys(ctrl, userKeys)
+	ks, err = ks.WithUserKeys(mockUserKeys, mockKeys)
+	require.NoError(t, err)
+	data, err := ks.GetTextData(ctx, old)
+	require.NoError(t, err)
+	require.Equal(t, "old", data)
+	require.Empty(t, userKeys)
+
+	item := domain.DataContext{ID: "new", UserID: "user", Type: domain.TextType}
+	require.NoError(t, ks.SetTextData(ctx, domain.TextData{Ctx: item, Data: "new"}))
+	require.Len(t, userKeys, 1)
+	data, err = ks.GetTextData(ctx, item)
+	require.NoError(t, err)
+	require.Equal(t, "new", data)
+	// the master key alone does not open items of the user
+	master, err := newKeeperKeyRing(mockKeys)
+	require.NoError(t, err)
+	_, err = master.Open(items[item.ID], associatedData(item))
+	require.Error(t, err)
+
+	// ciphertext restored from a backup after the key is deleted with the
+	// account stays sealed
+	backup := items[item.ID]
+	require.NoError(t, mockUserKeys.DeleteUserKey(ctx, item.UserID))
+	items[item.ID] = backup
+	_, err = ks.GetTextData(ctx, item)
+	require.Error(t, err)
+}
+
+func TestRotationService_UserKeys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockKeys := mock_port.NewMockKeyProvider(ctrl)
+	mockKeys.EXPECT().MasterKey().Return([]byte("master-key"), nil).AnyTimes()
+	mockKeys.EXPECT().PreviousKeys().Return(nil, nil).AnyTimes()
+	master, err := newKeeperKeyRing(mockKeys)
+	require.NoError(t, err)
+
+	item := domain.DataContext{ID: "item", UserID: "user", Type: domain.TextType}
+	data, err := master.Seal([]byte("data"), associatedData(item))
+	require.NoError(t, err)
+	mockUsers := mock_port.NewMockUserRepository(ctrl)
+	mockUsers.EXPECT().GetUsers(gomock.Any()).Return([]domain.User{{ID: item.UserID, Name: "name"}}, nil)
+	mockUsers.EXPECT().GetUserByName(gomock.Any(), domain.UserName("name")).Return(domain.User{ID: item.UserID, Name: "name"}, nil)
+	mockRepo := mock_port.NewMockKeeperRepository(ctrl)
+	mockRepo.EXPECT().GetAllData(gomock.Any(), item.UserID).Return([]domain.DataContext{item}, nil)
+	mockRepo.EXPECT().GetStream(gomock.Any(), item).Return(io.NopCloser(bytes.NewReader(data)), nil)
+	mockRepo.EXPECT().ReplaceHead(gomock.Any(), item, data[:util.EnvelopeHeadSize], gomock.Any()).DoAndReturn(
+		func(ctx context.Context, dataCtx domain.DataContext, old, head []byte) error {
+			data = append(head, data[len(old):]...)
+			return nil
+		},
+	)
+	checkpoint := mock_port.NewMockRotationCheckpoint(ctrl)
+	checkpoint.EXPECT().IsDone(gomock.Any(), item.UserID).Return(false, nil)
+	checkpoint.EXPECT().MarkDone(gomock.Any(), item.UserID).Return(nil)
+	userKeys := map[domain.UserID][]byte{}
+	mockUserKeys := newMockUserKeys(ctrl, userKeys)
+
+	rs, err := NewRotationService(mockUsers, mockRepo, mockKeys)
+	require.NoError(t, err)
+	rs, err = rs.WithUserKeys(mockUserKeys, mockKeys)
+	require.NoError(t, err)
+	stats, err := rs.Rotate(context.Background(), checkpoint)
+	require.NoError(t, err)
+	require.Equal(t, domain.RotationStats{Users: 1, Items: 3, Rotated: 1, Skipped: 2}, stats)
+
+	// the item is moved under the new key of its user
+	require.Len(t, userKeys, 1)
+	_, err = master.Open(data, associatedData(item))
+	require.Error(t, err)
+	ks, err := NewKeeperService(mockRepo, mockKeys)
+	require.NoError(t, err)
+	ks, err = ks.WithUserKeys(mockUserKeys, mockKeys)
+	require.NoError(t, err)
+	opened, err := ks.decrypt(context.Background(), item, data)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), opened)
+}
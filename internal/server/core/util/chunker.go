@@ -0,0 +1,108 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// Chunk sizes of Chunker. Changing them or the gear table moves cut points,
+// so data chunked before no longer deduplicates with data chunked after.
+const (
+	MinChunkSize = 16 << 10
+	AvgChunkSize = 64 << 10
+	MaxChunkSize = 256 << 10
+
+	// normalized chunking: cut points before the average size need two more
+	// zero bits, after it two less
+	maskSmall = uint64(1<<(16+2)-1) << (64 - 16 - 2)
+	maskLarge = uint64(1<<(16-2)-1) << (64 - 16 + 2)
+)
+
+// gear maps bytes to random values of the rolling hash.
+var gear = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		sum := sha256.Sum256([]byte("gophkeeper gear " + strconv.Itoa(i)))
+		table[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return table
+}()
+
+// Chunker splits data into content defined chunks with FastCDC. Cut points
+// depend only on the bytes before them, so an edit moves the boundaries of
+// the chunks around it and the rest of the chunks stay the same.
+type Chunker struct {
+	src   io.Reader
+	buf   []byte
+	start int
+	end   int
+	eof   bool
+}
+
+func NewChunker(src io.Reader) *Chunker {
+	return &Chunker{src: src, buf: make([]byte, MaxChunkSize)}
+}
+
+// Next returns the next chunk, valid until the following call, and io.EOF
+// after the last one. Empty data has no chunks.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := cutPoint(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill reads src until the buffer holds a chunk of maximal size or src ends.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start == len(c.buf) {
+		return nil
+	}
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	n, err := io.ReadFull(c.src, c.buf[c.end:])
+	c.end += n
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.eof = true
+		return nil
+	}
+	return err
+}
+
+// cutPoint returns size of the first chunk of data.
+func cutPoint(data []byte) int {
+	n := len(data)
+	if n <= MinChunkSize {
+		return n
+	}
+	if n > MaxChunkSize {
+		n = MaxChunkSize
+	}
+	normal := AvgChunkSize
+	if n < normal {
+		normal = n
+	}
+
+	var hash uint64
+	i := MinChunkSize
+	for ; i < normal; i++ {
+		hash = hash<<1 + gear[data[i]]
+		if hash&maskSmall == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = hash<<1 + gear[data[i]]
+		if hash&maskLarge == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,70 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func chunks(t *testing.T, src io.Reader) [][]byte {
+	var result [][]byte
+	chunker := NewChunker(src)
+	for {
+		chunk, err := chunker.Next()
+		if err == io.EOF {
+			return result
+		}
+		require.NoError(t, err)
+		result = append(result, append([]byte(nil), chunk...))
+	}
+}
+
+func TestChunker(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	result := chunks(t, bytes.NewReader(data))
+	require.Equal(t, data, bytes.Join(result, nil))
+	for i, chunk := range result {
+		require.LessOrEqual(t, len(chunk), MaxChunkSize)
+		if i < len(result)-1 {
+			require.GreaterOrEqual(t, len(chunk), MinChunkSize)
+		}
+	}
+	average := len(data) / len(result)
+	require.Greater(t, average, AvgChunkSize/2)
+	require.Less(t, average, AvgChunkSize*2)
+
+	// cut points do not depend on how src is read
+	require.Equal(t, result, chunks(t, iotest.HalfReader(bytes.NewReader(data))))
+
+	require.Empty(t, chunks(t, bytes.NewReader(nil)))
+	require.Equal(t, [][]byte{[]byte("small")}, chunks(t, bytes.NewReader([]byte("small"))))
+	zeros := chunks(t, bytes.NewReader(make([]byte, 3*MaxChunkSize)))
+	require.Len(t, zeros, 3)
+}
+
+func TestChunker_Edit(t *testing.T) {
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+	edited := append([]byte("inserted at the start"), data...)
+	edited[len(edited)/2] ^= 1
+
+	original := make(map[string]bool)
+	for _, chunk := range chunks(t, bytes.NewReader(data)) {
+		original[string(chunk)] = true
+	}
+	result := chunks(t, bytes.NewReader(edited))
+	var shared int
+	for _, chunk := range result {
+		if original[string(chunk)] {
+			shared++
+		}
+	}
+	// only the chunks around the two edits change
+	require.GreaterOrEqual(t, shared, len(result)-4)
+}
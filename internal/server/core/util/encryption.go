@@ -1,16 +1,149 @@
 package util
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
 
-func HashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrInvalidHash      = errors.New("invalid password hash")
+)
+
+// Argon2Params are Argon2id parameters, Memory is in KiB.
+type Argon2Params struct {
+	Memory     uint32
+	Time       uint32
+	Threads    uint8
+	SaltLength uint32
+	KeyLength  uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106.
+var DefaultArgon2Params = Argon2Params{
+	Memory:     64 * 1024,
+	Time:       3,
+	Threads:    4,
+	SaltLength: 16,
+	KeyLength:  32,
+}
+
+var defaultHasher = NewPasswordHasher(DefaultArgon2Params)
+
+// PasswordHasher stores passwords as Argon2id PHC strings:
+//
+//	$argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>
+//
+// and still verifies bcrypt hashes written before.
+type PasswordHasher struct {
+	params Argon2Params
+
+	dummyOnce sync.Once
+	dummy     string
+	dummyErr  error
+}
+
+func NewPasswordHasher(params Argon2Params) *PasswordHasher {
+	return &PasswordHasher{params: params}
+}
+
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
 		return "", err
 	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+		h.params.Memory, h.params.Time, h.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify checks password against hash and reports whether hash should be
+// replaced, because it is bcrypt or uses other parameters.
+func (h *PasswordHasher) Verify(password, hash string) (bool, error) {
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, ErrInvalidHash
+		}
+		return true, nil
+	}
 
-	return string(hashedPassword), nil
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return false, err
+	}
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLength)
+	if subtle.ConstantTimeCompare(actual, key) != 1 {
+		return false, ErrPasswordMismatch
+	}
+	return params != h.params, nil
+}
+
+// VerifyMissing spends the time of Verify on a login of unknown user, so
+// response time does not tell which usernames exist. The password is checked
+// against a dummy hash written with the current parameters and never matches.
+func (h *PasswordHasher) VerifyMissing(password string) error {
+	h.dummyOnce.Do(func() {
+		secret := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+			h.dummyErr = err
+			return
+		}
+		h.dummy, h.dummyErr = h.Hash(base64.RawStdEncoding.EncodeToString(secret))
+	})
+	if h.dummyErr != nil {
+		return h.dummyErr
+	}
+	h.Verify(password, h.dummy)
+	return ErrPasswordMismatch
+}
+
+func decodeArgon2(hash string) (Argon2Params, []byte, []byte, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 || fields[0] != "" || fields[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(fields[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	var params Argon2Params
+	_, err := fmt.Sscanf(fields[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil || params.Memory == 0 || params.Time == 0 || params.Threads == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(fields[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(fields[5])
+	if err != nil || len(key) == 0 {
+		return Argon2Params{}, nil, nil, ErrInvalidHash
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
+
+// HashPassword hashes password with the default parameters.
+func HashPassword(password string) (string, error) {
+	return defaultHasher.Hash(password)
 }
 
 func ComparePassword(password, hashedPassword string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	_, err := defaultHasher.Verify(password, hashedPassword)
+	return err
 }
@@ -0,0 +1,50 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordHasher(t *testing.T) {
+	params := Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32}
+	hasher := NewPasswordHasher(params)
+
+	hash, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+	other, err := hasher.Hash("password")
+	require.NoError(t, err)
+	require.NotEqual(t, hash, other)
+
+	rehash, err := hasher.Verify("password", hash)
+	require.NoError(t, err)
+	require.False(t, rehash)
+	_, err = hasher.Verify("wrong", hash)
+	require.Equal(t, ErrPasswordMismatch, err)
+
+	stronger := NewPasswordHasher(Argon2Params{Memory: 2048, Time: 1, Threads: 1, SaltLength: 16, KeyLength: 32})
+	rehash, err = stronger.Verify("password", hash)
+	require.NoError(t, err)
+	require.True(t, rehash)
+
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	rehash, err = hasher.Verify("password", string(bcryptHash))
+	require.NoError(t, err)
+	require.True(t, rehash)
+	_, err = hasher.Verify("wrong", string(bcryptHash))
+	require.Equal(t, ErrPasswordMismatch, err)
+
+	for _, invalid := range []string{"", "plain", "$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=0,t=1,p=1$c2FsdA$a2V5", "$argon2id$v=19$m=1024,t=1,p=1$!$a2V5"} {
+		_, err = hasher.Verify("password", invalid)
+		require.Equal(t, ErrInvalidHash, err, invalid)
+	}
+
+	// unknown user costs the same Argon2id work and never matches
+	require.Equal(t, ErrPasswordMismatch, hasher.VerifyMissing("password"))
+	require.Equal(t, ErrPasswordMismatch, hasher.VerifyMissing(""))
+	require.True(t, strings.HasPrefix(hasher.dummy, "$argon2id$v=19$m=1024,t=1,p=1$"))
+}
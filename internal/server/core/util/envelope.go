@@ -0,0 +1,280 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Envelope layout (version 3):
+//
+//	magic "GKE" | version | key id | dek nonce | wrapped dek | data nonce | ciphertext
+//
+// Every item gets its own random data encryption key (dek) and nonce, the dek
+// is sealed with the key encryption key (kek) identified by key id. Caller
+// supplied associated data is authenticated with both the dek and the data,
+// the header is authenticated with the dek. Version 2 has the same layout
+// without associated data, version 4 is the chunked stream envelope written
+// by SealReader. Version 1 has no key id and, like blobs without
+// any header, belongs to the legacy key.
+var envelopeMagic = []byte("GKE")
+
+const (
+	envelopeV1 byte = 1
+	envelopeV2 byte = 2
+	envelopeV3 byte = 3
+
+	// EnvelopeVersion is the version written by Seal.
+	EnvelopeVersion = envelopeV3
+
+	dataKeySize = 32
+	keyIDSize   = 4
+	nonceSize   = 12
+	tagSize     = 16
+
+	wrappedKeySize = dataKeySize + tagSize
+	envelopePrefix = 3 + 1
+	envelopeHeader = envelopePrefix + keyIDSize
+	envelopeBody   = nonceSize + wrappedKeySize + nonceSize
+
+	// EnvelopeHeadSize is the size of the head of envelopes in the current
+	// formats, it holds the wrapped data key and is all Rewrap changes.
+	EnvelopeHeadSize = envelopeHeader + nonceSize + wrappedKeySize
+)
+
+var (
+	ErrInvalidEnvelope = errors.New("invalid envelope")
+	ErrDecrypt         = errors.New("failed to decrypt envelope")
+	ErrUnboundEnvelope = errors.New("envelope is not bound to associated data")
+	// ErrOutdatedEnvelope is returned by RewrapHead for envelopes which have
+	// to be sealed again as a whole.
+	ErrOutdatedEnvelope = errors.New("envelope is in an outdated format")
+)
+
+// Seal encrypts src with a fresh data key wrapped by the primary key and
+// binds the result to aad.
+func (kr *KeyRing) Seal(src, aad []byte) ([]byte, error) {
+	dek := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	dst := make([]byte, 0, envelopeHeader+envelopeBody+len(src)+tagSize)
+	dst, err := kr.appendWrappedKey(dst, EnvelopeVersion, dek, aad)
+	if err != nil {
+		return nil, err
+	}
+
+	dataNonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+	dst = append(dst, dataNonce...)
+	return sealTo(dst, dek, dataNonce, src, aad)
+}
+
+// Open decrypts blob produced by Seal or by one of the previous formats. The
+// aad must match the one blob was sealed with, formats before version 3
+// ignore it unless the ring accepts bound formats only.
+func (kr *KeyRing) Open(blob, aad []byte) ([]byte, error) {
+	version, ok := envelopeVersion(blob)
+	if kr.boundOnly && !isBound(ok, version) {
+		return nil, ErrUnboundEnvelope
+	}
+	if !ok {
+		return kr.openLegacy(blob)
+	}
+
+	body := blob[envelopePrefix:]
+	switch version {
+	case envelopeV1:
+		if kr.legacy == nil {
+			return nil, ErrUnknownKey
+		}
+		return openBody(kr.legacy, body, nil, nil)
+	case envelopeV2, envelopeV3:
+		key, err := kr.key(KeyID(binary.BigEndian.Uint32(body)))
+		if err != nil {
+			return nil, err
+		}
+		if version == envelopeV2 {
+			return openBody(key.Secret, body[keyIDSize:], nil, nil)
+		}
+		return openBody(key.Secret, body[keyIDSize:], headerAAD(blob, aad), aad)
+	case envelopeV4:
+		return kr.openStream(blob, aad)
+	default:
+		return kr.openLegacy(blob)
+	}
+}
+
+// IsPrimary reports whether blob is sealed in the current format with the
+// primary key. Only the header is looked at, so the head of a large envelope
+// is enough.
+func (kr *KeyRing) IsPrimary(blob []byte) bool {
+	return len(blob) >= envelopeHeader && bytes.HasPrefix(blob, envelopeMagic) &&
+		isCurrent(blob[len(envelopeMagic)]) &&
+		KeyID(binary.BigEndian.Uint32(blob[envelopePrefix:])) == kr.primary.ID
+}
+
+// Rewrap moves blob under the primary key. Envelopes in the current formats
+// only get their data key wrapped again, older blobs are encrypted again and
+// bound to aad.
+func (kr *KeyRing) Rewrap(blob, aad []byte) ([]byte, error) {
+	version, ok := envelopeVersion(blob)
+	if !ok || !isCurrent(version) {
+		src, err := kr.Open(blob, aad)
+		if err != nil {
+			return nil, err
+		}
+		return kr.Seal(src, aad)
+	}
+
+	head, err := kr.RewrapHead(blob[:EnvelopeHeadSize], aad)
+	if err != nil {
+		return nil, err
+	}
+	return append(head, blob[EnvelopeHeadSize:]...), nil
+}
+
+// RewrapHead wraps the data key held in head, the first EnvelopeHeadSize
+// bytes of an envelope in the current formats, with the primary key. The rest
+// of the envelope stays valid behind the returned head, so a large item is
+// moved without being read. Envelopes in older formats fail with
+// ErrOutdatedEnvelope, Rewrap seals them again.
+func (kr *KeyRing) RewrapHead(head, aad []byte) ([]byte, error) {
+	if len(head) < EnvelopeHeadSize || !bytes.HasPrefix(head, envelopeMagic) || !isCurrent(head[len(envelopeMagic)]) {
+		return nil, ErrOutdatedEnvelope
+	}
+	body := head[envelopePrefix:]
+	key, err := kr.key(KeyID(binary.BigEndian.Uint32(body)))
+	if err != nil {
+		return nil, err
+	}
+	body = body[keyIDSize:]
+	dek, err := open(key.Secret, body[:nonceSize], body[nonceSize:nonceSize+wrappedKeySize], headerAAD(head, aad))
+	if err != nil {
+		return nil, err
+	}
+	return kr.appendWrappedKey(make([]byte, 0, EnvelopeHeadSize), head[len(envelopeMagic)], dek, aad)
+}
+
+// appendWrappedKey appends header of version and dek wrapped by the primary
+// key to dst.
+func (kr *KeyRing) appendWrappedKey(dst []byte, version byte, dek, aad []byte) ([]byte, error) {
+	dst = append(dst, envelopeMagic...)
+	dst = append(dst, version)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(kr.primary.ID))
+
+	nonce, err := randomNonce()
+	if err != nil {
+		return nil, err
+	}
+	header := headerAAD(dst, aad)
+	dst = append(dst, nonce...)
+	return sealTo(dst, kr.primary.Secret, nonce, dek, header)
+}
+
+// IsSealed reports whether blob has an envelope header, secrets stored
+// before they were sealed have none.
+func IsSealed(blob []byte) bool {
+	_, ok := envelopeVersion(blob)
+	return ok
+}
+
+// envelopeVersion returns version of blob with envelope header.
+func envelopeVersion(blob []byte) (byte, bool) {
+	if !bytes.HasPrefix(blob, envelopeMagic) || len(blob) < envelopePrefix+envelopeBody {
+		return 0, false
+	}
+	version := blob[len(envelopeMagic)]
+	switch version {
+	case envelopeV1:
+		return version, true
+	case envelopeV2, envelopeV3:
+		return version, len(blob) >= envelopeHeader+envelopeBody
+	case envelopeV4:
+		return version, len(blob) >= streamHeader+tagSize
+	}
+	return 0, false
+}
+
+// isCurrent reports whether envelopes of version are written by this build.
+func isCurrent(version byte) bool {
+	return version == EnvelopeVersion || version == envelopeV4
+}
+
+// isBound reports whether envelope of version authenticates associated data.
+func isBound(ok bool, version byte) bool {
+	return ok && (version == envelopeV3 || version == envelopeV4)
+}
+
+// headerAAD authenticates envelope header together with caller aad.
+func headerAAD(blob, aad []byte) []byte {
+	header := make([]byte, 0, envelopeHeader+len(aad))
+	header = append(header, blob[:envelopeHeader]...)
+	return append(header, aad...)
+}
+
+func openBody(kek, body, keyAAD, dataAAD []byte) ([]byte, error) {
+	dekNonce := body[:nonceSize]
+	body = body[nonceSize:]
+	wrappedKey := body[:wrappedKeySize]
+	body = body[wrappedKeySize:]
+	dataNonce := body[:nonceSize]
+	body = body[nonceSize:]
+
+	dek, err := open(kek, dekNonce, wrappedKey, keyAAD)
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, dataNonce, body, dataAAD)
+}
+
+// openLegacy reads blobs sealed with the nonce taken from the tail of the key.
+func (kr *KeyRing) openLegacy(blob []byte) ([]byte, error) {
+	if kr.legacy == nil {
+		return nil, ErrUnknownKey
+	}
+	return open(kr.legacy, kr.legacy[len(kr.legacy)-nonceSize:], blob, nil)
+}
+
+func randomNonce() ([]byte, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return nonce, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesblock, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(aesblock)
+}
+
+func sealTo(dst, key, nonce, src, aad []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesgcm.Seal(dst, nonce, src, aad), nil
+}
+
+func open(key, nonce, src, aad []byte) ([]byte, error) {
+	aesgcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := aesgcm.Open(nil, nonce, src, aad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return dst, nil
+}
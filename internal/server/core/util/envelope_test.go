@@ -0,0 +1,140 @@
+package util
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyRing_SealOpen(t *testing.T) {
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:]))
+	data := []byte("data")
+
+	aad := []byte("user/item")
+
+	first, err := ring.Seal(data, aad)
+	require.NoError(t, err)
+	second, err := ring.Seal(data, aad)
+	require.NoError(t, err)
+	require.NotEqual(t, first, second)
+
+	actual, err := ring.Open(first, aad)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+
+	_, err = ring.Open(first, []byte("other/item"))
+	require.Equal(t, ErrDecrypt, err)
+
+	otherKek := sha256.Sum256([]byte("other"))
+	_, err = NewKeyRing(NewKey(otherKek[:])).Open(first, aad)
+	require.Equal(t, ErrUnknownKey, err)
+
+	first[len(first)-1] ^= 1
+	_, err = ring.Open(first, aad)
+	require.Equal(t, ErrDecrypt, err)
+}
+
+func TestKeyRing_Rewrap(t *testing.T) {
+	oldKek := sha256.Sum256([]byte("old"))
+	newKek := sha256.Sum256([]byte("new"))
+	oldRing := NewKeyRing(NewKey(oldKek[:]))
+	newRing := NewKeyRing(NewKey(newKek[:]), NewKey(oldKek[:]))
+	aad := []byte("user/item")
+
+	blob, err := oldRing.Seal([]byte("data"), aad)
+	require.NoError(t, err)
+	require.True(t, oldRing.IsPrimary(blob))
+	require.False(t, newRing.IsPrimary(blob))
+
+	_, err = newRing.Rewrap(blob, []byte("other/item"))
+	require.Equal(t, ErrDecrypt, err)
+
+	rewrapped, err := newRing.Rewrap(blob, aad)
+	require.NoError(t, err)
+	require.True(t, newRing.IsPrimary(rewrapped))
+	require.Equal(t, blob[len(blob)-len("data")-tagSize:], rewrapped[len(rewrapped)-len("data")-tagSize:])
+	actual, err := NewKeyRing(NewKey(newKek[:])).Open(rewrapped, aad)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), actual)
+}
+
+func TestKeyRing_WithPrimary(t *testing.T) {
+	masterKek := sha256.Sum256([]byte("master"))
+	userKek := sha256.Sum256([]byte("user"))
+	master := NewKeyRing(NewKey(masterKek[:]))
+	user := master.WithPrimary(NewKey(userKek[:]))
+	aad := []byte("user/item")
+
+	old, err := master.Seal([]byte("old"), aad)
+	require.NoError(t, err)
+	actual, err := user.Open(old, aad)
+	require.NoError(t, err)
+	require.Equal(t, []byte("old"), actual)
+	require.False(t, user.IsPrimary(old))
+
+	blob, err := user.Seal([]byte("data"), aad)
+	require.NoError(t, err)
+	require.True(t, user.IsPrimary(blob))
+	require.False(t, master.IsPrimary(blob))
+	_, err = master.Open(blob, aad)
+	require.Equal(t, ErrUnknownKey, err)
+}
+
+func TestKeyRing_OpenLegacy(t *testing.T) {
+	legacy := sha256.Sum256([]byte("legacy"))
+	aesblock, err := aes.NewCipher(legacy[:])
+	require.NoError(t, err)
+	aesgcm, err := cipher.NewGCM(aesblock)
+	require.NoError(t, err)
+	blob := aesgcm.Seal(nil, legacy[len(legacy)-aesgcm.NonceSize():], []byte("data"), nil)
+
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:]))
+	_, err = ring.Open(blob, nil)
+	require.Equal(t, ErrUnknownKey, err)
+
+	actual, err := ring.WithLegacy(legacy[:]).Open(blob, []byte("ignored"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), actual)
+}
+
+func TestKeyRing_WithBoundOnly(t *testing.T) {
+	legacy := sha256.Sum256([]byte("legacy"))
+	aesblock, err := aes.NewCipher(legacy[:])
+	require.NoError(t, err)
+	aesgcm, err := cipher.NewGCM(aesblock)
+	require.NoError(t, err)
+	blob := aesgcm.Seal(nil, legacy[len(legacy)-aesgcm.NonceSize():], []byte("data"), nil)
+
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:])).WithLegacy(legacy[:])
+	aad := []byte("user/item")
+	resealed, err := ring.Rewrap(blob, aad)
+	require.NoError(t, err)
+	unbound, err := ring.Seal([]byte("data"), aad)
+	require.NoError(t, err)
+	unbound[len(envelopeMagic)] = envelopeV2
+	// formats before version 3 are sealed again as a whole
+	_, err = ring.RewrapHead(unbound[:EnvelopeHeadSize], aad)
+	require.Equal(t, ErrOutdatedEnvelope, err)
+
+	bound := NewKeyRing(NewKey(kek[:])).WithLegacy(legacy[:]).WithBoundOnly()
+	_, err = bound.Open(blob, aad)
+	require.Equal(t, ErrUnboundEnvelope, err)
+	_, err = bound.Open(unbound, aad)
+	require.Equal(t, ErrUnboundEnvelope, err)
+	_, err = bound.OpenReader(bytes.NewReader(blob), aad)
+	require.Equal(t, ErrUnboundEnvelope, err)
+
+	// items resealed by rotation stay readable
+	actual, err := bound.Open(resealed, aad)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), actual)
+	_, err = bound.WithPrimary(NewKey(legacy[:])).Open(blob, aad)
+	require.Equal(t, ErrUnboundEnvelope, err)
+}
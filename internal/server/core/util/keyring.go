@@ -0,0 +1,102 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+var ErrUnknownKey = errors.New("unknown key encryption key")
+
+// KeyID identifies key encryption key inside envelope header.
+type KeyID uint32
+
+// Key is a key encryption key.
+type Key struct {
+	ID     KeyID
+	Secret []byte
+}
+
+// NewKey creates key and derives its identifier from the key fingerprint.
+func NewKey(secret []byte) Key {
+	sum := sha256.Sum256(append([]byte("gophkeeper key id:"), secret...))
+	return Key{ID: KeyID(binary.BigEndian.Uint32(sum[:4])), Secret: secret}
+}
+
+// DeriveKey derives a 32 byte subkey of the master key for the given purpose.
+func DeriveKey(master []byte, purpose string) ([]byte, error) {
+	key := make([]byte, dataKeySize)
+	_, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte(purpose)), key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyRing seals envelopes with the primary key and opens envelopes sealed
+// with any key it knows about.
+type KeyRing struct {
+	primary   Key
+	keys      map[KeyID]Key
+	legacy    []byte
+	boundOnly bool
+}
+
+// NewKeyRing creates key ring sealing with primary key. Previous keys are
+// only used to open envelopes sealed before key rotation.
+func NewKeyRing(primary Key, previous ...Key) *KeyRing {
+	keys := map[KeyID]Key{primary.ID: primary}
+	for _, key := range previous {
+		if _, ok := keys[key.ID]; !ok {
+			keys[key.ID] = key
+		}
+	}
+	return &KeyRing{primary: primary, keys: keys}
+}
+
+// PrimaryID returns identifier of the key used to seal new envelopes.
+func (kr *KeyRing) PrimaryID() KeyID {
+	return kr.primary.ID
+}
+
+// WithLegacy sets key used for blobs written without key identifier.
+func (kr *KeyRing) WithLegacy(secret []byte) *KeyRing {
+	kr.legacy = secret
+	return kr
+}
+
+// WithPrimary returns key ring sealing with primary key, it opens every
+// envelope kr opens.
+func (kr *KeyRing) WithPrimary(primary Key) *KeyRing {
+	keys := make(map[KeyID]Key, len(kr.keys)+1)
+	for id, key := range kr.keys {
+		keys[id] = key
+	}
+	keys[primary.ID] = primary
+	return &KeyRing{primary: primary, keys: keys, legacy: kr.legacy, boundOnly: kr.boundOnly}
+}
+
+// WithBoundOnly makes Open refuse formats that do not bind associated data,
+// legacy blobs and versions 1 and 2, with ErrUnboundEnvelope. It is meant for
+// keepers whose items were all resealed by rotation.
+func (kr *KeyRing) WithBoundOnly() *KeyRing {
+	kr.boundOnly = true
+	return kr
+}
+
+func (kr *KeyRing) key(id KeyID) (Key, error) {
+	key, ok := kr.keys[id]
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// DeriveKey derives a 32 byte subkey of the primary key for the given
+// purpose, it changes with the primary key.
+func (kr *KeyRing) DeriveKey(purpose string) ([]byte, error) {
+	return DeriveKey(kr.primary.Secret, purpose)
+}
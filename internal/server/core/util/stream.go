@@ -0,0 +1,255 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Stream envelope layout (version 4):
+//
+//	magic "GKE" | version | key id | dek nonce | wrapped dek | nonce prefix | chunks
+//
+// The header and the data key are the same as in version 3. Data is split
+// into chunks of StreamChunkSize bytes sealed one by one as in the STREAM
+// construction: the nonce of a chunk is the nonce prefix, the big endian
+// chunk counter and a flag set only on the last chunk. Reordered, dropped or
+// appended chunks fail to open and a truncated stream fails at its end.
+const (
+	envelopeV4 byte = 4
+
+	// StreamChunkSize is the size of plaintext sealed in one chunk.
+	StreamChunkSize = 64 << 10
+
+	streamPrefixSize = nonceSize - 4 - 1
+	streamHeader     = envelopeHeader + nonceSize + wrappedKeySize + streamPrefixSize
+	sealedChunkSize  = StreamChunkSize + tagSize
+)
+
+var ErrStreamTooLong = errors.New("stream is too long")
+
+// SealReader returns reader of src sealed with a fresh data key wrapped by
+// the primary key and bound to aad. Only one chunk of src is kept in memory.
+func (kr *KeyRing) SealReader(src io.Reader, aad []byte) (io.Reader, error) {
+	dek := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	header, err := kr.appendWrappedKey(make([]byte, 0, streamHeader), envelopeV4, dek, aad)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamPrefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	header = append(header, prefix...)
+
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &streamSealer{
+		src:     bufio.NewReader(src),
+		aead:    aead,
+		nonce:   streamNonce{prefix: prefix},
+		aad:     aad,
+		chunk:   make([]byte, StreamChunkSize),
+		sealed:  make([]byte, 0, sealedChunkSize),
+		pending: header,
+	}, nil
+}
+
+// OpenReader returns reader of data sealed by SealReader. Blobs in the other
+// formats are read whole and opened with Open: they were written by Seal in
+// one piece before streaming, so opening one takes as much memory as writing
+// it took. Every stream written now is in the stream format.
+func (kr *KeyRing) OpenReader(src io.Reader, aad []byte) (io.Reader, error) {
+	buffered := bufio.NewReader(src)
+	header, err := buffered.Peek(streamHeader)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(header) < streamHeader || !bytes.HasPrefix(header, envelopeMagic) || header[len(envelopeMagic)] != envelopeV4 {
+		blob, err := io.ReadAll(buffered)
+		if err != nil {
+			return nil, err
+		}
+		data, err := kr.Open(blob, aad)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+
+	key, err := kr.key(KeyID(binary.BigEndian.Uint32(header[envelopePrefix:])))
+	if err != nil {
+		return nil, err
+	}
+	body := header[envelopeHeader:]
+	dek, err := open(key.Secret, body[:nonceSize], body[nonceSize:nonceSize+wrappedKeySize], headerAAD(header, aad))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	prefix := append([]byte(nil), body[nonceSize+wrappedKeySize:]...)
+	if _, err := buffered.Discard(streamHeader); err != nil {
+		return nil, err
+	}
+	return &streamOpener{
+		src:   buffered,
+		aead:  aead,
+		nonce: streamNonce{prefix: prefix},
+		aad:   aad,
+		chunk: make([]byte, sealedChunkSize),
+	}, nil
+}
+
+// openStream opens whole stream envelope.
+func (kr *KeyRing) openStream(blob, aad []byte) ([]byte, error) {
+	reader, err := kr.OpenReader(bytes.NewReader(blob), aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// streamNonce produces nonces of consecutive chunks.
+type streamNonce struct {
+	prefix    []byte
+	counter   uint32
+	exhausted bool
+}
+
+func (sn *streamNonce) next(last bool) ([]byte, error) {
+	if sn.exhausted {
+		return nil, ErrStreamTooLong
+	}
+	nonce := make([]byte, 0, nonceSize)
+	nonce = append(nonce, sn.prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, sn.counter)
+	if last {
+		nonce = append(nonce, 1)
+	} else {
+		nonce = append(nonce, 0)
+	}
+	sn.counter++
+	sn.exhausted = sn.counter == 0
+	return nonce, nil
+}
+
+// readChunk reads the next chunk of src into chunk and reports whether it is
+// the last one.
+func readChunk(src *bufio.Reader, chunk []byte) (int, bool, error) {
+	n, err := io.ReadFull(src, chunk)
+	switch err {
+	case nil:
+		if _, err := src.Peek(1); err != nil {
+			if err == io.EOF {
+				return n, true, nil
+			}
+			return 0, false, err
+		}
+		return n, false, nil
+	case io.EOF, io.ErrUnexpectedEOF:
+		return n, true, nil
+	default:
+		return 0, false, err
+	}
+}
+
+type streamSealer struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	nonce   streamNonce
+	aad     []byte
+	chunk   []byte
+	sealed  []byte
+	pending []byte
+	done    bool
+	err     error
+}
+
+func (ss *streamSealer) Read(p []byte) (int, error) {
+	for len(ss.pending) == 0 {
+		if ss.err != nil {
+			return 0, ss.err
+		}
+		if ss.done {
+			return 0, io.EOF
+		}
+		ss.err = ss.sealChunk()
+	}
+	n := copy(p, ss.pending)
+	ss.pending = ss.pending[n:]
+	return n, nil
+}
+
+func (ss *streamSealer) sealChunk() error {
+	n, last, err := readChunk(ss.src, ss.chunk)
+	if err != nil {
+		return err
+	}
+	nonce, err := ss.nonce.next(last)
+	if err != nil {
+		return err
+	}
+	ss.pending = ss.aead.Seal(ss.sealed[:0], nonce, ss.chunk[:n], ss.aad)
+	ss.done = last
+	return nil
+}
+
+type streamOpener struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	nonce   streamNonce
+	aad     []byte
+	chunk   []byte
+	pending []byte
+	done    bool
+	err     error
+}
+
+func (so *streamOpener) Read(p []byte) (int, error) {
+	for len(so.pending) == 0 {
+		if so.err != nil {
+			return 0, so.err
+		}
+		if so.done {
+			return 0, io.EOF
+		}
+		so.err = so.openChunk()
+	}
+	n := copy(p, so.pending)
+	so.pending = so.pending[n:]
+	return n, nil
+}
+
+func (so *streamOpener) openChunk() error {
+	n, last, err := readChunk(so.src, so.chunk)
+	if err != nil {
+		return err
+	}
+	if n < tagSize {
+		return ErrDecrypt
+	}
+	nonce, err := so.nonce.next(last)
+	if err != nil {
+		return err
+	}
+	// the plaintext is opened in place, it is consumed before the next chunk
+	// is read
+	so.pending, err = so.aead.Open(so.chunk[:0], nonce, so.chunk[:n], so.aad)
+	if err != nil {
+		return ErrDecrypt
+	}
+	so.done = last
+	return nil
+}
@@ -0,0 +1,143 @@
+package util
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func sealStream(t *testing.T, ring *KeyRing, data, aad []byte) []byte {
+	reader, err := ring.SealReader(bytes.NewReader(data), aad)
+	require.NoError(t, err)
+	sealed, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return sealed
+}
+
+func openStream(ring *KeyRing, sealed, aad []byte) ([]byte, error) {
+	reader, err := ring.OpenReader(bytes.NewReader(sealed), aad)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func TestKeyRing_SealReader(t *testing.T) {
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:]))
+	aad := []byte("user/item")
+
+	for _, size := range []int{0, 1, StreamChunkSize - 1, StreamChunkSize, StreamChunkSize + 1, 3*StreamChunkSize + 7} {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		sealed := sealStream(t, ring, data, aad)
+		chunks := max(1, (size+StreamChunkSize-1)/StreamChunkSize)
+		require.Len(t, sealed, streamHeader+size+chunks*tagSize)
+
+		actual, err := openStream(ring, sealed, aad)
+		require.NoError(t, err)
+		require.Equal(t, data, actual)
+
+		// whole envelope opens like any other blob
+		actual, err = ring.Open(sealed, aad)
+		require.NoError(t, err)
+		require.Equal(t, data, actual)
+	}
+
+	reader, err := ring.SealReader(iotest.OneByteReader(bytes.NewReader([]byte("data"))), aad)
+	require.NoError(t, err)
+	sealed, err := io.ReadAll(iotest.OneByteReader(reader))
+	require.NoError(t, err)
+	opened, err := ring.OpenReader(iotest.HalfReader(bytes.NewReader(sealed)), aad)
+	require.NoError(t, err)
+	actual, err := io.ReadAll(opened)
+	require.NoError(t, err)
+	require.Equal(t, []byte("data"), actual)
+}
+
+func TestKeyRing_OpenReaderTampered(t *testing.T) {
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:]))
+	aad := []byte("user/item")
+	data := bytes.Repeat([]byte("x"), 2*StreamChunkSize+10)
+	sealed := sealStream(t, ring, data, aad)
+	firstChunk := sealed[streamHeader : streamHeader+sealedChunkSize]
+	secondChunk := sealed[streamHeader+sealedChunkSize : streamHeader+2*sealedChunkSize]
+
+	_, err := openStream(ring, sealed, []byte("other/item"))
+	require.Equal(t, ErrDecrypt, err)
+
+	otherKek := sha256.Sum256([]byte("other"))
+	_, err = openStream(NewKeyRing(NewKey(otherKek[:])), sealed, aad)
+	require.Equal(t, ErrUnknownKey, err)
+
+	tests := map[string][]byte{
+		"flipped bit":     append(append([]byte(nil), sealed[:len(sealed)-1]...), sealed[len(sealed)-1]^1),
+		"truncated chunk": sealed[:len(sealed)-1],
+		"dropped last":    sealed[:streamHeader+2*sealedChunkSize],
+		"dropped chunk":   append(append([]byte(nil), sealed[:streamHeader+sealedChunkSize]...), sealed[streamHeader+2*sealedChunkSize:]...),
+		"swapped chunks": append(append(append(append([]byte(nil), sealed[:streamHeader]...), secondChunk...), firstChunk...),
+			sealed[streamHeader+2*sealedChunkSize:]...),
+		"appended chunk": append(append([]byte(nil), sealed...), firstChunk...),
+	}
+	for name, tampered := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := openStream(ring, tampered, aad)
+			require.Equal(t, ErrDecrypt, err)
+		})
+	}
+}
+
+func TestKeyRing_OpenReaderOtherFormats(t *testing.T) {
+	kek := sha256.Sum256([]byte("kek"))
+	ring := NewKeyRing(NewKey(kek[:]))
+	aad := []byte("user/item")
+
+	for _, data := range [][]byte{nil, []byte("data"), bytes.Repeat([]byte("x"), streamHeader+1)} {
+		blob, err := ring.Seal(data, aad)
+		require.NoError(t, err)
+		actual, err := openStream(ring, blob, aad)
+		require.NoError(t, err)
+		require.Equal(t, string(data), string(actual))
+	}
+}
+
+func TestKeyRing_RewrapStream(t *testing.T) {
+	oldKek := sha256.Sum256([]byte("old"))
+	newKek := sha256.Sum256([]byte("new"))
+	oldRing := NewKeyRing(NewKey(oldKek[:]))
+	newRing := NewKeyRing(NewKey(newKek[:]), NewKey(oldKek[:]))
+	aad := []byte("user/item")
+	data := bytes.Repeat([]byte("x"), StreamChunkSize+1)
+
+	sealed := sealStream(t, oldRing, data, aad)
+	require.True(t, oldRing.IsPrimary(sealed))
+	require.False(t, newRing.IsPrimary(sealed))
+
+	rewrapped, err := newRing.Rewrap(sealed, aad)
+	require.NoError(t, err)
+	require.True(t, newRing.IsPrimary(rewrapped))
+	// chunks are kept, only the data key is wrapped again
+	require.Equal(t, sealed[streamHeader-streamPrefixSize:], rewrapped[streamHeader-streamPrefixSize:])
+	actual, err := openStream(NewKeyRing(NewKey(newKek[:])), rewrapped, aad)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+
+	// the head alone is enough to move the stream
+	require.Equal(t, streamHeader-streamPrefixSize, EnvelopeHeadSize)
+	require.False(t, newRing.IsPrimary(sealed[:EnvelopeHeadSize]))
+	head, err := newRing.RewrapHead(sealed[:EnvelopeHeadSize], aad)
+	require.NoError(t, err)
+	require.Len(t, head, EnvelopeHeadSize)
+	require.True(t, newRing.IsPrimary(head))
+	actual, err = openStream(NewKeyRing(NewKey(newKek[:])), append(head, sealed[EnvelopeHeadSize:]...), aad)
+	require.NoError(t, err)
+	require.Equal(t, data, actual)
+	_, err = newRing.RewrapHead(sealed[:EnvelopeHeadSize], []byte("other/item"))
+	require.Error(t, err)
+	_, err = newRing.RewrapHead(sealed[:EnvelopeHeadSize-1], aad)
+	require.Equal(t, ErrOutdatedEnvelope, err)
+}
@@ -0,0 +1,94 @@
+package util
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+// TOTP parameters (RFC 6238) understood by every authenticator app.
+const (
+	totpDigits     = 6
+	totpPeriod     = 30
+	totpSecretSize = 20
+	// totpSkew accepts codes of neighbour time steps to allow clock drift.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func NewTOTPSecret() ([]byte, error) {
+	secret := make([]byte, totpSecretSize)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// EncodeTOTPSecret returns secret in the base32 form typed into authenticator
+// apps.
+func EncodeTOTPSecret(secret []byte) string {
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI returns otpauth URI usually shown as a QR code.
+func TOTPURI(issuer, account string, secret []byte) string {
+	values := url.Values{}
+	values.Set("secret", EncodeTOTPSecret(secret))
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(totpDigits))
+	values.Set("period", fmt.Sprint(totpPeriod))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: values.Encode(),
+	}
+	return u.String()
+}
+
+// TOTPStep returns time step of t.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / totpPeriod
+}
+
+// TOTPCode computes code of the time step.
+func TOTPCode(secret []byte, step int64) string {
+	return hotp(secret, uint64(step), totpDigits)
+}
+
+// VerifyTOTP checks code against time steps around now and returns the
+// matched step, callers reject steps already used to prevent replay.
+func VerifyTOTP(secret []byte, code string, now time.Time) (int64, bool) {
+	step := TOTPStep(now)
+	for i := -totpSkew; i <= totpSkew; i++ {
+		expected := TOTPCode(secret, step+int64(i))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// hotp implements RFC 4226.
+func hotp(secret []byte, counter uint64, digits int) string {
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(binary.BigEndian.AppendUint64(nil, counter))
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
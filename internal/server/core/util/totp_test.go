@@ -0,0 +1,45 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA1
+	secret := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1234567890, "89005924"},
+		{20000000000, "65353130"},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.code, hotp(secret, uint64(tt.unix/totpPeriod), 8))
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	matched, ok := VerifyTOTP(secret, TOTPCode(secret, step-1), now)
+	require.True(t, ok)
+	require.Equal(t, step-1, matched)
+	_, ok = VerifyTOTP(secret, TOTPCode(secret, step+2), now)
+	require.False(t, ok)
+	_, ok = VerifyTOTP(secret, "", now)
+	require.False(t, ok)
+
+	uri := TOTPURI("gophkeeper", "admin", secret)
+	require.True(t, strings.HasPrefix(uri, "otpauth://totp/gophkeeper:admin?"))
+	require.Contains(t, uri, "secret="+EncodeTOTPSecret(secret))
+}